@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runCommand executes the command named by the first argument and reports
+// whether the input was a command rather than a destination address.
+func (computer *Computer) runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "ping":
+		err = computer.ping(args[1:])
+	case "route":
+		for _, entry := range computer.routes.Routes() {
+			fmt.Println(entry)
+		}
+	case "udp":
+		err = computer.udpCommand(args[1:])
+	case "tcp":
+		err = computer.tcpCommand(args[1:])
+	case "link":
+		err = computer.printLinkStats()
+	default:
+		return false
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err.Error())
+	}
+	return true
+}
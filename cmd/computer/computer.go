@@ -2,34 +2,61 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"io"
-	"net"
 	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"tcp-ip/internal/arp"
+	"tcp-ip/internal/capture"
 	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/icmp"
 	"tcp-ip/internal/ip"
+	"tcp-ip/internal/link"
 	"tcp-ip/internal/nic"
+	"tcp-ip/internal/route"
+	"tcp-ip/internal/tcp"
+	"tcp-ip/internal/udp"
 	"tcp-ip/pkg/utils"
 	"time"
 )
 
 const (
-	slotSize        = 2048
-	descriptorSlots = 64
-	reconnectDelay  = 3
+	slotSize         = 2048
+	descriptorSlots  = 64
+	reconnectDelay   = 3
+	defaultPrefixLen = 24
+)
+
+var (
+	linkFlags   = link.RegisterFlags(flag.CommandLine)
+	captureFile = flag.String("capture", "", "file to capture the frames of the NIC to, pcapng when it ends in .pcapng and pcap otherwise")
 )
 
 type Computer struct {
 	memory     []byte
 	ring       []nic.Descriptor
-	routerConn net.Conn
-	ip         ip.IPAddress
-	nic        *nic.NIC
-	reader     *bufio.Reader
-	arp        *arp.ARPModule
+	routerLink link.Link
+	// capture records the frames through the NIC, when capturing
+	capture     *capture.Interface
+	ip          ip.IPAddress
+	subnet      ip.Prefix
+	routes      *route.Table
+	nic         *nic.NIC
+	reader      *bufio.Reader
+	arp         *arp.ARPModule
+	icmp        *icmp.ICMPModule
+	udp         *udp.UDPModule
+	udpSockets  map[uint16]*udp.Socket
+	tcp         *tcp.TCPModule
+	tcpConns    *connTable
+	reassembler *ip.Reassembler
+	packetID    atomic.Uint32
 }
 
 func (computer *Computer) readMemory(slotIndex int) ([]byte, error) {
@@ -48,33 +75,120 @@ func (computer *Computer) connectToRouter() error {
 	if err != nil {
 		return err
 	}
-	conn, err := net.Dial("tcp", address)
-	computer.routerConn = conn
-	return err
+	routerLink, err := link.Dial(address)
+	if err != nil {
+		return err
+	}
+	computer.routerLink = linkFlags.Wrap(routerLink)
+	return nil
+}
+
+func (computer *Computer) reassemblyTimedOut(first *ip.Packet) {
+	err := computer.icmp.SendTimeExceeded(icmp.CodeReassemblyExceeded, first)
+	if err != nil {
+		fmt.Println("Could not send reassembly time exceeded:", err.Error())
+	}
 }
 
-func parseIpArgs() (ip.IPAddress, error) {
+func parseArgs() (ip.Prefix, ip.IPAddress, error) {
+	prefixLen := flag.Int("prefix", defaultPrefixLen, "subnet prefix length, unless given as ip/prefix")
+	gatewayString := flag.String("gateway", "", "default gateway for off-subnet destinations")
 	flag.Parse()
+	err := linkFlags.Parse()
+	if err != nil {
+		return ip.Prefix{}, ip.IPAddress{}, err
+	}
+	if *traceMode != traceOff && *traceMode != traceLine && *traceMode != traceTree {
+		return ip.Prefix{}, ip.IPAddress{}, fmt.Errorf("invalid trace mode %q", *traceMode)
+	}
 	args := flag.Args()
 	if len(args) < 1 {
-		return ip.IPAddress{}, fmt.Errorf("IP address argument expected")
+		return ip.Prefix{}, ip.IPAddress{}, fmt.Errorf("IP address argument expected")
 	}
 	if len(args) > 1 {
-		return ip.IPAddress{}, fmt.Errorf("unexpected extra arguments")
+		return ip.Prefix{}, ip.IPAddress{}, fmt.Errorf("unexpected extra arguments")
+	}
+
+	var subnet ip.Prefix
+	if strings.Contains(args[0], "/") {
+		subnet, err = ip.ParsePrefix(args[0])
+	} else {
+		subnet.Address, err = ip.ParseIP(args[0])
+		subnet.Length = *prefixLen
+	}
+	if err != nil {
+		return ip.Prefix{}, ip.IPAddress{}, err
 	}
-	return ip.ParseIP(args[0])
+	if subnet.Length < 0 || subnet.Length > 32 {
+		return ip.Prefix{}, ip.IPAddress{}, fmt.Errorf("invalid prefix length %d", subnet.Length)
+	}
+
+	var gateway ip.IPAddress
+	if *gatewayString != "" {
+		gateway, err = ip.ParseIP(*gatewayString)
+		if err != nil {
+			return ip.Prefix{}, ip.IPAddress{}, fmt.Errorf("invalid gateway: %w", err)
+		}
+	}
+	return subnet, gateway, nil
 }
 
 func main() {
-	ip, err := parseIpArgs()
+	subnet, gateway, err := parseArgs()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Invalid arguments:", err.Error())
 		return
 	}
+	routes := route.NewTable()
+	routes.AddConnected(subnet, 0)
+	if gateway != (ip.IPAddress{}) {
+		err = routes.AddDefault(gateway, route.StaticMetric)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid arguments:", err.Error())
+			return
+		}
+	}
 	reader := bufio.NewReader(io.LimitReader(os.Stdin, int64(ethernet.MaxFramePayload)))
-	computer := &Computer{reader: reader, ip: ip, memory: make([]byte, slotSize*descriptorSlots), ring: make([]nic.Descriptor, descriptorSlots)}
+	computer := &Computer{reader: reader, ip: subnet.Address, subnet: subnet, routes: routes, memory: make([]byte, slotSize*descriptorSlots), ring: make([]nic.Descriptor, descriptorSlots)}
 	computer.nic = nic.NewNIC(computer.memory, computer.ring, slotSize)
+	if *captureFile != "" {
+		writer, err := capture.Create(*captureFile)
+		if err == nil {
+			computer.capture, err = capture.NewInterface(writer, "nic")
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not create capture file:", err.Error())
+			return
+		}
+		defer writer.Close()
+	}
+	computer.reassembler = ip.NewReassembler(ip.ReassemblyTimeout, ip.MaxReassemblyBytes, ip.MaxReassemblyBuffers)
+	computer.icmp = icmp.NewICMPModule(computer)
+	computer.udp = udp.NewUDPModule(computer.ip, computer)
+	computer.udpSockets = make(map[uint16]*udp.Socket)
+	computer.tcp = tcp.NewTCPModule(computer.ip, computer, ethernet.MaxFramePayload)
+	computer.tcpConns = newConnTable()
+	// an interrupt ends the process through the deferred calls, closing the
+	// capture, instead of killing it outright
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go computer.reassembler.RunGC(ctx, computer.reassemblyTimedOut)
 
+	done := make(chan struct{})
+	go func() {
+		computer.run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		fmt.Println("Shutting down")
+	}
+}
+
+// run connects to a router and serves the link until the user declines to
+// reconnect.
+func (computer *Computer) run() {
 	for {
 		err := computer.connectToRouter()
 		if err != nil {
@@ -98,6 +212,6 @@ func main() {
 			time.Sleep(time.Duration(reconnectDelay) * time.Second)
 			continue
 		}
-		break
+		return
 	}
 }
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/icmp"
+	"tcp-ip/internal/ip"
+	"tcp-ip/internal/udp"
 )
 
 // look around for the delay and race
@@ -17,12 +21,60 @@ import (
 // go over everything carefully again
 // refactor errors and logins throughout
 // smart switch logic
+func (computer *Computer) dispatchIP(packet *ip.Packet) error {
+	if packet.DstIP != computer.ip && !computer.IsBroadcast(packet.DstIP) {
+		return fmt.Errorf("packet addressed to %v, dropping", packet.DstIP)
+	}
+
+	switch packet.Protocol {
+	case ip.ProtoTest:
+		_, _ = fmt.Fprintf(os.Stdout, "Packet received\nSource: %v\nDestination: %v\nID: %d\nTTL: %d\nPayload: %s\n",
+			packet.SrcIP, packet.DstIP, packet.ID, packet.TTL, packet.Data)
+		return nil
+
+	case ip.ProtoICMP:
+		return computer.icmp.Receive(packet)
+
+	case ip.ProtoUDP:
+		err := computer.udp.Receive(packet)
+		if errors.Is(err, udp.ErrPortUnreachable) && packet.DstIP == computer.ip {
+			icmpErr := computer.icmp.SendDestUnreachable(icmp.CodePortUnreachable, packet)
+			if icmpErr != nil {
+				return fmt.Errorf("could not send port unreachable: %w", icmpErr)
+			}
+		}
+		return err
+
+	case ip.ProtoTCP:
+		if packet.DstIP != computer.ip {
+			return fmt.Errorf("TCP segment addressed to broadcast %v, dropping", packet.DstIP)
+		}
+		return computer.tcp.Receive(packet)
+
+	default:
+		err := computer.icmp.SendDestUnreachable(icmp.CodeProtoUnreachable, packet)
+		if err != nil {
+			return fmt.Errorf("could not send protocol unreachable: %w", err)
+		}
+		return fmt.Errorf("unrecognized protocol %d", packet.Protocol)
+	}
+}
+
 func (computer *Computer) dispatch(frame *ethernet.Frame) error {
 	switch frame.EtherType {
 	case ethernet.IPv4EtherType:
-		_, _ = fmt.Fprintf(os.Stdout, "Frame received\nDestination: %x\nSource: %x\nEtherType: %d\nPayload: %s\nCRC: %d\n",
-			frame.DstMAC, frame.SrcMAC, frame.EtherType, frame.Data, frame.FCS)
-		return nil
+		packet, err := ip.Deserialize(frame.Data)
+		if err != nil {
+			return fmt.Errorf("could not parse packet: %w", err)
+		}
+		packet, err = computer.reassembler.Add(packet)
+		if err != nil {
+			return fmt.Errorf("could not reassemble packet: %w", err)
+		}
+		if packet == nil {
+			return nil
+		}
+		return computer.dispatchIP(packet)
 
 	case ethernet.ARPEtherType:
 		return computer.arp.Receive(frame.Data)
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"tcp-ip/internal/link"
+)
+
+// printLinkStats shows how the transmit queue towards the router fared,
+// which only exists when the link is shaped.
+func (computer *Computer) printLinkStats() error {
+	shaped, ok := computer.routerLink.(*link.ShapedLink)
+	if !ok {
+		return fmt.Errorf("link to %v is not shaped, start with -rate", computer.routerLink)
+	}
+	stats := shaped.Stats()
+	fmt.Printf("sent %d, tail drops %d, RED drops %d, queued %d, max queued %d\n",
+		stats.Sent, stats.TailDrops, stats.REDDrops, stats.Queued, stats.MaxQueued)
+	return nil
+}
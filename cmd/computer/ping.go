@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"tcp-ip/internal/icmp"
+	"tcp-ip/internal/ip"
+	"time"
+)
+
+const (
+	pingCount    = 4
+	pingSize     = 56
+	pingInterval = time.Second
+	pingTimeout  = time.Second * 2
+)
+
+func parsePingArgs(args []string) (ip.IPAddress, int, int, error) {
+	flags := flag.NewFlagSet("ping", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	count := flags.Int("c", pingCount, "number of echo requests to send")
+	size := flags.Int("s", pingSize, "number of data bytes to send")
+
+	// accept the destination either before or after the flags
+	var target string
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		target, args = args[0], args[1:]
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return ip.IPAddress{}, 0, 0, err
+	}
+	if target == "" && flags.NArg() > 0 {
+		target = flags.Arg(0)
+	} else if flags.NArg() > 0 {
+		return ip.IPAddress{}, 0, 0, fmt.Errorf("unexpected extra arguments")
+	}
+	if target == "" {
+		return ip.IPAddress{}, 0, 0, fmt.Errorf("usage: ping <ip> [-c count] [-s size]")
+	}
+	if *count < 1 {
+		return ip.IPAddress{}, 0, 0, fmt.Errorf("invalid count %d", *count)
+	}
+	if *size < 0 || *size > ip.MaxPacketSize-ip.MinHeaderSize-icmp.HeaderSize {
+		return ip.IPAddress{}, 0, 0, fmt.Errorf("invalid size %d", *size)
+	}
+
+	dst, err := ip.ParseIP(target)
+	return dst, *count, *size, err
+}
+
+func (computer *Computer) ping(args []string) error {
+	dst, count, size, err := parsePingArgs(args)
+	if err != nil {
+		return err
+	}
+
+	payload := make([]byte, size)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	identifier := uint16(os.Getpid())
+
+	fmt.Printf("PING %v %d(%d) bytes of data.\n", dst, size, size+icmp.HeaderSize+ip.MinHeaderSize)
+	start := time.Now()
+	received := 0
+	var minRTT, maxRTT, totalRTT time.Duration
+	for i := range count {
+		if i > 0 {
+			time.Sleep(pingInterval)
+		}
+		sequence := uint16(i + 1)
+		sent := time.Now()
+		ch, err := computer.icmp.Echo(dst, identifier, sequence, payload)
+		if err != nil {
+			fmt.Printf("From %v icmp_seq=%d %s\n", computer.ip, sequence, err.Error())
+			continue
+		}
+
+		result := computer.icmp.AwaitEcho(ch, identifier, sequence, pingTimeout)
+		if result.Err != nil {
+			if result.From == (ip.IPAddress{}) {
+				fmt.Printf("icmp_seq=%d %s\n", sequence, result.Err.Error())
+			} else {
+				fmt.Printf("From %v icmp_seq=%d %s\n", result.From, sequence, result.Err.Error())
+			}
+			continue
+		}
+
+		rtt := time.Since(sent)
+		if received == 0 || rtt < minRTT {
+			minRTT = rtt
+		}
+		maxRTT = max(maxRTT, rtt)
+		totalRTT += rtt
+		received++
+		fmt.Printf("%d bytes from %v: icmp_seq=%d ttl=%d time=%.3f ms\n",
+			result.Size, result.From, sequence, result.TTL, milliseconds(rtt))
+	}
+
+	fmt.Printf("\n--- %v ping statistics ---\n", dst)
+	fmt.Printf("%d packets transmitted, %d received, %d%% packet loss, time %dms\n",
+		count, received, (count-received)*100/count, time.Since(start).Milliseconds())
+	if received > 0 {
+		fmt.Printf("rtt min/avg/max = %.3f/%.3f/%.3f ms\n",
+			milliseconds(minRTT), milliseconds(totalRTT/time.Duration(received)), milliseconds(maxRTT))
+	}
+	return nil
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
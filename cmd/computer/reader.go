@@ -1,19 +1,18 @@
 package main
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"sync"
 	"tcp-ip/internal/arp"
 	"tcp-ip/internal/ethernet"
 	"tcp-ip/internal/nic"
-	"time"
 )
 
+// isForMe filters frames before they take a slot of the NIC. The FCS is
+// left to Deserialize, which checks it anyway.
 func (computer *Computer) isForMe(data []byte) bool {
 	if len(data) < ethernet.MinFrame {
 		fmt.Println("Too small frame received, dropping frame")
@@ -28,45 +27,17 @@ func (computer *Computer) isForMe(data []byte) bool {
 		fmt.Println("Invalid frame size received, dropping frame")
 		return false
 	}
-	if binary.BigEndian.Uint32(data[len(data)-4:]) != ethernet.CRC(data[:len(data)-4]) {
-		fmt.Println("FSC doesn't match, dropping frame")
-		return false
-	}
 	return true
 }
 
-func (computer *Computer) getMessage(conn net.Conn, waitTime int, maxMessageLength int) ([]byte, error) {
-	err := conn.SetReadDeadline(time.Now().Add(time.Duration(waitTime) * time.Minute))
-	if err != nil {
-		return nil, err
-	}
-
-	var length uint16
-	err = binary.Read(conn, binary.BigEndian, &length)
-	if err != nil {
-		return nil, err
-	}
-
-	if length > uint16(maxMessageLength) || length <= 0 {
-		return nil, fmt.Errorf("invalid message length received")
-	}
-
-	buf := make([]byte, length)
-	_, err = io.ReadFull(conn, buf)
-	if err != nil {
-		return nil, err
-	}
-	return buf, nil
-}
-
 func (computer *Computer) handleReceiving(wg *sync.WaitGroup) {
 	defer func() {
 		wg.Done()
-		_ = computer.routerConn.Close()
+		_ = computer.routerLink.Close()
 	}()
 
 	for {
-		data, err := computer.getMessage(computer.routerConn, 10, ethernet.MTU)
+		data, err := computer.routerLink.ReadFrame()
 		if errors.Is(err, io.EOF) {
 			fmt.Println("The server closed the connection")
 			return
@@ -75,6 +46,10 @@ func (computer *Computer) handleReceiving(wg *sync.WaitGroup) {
 			fmt.Fprintln(os.Stderr, "Error receiving message:", err.Error())
 			return
 		}
+		if computer.capture != nil {
+			_ = computer.capture.WriteFrame(data)
+		}
+		computer.trace("In", data)
 
 		if !computer.isForMe(data) {
 			continue
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"tcp-ip/internal/ip"
+	"tcp-ip/internal/tcp"
+)
+
+const tcpUsage = "usage: tcp listen <port> | tcp unlisten <port> | tcp connect <ip> <port> | " +
+	"tcp send <id> <payload> | tcp close <id> | tcp abort <id> | tcp status | " +
+	"tcp cc [<id>] <algorithm> | tcp cwnd <id> [file]"
+
+// connTable numbers the connections opened from the prompt so later
+// commands can refer to them.
+type connTable struct {
+	conns     map[int]*tcp.Conn
+	listeners map[uint16]*tcp.Listener
+	nextID    int
+	mutex     *sync.Mutex
+}
+
+func newConnTable() *connTable {
+	return &connTable{
+		conns:     make(map[int]*tcp.Conn),
+		listeners: make(map[uint16]*tcp.Listener),
+		nextID:    1,
+		mutex:     new(sync.Mutex),
+	}
+}
+
+func (table *connTable) add(conn *tcp.Conn) int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	id := table.nextID
+	table.nextID++
+	table.conns[id] = conn
+	return id
+}
+
+func (table *connTable) get(arg string) (int, *tcp.Conn, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid connection id %q", arg)
+	}
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	conn, ok := table.conns[id]
+	if !ok {
+		return 0, nil, fmt.Errorf("no connection %d", id)
+	}
+	return id, conn, nil
+}
+
+func (table *connTable) remove(id int) {
+	table.mutex.Lock()
+	delete(table.conns, id)
+	table.mutex.Unlock()
+}
+
+func (computer *Computer) tcpCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(tcpUsage)
+	}
+	table := computer.tcpConns
+
+	switch args[0] {
+	case "listen":
+		if len(args) < 2 {
+			return errors.New(tcpUsage)
+		}
+		port, err := parsePort(args[1])
+		if err != nil {
+			return err
+		}
+		listener, err := computer.tcp.Listen(port)
+		if err != nil {
+			return err
+		}
+		table.mutex.Lock()
+		table.listeners[port] = listener
+		table.mutex.Unlock()
+		go computer.acceptConns(listener)
+		fmt.Printf("Listening on TCP port %d\n", port)
+		return nil
+
+	case "unlisten":
+		if len(args) < 2 {
+			return errors.New(tcpUsage)
+		}
+		port, err := parsePort(args[1])
+		if err != nil {
+			return err
+		}
+		table.mutex.Lock()
+		listener, ok := table.listeners[port]
+		delete(table.listeners, port)
+		table.mutex.Unlock()
+		if !ok {
+			return fmt.Errorf("not listening on port %d", port)
+		}
+		return listener.Close()
+
+	case "connect":
+		if len(args) < 3 {
+			return errors.New(tcpUsage)
+		}
+		dst, err := ip.ParseIP(args[1])
+		if err != nil {
+			return err
+		}
+		port, err := parsePort(args[2])
+		if err != nil {
+			return err
+		}
+		conn, err := computer.tcp.Dial(dst, port)
+		if err != nil {
+			return err
+		}
+		id := table.add(conn)
+		fmt.Printf("Connection %d established: %v\n", id, conn)
+		go printStream(id, conn)
+		return nil
+
+	case "send":
+		if len(args) < 3 {
+			return errors.New(tcpUsage)
+		}
+		_, conn, err := table.get(args[1])
+		if err != nil {
+			return err
+		}
+		_, err = conn.Write([]byte(strings.Join(args[2:], " ") + "\n"))
+		return err
+
+	case "close":
+		if len(args) < 2 {
+			return errors.New(tcpUsage)
+		}
+		_, conn, err := table.get(args[1])
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case "abort":
+		if len(args) < 2 {
+			return errors.New(tcpUsage)
+		}
+		id, conn, err := table.get(args[1])
+		if err != nil {
+			return err
+		}
+		conn.Abort()
+		table.remove(id)
+		return nil
+
+	case "status":
+		table.mutex.Lock()
+		defer table.mutex.Unlock()
+		ids := make([]int, 0, len(table.conns))
+		for id := range table.conns {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			conn := table.conns[id]
+			state := conn.State()
+			fmt.Printf("%3d  %-12v %-8s %v\n", id, state, conn.CongestionControl(), conn)
+			// closed connections are listed once more and then forgotten
+			if state == tcp.StateClosed {
+				delete(table.conns, id)
+			}
+		}
+		for port := range table.listeners {
+			fmt.Printf("     %-12v %-8s port %d\n", tcp.StateListen, "", port)
+		}
+		return nil
+
+	case "cc":
+		if len(args) < 2 {
+			fmt.Println("Available:", strings.Join(tcp.CongestionControls(), " "))
+			return nil
+		}
+		if len(args) == 2 {
+			return computer.tcp.SetCongestionControl(args[1])
+		}
+		_, conn, err := table.get(args[1])
+		if err != nil {
+			return err
+		}
+		return conn.SetCongestionControl(args[2])
+
+	case "cwnd":
+		if len(args) < 2 {
+			return errors.New(tcpUsage)
+		}
+		_, conn, err := table.get(args[1])
+		if err != nil {
+			return err
+		}
+		if len(args) < 3 {
+			return writeCwndHistory(os.Stdout, conn)
+		}
+		file, err := os.Create(args[2])
+		if err != nil {
+			return err
+		}
+		err = writeCwndHistory(file, conn)
+		closeErr := file.Close()
+		if err != nil {
+			return err
+		}
+		return closeErr
+
+	default:
+		return errors.New(tcpUsage)
+	}
+}
+
+// writeCwndHistory writes the congestion window samples as CSV, with the
+// time in milliseconds since the first sample, ready for plotting.
+func writeCwndHistory(writer io.Writer, conn *tcp.Conn) error {
+	history := conn.CwndHistory()
+	_, err := fmt.Fprintln(writer, "ms,cwnd,ssthresh")
+	if err != nil {
+		return err
+	}
+	for _, sample := range history {
+		elapsed := float64(sample.Time.Sub(history[0].Time).Microseconds()) / 1000
+		_, err = fmt.Fprintf(writer, "%.3f,%d,%d\n", elapsed, sample.Window, sample.Threshold)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (computer *Computer) acceptConns(listener *tcp.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		id := computer.tcpConns.add(conn)
+		fmt.Printf("Connection %d accepted: %v\n", id, conn)
+		go printStream(id, conn)
+	}
+}
+
+// printStream prints what the peer sends until it closes its side. The
+// connection stays in the table until it is closed from the prompt too.
+func printStream(id int, conn *tcp.Conn) {
+	buffer := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buffer)
+		if n > 0 {
+			fmt.Printf("TCP connection %d: %s", id, buffer[:n])
+		}
+		if errors.Is(err, io.EOF) {
+			fmt.Printf("TCP connection %d: peer closed\n", id)
+			return
+		}
+		if err != nil {
+			fmt.Printf("TCP connection %d: %s\n", id, err.Error())
+			return
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"tcp-ip/internal/dissector"
+)
+
+const (
+	traceOff  = "off"
+	traceLine = "line"
+	traceTree = "tree"
+)
+
+var traceMode = flag.String("trace", traceOff, "print the frames through the NIC, including those on the link addressed to other hosts: off, line for a summary or tree for every field")
+
+// trace prints a frame crossing the NIC in direction, In or Out. Frames
+// coming in are traced before the NIC filters them by address.
+func (computer *Computer) trace(direction string, data []byte) {
+	switch *traceMode {
+	case traceLine:
+		fmt.Printf("%s %v\n", direction, dissector.Dissect(data))
+	case traceTree:
+		fmt.Printf("%s %s", direction, dissector.Dissect(data).Tree())
+	}
+}
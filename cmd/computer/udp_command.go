@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"tcp-ip/internal/ip"
+	"tcp-ip/internal/udp"
+)
+
+const udpUsage = "usage: udp listen <port> | udp close <port> | udp send <ip> <port> <payload>"
+
+func parsePort(port string) (uint16, error) {
+	value, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("invalid port %q", port)
+	}
+	return uint16(value), nil
+}
+
+func (computer *Computer) udpCommand(args []string) error {
+	if len(args) < 2 {
+		return errors.New(udpUsage)
+	}
+
+	switch args[0] {
+	case "listen":
+		port, err := parsePort(args[1])
+		if err != nil {
+			return err
+		}
+		socket, err := computer.udp.Bind(port)
+		if err != nil {
+			return err
+		}
+		computer.udpSockets[port] = socket
+		go printDatagrams(socket)
+		fmt.Printf("Listening on UDP port %d\n", port)
+		return nil
+
+	case "close":
+		port, err := parsePort(args[1])
+		if err != nil {
+			return err
+		}
+		socket, ok := computer.udpSockets[port]
+		if !ok {
+			return fmt.Errorf("not listening on port %d", port)
+		}
+		delete(computer.udpSockets, port)
+		return socket.Close()
+
+	case "send":
+		if len(args) < 4 {
+			return errors.New(udpUsage)
+		}
+		dst, err := ip.ParseIP(args[1])
+		if err != nil {
+			return err
+		}
+		port, err := parsePort(args[2])
+		if err != nil {
+			return err
+		}
+		socket, err := computer.udp.Bind(0)
+		if err != nil {
+			return err
+		}
+		defer socket.Close()
+		return socket.SendTo([]byte(strings.Join(args[3:], " ")), dst, port)
+
+	default:
+		return errors.New(udpUsage)
+	}
+}
+
+func printDatagrams(socket *udp.Socket) {
+	for {
+		data, src, srcPort, err := socket.RecvFrom()
+		if err != nil {
+			return
+		}
+		fmt.Printf("UDP datagram on port %d from %v:%d: %s\n", socket.LocalPort(), src, srcPort, data)
+	}
+}
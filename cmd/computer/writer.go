@@ -1,54 +1,79 @@
 package main
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"tcp-ip/internal/arp"
 	"tcp-ip/internal/ethernet"
 	"tcp-ip/internal/ip"
 	"tcp-ip/internal/nic"
 	"tcp-ip/pkg/utils"
-	"time"
 )
 
 func (computer *Computer) SendToMAC(message []byte, dstMAC nic.MACAddress, etherType uint16) error {
-	conn := computer.routerConn
 	frame, err := ethernet.NewFrame(computer.nic.MAC, dstMAC, etherType, message)
 	if err != nil {
 		return err
 	}
 	data := frame.Serialize()
-	length := uint16(len(data))
+	if computer.capture != nil {
+		_ = computer.capture.WriteFrame(data)
+	}
+	computer.trace("Out", data)
+	return computer.routerLink.WriteFrame(data)
+}
 
-	err = conn.SetWriteDeadline(time.Now().Add(time.Duration(10) * time.Minute))
-	if err != nil {
-		return err
+func (computer *Computer) IsBroadcast(address ip.IPAddress) bool {
+	return address == ip.LimitedBroadcast || address == computer.subnet.Broadcast()
+}
+
+// resolveNextHop picks the link layer destination for dstIP, the host itself
+// when it is on-link and the gateway otherwise.
+func (computer *Computer) resolveNextHop(dstIP ip.IPAddress) (nic.MACAddress, error) {
+	if computer.IsBroadcast(dstIP) {
+		return ethernet.BroadcastAddress, nil
 	}
-	err = binary.Write(conn, binary.BigEndian, length)
+
+	entry, err := computer.routes.Lookup(dstIP)
 	if err != nil {
-		return err
+		return nic.MACAddress{}, err
 	}
 
-	err = conn.SetWriteDeadline(time.Now().Add(time.Duration(10) * time.Minute))
+	nextHop := entry.NextHop(dstIP)
+	dstMAC, err := computer.arp.Resolve(nextHop)
+	if err != nil && nextHop != dstIP {
+		return nic.MACAddress{}, fmt.Errorf("could not resolve gateway %v: %w", nextHop, err)
+	}
 	if err != nil {
-		return err
+		return nic.MACAddress{}, fmt.Errorf("could not resolve IP address: %w", err)
 	}
-	_, err = conn.Write(data)
-	return err
+	return dstMAC, nil
 }
 
-func (computer *Computer) sendToIP(message []byte, dstIP ip.IPAddress) error {
-	dstMAC, err := computer.arp.Resolve(dstIP)
+func (computer *Computer) SendToIP(message []byte, dstIP ip.IPAddress, protocol uint8) error {
+	packet, err := ip.NewPacket(computer.ip, dstIP, protocol, uint16(computer.packetID.Add(1)), message)
 	if err != nil {
-		return fmt.Errorf("could not resolve IP address: %w", err)
+		return fmt.Errorf("could not build packet: %w", err)
 	}
 
-	err = computer.SendToMAC(message, dstMAC, ethernet.IPv4EtherType)
+	dstMAC, err := computer.resolveNextHop(dstIP)
 	if err != nil {
-		return fmt.Errorf("could not send message to MAC: %w", err)
+		return err
+	}
+
+	fragments, err := ip.Fragment(packet, ethernet.MaxFramePayload)
+	if err != nil {
+		return fmt.Errorf("could not fragment packet: %w", err)
+	}
+
+	for _, fragment := range fragments {
+		err = computer.SendToMAC(fragment.Serialize(), dstMAC, ethernet.IPv4EtherType)
+		if err != nil {
+			return fmt.Errorf("could not send message to MAC: %w", err)
+		}
 	}
 	return nil
 }
@@ -56,7 +81,7 @@ func (computer *Computer) sendToIP(message []byte, dstIP ip.IPAddress) error {
 func (computer *Computer) handleSending(wg *sync.WaitGroup) {
 	defer func() {
 		wg.Done()
-		_ = computer.routerConn.Close()
+		_ = computer.routerLink.Close()
 	}()
 
 	ch, err := computer.arp.SendGARP()
@@ -76,12 +101,16 @@ func (computer *Computer) handleSending(wg *sync.WaitGroup) {
 	}
 
 	for {
-		dstIPStr, err := utils.PromptString(computer.reader, "Enter destination IP address:")
+		dstIPStr, err := utils.PromptString(computer.reader, "Enter destination IP address or command:")
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Could not read input:", err.Error())
 			continue
 		}
 
+		if computer.runCommand(strings.Fields(dstIPStr)) {
+			continue
+		}
+
 		dstIP, err := ip.ParseIP(dstIPStr)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Could not parse IP address:", err.Error())
@@ -94,7 +123,7 @@ func (computer *Computer) handleSending(wg *sync.WaitGroup) {
 			continue
 		}
 
-		err = computer.sendToIP(payload, dstIP)
+		err = computer.SendToIP(payload, dstIP, ip.ProtoTest)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Could not send message to IP: ", err.Error())
 		}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"tcp-ip/internal/arp"
+	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/ip"
+	"tcp-ip/internal/link"
+	"tcp-ip/internal/nic"
+	"time"
+)
+
+const (
+	interfaceSlots = 64
+	// packets waiting to be routed beyond interfaceQueue are dropped
+	interfaceQueue = 256
+	// failed accepts are retried after a backoff growing up to maxAcceptDelay
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+type Interface struct {
+	index    int
+	address  ip.Prefix
+	mtu      int
+	listener link.Listener
+	memory   []byte
+	ring     []nic.Descriptor
+	nic      *nic.NIC
+	arp      *arp.ARPModule
+	router   *IPRouter
+	packets  chan *ip.Packet
+
+	link   link.Link
+	closed bool
+	mutex  sync.RWMutex
+}
+
+func NewInterface(index int, address ip.Prefix, listener link.Listener, router *IPRouter) *Interface {
+	iface := &Interface{
+		index:    index,
+		address:  address,
+		mtu:      ethernet.MaxFramePayload,
+		listener: listener,
+		memory:   make([]byte, slotSize*interfaceSlots),
+		ring:     make([]nic.Descriptor, interfaceSlots),
+		router:   router,
+		packets:  make(chan *ip.Packet, interfaceQueue),
+	}
+	iface.nic = nic.NewNIC(iface.memory, iface.ring, slotSize)
+	// every NIC derives its MAC from the PID, so the interface index tells
+	// the interfaces of the same process apart
+	iface.nic.MAC[1] = byte(index)
+	iface.arp = arp.NewARPModule(arp.HrdEthernet, arp.HrdLenEthernet, arp.ProtoIPv4, arp.ProtoLenIpv4, iface.nic.MAC, iface.address.Address, iface)
+	return iface
+}
+
+func (iface *Interface) String() string {
+	return fmt.Sprintf("eth%d (%v)", iface.index, iface.address)
+}
+
+func (iface *Interface) readMemory(slotIndex int) ([]byte, error) {
+	slot := &iface.ring[slotIndex]
+	if slot.Owner != nic.CPUOwned {
+		return nil, fmt.Errorf("slot currently owned by the NIC")
+	}
+	data := make([]byte, slot.Length)
+	copy(data, iface.memory[slotIndex*slotSize:])
+	slot.Owner = nic.NICOwned
+	return data, nil
+}
+
+func (iface *Interface) isForMe(data []byte) bool {
+	if len(data) < ethernet.MinFrame || len(data) > ethernet.MTU {
+		return false
+	}
+	dstMAC := nic.MACAddress(data[0:6])
+	return dstMAC == iface.nic.MAC || dstMAC == ethernet.BroadcastAddress
+}
+
+func (iface *Interface) SendToMAC(message []byte, dstMAC nic.MACAddress, etherType uint16) error {
+	iface.mutex.RLock()
+	wire := iface.link
+	iface.mutex.RUnlock()
+	if wire == nil {
+		return fmt.Errorf("%v: link is down", iface)
+	}
+
+	frame, err := ethernet.NewFrame(iface.nic.MAC, dstMAC, etherType, message)
+	if err != nil {
+		return err
+	}
+	return wire.WriteFrame(frame.Serialize())
+}
+
+// Serve accepts one link at a time, each one acting as the wire plugged
+// into the interface, until the interface is closed.
+func (iface *Interface) Serve(ctx context.Context) {
+	go iface.arp.RunGC(ctx)
+	go iface.route()
+	delay := minAcceptDelay
+	for {
+		wire, err := iface.listener.Accept()
+		if errors.Is(err, net.ErrClosed) || errors.Is(err, link.ErrClosed) {
+			close(iface.packets)
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: could not accept link: %s\n", iface, err.Error())
+			time.Sleep(delay)
+			delay = min(2*delay, maxAcceptDelay)
+			continue
+		}
+		delay = minAcceptDelay
+		fmt.Printf("%v: link up to %v\n", iface, wire)
+
+		wire = linkFlags.Wrap(wire)
+		iface.mutex.Lock()
+		if iface.closed {
+			// accepted just before Close, which had no link to take down
+			iface.mutex.Unlock()
+			_ = wire.Close()
+			continue
+		}
+		iface.link = wire
+		iface.mutex.Unlock()
+
+		_, err = iface.arp.SendGARP()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: could not send GARP: %s\n", iface, err.Error())
+		}
+		iface.receive(wire)
+
+		iface.mutex.Lock()
+		iface.link = nil
+		iface.mutex.Unlock()
+		_ = wire.Close()
+		fmt.Printf("%v: link down\n", iface)
+	}
+}
+
+// Close stops accepting links and takes the current one down, so Serve
+// returns.
+func (iface *Interface) Close() error {
+	iface.mutex.Lock()
+	iface.closed = true
+	wire := iface.link
+	iface.mutex.Unlock()
+	if wire != nil {
+		_ = wire.Close()
+	}
+	return iface.listener.Close()
+}
+
+func (iface *Interface) receive(wire link.Link) {
+	for {
+		data, err := wire.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if errors.Is(err, net.ErrClosed) || errors.Is(err, link.ErrClosed) {
+			// the interface was closed
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: error receiving message: %s\n", iface, err.Error())
+			return
+		}
+		if !iface.isForMe(data) {
+			continue
+		}
+
+		slotIndex, err := iface.nic.LoadFrame(data)
+		if err != nil {
+			fmt.Printf("%v: could not write to memory, dropping frame: %s\n", iface, err.Error())
+			continue
+		}
+		data, err = iface.readMemory(slotIndex)
+		if err != nil {
+			fmt.Printf("%v: could not read from memory, dropping frame: %s\n", iface, err.Error())
+			continue
+		}
+
+		frame, err := ethernet.Deserialize(data)
+		if err != nil {
+			fmt.Printf("%v: could not parse frame, dropping frame: %s\n", iface, err.Error())
+			continue
+		}
+
+		err = iface.dispatch(frame)
+		if err != nil {
+			fmt.Printf("%v: could not dispatch frame: %s\n", iface, err.Error())
+		}
+	}
+}
+
+func (iface *Interface) dispatch(frame *ethernet.Frame) error {
+	switch frame.EtherType {
+	case ethernet.ARPEtherType:
+		return iface.arp.Receive(frame.Data)
+
+	case ethernet.IPv4EtherType:
+		packet, err := ip.Deserialize(frame.Data)
+		if err != nil {
+			return fmt.Errorf("could not parse packet: %w", err)
+		}
+		// forwarding may block on ARP resolution of the next hop, which
+		// must not stall the frames arriving on this wire, so packets are
+		// queued for route in the order they arrived
+		select {
+		case iface.packets <- packet:
+			return nil
+		default:
+			return fmt.Errorf("routing queue full, dropping packet")
+		}
+
+	default:
+		return fmt.Errorf("unrecognized ethertype")
+	}
+}
+
+// route hands the packets received on the interface to the router, one at a
+// time.
+func (iface *Interface) route() {
+	for packet := range iface.packets {
+		iface.router.receive(packet, iface)
+	}
+}
+
+func (iface *Interface) resolve(nextHop ip.IPAddress) (nic.MACAddress, error) {
+	mac, err := iface.arp.Resolve(nextHop)
+	if err != nil {
+		return nic.MACAddress{}, fmt.Errorf("%v: could not resolve %v: %w", iface, nextHop, err)
+	}
+	return mac, nil
+}
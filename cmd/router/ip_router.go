@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/icmp"
+	"tcp-ip/internal/ip"
+	"tcp-ip/internal/link"
+	"tcp-ip/internal/route"
+)
+
+type IPRouter struct {
+	interfaces  []*Interface
+	table       *route.Table
+	icmp        *icmp.ICMPModule
+	reassembler *ip.Reassembler
+	packetID    atomic.Uint32
+}
+
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, " ")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+func NewIPRouter() *IPRouter {
+	router := &IPRouter{
+		table:       route.NewTable(),
+		reassembler: ip.NewReassembler(ip.ReassemblyTimeout, ip.MaxReassemblyBytes, ip.MaxReassemblyBuffers),
+	}
+	router.icmp = icmp.NewICMPModule(router)
+	return router
+}
+
+// AddInterface parses an interface in the listen-address,ip/prefix format
+// and installs the connected route for its subnet.
+func (router *IPRouter) AddInterface(config string) error {
+	listenAddress, cidr, found := strings.Cut(config, ",")
+	if !found {
+		return fmt.Errorf("invalid interface %q: expected listen-address,ip/prefix", config)
+	}
+	address, err := ip.ParsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	listener, err := link.Listen(listenAddress)
+	if err != nil {
+		return fmt.Errorf("could not create listener: %w", err)
+	}
+
+	iface := NewInterface(len(router.interfaces), address, listener, router)
+	router.interfaces = append(router.interfaces, iface)
+	router.table.AddConnected(address, iface.index)
+	return nil
+}
+
+// AddRoute parses a static route in the network/prefix,gateway[,metric]
+// format, where the network may also be "default".
+func (router *IPRouter) AddRoute(config string) error {
+	fields := strings.Split(config, ",")
+	if len(fields) < 2 || len(fields) > 3 {
+		return fmt.Errorf("invalid route %q: expected network/prefix,gateway[,metric]", config)
+	}
+	var prefix ip.Prefix
+	if fields[0] != "default" {
+		var err error
+		prefix, err = ip.ParsePrefix(fields[0])
+		if err != nil {
+			return err
+		}
+	}
+	gateway, err := ip.ParseIP(fields[1])
+	if err != nil {
+		return err
+	}
+	metric := route.StaticMetric
+	if len(fields) == 3 {
+		metric, err = strconv.Atoi(fields[2])
+		if err != nil || metric < 0 {
+			return fmt.Errorf("invalid route %q: invalid metric", config)
+		}
+	}
+	return router.table.AddStatic(prefix, gateway, metric)
+}
+
+func (router *IPRouter) isLocal(dst ip.IPAddress, ingress *Interface) bool {
+	if dst == ip.LimitedBroadcast || dst == ingress.address.Broadcast() {
+		return true
+	}
+	for _, iface := range router.interfaces {
+		if dst == iface.address.Address {
+			return true
+		}
+	}
+	return false
+}
+
+func (router *IPRouter) IsBroadcast(address ip.IPAddress) bool {
+	if address == ip.LimitedBroadcast {
+		return true
+	}
+	for _, iface := range router.interfaces {
+		if address == iface.address.Broadcast() {
+			return true
+		}
+	}
+	return false
+}
+
+func (router *IPRouter) receive(packet *ip.Packet, ingress *Interface) {
+	if !router.isLocal(packet.DstIP, ingress) {
+		router.forward(packet)
+		return
+	}
+
+	packet, err := router.reassembler.Add(packet)
+	if err != nil {
+		fmt.Println("Could not reassemble packet:", err.Error())
+		return
+	}
+	if packet == nil {
+		return
+	}
+
+	switch packet.Protocol {
+	case ip.ProtoICMP:
+		err = router.icmp.Receive(packet)
+	default:
+		err = router.icmp.SendDestUnreachable(icmp.CodeProtoUnreachable, packet)
+	}
+	if err != nil {
+		fmt.Println("Could not handle local packet:", err.Error())
+	}
+}
+
+func (router *IPRouter) forward(packet *ip.Packet) {
+	if packet.TTL <= 1 {
+		fmt.Printf("TTL expired for packet from %v to %v, dropping\n", packet.SrcIP, packet.DstIP)
+		router.reportError(router.icmp.SendTimeExceeded(icmp.CodeTTLExceeded, packet))
+		return
+	}
+
+	entry, err := router.table.Lookup(packet.DstIP)
+	if err != nil {
+		fmt.Printf("No route to %v, dropping\n", packet.DstIP)
+		router.reportError(router.icmp.SendDestUnreachable(icmp.CodeNetUnreachable, packet))
+		return
+	}
+	egress := router.interfaces[entry.Interface]
+	// the errors below quote the header as the source sent it
+	forwarded := *packet
+	forwarded.TTL--
+
+	err = router.sendPacket(&forwarded, entry)
+	if errors.Is(err, ip.ErrFragmentationNeeded) {
+		router.reportError(router.icmp.SendFragNeeded(egress.mtu, packet))
+		return
+	}
+	if err != nil {
+		fmt.Printf("Could not forward packet from %v to %v: %s\n", packet.SrcIP, packet.DstIP, err.Error())
+		router.reportError(router.icmp.SendDestUnreachable(icmp.CodeHostUnreachable, packet))
+		return
+	}
+	fmt.Printf("Forwarded packet from %v to %v via %v\n", packet.SrcIP, packet.DstIP, egress)
+}
+
+// sendPacket resolves the next hop of entry and writes packet out of its
+// interface, fragmenting it to the interface MTU. Serializing recomputes the
+// header checksum after the TTL changed.
+func (router *IPRouter) sendPacket(packet *ip.Packet, entry route.Route) error {
+	egress := router.interfaces[entry.Interface]
+	fragments, err := ip.Fragment(packet, egress.mtu)
+	if err != nil {
+		return err
+	}
+
+	dstMAC, err := egress.resolve(entry.NextHop(packet.DstIP))
+	if err != nil {
+		return err
+	}
+
+	for _, fragment := range fragments {
+		err = egress.SendToMAC(fragment.Serialize(), dstMAC, ethernet.IPv4EtherType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (router *IPRouter) SendToIP(message []byte, dst ip.IPAddress, protocol uint8) error {
+	entry, err := router.table.Lookup(dst)
+	if err != nil {
+		return err
+	}
+	src := router.interfaces[entry.Interface].address.Address
+	packet, err := ip.NewPacket(src, dst, protocol, uint16(router.packetID.Add(1)), message)
+	if err != nil {
+		return err
+	}
+	return router.sendPacket(packet, entry)
+}
+
+func (router *IPRouter) reportError(err error) {
+	if err != nil {
+		fmt.Println("Could not send ICMP error:", err.Error())
+	}
+}
+
+// runIPRouter routes between the interfaces until ctx is done.
+func runIPRouter(ctx context.Context, interfaces, routes []string) {
+	router := NewIPRouter()
+	for _, config := range interfaces {
+		err := router.AddInterface(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not add interface:", err.Error())
+			return
+		}
+	}
+	if len(router.interfaces) == 0 {
+		fmt.Fprintln(os.Stderr, "At least one -iface is required in route mode")
+		return
+	}
+	for _, config := range routes {
+		err := router.AddRoute(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not add route:", err.Error())
+			return
+		}
+	}
+
+	for _, entry := range router.table.Routes() {
+		fmt.Println("Route:", entry)
+	}
+
+	go router.reassembler.RunGC(ctx, nil)
+	context.AfterFunc(ctx, func() {
+		for _, iface := range router.interfaces {
+			_ = iface.Close()
+		}
+	})
+	wg := new(sync.WaitGroup)
+	for _, iface := range router.interfaces {
+		fmt.Printf("%v listening at %s with MAC %x\n", iface, iface.listener.Addr().String(), iface.nic.MAC)
+		wg.Go(func() { iface.Serve(ctx) })
+	}
+	wg.Wait()
+	fmt.Println("Shutting down")
+}
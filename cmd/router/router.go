@@ -1,15 +1,18 @@
 package main
 
 import (
-	"encoding/binary"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log/slog"
-	"net"
 	"os"
-	"sync"
-	"tcp-ip/internal/ethernet"
+	"os/signal"
+	"syscall"
+	"tcp-ip/internal/bridge"
+	"tcp-ip/internal/capture"
+	"tcp-ip/internal/link"
 	"tcp-ip/internal/nic"
 	"time"
 )
@@ -19,136 +22,276 @@ const (
 	descriptorSlots = 1024
 )
 
+var (
+	linkFlags = link.RegisterFlags(flag.CommandLine)
+	// uplinks are redialed after a backoff growing up to maxRedialDelay
+	minRedialDelay = time.Second
+	maxRedialDelay = 30 * time.Second
+)
+
 type Router struct {
-	MACTable map[[6]byte]net.Conn
-	memory   []byte
-	ring     []nic.Descriptor
-	NIC      *nic.NIC
-	mutex    sync.Mutex
-	host     string
+	bridge *bridge.Bridge
+	memory []byte
+	ring   []nic.Descriptor
+	NIC    *nic.NIC
+	host   string
+	// captures are the capture files the bridge writes to, closed on
+	// shutdown so that their last records reach the disk
+	captures []capture.Writer
 }
 
-func (router *Router) getMessage(conn net.Conn, waitTime int) ([]byte, error) {
-	err := conn.SetReadDeadline(time.Now().Add(time.Duration(waitTime) * time.Minute))
-	if err != nil {
-		return nil, err
-	}
-
-	var length uint16
-	err = binary.Read(conn, binary.BigEndian, &length)
-	if err != nil {
-		return nil, err
+func (router *Router) switchConnection(wire link.Link) {
+	port := router.bridge.AddPort(wire)
+	fmt.Printf("Connection from %v on port %d, %v\n", wire, port.Number(), port.VLAN())
+	err := port.Serve()
+	if errors.Is(err, io.EOF) {
+		fmt.Printf("The client on port %d closed the connection\n", port.Number())
+		return
 	}
+	fmt.Fprintf(os.Stderr, "Error receiving message on port %d: %s\n", port.Number(), err.Error())
+}
 
-	if int(length) > ethernet.MTU || length <= 0 {
-		return nil, fmt.Errorf("invalid message length received")
+// uplink keeps a connection to the switch at address plugged in as a port,
+// dialing it again whenever it fails, until ctx is done.
+func (router *Router) uplink(ctx context.Context, address string) {
+	delay := minRedialDelay
+	for ctx.Err() == nil {
+		wire, err := link.Dial(address)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not connect uplink to %s: %s\n", address, err.Error())
+			sleep(ctx, delay)
+			delay = min(2*delay, maxRedialDelay)
+			continue
+		}
+		delay = minRedialDelay
+		wire = linkFlags.Wrap(wire)
+		port := router.bridge.AddPort(wire)
+		fmt.Printf("Uplink to %s on port %d, %v\n", address, port.Number(), port.VLAN())
+		stop := context.AfterFunc(ctx, func() { _ = wire.Close() })
+		err = port.Serve()
+		stop()
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, io.EOF) {
+			fmt.Printf("The switch at %s closed the uplink on port %d\n", address, port.Number())
+		} else {
+			fmt.Fprintf(os.Stderr, "Error receiving message on uplink port %d: %s\n", port.Number(), err.Error())
+		}
+		sleep(ctx, delay)
 	}
+}
 
-	buf := make([]byte, length)
-	_, err = io.ReadFull(conn, buf)
-	if err != nil {
-		return nil, err
+// sleep waits for delay or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
 	}
-	return buf, nil
 }
 
-func (router *Router) forwardMessage(data []byte, conn net.Conn) error {
-	length := uint16(len(data))
-	err := conn.SetWriteDeadline(time.Now().Add(time.Duration(10) * time.Minute))
-	if err != nil {
-		return err
-	}
-	err = binary.Write(conn, binary.BigEndian, length)
-	if err != nil {
-		return err
+// addMirrors sets up the mirrors given on the command line. Mirrors to the
+// same file share it.
+func (router *Router) addMirrors(specs []string) error {
+	files := make(map[string]*capture.Interface)
+	for _, config := range specs {
+		spec, err := bridge.ParseMirror(config)
+		if err != nil {
+			return err
+		}
+		var mirror *bridge.Mirror
+		if spec.File == "" {
+			mirror = bridge.NewPortMirror(spec.Ports, spec.Direction, spec.Monitor)
+		} else {
+			writer := files[spec.File]
+			if writer == nil {
+				file, err := capture.Create(spec.File)
+				if err != nil {
+					return err
+				}
+				router.captures = append(router.captures, file)
+				writer, err = capture.NewInterface(file, "mirror")
+				if err != nil {
+					return err
+				}
+				files[spec.File] = writer
+			}
+			mirror = bridge.NewWriterMirror(spec.Ports, spec.Direction, writer)
+		}
+		mirror.VLAN = spec.VLAN
+		mirror.EtherType = spec.EtherType
+		router.bridge.AddMirror(mirror)
+		fmt.Println(mirror)
 	}
+	return nil
+}
 
-	err = conn.SetWriteDeadline(time.Now().Add(time.Duration(10) * time.Minute))
-	if err != nil {
-		return err
+// closeCaptures closes the capture files.
+func (router *Router) closeCaptures() {
+	for _, writer := range router.captures {
+		err := writer.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not close capture file:", err.Error())
+		}
 	}
-	_, err = conn.Write(data)
-	return err
 }
 
-func (router *Router) switchConnection(conn net.Conn) {
-	var srcMAC nic.MACAddress
-	defer func() {
-		fmt.Println("Clossing connection to: ", conn.RemoteAddr().String())
-		delete(router.MACTable, srcMAC)
-		_ = conn.Close()
-	}()
-
+// printStats writes the counters of every port each interval until ctx is
+// done.
+func (router *Router) printStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
-		data, err := router.getMessage(conn, 10)
-		if errors.Is(err, io.EOF) {
-			fmt.Println("The client closed the connection")
-			return
-		}
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error receiving message: ", err.Error())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
 			return
 		}
-
-		srcMAC = nic.MACAddress(data[6:12])
-		router.mutex.Lock()
-		router.MACTable[nic.MACAddress(srcMAC)] = conn
-		fmt.Fprintf(os.Stderr, "MAC table updated: added %x\n", srcMAC)
-		router.mutex.Unlock()
-
-		dstMAC := nic.MACAddress(data[:6])
-		dstConn, ok := router.MACTable[dstMAC]
-		if !ok && dstMAC != ethernet.BroadcastAddress {
-			fmt.Fprintln(os.Stderr, "Unknown MAC address received, dropping frame")
-			continue
+		fmt.Printf("%d MAC addresses learned\n", router.bridge.FDB().Len())
+		status, stp := router.bridge.STPStatus()
+		if stp {
+			fmt.Println(status)
 		}
-
-		if dstMAC == ethernet.BroadcastAddress {
-			_, _ = fmt.Fprintf(os.Stdout, "Broadcasting message from %x\n", srcMAC)
-			for MAC, conn := range router.MACTable {
-				if MAC == srcMAC {
-					continue
-				}
-				err = router.forwardMessage(data, conn)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error forwading message from %x to %x: %s\n", srcMAC, dstMAC, err.Error())
-				}
+		for _, port := range router.bridge.Ports() {
+			stats := port.Stats()
+			if stp {
+				fmt.Printf("%v: %v %v\n", port, port.Role(), port.State())
 			}
-			continue
+			fmt.Printf("%v: rx %d (unicast %d, multicast %d, broadcast %d) tx %d (unicast %d, multicast %d, broadcast %d) flooded %d filtered %d errors rx %d tx %d\n",
+				port, stats.RxFrames, stats.RxUnicast, stats.RxMulticast, stats.RxBroadcast,
+				stats.TxFrames, stats.TxUnicast, stats.TxMulticast, stats.TxBroadcast,
+				stats.Flooded, stats.Filtered, stats.RxErrors, stats.TxErrors)
 		}
-
-		err = router.forwardMessage(data, dstConn)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error forwading message from %x to %x: %s\n", srcMAC, dstMAC, err.Error())
-			continue
+		for _, mirror := range router.bridge.Mirrors() {
+			mirrored, dropped := mirror.Stats()
+			fmt.Printf("%v: %d frames mirrored, %d dropped\n", mirror, mirrored, dropped)
 		}
-		_, _ = fmt.Fprintf(os.Stdout, "Forwaded message from %x to %x\n", srcMAC, dstMAC)
 	}
 }
 
 func main() {
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
-	listener, err := net.Listen("tcp", ":8080")
+	var interfaces, routes, ports, stpPorts, uplinks, mirrors stringList
+	mode := flag.String("mode", "switch", "operating mode: switch or route")
+	listenAddress := flag.String("listen", ":8080", "address to accept hosts and switches on (switch mode)")
+	flag.Var(&uplinks, "uplink", "address of another switch to connect to (switch mode, repeatable)")
+	agingTime := flag.Duration("aging", bridge.DefaultAgingTime, "time after which unseen MAC addresses are forgotten (switch mode)")
+	fdbSize := flag.Int("fdb-size", bridge.DefaultFDBCapacity, "maximum number of learned MAC addresses (switch mode)")
+	captureFile := flag.String("capture", "", "file to capture the frames of every port to, pcapng when it ends in .pcapng and pcap otherwise (switch mode)")
+	statsInterval := flag.Duration("stats", 0, "interval to print port counters at, never when 0 (switch mode)")
+	flag.Var(&interfaces, "iface", "routing interface as listen-address,ip/prefix (route mode, repeatable)")
+	flag.Var(&ports, "port", "VLAN of a switch port as number,access,vid or number,trunk,native,vid/vid/...[,qinq] (switch mode, repeatable)")
+	stpVersion := flag.String("stp", "off", "spanning tree version: off, stp or rstp (switch mode)")
+	stpPriority := flag.Uint("stp-priority", bridge.DefaultBridgePriority, "bridge priority, a multiple of 4096 (switch mode)")
+	helloTime := flag.Duration("hello", bridge.DefaultHelloTime, "interval between BPDUs (switch mode)")
+	forwardDelay := flag.Duration("forward-delay", bridge.DefaultForwardDelay, "time a port spends in each of listening and learning (switch mode)")
+	flag.Var(&stpPorts, "stp-port", "spanning tree settings of a switch port as number[,cost=n][,priority=n][,edge] (switch mode, repeatable)")
+	flag.Var(&mirrors, "mirror", "mirror as ports=n/n,to=port:n|file:path[,dir=rx|tx|both][,vlan=vid][,ethertype=type] (switch mode, repeatable)")
+	flag.Var(&routes, "route", "static route as network/prefix,gateway[,metric] (route mode, repeatable)")
+	flag.Parse()
+	err := linkFlags.Parse()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid arguments:", err.Error())
+		return
+	}
+
+	// an interrupt closes the listeners, which ends the process through the
+	// deferred calls instead of killing it outright
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch *mode {
+	case "route":
+		runIPRouter(ctx, interfaces, routes)
+		return
+	case "switch":
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown mode:", *mode)
+		return
+	}
+
+	if *fdbSize <= 0 || *agingTime <= 0 {
+		fmt.Fprintln(os.Stderr, "Invalid arguments: -fdb-size and -aging must be positive")
+		return
+	}
+	listener, err := link.Listen(*listenAddress)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Could not create listener:", err.Error())
 		return
 	}
 
 	router := &Router{
-		MACTable: make(map[[6]byte]net.Conn),
-		memory:   make([]byte, slotSize*descriptorSlots),
-		ring:     make([]nic.Descriptor, descriptorSlots),
-		host:     listener.Addr().String(),
+		bridge: bridge.NewBridge(bridge.NewFDB(*fdbSize, *agingTime)),
+		memory: make([]byte, slotSize*descriptorSlots),
+		ring:   make([]nic.Descriptor, descriptorSlots),
+		host:   listener.Addr().String(),
 	}
 	router.NIC = nic.NewNIC(router.memory, router.ring, slotSize)
+	defer router.closeCaptures()
+	for _, config := range ports {
+		number, vlan, err := bridge.ParsePortVLAN(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not configure port:", err.Error())
+			return
+		}
+		router.bridge.SetPortVLAN(number, vlan)
+		fmt.Printf("Port %d: %v\n", number, vlan)
+	}
+	version, err := bridge.ParseSTPVersion(*stpVersion)
+	if err != nil || *stpPriority > 61440 || *stpPriority%4096 != 0 {
+		fmt.Fprintln(os.Stderr, "Invalid arguments: -stp must be off, stp or rstp and -stp-priority a multiple of 4096 up to 61440")
+		return
+	}
+	router.bridge.EnableSTP(bridge.STPConfig{
+		Version:      version,
+		Priority:     uint16(*stpPriority),
+		HelloTime:    *helloTime,
+		ForwardDelay: *forwardDelay,
+	}, router.NIC.MAC)
+	for _, config := range stpPorts {
+		number, settings, err := bridge.ParsePortSTP(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not configure port:", err.Error())
+			return
+		}
+		router.bridge.SetPortSTP(number, settings)
+	}
+	if *captureFile != "" {
+		writer, err := capture.Create(*captureFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not create capture file:", err.Error())
+			return
+		}
+		router.captures = append(router.captures, writer)
+		router.bridge.Capture(writer)
+	}
+	err = router.addMirrors(mirrors)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not configure mirror:", err.Error())
+		return
+	}
+	go router.bridge.FDB().RunAging(ctx)
+	if *statsInterval > 0 {
+		go router.printStats(ctx, *statsInterval)
+	}
 	fmt.Println("Server started at:", router.host)
+	for _, address := range uplinks {
+		go router.uplink(ctx, address)
+	}
 
+	context.AfterFunc(ctx, func() { _ = listener.Close() })
 	for {
-		conn, err := listener.Accept()
+		wire, err := listener.Accept()
+		if ctx.Err() != nil {
+			fmt.Println("Shutting down")
+			return
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Could not accept connection:", err.Error())
+			continue
 		}
-		fmt.Println("Connection received from:", conn.RemoteAddr().String())
-		go router.switchConnection(conn)
+		go router.switchConnection(linkFlags.Wrap(wire))
 	}
 }
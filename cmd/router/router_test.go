@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"tcp-ip/internal/bridge"
+	"tcp-ip/internal/link"
+	"testing"
+	"time"
+)
+
+func accept(t *testing.T, listener link.Listener) link.Link {
+	t.Helper()
+	accepted := make(chan link.Link, 1)
+	go func() {
+		wire, err := listener.Accept()
+		if err == nil {
+			accepted <- wire
+		}
+	}()
+	select {
+	case wire := <-accepted:
+		return wire
+	case <-time.After(5 * time.Second):
+		t.Fatal("the uplink did not dial the switch")
+		return nil
+	}
+}
+
+// waitPorts waits for the bridge to have want ports plugged in.
+func waitPorts(t *testing.T, router *Router, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(router.bridge.Ports()) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("bridge has %d ports, want %d", len(router.bridge.Ports()), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUplinkRedial(t *testing.T) {
+	minDelay, maxDelay := minRedialDelay, maxRedialDelay
+	minRedialDelay, maxRedialDelay = 10*time.Millisecond, 40*time.Millisecond
+	t.Cleanup(func() { minRedialDelay, maxRedialDelay = minDelay, maxDelay })
+
+	router := &Router{bridge: bridge.NewBridge(bridge.NewFDB(bridge.DefaultFDBCapacity, bridge.DefaultAgingTime))}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	address := "pipe://" + t.Name()
+	go func() {
+		router.uplink(ctx, address)
+		close(done)
+	}()
+
+	// the switch is not up yet, so the first dials fail and back off
+	time.Sleep(100 * time.Millisecond)
+	listener, err := link.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		wire := accept(t, listener)
+		waitPorts(t, router, 1)
+		// the switch dropping the uplink unplugs the port until the redial
+		wire.Close()
+	}
+	wire := accept(t, listener)
+	waitPorts(t, router, 1)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("uplink kept running after the context was done")
+	}
+	waitPorts(t, router, 0)
+	wire.Close()
+	listener.Close()
+}
@@ -1,6 +1,7 @@
 package arp
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"tcp-ip/internal/ethernet"
@@ -84,26 +85,41 @@ func NewARPModule(hrd uint16, hrdLen uint8, proto uint16, protoLen uint8, hrdAdd
 
 // TODO: on receiving response, update as well, but send to channel only if pending
 // What's the deal with the garps
-func (arp *ARPModule) RunGC() {
+
+// RunGC ages the table every gcTick and returns once ctx is done.
+func (arp *ARPModule) RunGC(ctx context.Context) {
 	ticker := time.NewTicker(gcTick)
-	for range ticker.C {
-		arp.mutex.Lock()
-		for ip, entry := range arp.table {
-
-			if time.Since(entry.lastUsed) > timeToDelete ||
-				(entry.state == StateFailed && time.Since(entry.lastUpdated) > timeToDelete) {
-				delete(arp.table, ip)
-				if ch, ok := arp.pending[ip]; ok {
-					close(ch)
-					delete(arp.pending, ip)
-				}
-			}
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			arp.collect()
+		}
+	}
+}
 
-			if entry.state == StateReachable && time.Since(entry.lastUpdated) > timeToStale {
-				entry.state = StateStale
+// collect deletes the entries unused or failed for too long and marks
+// reachable ones stale once they were not confirmed for a while.
+func (arp *ARPModule) collect() {
+	arp.mutex.Lock()
+	defer arp.mutex.Unlock()
+	for ip, entry := range arp.table {
+
+		if time.Since(entry.lastUsed) > timeToDelete ||
+			(entry.state == StateFailed && time.Since(entry.lastUpdated) > timeToDelete) {
+			delete(arp.table, ip)
+			if ch, ok := arp.pending[ip]; ok {
+				close(ch)
+				delete(arp.pending, ip)
 			}
+		}
 
+		if entry.state == StateReachable && time.Since(entry.lastUpdated) > timeToStale {
+			entry.state = StateStale
 		}
+
 	}
 }
 
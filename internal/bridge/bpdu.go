@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"tcp-ip/internal/nic"
+	"time"
+)
+
+// BridgeGroupAddress is where bridges send their BPDUs. Frames to it and to
+// the rest of 01-80-C2-00-00-00/44 are never forwarded.
+var BridgeGroupAddress = nic.MACAddress{0x01, 0x80, 0xC2, 0x00, 0x00, 0x00}
+
+func isReserved(dst nic.MACAddress) bool {
+	return bytes.Equal(dst[:5], BridgeGroupAddress[:5]) && dst[5] <= 0x0F
+}
+
+const (
+	bpduVersionSTP  = 0
+	bpduVersionRSTP = 2
+
+	bpduTypeConfig = 0x00
+	bpduTypeTCN    = 0x80
+	bpduTypeRST    = 0x02
+
+	configBPDUSize = 35
+	rstBPDUSize    = 36
+	tcnBPDUSize    = 4
+)
+
+const (
+	flagTC          = 1 << 0
+	flagProposal    = 1 << 1
+	flagRoleShift   = 2
+	flagLearning    = 1 << 4
+	flagForwarding  = 1 << 5
+	flagAgreement   = 1 << 6
+	flagTCAck       = 1 << 7
+	flagRoleMask    = 3 << flagRoleShift
+	bpduRoleUnknown = 0
+	bpduRoleAltBack = 1
+	bpduRoleRoot    = 2
+	bpduRoleDesig   = 3
+)
+
+// llcHeader is the 802.2 header carrying BPDUs, which travel in 802.3
+// frames with a length where Ethernet II has its EtherType.
+var llcHeader = []byte{0x42, 0x42, 0x03}
+
+// BridgeID orders bridges by priority and then by address, the lowest one
+// becoming the root.
+type BridgeID struct {
+	Priority uint16
+	MAC      nic.MACAddress
+}
+
+func (id BridgeID) compare(other BridgeID) int {
+	if id.Priority != other.Priority {
+		return int(id.Priority) - int(other.Priority)
+	}
+	return bytes.Compare(id.MAC[:], other.MAC[:])
+}
+
+func (id BridgeID) String() string {
+	return fmt.Sprintf("%d.%x", id.Priority, id.MAC)
+}
+
+func (id BridgeID) serialize() []byte {
+	data := binary.BigEndian.AppendUint16(nil, id.Priority)
+	return append(data, id.MAC[:]...)
+}
+
+func parseBridgeID(data []byte) BridgeID {
+	return BridgeID{Priority: binary.BigEndian.Uint16(data[0:2]), MAC: nic.MACAddress(data[2:8])}
+}
+
+// priorityVector is what bridges compare to agree on the spanning tree,
+// field by field with lower values better.
+type priorityVector struct {
+	rootID           BridgeID
+	rootPathCost     uint32
+	designatedBridge BridgeID
+	designatedPort   uint16
+}
+
+func (vector priorityVector) compare(other priorityVector) int {
+	if c := vector.rootID.compare(other.rootID); c != 0 {
+		return c
+	}
+	if vector.rootPathCost != other.rootPathCost {
+		if vector.rootPathCost < other.rootPathCost {
+			return -1
+		}
+		return 1
+	}
+	if c := vector.designatedBridge.compare(other.designatedBridge); c != 0 {
+		return c
+	}
+	return int(vector.designatedPort) - int(other.designatedPort)
+}
+
+// times are the timer values the root hands down the tree.
+type times struct {
+	messageAge   time.Duration
+	maxAge       time.Duration
+	helloTime    time.Duration
+	forwardDelay time.Duration
+}
+
+type bpdu struct {
+	version uint8
+	kind    uint8
+	flags   uint8
+	vector  priorityVector
+	times   times
+}
+
+func (message *bpdu) role() uint8 {
+	return (message.flags & flagRoleMask) >> flagRoleShift
+}
+
+// BPDU times travel in units of 1/256 of a second.
+func encodeTime(duration time.Duration) uint16 {
+	return uint16(duration * 256 / time.Second)
+}
+
+func decodeTime(value uint16) time.Duration {
+	return time.Duration(value) * time.Second / 256
+}
+
+func (message *bpdu) serialize() []byte {
+	data := []byte{0, 0, message.version, message.kind}
+	if message.kind == bpduTypeTCN {
+		return data
+	}
+	data = append(data, message.flags)
+	data = append(data, message.vector.rootID.serialize()...)
+	data = binary.BigEndian.AppendUint32(data, message.vector.rootPathCost)
+	data = append(data, message.vector.designatedBridge.serialize()...)
+	data = binary.BigEndian.AppendUint16(data, message.vector.designatedPort)
+	data = binary.BigEndian.AppendUint16(data, encodeTime(message.times.messageAge))
+	data = binary.BigEndian.AppendUint16(data, encodeTime(message.times.maxAge))
+	data = binary.BigEndian.AppendUint16(data, encodeTime(message.times.helloTime))
+	data = binary.BigEndian.AppendUint16(data, encodeTime(message.times.forwardDelay))
+	if message.kind == bpduTypeRST {
+		// version 1 length, always zero
+		data = append(data, 0)
+	}
+	return data
+}
+
+func parseBPDU(data []byte) (*bpdu, error) {
+	if len(data) < tcnBPDUSize || binary.BigEndian.Uint16(data[0:2]) != 0 {
+		return nil, fmt.Errorf("invalid BPDU: bad protocol identifier")
+	}
+	message := &bpdu{version: data[2], kind: data[3]}
+	switch message.kind {
+	case bpduTypeTCN:
+		return message, nil
+	case bpduTypeConfig:
+		if len(data) < configBPDUSize {
+			return nil, fmt.Errorf("invalid BPDU: configuration BPDU too short")
+		}
+	case bpduTypeRST:
+		if len(data) < rstBPDUSize {
+			return nil, fmt.Errorf("invalid BPDU: RST BPDU too short")
+		}
+	default:
+		return nil, fmt.Errorf("invalid BPDU: unknown type %#x", message.kind)
+	}
+	message.flags = data[4]
+	message.vector = priorityVector{
+		rootID:           parseBridgeID(data[5:13]),
+		rootPathCost:     binary.BigEndian.Uint32(data[13:17]),
+		designatedBridge: parseBridgeID(data[17:25]),
+		designatedPort:   binary.BigEndian.Uint16(data[25:27]),
+	}
+	message.times = times{
+		messageAge:   decodeTime(binary.BigEndian.Uint16(data[27:29])),
+		maxAge:       decodeTime(binary.BigEndian.Uint16(data[29:31])),
+		helloTime:    decodeTime(binary.BigEndian.Uint16(data[31:33])),
+		forwardDelay: decodeTime(binary.BigEndian.Uint16(data[33:35])),
+	}
+	return message, nil
+}
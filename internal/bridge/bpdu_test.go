@@ -0,0 +1,156 @@
+package bridge
+
+import (
+	"bytes"
+	"tcp-ip/internal/nic"
+	"testing"
+	"time"
+)
+
+func testBridgeID(priority uint16, last byte) BridgeID {
+	return BridgeID{Priority: priority, MAC: nic.MACAddress{0x02, 0, 0, 0, 0, last}}
+}
+
+func TestBPDURoundTrip(t *testing.T) {
+	vector := priorityVector{
+		rootID:           testBridgeID(4096, 1),
+		rootPathCost:     40000,
+		designatedBridge: testBridgeID(DefaultBridgePriority, 2),
+		designatedPort:   0x8003,
+	}
+	timers := times{messageAge: time.Second, maxAge: DefaultMaxAge, helloTime: DefaultHelloTime, forwardDelay: DefaultForwardDelay}
+	tests := []struct {
+		name    string
+		message bpdu
+		size    int
+	}{
+		{"configuration", bpdu{version: bpduVersionSTP, kind: bpduTypeConfig, flags: flagTC | flagTCAck, vector: vector, times: timers}, configBPDUSize},
+		{"rapid", bpdu{version: bpduVersionRSTP, kind: bpduTypeRST, flags: flagProposal | bpduRoleDesig<<flagRoleShift | flagLearning, vector: vector, times: timers}, rstBPDUSize},
+		{"topology change notification", bpdu{version: bpduVersionSTP, kind: bpduTypeTCN}, tcnBPDUSize},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.message.serialize()
+			if len(data) != test.size {
+				t.Fatalf("serialized %d bytes, want %d", len(data), test.size)
+			}
+			message, err := parseBPDU(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *message != test.message {
+				t.Errorf("parseBPDU = %+v, want %+v", *message, test.message)
+			}
+		})
+	}
+}
+
+func TestBPDULayout(t *testing.T) {
+	message := &bpdu{
+		version: bpduVersionRSTP,
+		kind:    bpduTypeRST,
+		flags:   flagAgreement | bpduRoleRoot<<flagRoleShift | flagForwarding | flagLearning,
+		vector: priorityVector{
+			rootID:           testBridgeID(0x1000, 1),
+			rootPathCost:     20000,
+			designatedBridge: testBridgeID(0x8000, 2),
+			designatedPort:   0x8001,
+		},
+		times: times{messageAge: time.Second, maxAge: 20 * time.Second, helloTime: 2 * time.Second, forwardDelay: 1500 * time.Millisecond},
+	}
+	want := []byte{
+		0x00, 0x00, // protocol identifier
+		0x02, 0x02, // version and type
+		0x78,                                           // agreement, forwarding, learning, root role
+		0x10, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01, // root identifier
+		0x00, 0x00, 0x4E, 0x20, // root path cost
+		0x80, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x02, // bridge identifier
+		0x80, 0x01, // port identifier
+		0x01, 0x00, // message age, in 1/256 s
+		0x14, 0x00, // max age
+		0x02, 0x00, // hello time
+		0x01, 0x80, // forward delay
+		0x00, // version 1 length
+	}
+	if data := message.serialize(); !bytes.Equal(data, want) {
+		t.Errorf("serialize =\n% x, want\n% x", data, want)
+	}
+	if role := message.role(); role != bpduRoleRoot {
+		t.Errorf("role %d, want %d", role, bpduRoleRoot)
+	}
+}
+
+func TestParseBPDUInvalid(t *testing.T) {
+	config := (&bpdu{kind: bpduTypeConfig}).serialize()
+	rapid := (&bpdu{version: bpduVersionRSTP, kind: bpduTypeRST}).serialize()
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"protocol identifier", []byte{0, 1, 0, bpduTypeTCN}},
+		{"unknown type", []byte{0, 0, 0, 0x42}},
+		{"short configuration", config[:configBPDUSize-1]},
+		{"short rapid", rapid[:rstBPDUSize-1]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if message, err := parseBPDU(test.data); err == nil {
+				t.Errorf("parseBPDU = %+v, want an error", message)
+			}
+		})
+	}
+}
+
+func TestPriorityVectorCompare(t *testing.T) {
+	base := priorityVector{
+		rootID:           testBridgeID(DefaultBridgePriority, 1),
+		rootPathCost:     20000,
+		designatedBridge: testBridgeID(DefaultBridgePriority, 2),
+		designatedPort:   0x8002,
+	}
+	tests := []struct {
+		name   string
+		change func(vector *priorityVector)
+	}{
+		{"root priority", func(vector *priorityVector) { vector.rootID.Priority = 4096 }},
+		{"root address", func(vector *priorityVector) { vector.rootID.MAC[5] = 0 }},
+		{"root path cost", func(vector *priorityVector) { vector.rootPathCost = 19999 }},
+		{"designated bridge", func(vector *priorityVector) { vector.designatedBridge.MAC[5] = 1 }},
+		{"designated port", func(vector *priorityVector) { vector.designatedPort = 0x8001 }},
+		// the root outweighs everything after it
+		{"root before cost", func(vector *priorityVector) {
+			vector.rootID.MAC[5] = 0
+			vector.rootPathCost = 1 << 30
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			better := base
+			test.change(&better)
+			if better.compare(base) >= 0 || base.compare(better) <= 0 {
+				t.Errorf("%+v is not better than %+v", better, base)
+			}
+		})
+	}
+	if base.compare(base) != 0 {
+		t.Errorf("a vector differs from itself")
+	}
+}
+
+func TestIsReserved(t *testing.T) {
+	tests := []struct {
+		mac  nic.MACAddress
+		want bool
+	}{
+		{BridgeGroupAddress, true},
+		{nic.MACAddress{0x01, 0x80, 0xC2, 0x00, 0x00, 0x0E}, true},
+		{nic.MACAddress{0x01, 0x80, 0xC2, 0x00, 0x00, 0x10}, false},
+		{nic.MACAddress{0x01, 0x00, 0x5E, 0x00, 0x00, 0x01}, false},
+	}
+	for _, test := range tests {
+		if got := isReserved(test.mac); got != test.want {
+			t.Errorf("isReserved(%x) = %t, want %t", test.mac, got, test.want)
+		}
+	}
+}
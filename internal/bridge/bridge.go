@@ -0,0 +1,281 @@
+package bridge
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"tcp-ip/internal/capture"
+	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/link"
+	"tcp-ip/internal/nic"
+)
+
+type destinationKind int
+
+const (
+	unicast destinationKind = iota
+	multicast
+	broadcast
+)
+
+func classify(dst nic.MACAddress) destinationKind {
+	switch {
+	case dst == ethernet.BroadcastAddress:
+		return broadcast
+	case dst[0]&1 != 0:
+		// the individual/group bit of the first octet
+		return multicast
+	default:
+		return unicast
+	}
+}
+
+// Bridge is a transparent 802.1D bridge. It learns where source addresses
+// live, forwards known unicast out of a single port and floods broadcast,
+// multicast and unknown unicast out of every other port.
+//
+// Each VLAN is a bridge of its own: addresses are learned per VLAN and
+// frames only leave through ports that are members of their VLAN.
+type Bridge struct {
+	fdb   *FDB
+	ports map[int]*Port
+	// vlans holds the configuration of port numbers, including the ones not
+	// plugged in yet
+	vlans map[int]VLANConfig
+	// stp is nil unless the spanning tree was enabled
+	stp *stp
+	// capture is nil unless capturing, and captures holds the capture
+	// interface of each port number
+	capture  capture.Writer
+	captures map[int]*capture.Interface
+	// mirrors is replaced as a whole, so forwarding reads it without locking
+	mirrors atomic.Pointer[[]*Mirror]
+	mutex   *sync.RWMutex
+}
+
+func NewBridge(fdb *FDB) *Bridge {
+	return &Bridge{
+		fdb:      fdb,
+		ports:    make(map[int]*Port),
+		vlans:    make(map[int]VLANConfig),
+		captures: make(map[int]*capture.Interface),
+		mutex:    new(sync.RWMutex),
+	}
+}
+
+// SetPortVLAN configures port number, applying to the port plugged in now
+// and to the ones plugged in later under that number.
+func (bridge *Bridge) SetPortVLAN(number int, config VLANConfig) {
+	bridge.mutex.Lock()
+	defer bridge.mutex.Unlock()
+	config.Allowed = slices.Clone(config.Allowed)
+	bridge.vlans[number] = config
+	if port := bridge.ports[number]; port != nil {
+		port.vlan.Store(&config)
+	}
+}
+
+// EnableSTP starts the spanning tree, identifying the bridge by mac. It
+// must be called before any port is added.
+func (bridge *Bridge) EnableSTP(config STPConfig, mac nic.MACAddress) {
+	if config.Version == STPOff {
+		return
+	}
+	bridge.stp = newSTP(bridge, config, mac)
+	go bridge.stp.run()
+}
+
+// Capture records the frames received and sent by every port to writer,
+// each port number being an interface of its own. It must be called before
+// any port is added.
+func (bridge *Bridge) Capture(writer capture.Writer) {
+	bridge.capture = writer
+}
+
+// portCapture returns the capture interface of port number, describing it
+// to the writer the first time. It is called with the mutex held.
+func (bridge *Bridge) portCapture(number int) *capture.Interface {
+	if bridge.capture == nil {
+		return nil
+	}
+	if iface := bridge.captures[number]; iface != nil {
+		return iface
+	}
+	iface, err := capture.NewInterface(bridge.capture, fmt.Sprintf("port %d", number))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not capture port %d: %s\n", number, err.Error())
+		return nil
+	}
+	bridge.captures[number] = iface
+	return iface
+}
+
+func (bridge *Bridge) SetPortSTP(number int, config PortSTPConfig) {
+	if bridge.stp != nil {
+		bridge.stp.setPortConfig(number, config)
+	}
+}
+
+// STPStatus reports the spanning tree, and false when it is off.
+func (bridge *Bridge) STPStatus() (STPStatus, bool) {
+	if bridge.stp == nil {
+		return STPStatus{}, false
+	}
+	return bridge.stp.status(), true
+}
+
+func (bridge *Bridge) portVLAN(number int) VLANConfig {
+	config, ok := bridge.vlans[number]
+	if !ok {
+		return VLANConfig{Mode: ModeAccess, PVID: DefaultVLAN}
+	}
+	return config
+}
+
+func (bridge *Bridge) FDB() *FDB {
+	return bridge.fdb
+}
+
+// AddPort plugs wire into the lowest free port number.
+func (bridge *Bridge) AddPort(wire link.Link) *Port {
+	bridge.mutex.Lock()
+	number := 0
+	for bridge.ports[number] != nil {
+		number++
+	}
+	port := &Port{number: number, link: wire, bridge: bridge, capture: bridge.portCapture(number)}
+	config := bridge.portVLAN(number)
+	port.vlan.Store(&config)
+	if bridge.stp != nil {
+		// the spanning tree decides when the port may forward
+		port.state.Store(int32(bridge.stp.discarding()))
+	}
+	bridge.ports[number] = port
+	bridge.mutex.Unlock()
+
+	if bridge.stp != nil {
+		bridge.stp.addPort(port)
+	}
+	return port
+}
+
+// RemovePort unplugs port and forgets the addresses learned on it.
+func (bridge *Bridge) RemovePort(port *Port) {
+	bridge.mutex.Lock()
+	if bridge.ports[port.number] != port {
+		bridge.mutex.Unlock()
+		return
+	}
+	delete(bridge.ports, port.number)
+	bridge.mutex.Unlock()
+
+	if bridge.stp != nil {
+		bridge.stp.removePort(port)
+	}
+	bridge.fdb.FlushPort(port.number)
+	_ = port.link.Close()
+}
+
+// Ports returns the ports ordered by number.
+func (bridge *Bridge) Ports() []*Port {
+	bridge.mutex.RLock()
+	defer bridge.mutex.RUnlock()
+	ports := make([]*Port, 0, len(bridge.ports))
+	for _, port := range bridge.ports {
+		ports = append(ports, port)
+	}
+	slices.SortFunc(ports, func(a, b *Port) int {
+		return a.number - b.number
+	})
+	return ports
+}
+
+func (bridge *Bridge) port(number int) *Port {
+	bridge.mutex.RLock()
+	defer bridge.mutex.RUnlock()
+	return bridge.ports[number]
+}
+
+// receive forwards a frame arriving on ingress. The bridge stores frames
+// before forwarding them, so frames with a bad FCS go no further.
+func (bridge *Bridge) receive(ingress *Port, data []byte) {
+	frame, err := ethernet.Deserialize(data)
+	if err != nil {
+		ingress.counters.rxErrors.Add(1)
+		return
+	}
+	dst := nic.MACAddress(frame.DstMAC)
+	src := nic.MACAddress(frame.SrcMAC)
+	kind := classify(dst)
+	ingress.countRx(kind)
+
+	vlan, priority, ok := ingress.vlan.Load().classify(frame)
+	bridge.mirror(ingress.number, MirrorIngress, vlan, frame.EtherType, data)
+	if bridge.isMonitor(ingress.number) {
+		ingress.counters.filtered.Add(1)
+		return
+	}
+
+	if isReserved(dst) {
+		// link local frames, BPDUs among them, end at the bridge
+		if dst == BridgeGroupAddress && bridge.stp != nil && frame.EtherType < 0x600 &&
+			len(frame.Data) > len(llcHeader) && bytes.Equal(frame.Data[:len(llcHeader)], llcHeader) {
+			bridge.stp.receive(ingress, frame.Data[len(llcHeader):])
+		}
+		return
+	}
+
+	state := ingress.State()
+	if (state != StateForwarding && state != StateLearning) || !ok {
+		ingress.counters.filtered.Add(1)
+		return
+	}
+
+	// a group address is never the source of a valid frame
+	if classify(src) == unicast {
+		previous, moved := bridge.fdb.Learn(vlan, src, ingress.number)
+		if moved {
+			fmt.Printf("MAC table updated: %x moved from port %d to port %d in vlan %d\n", src, previous, ingress.number, vlan)
+		}
+	}
+
+	if state != StateForwarding {
+		return
+	}
+	if kind != unicast {
+		bridge.flood(ingress, *frame, kind, vlan, priority)
+		return
+	}
+	number, known := bridge.fdb.Lookup(vlan, dst)
+	if !known {
+		bridge.flood(ingress, *frame, kind, vlan, priority)
+		return
+	}
+	if number == ingress.number {
+		// the destination sits behind the ingress port and has the frame
+		ingress.counters.filtered.Add(1)
+		return
+	}
+	egress := bridge.port(number)
+	if egress == nil {
+		bridge.flood(ingress, *frame, kind, vlan, priority)
+		return
+	}
+	egress.transmit(*frame, kind, vlan, priority)
+}
+
+func (bridge *Bridge) flood(ingress *Port, frame ethernet.Frame, kind destinationKind, vlan uint16, priority uint8) {
+	for _, egress := range bridge.Ports() {
+		if egress == ingress || !egress.vlan.Load().member(vlan) || egress.State() != StateForwarding ||
+			bridge.isMonitor(egress.number) {
+			continue
+		}
+		if kind == unicast {
+			egress.counters.flooded.Add(1)
+		}
+		egress.transmit(frame, kind, vlan, priority)
+	}
+}
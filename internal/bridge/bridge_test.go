@@ -0,0 +1,80 @@
+package bridge
+
+import (
+	"slices"
+	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/nic"
+	"testing"
+)
+
+// hostFrame is a frame from host src to dst, as read off a port.
+func hostFrame(t *testing.T, src, dst nic.MACAddress) []byte {
+	t.Helper()
+	frame, err := ethernet.NewFrame(src, dst, ethernet.IPv4EtherType, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame.Serialize()
+}
+
+// delivered returns the ports whose wires were written to since the last
+// call, emptying the wires.
+func delivered(wires []*recorder) []int {
+	var ports []int
+	for number, wire := range wires {
+		wire.mutex.Lock()
+		if len(wire.frames) > 0 {
+			ports = append(ports, number)
+		}
+		wire.frames = nil
+		wire.mutex.Unlock()
+	}
+	return ports
+}
+
+func TestFlood(t *testing.T) {
+	bridge := NewBridge(NewFDB(DefaultFDBCapacity, DefaultAgingTime))
+	var wires []*recorder
+	for range 4 {
+		wire := newRecorder()
+		bridge.AddPort(wire)
+		wires = append(wires, wire)
+	}
+	multicast := nic.MACAddress{0x01, 0x00, 0x5e, 0, 0, 1}
+	broadcast := nic.MACAddress{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	// the host behind port n has address testMAC(n + 1)
+	steps := []struct {
+		name    string
+		ingress int
+		dst     nic.MACAddress
+		want    []int
+	}{
+		{"unknown unicast", 0, testMAC(4), []int{1, 2, 3}},
+		{"multicast", 1, multicast, []int{0, 2, 3}},
+		{"broadcast", 2, broadcast, []int{0, 1, 3}},
+		{"known unicast", 3, testMAC(1), []int{0}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			ingress := bridge.port(step.ingress)
+			bridge.receive(ingress, hostFrame(t, testMAC(byte(step.ingress+1)), step.dst))
+			if got := delivered(wires); !slices.Equal(got, step.want) {
+				t.Errorf("frame from port %d sent out of ports %v, want %v", step.ingress, got, step.want)
+			}
+		})
+	}
+
+	// only the flooded unicast frame counts as flooded
+	want := []PortStats{
+		{RxFrames: 1, RxUnicast: 1, TxFrames: 3, TxUnicast: 1, TxMulticast: 1, TxBroadcast: 1},
+		{RxFrames: 1, RxMulticast: 1, TxFrames: 2, TxUnicast: 1, TxBroadcast: 1, Flooded: 1},
+		{RxFrames: 1, RxBroadcast: 1, TxFrames: 2, TxUnicast: 1, TxMulticast: 1, Flooded: 1},
+		{RxFrames: 1, RxUnicast: 1, TxFrames: 3, TxUnicast: 1, TxMulticast: 1, TxBroadcast: 1, Flooded: 1},
+	}
+	for number, stats := range want {
+		if got := bridge.port(number).Stats(); got != stats {
+			t.Errorf("port %d Stats() = %+v, want %+v", number, got, stats)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package bridge
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"tcp-ip/internal/nic"
+	"time"
+)
+
+const (
+	// DefaultAgingTime is the 802.1D recommended aging time
+	DefaultAgingTime   = 300 * time.Second
+	DefaultFDBCapacity = 8192
+	agingTick          = time.Second
+)
+
+// Entry is a MAC address learned on a port. Every VLAN learns on its own,
+// so the same address may live behind different ports in different VLANs.
+type Entry struct {
+	VLAN     uint16
+	MAC      nic.MACAddress
+	Port     int
+	LastSeen time.Time
+}
+
+func (entry Entry) String() string {
+	return fmt.Sprintf("vlan %d %x port %d age %v", entry.VLAN, entry.MAC, entry.Port, time.Since(entry.LastSeen).Truncate(time.Second))
+}
+
+type fdbKey struct {
+	vlan uint16
+	mac  nic.MACAddress
+}
+
+func (entry *Entry) key() fdbKey {
+	return fdbKey{vlan: entry.VLAN, mac: entry.MAC}
+}
+
+// FDB is the filtering database of a bridge. Entries are kept in least
+// recently seen order, so aging stops at the first fresh entry and a full
+// database evicts the stalest one.
+type FDB struct {
+	entries   map[fdbKey]*list.Element
+	lru       *list.List
+	capacity  int
+	agingTime time.Duration
+	mutex     *sync.Mutex
+}
+
+func NewFDB(capacity int, agingTime time.Duration) *FDB {
+	return &FDB{
+		entries:   make(map[fdbKey]*list.Element),
+		lru:       list.New(),
+		capacity:  capacity,
+		agingTime: agingTime,
+		mutex:     new(sync.Mutex),
+	}
+}
+
+func (fdb *FDB) expired(entry *Entry, now time.Time) bool {
+	return now.Sub(entry.LastSeen) > fdb.agingTime
+}
+
+// Learn records that mac was seen as the source of a frame on port in
+// vlan. It reports the previous port when the address moved.
+func (fdb *FDB) Learn(vlan uint16, mac nic.MACAddress, port int) (int, bool) {
+	fdb.mutex.Lock()
+	defer fdb.mutex.Unlock()
+
+	now := time.Now()
+	key := fdbKey{vlan: vlan, mac: mac}
+	if element, ok := fdb.entries[key]; ok {
+		entry := element.Value.(*Entry)
+		previous := entry.Port
+		entry.Port = port
+		entry.LastSeen = now
+		fdb.lru.MoveToBack(element)
+		return previous, previous != port
+	}
+
+	if fdb.lru.Len() >= fdb.capacity {
+		oldest := fdb.lru.Front()
+		delete(fdb.entries, oldest.Value.(*Entry).key())
+		fdb.lru.Remove(oldest)
+	}
+	fdb.entries[key] = fdb.lru.PushBack(&Entry{VLAN: vlan, MAC: mac, Port: port, LastSeen: now})
+	return 0, false
+}
+
+// Lookup returns the port mac was learned on in vlan, unless it has aged
+// out.
+func (fdb *FDB) Lookup(vlan uint16, mac nic.MACAddress) (int, bool) {
+	fdb.mutex.Lock()
+	defer fdb.mutex.Unlock()
+
+	key := fdbKey{vlan: vlan, mac: mac}
+	element, ok := fdb.entries[key]
+	if !ok {
+		return 0, false
+	}
+	entry := element.Value.(*Entry)
+	if fdb.expired(entry, time.Now()) {
+		delete(fdb.entries, key)
+		fdb.lru.Remove(element)
+		return 0, false
+	}
+	return entry.Port, true
+}
+
+// FlushPort forgets every address learned on port, as when its link goes
+// down.
+func (fdb *FDB) FlushPort(port int) int {
+	fdb.mutex.Lock()
+	defer fdb.mutex.Unlock()
+
+	flushed := 0
+	for element := fdb.lru.Front(); element != nil; {
+		next := element.Next()
+		if entry := element.Value.(*Entry); entry.Port == port {
+			delete(fdb.entries, entry.key())
+			fdb.lru.Remove(element)
+			flushed++
+		}
+		element = next
+	}
+	return flushed
+}
+
+// Age removes the entries not seen within the aging time.
+func (fdb *FDB) Age() int {
+	return fdb.age(time.Now())
+}
+
+func (fdb *FDB) age(now time.Time) int {
+	fdb.mutex.Lock()
+	defer fdb.mutex.Unlock()
+
+	aged := 0
+	for element := fdb.lru.Front(); element != nil; element = fdb.lru.Front() {
+		entry := element.Value.(*Entry)
+		if !fdb.expired(entry, now) {
+			break
+		}
+		delete(fdb.entries, entry.key())
+		fdb.lru.Remove(element)
+		aged++
+	}
+	return aged
+}
+
+// RunAging ages the database every agingTick until ctx is done.
+func (fdb *FDB) RunAging(ctx context.Context) {
+	ticker := time.NewTicker(agingTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			fdb.age(now)
+		}
+	}
+}
+
+func (fdb *FDB) SetAgingTime(agingTime time.Duration) {
+	fdb.mutex.Lock()
+	fdb.agingTime = agingTime
+	fdb.mutex.Unlock()
+}
+
+func (fdb *FDB) AgingTime() time.Duration {
+	fdb.mutex.Lock()
+	defer fdb.mutex.Unlock()
+	return fdb.agingTime
+}
+
+func (fdb *FDB) Len() int {
+	fdb.mutex.Lock()
+	defer fdb.mutex.Unlock()
+	return fdb.lru.Len()
+}
+
+// Entries returns a copy of the database ordered by port, VLAN and address.
+func (fdb *FDB) Entries() []Entry {
+	fdb.mutex.Lock()
+	entries := make([]Entry, 0, fdb.lru.Len())
+	for element := fdb.lru.Front(); element != nil; element = element.Next() {
+		entries = append(entries, *element.Value.(*Entry))
+	}
+	fdb.mutex.Unlock()
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		if a.Port != b.Port {
+			return a.Port - b.Port
+		}
+		if a.VLAN != b.VLAN {
+			return int(a.VLAN) - int(b.VLAN)
+		}
+		return slices.Compare(a.MAC[:], b.MAC[:])
+	})
+	return entries
+}
@@ -0,0 +1,146 @@
+package bridge
+
+import (
+	"context"
+	"slices"
+	"tcp-ip/internal/nic"
+	"testing"
+	"time"
+)
+
+func testMAC(last byte) nic.MACAddress {
+	return nic.MACAddress{0x02, 0, 0, 0, 0, last}
+}
+
+func TestLearn(t *testing.T) {
+	fdb := NewFDB(DefaultFDBCapacity, DefaultAgingTime)
+	tests := []struct {
+		name     string
+		vlan     uint16
+		mac      nic.MACAddress
+		port     int
+		previous int
+		moved    bool
+	}{
+		{"new address", 1, testMAC(1), 1, 0, false},
+		{"same port", 1, testMAC(1), 1, 1, false},
+		{"moved", 1, testMAC(1), 2, 1, true},
+		{"other vlan", 2, testMAC(1), 3, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous, moved := fdb.Learn(test.vlan, test.mac, test.port)
+			if previous != test.previous || moved != test.moved {
+				t.Errorf("Learn = %d, %t, want %d, %t", previous, moved, test.previous, test.moved)
+			}
+			if port, ok := fdb.Lookup(test.vlan, test.mac); !ok || port != test.port {
+				t.Errorf("Lookup = %d, %t, want %d", port, ok, test.port)
+			}
+		})
+	}
+	// every VLAN learns on its own
+	if port, _ := fdb.Lookup(1, testMAC(1)); port != 2 {
+		t.Errorf("vlan 1 entry on port %d, want 2", port)
+	}
+	if _, ok := fdb.Lookup(3, testMAC(1)); ok {
+		t.Errorf("found an address in a vlan that never saw it")
+	}
+}
+
+func TestLookupExpired(t *testing.T) {
+	fdb := NewFDB(DefaultFDBCapacity, time.Millisecond)
+	fdb.Learn(1, testMAC(1), 1)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := fdb.Lookup(1, testMAC(1)); ok {
+		t.Errorf("found an entry older than the aging time")
+	}
+	if fdb.Len() != 0 {
+		t.Errorf("expired entry left in the database")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	fdb := NewFDB(3, DefaultAgingTime)
+	for i := range byte(3) {
+		fdb.Learn(1, testMAC(i), 1)
+	}
+	// seeing the oldest again makes the second the stalest
+	fdb.Learn(1, testMAC(0), 1)
+	fdb.Learn(1, testMAC(3), 1)
+
+	if fdb.Len() != 3 {
+		t.Fatalf("%d entries, want the capacity of 3", fdb.Len())
+	}
+	for i, want := range []bool{true, false, true, true} {
+		if _, ok := fdb.Lookup(1, testMAC(byte(i))); ok != want {
+			t.Errorf("address %d present %t, want %t", i, ok, want)
+		}
+	}
+}
+
+func TestAge(t *testing.T) {
+	fdb := NewFDB(DefaultFDBCapacity, time.Minute)
+	for i := range byte(4) {
+		fdb.Learn(1, testMAC(i), 1)
+	}
+	fdb.Learn(1, testMAC(1), 2)
+	start := time.Now()
+
+	if aged := fdb.age(start); aged != 0 {
+		t.Errorf("aged %d fresh entries", aged)
+	}
+	if aged := fdb.age(start.Add(2 * time.Minute)); aged != 4 {
+		t.Errorf("aged %d entries, want 4", aged)
+	}
+	if fdb.Len() != 0 {
+		t.Errorf("%d entries left", fdb.Len())
+	}
+}
+
+func TestFlushPort(t *testing.T) {
+	fdb := NewFDB(DefaultFDBCapacity, DefaultAgingTime)
+	fdb.Learn(1, testMAC(1), 1)
+	fdb.Learn(1, testMAC(2), 2)
+	fdb.Learn(2, testMAC(3), 1)
+
+	if flushed := fdb.FlushPort(1); flushed != 2 {
+		t.Errorf("flushed %d entries, want 2", flushed)
+	}
+	entries := fdb.Entries()
+	if len(entries) != 1 || entries[0].MAC != testMAC(2) {
+		t.Errorf("entries %v, want only the one on port 2", entries)
+	}
+}
+
+func TestEntriesOrder(t *testing.T) {
+	fdb := NewFDB(DefaultFDBCapacity, DefaultAgingTime)
+	fdb.Learn(2, testMAC(1), 2)
+	fdb.Learn(1, testMAC(2), 1)
+	fdb.Learn(2, testMAC(3), 1)
+	fdb.Learn(1, testMAC(1), 1)
+
+	var got []nic.MACAddress
+	for _, entry := range fdb.Entries() {
+		got = append(got, entry.MAC)
+	}
+	want := []nic.MACAddress{testMAC(1), testMAC(2), testMAC(3), testMAC(1)}
+	if !slices.Equal(got, want) {
+		t.Errorf("entries %v, want %v", got, want)
+	}
+}
+
+func TestRunAgingStops(t *testing.T) {
+	fdb := NewFDB(DefaultFDBCapacity, DefaultAgingTime)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		fdb.RunAging(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunAging did not return after the context was canceled")
+	}
+}
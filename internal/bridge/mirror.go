@@ -0,0 +1,252 @@
+package bridge
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+type MirrorDirection int
+
+const (
+	MirrorIngress MirrorDirection = 1 << iota
+	MirrorEgress
+	MirrorBoth = MirrorIngress | MirrorEgress
+)
+
+func (direction MirrorDirection) String() string {
+	switch direction {
+	case MirrorIngress:
+		return "rx"
+	case MirrorEgress:
+		return "tx"
+	case MirrorBoth:
+		return "both"
+	default:
+		return fmt.Sprintf("MirrorDirection(%d)", int(direction))
+	}
+}
+
+// FrameWriter takes the copies of a mirror. Links are frame writers, and so
+// are capture interfaces.
+type FrameWriter interface {
+	WriteFrame(frame []byte) error
+}
+
+var ErrNoMonitor = fmt.Errorf("the monitor port is not plugged in")
+
+// noMonitor marks a mirror that writes to a FrameWriter instead of a port.
+const noMonitor = -1
+
+// Mirror copies the frames crossing the source ports, as they arrived or
+// as they left, to a monitor port or to a FrameWriter. A zero VLAN or
+// EtherType lets frames of any VLAN or EtherType through.
+type Mirror struct {
+	Ports     []int
+	Direction MirrorDirection
+	VLAN      uint16
+	EtherType uint16
+	// Monitor is the port the copies leave through. The monitor port takes
+	// no part in forwarding and drops the frames it receives.
+	Monitor int
+	Writer  FrameWriter
+
+	mirrored atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+// NewPortMirror mirrors ports to the monitor port.
+func NewPortMirror(ports []int, direction MirrorDirection, monitor int) *Mirror {
+	return &Mirror{Ports: slices.Clone(ports), Direction: direction, Monitor: monitor}
+}
+
+// NewWriterMirror mirrors ports to writer.
+func NewWriterMirror(ports []int, direction MirrorDirection, writer FrameWriter) *Mirror {
+	return &Mirror{Ports: slices.Clone(ports), Direction: direction, Monitor: noMonitor, Writer: writer}
+}
+
+// Stats returns the number of frames copied and of copies that could not be
+// written.
+func (mirror *Mirror) Stats() (mirrored, dropped uint64) {
+	return mirror.mirrored.Load(), mirror.dropped.Load()
+}
+
+func (mirror *Mirror) String() string {
+	destination := "writer"
+	if mirror.Monitor != noMonitor {
+		destination = fmt.Sprintf("port %d", mirror.Monitor)
+	}
+	text := fmt.Sprintf("mirror %s of ports %v to %s", mirror.Direction, mirror.Ports, destination)
+	if mirror.VLAN != 0 {
+		text += fmt.Sprintf(" in vlan %d", mirror.VLAN)
+	}
+	if mirror.EtherType != 0 {
+		text += fmt.Sprintf(" of ethertype %#04x", mirror.EtherType)
+	}
+	return text
+}
+
+func (mirror *Mirror) matches(number int, direction MirrorDirection, vlan uint16, etherType uint16) bool {
+	return mirror.Direction&direction != 0 &&
+		number != mirror.Monitor &&
+		slices.Contains(mirror.Ports, number) &&
+		(mirror.VLAN == 0 || mirror.VLAN == vlan) &&
+		(mirror.EtherType == 0 || mirror.EtherType == etherType)
+}
+
+// MirrorSpec is a mirror as given on the command line, before its
+// destination is opened.
+type MirrorSpec struct {
+	Ports     []int
+	Direction MirrorDirection
+	VLAN      uint16
+	EtherType uint16
+	// either Monitor is a port number or File is the path of a pcap file
+	Monitor int
+	File    string
+}
+
+// ParseMirror parses a mirror given as
+// ports=n/n/...,to=port:n|file:path[,dir=rx|tx|both][,vlan=vid][,ethertype=type].
+// The direction defaults to both.
+func ParseMirror(spec string) (MirrorSpec, error) {
+	mirror := MirrorSpec{Direction: MirrorBoth, Monitor: noMonitor}
+	for _, field := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "ports":
+			for _, number := range strings.Split(value, "/") {
+				port, err := strconv.Atoi(number)
+				if err != nil || port < 0 {
+					return MirrorSpec{}, fmt.Errorf("invalid port number %q", number)
+				}
+				mirror.Ports = append(mirror.Ports, port)
+			}
+		case "to":
+			kind, target, _ := strings.Cut(value, ":")
+			switch kind {
+			case "port":
+				port, err := strconv.Atoi(target)
+				if err != nil || port < 0 {
+					return MirrorSpec{}, fmt.Errorf("invalid monitor port %q", target)
+				}
+				mirror.Monitor = port
+			case "file":
+				if target == "" {
+					return MirrorSpec{}, fmt.Errorf("invalid mirror %q: missing file name", spec)
+				}
+				mirror.File = target
+			default:
+				return MirrorSpec{}, fmt.Errorf("invalid mirror destination %q: expected port:n or file:path", value)
+			}
+		case "dir":
+			switch value {
+			case "rx":
+				mirror.Direction = MirrorIngress
+			case "tx":
+				mirror.Direction = MirrorEgress
+			case "both":
+				mirror.Direction = MirrorBoth
+			default:
+				return MirrorSpec{}, fmt.Errorf("invalid mirror direction %q", value)
+			}
+		case "vlan":
+			vid, err := parseVID(value, false)
+			if err != nil {
+				return MirrorSpec{}, err
+			}
+			mirror.VLAN = vid
+		case "ethertype":
+			etherType, err := strconv.ParseUint(value, 0, 16)
+			if err != nil {
+				return MirrorSpec{}, fmt.Errorf("invalid ethertype %q", value)
+			}
+			mirror.EtherType = uint16(etherType)
+		default:
+			return MirrorSpec{}, fmt.Errorf("invalid mirror setting %q", field)
+		}
+	}
+	if len(mirror.Ports) == 0 || (mirror.Monitor == noMonitor) == (mirror.File == "") {
+		return MirrorSpec{}, fmt.Errorf("invalid mirror %q: expected ports and one destination", spec)
+	}
+	if slices.Contains(mirror.Ports, mirror.Monitor) {
+		return MirrorSpec{}, fmt.Errorf("invalid mirror %q: port %d cannot monitor itself", spec, mirror.Monitor)
+	}
+	return mirror, nil
+}
+
+// AddMirror starts copying frames as mirror says.
+func (bridge *Bridge) AddMirror(mirror *Mirror) {
+	bridge.mutex.Lock()
+	defer bridge.mutex.Unlock()
+	var mirrors []*Mirror
+	if current := bridge.mirrors.Load(); current != nil {
+		mirrors = slices.Clone(*current)
+	}
+	mirrors = append(mirrors, mirror)
+	bridge.mirrors.Store(&mirrors)
+}
+
+// RemoveMirror stops mirror.
+func (bridge *Bridge) RemoveMirror(mirror *Mirror) {
+	bridge.mutex.Lock()
+	defer bridge.mutex.Unlock()
+	current := bridge.mirrors.Load()
+	if current == nil {
+		return
+	}
+	mirrors := slices.DeleteFunc(slices.Clone(*current), func(other *Mirror) bool {
+		return other == mirror
+	})
+	bridge.mirrors.Store(&mirrors)
+}
+
+func (bridge *Bridge) Mirrors() []*Mirror {
+	current := bridge.mirrors.Load()
+	if current == nil {
+		return nil
+	}
+	return slices.Clone(*current)
+}
+
+func (bridge *Bridge) isMonitor(number int) bool {
+	current := bridge.mirrors.Load()
+	if current == nil {
+		return false
+	}
+	for _, mirror := range *current {
+		if mirror.Monitor == number {
+			return true
+		}
+	}
+	return false
+}
+
+// mirror copies data, crossing port number in direction, to the mirrors
+// that want it.
+func (bridge *Bridge) mirror(number int, direction MirrorDirection, vlan uint16, etherType uint16, data []byte) {
+	current := bridge.mirrors.Load()
+	if current == nil {
+		return
+	}
+	for _, mirror := range *current {
+		if !mirror.matches(number, direction, vlan, etherType) {
+			continue
+		}
+		var err error
+		if mirror.Monitor == noMonitor {
+			err = mirror.Writer.WriteFrame(data)
+		} else if monitor := bridge.port(mirror.Monitor); monitor != nil {
+			err = monitor.write(data)
+		} else {
+			err = ErrNoMonitor
+		}
+		if err != nil {
+			mirror.dropped.Add(1)
+			continue
+		}
+		mirror.mirrored.Add(1)
+	}
+}
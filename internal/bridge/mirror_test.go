@@ -0,0 +1,152 @@
+package bridge
+
+import (
+	"bytes"
+	"slices"
+	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/nic"
+	"testing"
+)
+
+func TestParseMirror(t *testing.T) {
+	tests := []struct {
+		spec   string
+		mirror MirrorSpec
+		valid  bool
+	}{
+		{"ports=1/2,to=port:3", MirrorSpec{Ports: []int{1, 2}, Direction: MirrorBoth, Monitor: 3}, true},
+		{"ports=1,to=file:mirror.pcap,dir=rx", MirrorSpec{Ports: []int{1}, Direction: MirrorIngress, Monitor: noMonitor, File: "mirror.pcap"}, true},
+		{"dir=tx,ports=0,to=port:1", MirrorSpec{Ports: []int{0}, Direction: MirrorEgress, Monitor: 1}, true},
+		{"ports=1,to=port:2,dir=both,vlan=20", MirrorSpec{Ports: []int{1}, Direction: MirrorBoth, VLAN: 20, Monitor: 2}, true},
+		{"ports=1,to=port:2,ethertype=0x0806", MirrorSpec{Ports: []int{1}, Direction: MirrorBoth, EtherType: ethernet.ARPEtherType, Monitor: 2}, true},
+		{"ports=1,to=port:2,ethertype=2048", MirrorSpec{Ports: []int{1}, Direction: MirrorBoth, EtherType: ethernet.IPv4EtherType, Monitor: 2}, true},
+		{"to=port:2", MirrorSpec{}, false},
+		{"ports=1", MirrorSpec{}, false},
+		{"ports=1,to=port:2,to=file:mirror.pcap", MirrorSpec{}, false},
+		{"ports=1/x,to=port:2", MirrorSpec{}, false},
+		{"ports=-1,to=port:2", MirrorSpec{}, false},
+		{"ports=1,to=port:-2", MirrorSpec{}, false},
+		{"ports=1,to=file:", MirrorSpec{}, false},
+		{"ports=1,to=link:2", MirrorSpec{}, false},
+		{"ports=1/2,to=port:2", MirrorSpec{}, false},
+		{"ports=1,to=port:2,dir=up", MirrorSpec{}, false},
+		{"ports=1,to=port:2,vlan=0", MirrorSpec{}, false},
+		{"ports=1,to=port:2,vlan=4095", MirrorSpec{}, false},
+		{"ports=1,to=port:2,ethertype=0x10000", MirrorSpec{}, false},
+		{"ports=1,to=port:2,speed=10", MirrorSpec{}, false},
+	}
+	for _, test := range tests {
+		mirror, err := ParseMirror(test.spec)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseMirror(%q) error %v, want valid %t", test.spec, err, test.valid)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		if !slices.Equal(mirror.Ports, test.mirror.Ports) || mirror.Direction != test.mirror.Direction ||
+			mirror.VLAN != test.mirror.VLAN || mirror.EtherType != test.mirror.EtherType ||
+			mirror.Monitor != test.mirror.Monitor || mirror.File != test.mirror.File {
+			t.Errorf("ParseMirror(%q) = %+v, want %+v", test.spec, mirror, test.mirror)
+		}
+	}
+}
+
+// vlanFrame is a frame from host src to dst, tagged with vid unless it is
+// zero.
+func vlanFrame(t *testing.T, src, dst nic.MACAddress, etherType uint16, vid uint16) []byte {
+	t.Helper()
+	frame, err := ethernet.NewFrame(src, dst, etherType, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vid != 0 {
+		frame.Tags = []ethernet.Tag{{TPID: ethernet.TPID8021Q, VID: vid}}
+	}
+	return frame.Serialize()
+}
+
+func (recorder *recorder) written() [][]byte {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	return slices.Clone(recorder.frames)
+}
+
+func TestMirror(t *testing.T) {
+	bridge := NewBridge(NewFDB(DefaultFDBCapacity, DefaultAgingTime))
+	trunk := VLANConfig{Mode: ModeTrunk, PVID: 1}
+	var wires []*recorder
+	for number := range 4 {
+		if number < 3 {
+			bridge.SetPortVLAN(number, trunk)
+		}
+		wire := newRecorder()
+		bridge.AddPort(wire)
+		wires = append(wires, wire)
+	}
+	monitor := NewPortMirror([]int{0}, MirrorBoth, 3)
+	rx := NewWriterMirror([]int{0}, MirrorIngress, newRecorder())
+	tx := NewWriterMirror([]int{0}, MirrorEgress, newRecorder())
+	vlan := NewWriterMirror([]int{0}, MirrorBoth, newRecorder())
+	vlan.VLAN = 20
+	arp := NewWriterMirror([]int{0}, MirrorBoth, newRecorder())
+	arp.EtherType = ethernet.ARPEtherType
+	unplugged := NewPortMirror([]int{1}, MirrorIngress, 7)
+	for _, mirror := range []*Mirror{monitor, rx, tx, vlan, arp, unplugged} {
+		bridge.AddMirror(mirror)
+	}
+
+	broadcast := nic.MACAddress{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	// the host behind port n has address testMAC(n + 1)
+	fromPort0 := vlanFrame(t, testMAC(1), broadcast, ethernet.IPv4EtherType, 0)
+	bridge.receive(bridge.port(0), fromPort0)
+	bridge.receive(bridge.port(1), vlanFrame(t, testMAC(2), broadcast, ethernet.ARPEtherType, 20))
+	bridge.receive(bridge.port(2), vlanFrame(t, testMAC(3), testMAC(1), ethernet.IPv4EtherType, 0))
+	// the monitor port neither forwards what it receives nor is flooded to
+	bridge.receive(bridge.port(3), vlanFrame(t, testMAC(4), broadcast, ethernet.IPv4EtherType, 0))
+
+	tests := []struct {
+		name     string
+		mirror   *Mirror
+		mirrored uint64
+		dropped  uint64
+	}{
+		{"monitor port", monitor, 3, 0},
+		{"ingress", rx, 1, 0},
+		{"egress", tx, 2, 0},
+		{"vlan", vlan, 1, 0},
+		{"ethertype", arp, 1, 0},
+		{"monitor unplugged", unplugged, 0, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mirrored, dropped := test.mirror.Stats()
+			if mirrored != test.mirrored || dropped != test.dropped {
+				t.Errorf("Stats() = %d, %d, want %d, %d", mirrored, dropped, test.mirrored, test.dropped)
+			}
+			if test.mirror.Writer != nil {
+				if got := len(test.mirror.Writer.(*recorder).written()); uint64(got) != test.mirrored {
+					t.Errorf("writer took %d frames, want %d", got, test.mirrored)
+				}
+			}
+		})
+	}
+
+	copies := wires[3].written()
+	if len(copies) != 3 {
+		t.Fatalf("monitor port sent %d frames, want the 3 mirrored", len(copies))
+	}
+	if !bytes.Equal(copies[0], fromPort0) {
+		t.Errorf("ingress copy differs from the frame received")
+	}
+	if stats := bridge.port(3).Stats(); stats.Filtered != 1 || stats.TxFrames != 0 {
+		t.Errorf("monitor port Stats() = %+v, want 1 filtered and none sent", stats)
+	}
+	for number, wire := range wires[:3] {
+		for _, frame := range wire.written() {
+			if parsed, err := ethernet.Deserialize(frame); err == nil && nic.MACAddress(parsed.SrcMAC) == testMAC(4) {
+				t.Errorf("port %d forwarded a frame received on the monitor port", number)
+			}
+		}
+	}
+}
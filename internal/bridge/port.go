@@ -0,0 +1,159 @@
+package bridge
+
+import (
+	"fmt"
+	"sync/atomic"
+	"tcp-ip/internal/capture"
+	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/link"
+)
+
+// PortStats counts the frames through a port. Received frames are split by
+// destination kind, and Flooded counts unknown unicast sent out of the port
+// because the bridge had not learned where the destination was. Filtered
+// counts frames the port did not accept or had no need to forward.
+type PortStats struct {
+	RxFrames    uint64
+	RxUnicast   uint64
+	RxMulticast uint64
+	RxBroadcast uint64
+	TxFrames    uint64
+	TxUnicast   uint64
+	TxMulticast uint64
+	TxBroadcast uint64
+	Flooded     uint64
+	Filtered    uint64
+	RxErrors    uint64
+	TxErrors    uint64
+}
+
+type portCounters struct {
+	rxFrames    atomic.Uint64
+	rxUnicast   atomic.Uint64
+	rxMulticast atomic.Uint64
+	rxBroadcast atomic.Uint64
+	txFrames    atomic.Uint64
+	txUnicast   atomic.Uint64
+	txMulticast atomic.Uint64
+	txBroadcast atomic.Uint64
+	flooded     atomic.Uint64
+	filtered    atomic.Uint64
+	rxErrors    atomic.Uint64
+	txErrors    atomic.Uint64
+}
+
+// Port is a numbered port of a bridge with the link plugged into it.
+type Port struct {
+	number int
+	link   link.Link
+	bridge *Bridge
+	vlan   atomic.Pointer[VLANConfig]
+	// state is the PortState the spanning tree gave the port
+	state atomic.Int32
+	// capture records the frames through the port, when capturing
+	capture  *capture.Interface
+	counters portCounters
+}
+
+func (port *Port) Number() int {
+	return port.number
+}
+
+func (port *Port) String() string {
+	return fmt.Sprintf("port %d (%v)", port.number, port.link)
+}
+
+func (port *Port) VLAN() VLANConfig {
+	return *port.vlan.Load()
+}
+
+func (port *Port) State() PortState {
+	return PortState(port.state.Load())
+}
+
+func (port *Port) Role() PortRole {
+	if port.bridge.stp == nil {
+		return RoleDesignated
+	}
+	return port.bridge.stp.role(port)
+}
+
+func (port *Port) Stats() PortStats {
+	counters := &port.counters
+	return PortStats{
+		RxFrames:    counters.rxFrames.Load(),
+		RxUnicast:   counters.rxUnicast.Load(),
+		RxMulticast: counters.rxMulticast.Load(),
+		RxBroadcast: counters.rxBroadcast.Load(),
+		TxFrames:    counters.txFrames.Load(),
+		TxUnicast:   counters.txUnicast.Load(),
+		TxMulticast: counters.txMulticast.Load(),
+		TxBroadcast: counters.txBroadcast.Load(),
+		Flooded:     counters.flooded.Load(),
+		Filtered:    counters.filtered.Load(),
+		RxErrors:    counters.rxErrors.Load(),
+		TxErrors:    counters.txErrors.Load(),
+	}
+}
+
+func (port *Port) countRx(kind destinationKind) {
+	port.counters.rxFrames.Add(1)
+	switch kind {
+	case unicast:
+		port.counters.rxUnicast.Add(1)
+	case multicast:
+		port.counters.rxMulticast.Add(1)
+	case broadcast:
+		port.counters.rxBroadcast.Add(1)
+	}
+}
+
+// write sends data out of the port, capturing it on the way.
+func (port *Port) write(data []byte) error {
+	if port.capture != nil {
+		_ = port.capture.WriteFrame(data)
+	}
+	return port.link.WriteFrame(data)
+}
+
+// transmit sends frame out of the port if it belongs to vlan, tagging it
+// the way the port carries that VLAN.
+func (port *Port) transmit(frame ethernet.Frame, kind destinationKind, vlan uint16, priority uint8) {
+	config := port.vlan.Load()
+	if !config.member(vlan) || port.State() != StateForwarding {
+		return
+	}
+	frame = config.tag(frame, vlan, priority)
+	data := frame.Serialize()
+	err := port.write(data)
+	if err != nil {
+		port.counters.txErrors.Add(1)
+		return
+	}
+	port.bridge.mirror(port.number, MirrorEgress, vlan, frame.EtherType, data)
+	port.counters.txFrames.Add(1)
+	switch kind {
+	case unicast:
+		port.counters.txUnicast.Add(1)
+	case multicast:
+		port.counters.txMulticast.Add(1)
+	case broadcast:
+		port.counters.txBroadcast.Add(1)
+	}
+}
+
+// Serve reads frames from the link into the bridge until the link fails,
+// then removes the port.
+func (port *Port) Serve() error {
+	defer port.bridge.RemovePort(port)
+	for {
+		frame, err := port.link.ReadFrame()
+		if err != nil {
+			return err
+		}
+		if port.capture != nil {
+			_ = port.capture.WriteFrame(frame)
+		}
+		port.bridge.receive(port, frame)
+	}
+}
@@ -0,0 +1,799 @@
+package bridge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/nic"
+	"time"
+)
+
+type STPVersion int
+
+const (
+	STPOff STPVersion = iota
+	// STPLegacy is the original 802.1D spanning tree, which moves ports to
+	// forwarding only after listening and learning for a forward delay each
+	STPLegacy
+	// RSTP is the rapid spanning tree of 802.1D-2004, which brings ports to
+	// forwarding through a proposal and agreement handshake
+	RSTP
+)
+
+func ParseSTPVersion(value string) (STPVersion, error) {
+	switch value {
+	case "off":
+		return STPOff, nil
+	case "stp":
+		return STPLegacy, nil
+	case "rstp":
+		return RSTP, nil
+	default:
+		return STPOff, fmt.Errorf("unknown spanning tree version %q", value)
+	}
+}
+
+type PortState int32
+
+const (
+	StateForwarding PortState = iota
+	StateLearning
+	StateListening
+	StateBlocking
+	StateDiscarding
+)
+
+func (state PortState) String() string {
+	switch state {
+	case StateForwarding:
+		return "forwarding"
+	case StateLearning:
+		return "learning"
+	case StateListening:
+		return "listening"
+	case StateBlocking:
+		return "blocking"
+	default:
+		return "discarding"
+	}
+}
+
+type PortRole int
+
+const (
+	RoleDisabled PortRole = iota
+	RoleRoot
+	RoleDesignated
+	RoleAlternate
+	RoleBackup
+)
+
+func (role PortRole) String() string {
+	switch role {
+	case RoleRoot:
+		return "root"
+	case RoleDesignated:
+		return "designated"
+	case RoleAlternate:
+		return "alternate"
+	case RoleBackup:
+		return "backup"
+	default:
+		return "disabled"
+	}
+}
+
+func (role PortRole) bpduRole() uint8 {
+	switch role {
+	case RoleRoot:
+		return bpduRoleRoot
+	case RoleDesignated:
+		return bpduRoleDesig
+	case RoleAlternate, RoleBackup:
+		return bpduRoleAltBack
+	default:
+		return bpduRoleUnknown
+	}
+}
+
+const (
+	DefaultBridgePriority = 32768
+	DefaultPortPriority   = 128
+	// DefaultPathCost is the 802.1D-2004 cost of a 1 Gb/s link
+	DefaultPathCost     = 20000
+	DefaultHelloTime    = 2 * time.Second
+	DefaultMaxAge       = 20 * time.Second
+	DefaultForwardDelay = 15 * time.Second
+
+	stpTick = 100 * time.Millisecond
+	// messageAgeIncrement is how much older the root information gets at
+	// every bridge it crosses
+	messageAgeIncrement = time.Second
+	// migrateTime without a BPDU makes a designated port an edge port
+	migrateTime = 3 * time.Second
+)
+
+type STPConfig struct {
+	Version      STPVersion
+	Priority     uint16
+	HelloTime    time.Duration
+	MaxAge       time.Duration
+	ForwardDelay time.Duration
+}
+
+func (config STPConfig) withDefaults() STPConfig {
+	if config.Priority == 0 {
+		config.Priority = DefaultBridgePriority
+	}
+	if config.HelloTime == 0 {
+		config.HelloTime = DefaultHelloTime
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = DefaultMaxAge
+	}
+	if config.ForwardDelay == 0 {
+		config.ForwardDelay = DefaultForwardDelay
+	}
+	return config
+}
+
+// PortSTPConfig tunes a port for the spanning tree. Edge ports lead to
+// hosts only and forward right away, until a BPDU proves otherwise.
+type PortSTPConfig struct {
+	Priority uint8
+	PathCost uint32
+	Edge     bool
+}
+
+// ParsePortSTP parses the spanning tree settings of a port given as
+// number[,cost=n][,priority=n][,edge].
+func ParsePortSTP(spec string) (int, PortSTPConfig, error) {
+	fields := strings.Split(spec, ",")
+	port, err := strconv.Atoi(fields[0])
+	if err != nil || port < 0 {
+		return 0, PortSTPConfig{}, fmt.Errorf("invalid port number %q", fields[0])
+	}
+	var config PortSTPConfig
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "edge":
+			config.Edge = true
+		case "cost":
+			cost, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || cost == 0 {
+				return 0, PortSTPConfig{}, fmt.Errorf("invalid path cost %q", value)
+			}
+			config.PathCost = uint32(cost)
+		case "priority":
+			priority, err := strconv.ParseUint(value, 10, 8)
+			if err != nil || priority%16 != 0 {
+				return 0, PortSTPConfig{}, fmt.Errorf("invalid port priority %q: expected a multiple of 16 up to 240", value)
+			}
+			config.Priority = uint8(priority)
+		default:
+			return 0, PortSTPConfig{}, fmt.Errorf("invalid port setting %q", field)
+		}
+	}
+	return port, config, nil
+}
+
+type portInfo struct {
+	vector  priorityVector
+	times   times
+	expires time.Time
+}
+
+type portSTP struct {
+	config PortSTPConfig
+	id     uint16
+	role   PortRole
+	// info is the best information received from the designated bridge of
+	// the port's LAN, unless this bridge is the designated one
+	info *portInfo
+	edge bool
+	// since is when the port came up and lastBPDU when it last heard from
+	// another bridge
+	since    time.Time
+	lastBPDU time.Time
+	// fdWhile is when the port moves on to the next state
+	fdWhile   time.Time
+	proposing bool
+	agreed    bool
+	// tcWhile is until when the port sends topology changes
+	tcWhile time.Time
+	// legacyPeer is set on RSTP bridges talking to an 802.1D bridge
+	legacyPeer bool
+	tcAck      bool
+}
+
+type outgoing struct {
+	port *Port
+	data []byte
+}
+
+// stp runs the spanning tree for a bridge. Every port keeps the role and
+// state it was last given, and BPDUs are queued while the mutex is held and
+// written after it is released.
+type stp struct {
+	bridge      *Bridge
+	config      STPConfig
+	id          BridgeID
+	mac         nic.MACAddress
+	ports       map[*Port]*portSTP
+	portConfigs map[int]PortSTPConfig
+
+	rootVector priorityVector
+	rootPort   *Port
+	rootTimes  times
+	// rootTC is the topology change flag of the root, as heard on the root
+	// port by an 802.1D bridge
+	rootTC bool
+	// tcWhile is until when an 802.1D root flags topology changes and
+	// tcnPending whether a non root one still has to report one
+	tcWhile    time.Time
+	tcnPending bool
+	agingTime  time.Duration
+	lastHello  time.Time
+
+	out   []outgoing
+	mutex *sync.Mutex
+}
+
+func newSTP(bridge *Bridge, config STPConfig, mac nic.MACAddress) *stp {
+	config = config.withDefaults()
+	id := BridgeID{Priority: config.Priority, MAC: mac}
+	return &stp{
+		bridge:      bridge,
+		config:      config,
+		id:          id,
+		mac:         mac,
+		ports:       make(map[*Port]*portSTP),
+		portConfigs: make(map[int]PortSTPConfig),
+		rootVector:  priorityVector{rootID: id, designatedBridge: id},
+		rootTimes:   config.ownTimes(),
+		agingTime:   bridge.fdb.AgingTime(),
+		mutex:       new(sync.Mutex),
+	}
+}
+
+func (config STPConfig) ownTimes() times {
+	return times{maxAge: config.MaxAge, helloTime: config.HelloTime, forwardDelay: config.ForwardDelay}
+}
+
+func (stp *stp) rapid() bool {
+	return stp.config.Version == RSTP
+}
+
+func (stp *stp) discarding() PortState {
+	if stp.rapid() {
+		return StateDiscarding
+	}
+	return StateBlocking
+}
+
+// unlock releases the mutex and sends the BPDUs queued while it was held.
+func (stp *stp) unlock() {
+	out := stp.out
+	stp.out = nil
+	stp.mutex.Unlock()
+	for _, message := range out {
+		_ = message.port.write(message.data)
+	}
+}
+
+func (stp *stp) portConfig(number int) PortSTPConfig {
+	config := stp.portConfigs[number]
+	if config.Priority == 0 {
+		config.Priority = DefaultPortPriority
+	}
+	if config.PathCost == 0 {
+		config.PathCost = DefaultPathCost
+	}
+	return config
+}
+
+// portID puts the priority in the upper 4 bits and the port number, which
+// 802.1D counts from 1, in the rest.
+func portID(priority uint8, number int) uint16 {
+	return uint16(priority&0xF0)<<8 | uint16(number+1)&0x0FFF
+}
+
+func (stp *stp) setPortConfig(number int, config PortSTPConfig) {
+	stp.mutex.Lock()
+	defer stp.unlock()
+	stp.portConfigs[number] = config
+	for port, state := range stp.ports {
+		if port.number == number {
+			state.config = stp.portConfig(number)
+			state.id = portID(state.config.Priority, number)
+			state.edge = state.config.Edge
+			stp.reselect(time.Now())
+		}
+	}
+}
+
+func (stp *stp) addPort(port *Port) {
+	stp.mutex.Lock()
+	defer stp.unlock()
+	now := time.Now()
+	config := stp.portConfig(port.number)
+	state := &portSTP{
+		config: config,
+		id:     portID(config.Priority, port.number),
+		edge:   config.Edge,
+		since:  now,
+	}
+	stp.ports[port] = state
+	stp.reselect(now)
+}
+
+func (stp *stp) removePort(port *Port) {
+	stp.mutex.Lock()
+	defer stp.unlock()
+	delete(stp.ports, port)
+	stp.reselect(time.Now())
+}
+
+// reselect computes the root path and the role of every port from the
+// information received, as the port role selection of 802.1D-2004 17.21.25.
+func (stp *stp) reselect(now time.Time) {
+	best := priorityVector{rootID: stp.id, designatedBridge: stp.id}
+	var rootPort *Port
+	var rootPortID uint16
+	for port, state := range stp.ports {
+		if state.info == nil || state.info.vector.designatedBridge == stp.id {
+			continue
+		}
+		candidate := state.info.vector
+		candidate.rootPathCost += state.config.PathCost
+		c := candidate.compare(best)
+		if c < 0 || (c == 0 && rootPort != nil && state.id < rootPortID) {
+			best, rootPort, rootPortID = candidate, port, state.id
+		}
+	}
+
+	changed := best != stp.rootVector || rootPort != stp.rootPort
+	stp.rootVector = best
+	stp.rootPort = rootPort
+	if rootPort != nil {
+		stp.rootTimes = stp.ports[rootPort].info.times
+	} else {
+		stp.rootTimes = stp.config.ownTimes()
+		stp.rootTC = false
+	}
+
+	for port, state := range stp.ports {
+		designated := stp.designatedVector(state)
+		role := RoleDesignated
+		switch {
+		case port == rootPort:
+			role = RoleRoot
+		case state.info == nil:
+		case state.info.vector.compare(designated) < 0:
+			role = RoleAlternate
+			if state.info.vector.designatedBridge == stp.id {
+				role = RoleBackup
+			}
+		default:
+			// the information is worse than what this bridge offers, so it
+			// takes over as the designated bridge of the LAN
+			state.info = nil
+		}
+		stp.setRole(port, state, role, now)
+	}
+
+	if changed {
+		for port, state := range stp.ports {
+			if state.role == RoleDesignated {
+				stp.transmit(port, state, now)
+			}
+		}
+	}
+}
+
+func (stp *stp) designatedVector(state *portSTP) priorityVector {
+	return priorityVector{
+		rootID:           stp.rootVector.rootID,
+		rootPathCost:     stp.rootVector.rootPathCost,
+		designatedBridge: stp.id,
+		designatedPort:   state.id,
+	}
+}
+
+func (stp *stp) setRole(port *Port, state *portSTP, role PortRole, now time.Time) {
+	if state.role == role {
+		return
+	}
+	state.role = role
+	state.agreed = false
+	switch role {
+	case RoleRoot:
+		state.proposing = false
+		if stp.rapid() {
+			// an alternate port has a loop free path to the root, so it
+			// takes over right away
+			stp.setState(port, state, StateForwarding, now)
+		} else if PortState(port.state.Load()) == StateBlocking {
+			stp.setState(port, state, StateListening, now)
+			state.fdWhile = now.Add(stp.rootTimes.forwardDelay)
+		}
+	case RoleDesignated:
+		if state.edge {
+			stp.setState(port, state, StateForwarding, now)
+			break
+		}
+		if PortState(port.state.Load()) == StateForwarding {
+			break
+		}
+		if stp.rapid() {
+			stp.setState(port, state, StateDiscarding, now)
+			state.proposing = true
+		} else {
+			stp.setState(port, state, StateListening, now)
+		}
+		state.fdWhile = now.Add(stp.rootTimes.forwardDelay)
+		stp.transmit(port, state, now)
+	default:
+		state.proposing = false
+		state.fdWhile = time.Time{}
+		stp.setState(port, state, stp.discarding(), now)
+	}
+}
+
+func (stp *stp) setState(port *Port, state *portSTP, next PortState, now time.Time) {
+	previous := PortState(port.state.Swap(int32(next)))
+	if previous == next {
+		return
+	}
+	if next != StateForwarding {
+		// a port that stops forwarding must not leave stale addresses
+		stp.bridge.fdb.FlushPort(port.number)
+		return
+	}
+	state.fdWhile = time.Time{}
+	state.proposing = false
+	if !state.edge {
+		stp.topologyChange(port, now)
+	}
+}
+
+// topologyChange reacts to port starting to forward, which may move
+// stations to other ports.
+func (stp *stp) topologyChange(detected *Port, now time.Time) {
+	if !stp.rapid() {
+		if stp.rootPort == nil {
+			stp.tcWhile = now.Add(stp.rootTimes.maxAge + stp.rootTimes.forwardDelay)
+			return
+		}
+		stp.tcnPending = true
+		stp.transmitTCN(now)
+		return
+	}
+	for port, state := range stp.ports {
+		if state.edge || (state.role != RoleRoot && state.role != RoleDesignated) {
+			continue
+		}
+		if port != detected {
+			stp.bridge.fdb.FlushPort(port.number)
+		}
+		state.tcWhile = now.Add(2 * stp.rootTimes.helloTime)
+		stp.transmit(port, state, now)
+	}
+}
+
+// propagateTC handles a topology change received on ingress, flushing the
+// addresses behind every other port and passing it on. Ports that are
+// already passing one on keep their timer, so changes do not circle.
+func (stp *stp) propagateTC(ingress *Port, now time.Time) {
+	for port, state := range stp.ports {
+		if port == ingress || state.edge {
+			continue
+		}
+		stp.bridge.fdb.FlushPort(port.number)
+		if (state.role == RoleRoot || state.role == RoleDesignated) && !now.Before(state.tcWhile) {
+			state.tcWhile = now.Add(2 * stp.rootTimes.helloTime)
+			stp.transmit(port, state, now)
+		}
+	}
+}
+
+func (stp *stp) receive(port *Port, data []byte) {
+	message, err := parseBPDU(data)
+	if err != nil {
+		port.counters.rxErrors.Add(1)
+		return
+	}
+	stp.mutex.Lock()
+	defer stp.unlock()
+	state, ok := stp.ports[port]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	state.lastBPDU = now
+	if state.edge {
+		// another bridge is on the LAN after all
+		state.edge = false
+	}
+	if stp.rapid() {
+		state.legacyPeer = message.kind != bpduTypeRST
+	}
+
+	if message.kind == bpduTypeTCN {
+		if state.role == RoleDesignated {
+			state.tcAck = true
+			stp.transmit(port, state, now)
+			stp.topologyChange(port, now)
+		}
+		return
+	}
+
+	role := uint8(bpduRoleDesig)
+	if message.kind == bpduTypeRST {
+		role = message.role()
+	}
+	if role == bpduRoleDesig {
+		stp.receiveDesignated(port, state, message, now)
+	} else if message.flags&flagAgreement != 0 && state.role == RoleDesignated && state.proposing {
+		stp.setState(port, state, StateForwarding, now)
+	}
+
+	if message.kind == bpduTypeRST && message.flags&flagTC != 0 {
+		stp.propagateTC(port, now)
+	}
+	if message.kind == bpduTypeConfig && port == stp.rootPort {
+		if message.flags&flagTCAck != 0 {
+			stp.tcnPending = false
+		}
+		stp.rootTC = message.flags&flagTC != 0
+		stp.updateAging()
+	}
+}
+
+// receiveDesignated handles the BPDU of a bridge claiming to be designated
+// for the LAN of port.
+func (stp *stp) receiveDesignated(port *Port, state *portSTP, message *bpdu, now time.Time) {
+	sameSender := state.info != nil &&
+		state.info.vector.designatedBridge == message.vector.designatedBridge &&
+		state.info.vector.designatedPort == message.vector.designatedPort
+	superior := message.vector.compare(stp.designatedVector(state)) < 0
+	if !sameSender && !superior {
+		// an inferior bridge thinks it is designated, so it is told better
+		if state.role == RoleDesignated {
+			stp.transmit(port, state, now)
+		}
+		return
+	}
+	if message.times.messageAge >= message.times.maxAge {
+		return
+	}
+
+	expires := now.Add(message.times.maxAge - message.times.messageAge)
+	if message.kind == bpduTypeRST {
+		expires = now.Add(3 * message.times.helloTime)
+	}
+	state.info = &portInfo{vector: message.vector, times: message.times, expires: expires}
+	stp.reselect(now)
+
+	if message.flags&flagProposal == 0 || !stp.rapid() {
+		return
+	}
+	switch state.role {
+	case RoleRoot:
+		stp.agree(port, state, now)
+	case RoleAlternate, RoleBackup:
+		// a discarding port cannot close a loop, so it agrees at once
+		state.agreed = true
+		stp.transmit(port, state, now)
+	}
+}
+
+// agree answers a proposal on the root port. Every other designated port
+// first stops forwarding, so the new root port cannot close a loop, and
+// then proposes to the bridges below.
+func (stp *stp) agree(root *Port, rootState *portSTP, now time.Time) {
+	for port, state := range stp.ports {
+		if port == root || state.edge || state.role != RoleDesignated {
+			continue
+		}
+		if PortState(port.state.Load()) != StateDiscarding {
+			stp.setState(port, state, StateDiscarding, now)
+			state.fdWhile = now.Add(stp.rootTimes.forwardDelay)
+		}
+		state.proposing = true
+		stp.transmit(port, state, now)
+	}
+	rootState.agreed = true
+	stp.setState(root, rootState, StateForwarding, now)
+	stp.transmit(root, rootState, now)
+}
+
+// updateAging switches an 802.1D bridge to the forward delay as aging time
+// while the root reports a topology change, the legacy way to forget
+// stations that moved.
+func (stp *stp) updateAging() {
+	if stp.rapid() {
+		return
+	}
+	changing := stp.rootTC || (stp.rootPort == nil && !stp.tcWhile.IsZero())
+	if changing {
+		stp.bridge.fdb.SetAgingTime(min(stp.rootTimes.forwardDelay, stp.agingTime))
+	} else {
+		stp.bridge.fdb.SetAgingTime(stp.agingTime)
+	}
+}
+
+func (stp *stp) messageFor(port *Port, state *portSTP, now time.Time) *bpdu {
+	times := stp.rootTimes
+	if stp.rootPort != nil {
+		times.messageAge += messageAgeIncrement
+	}
+	message := &bpdu{vector: stp.designatedVector(state), times: times}
+
+	if stp.rapid() && !state.legacyPeer {
+		message.version = bpduVersionRSTP
+		message.kind = bpduTypeRST
+		message.flags = state.role.bpduRole() << flagRoleShift
+		switch PortState(port.state.Load()) {
+		case StateForwarding:
+			message.flags |= flagLearning | flagForwarding
+		case StateLearning:
+			message.flags |= flagLearning
+		}
+		if state.proposing && state.role == RoleDesignated {
+			message.flags |= flagProposal
+		}
+		if state.agreed && state.role != RoleDesignated {
+			message.flags |= flagAgreement
+		}
+		if now.Before(state.tcWhile) {
+			message.flags |= flagTC
+		}
+		return message
+	}
+
+	message.version = bpduVersionSTP
+	message.kind = bpduTypeConfig
+	if stp.rootTC || now.Before(stp.tcWhile) || now.Before(state.tcWhile) {
+		message.flags |= flagTC
+	}
+	if state.tcAck {
+		message.flags |= flagTCAck
+		state.tcAck = false
+	}
+	return message
+}
+
+func (stp *stp) frame(message *bpdu) []byte {
+	payload := append(append([]byte(nil), llcHeader...), message.serialize()...)
+	frame, err := ethernet.NewFrame(stp.mac, BridgeGroupAddress, uint16(len(payload)), payload)
+	if err != nil {
+		return nil
+	}
+	return frame.Serialize()
+}
+
+// transmit queues a BPDU on port. 802.1D bridges only speak on designated
+// ports, while RSTP also sends agreements and topology changes from the
+// others.
+func (stp *stp) transmit(port *Port, state *portSTP, now time.Time) {
+	switch state.role {
+	case RoleDesignated:
+	case RoleRoot:
+		if !stp.rapid() || state.legacyPeer {
+			return
+		}
+	case RoleAlternate, RoleBackup:
+		if !stp.rapid() || state.legacyPeer || !state.agreed {
+			return
+		}
+	default:
+		return
+	}
+	stp.out = append(stp.out, outgoing{port: port, data: stp.frame(stp.messageFor(port, state, now))})
+}
+
+func (stp *stp) transmitTCN(now time.Time) {
+	if stp.rootPort == nil {
+		return
+	}
+	message := &bpdu{version: bpduVersionSTP, kind: bpduTypeTCN}
+	stp.out = append(stp.out, outgoing{port: stp.rootPort, data: stp.frame(message)})
+}
+
+func (stp *stp) tick(now time.Time) {
+	stp.mutex.Lock()
+	defer stp.unlock()
+
+	expired := false
+	for _, state := range stp.ports {
+		if state.info != nil && !now.Before(state.info.expires) {
+			state.info = nil
+			expired = true
+		}
+	}
+	if expired {
+		stp.reselect(now)
+	}
+
+	for port, state := range stp.ports {
+		if stp.rapid() && !state.edge && state.role == RoleDesignated &&
+			state.lastBPDU.IsZero() && now.Sub(state.since) >= migrateTime {
+			// nothing but hosts behind the port
+			state.edge = true
+			stp.setState(port, state, StateForwarding, now)
+		}
+		if state.fdWhile.IsZero() || now.Before(state.fdWhile) {
+			continue
+		}
+		switch PortState(port.state.Load()) {
+		case StateListening, StateDiscarding:
+			stp.setState(port, state, StateLearning, now)
+			state.fdWhile = now.Add(stp.rootTimes.forwardDelay)
+		case StateLearning:
+			stp.setState(port, state, StateForwarding, now)
+		}
+	}
+
+	if !stp.tcWhile.IsZero() && !now.Before(stp.tcWhile) {
+		stp.tcWhile = time.Time{}
+	}
+	stp.updateAging()
+
+	if now.Sub(stp.lastHello) >= stp.config.HelloTime {
+		stp.lastHello = now
+		for port, state := range stp.ports {
+			if state.role == RoleDesignated {
+				stp.transmit(port, state, now)
+			}
+		}
+		if stp.tcnPending {
+			stp.transmitTCN(now)
+		}
+	}
+}
+
+func (stp *stp) run() {
+	ticker := time.NewTicker(stpTick)
+	for now := range ticker.C {
+		stp.tick(now)
+	}
+}
+
+// STPStatus describes the spanning tree as this bridge sees it.
+type STPStatus struct {
+	BridgeID     BridgeID
+	RootID       BridgeID
+	RootPathCost uint32
+	// RootPort is -1 on the root bridge
+	RootPort int
+}
+
+func (status STPStatus) String() string {
+	if status.RootPort < 0 {
+		return fmt.Sprintf("bridge %v is the root", status.BridgeID)
+	}
+	return fmt.Sprintf("bridge %v, root %v at cost %d through port %d", status.BridgeID, status.RootID, status.RootPathCost, status.RootPort)
+}
+
+func (stp *stp) status() STPStatus {
+	stp.mutex.Lock()
+	defer stp.mutex.Unlock()
+	status := STPStatus{BridgeID: stp.id, RootID: stp.rootVector.rootID, RootPathCost: stp.rootVector.rootPathCost, RootPort: -1}
+	if stp.rootPort != nil {
+		status.RootPort = stp.rootPort.number
+	}
+	return status
+}
+
+func (stp *stp) role(port *Port) PortRole {
+	stp.mutex.Lock()
+	defer stp.mutex.Unlock()
+	if state, ok := stp.ports[port]; ok {
+		return state.role
+	}
+	return RoleDisabled
+}
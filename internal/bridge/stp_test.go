@@ -0,0 +1,335 @@
+package bridge
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/link"
+	"tcp-ip/internal/nic"
+	"testing"
+	"time"
+)
+
+// recorder is a link that keeps the frames written to it.
+type recorder struct {
+	frames [][]byte
+	mutex  *sync.Mutex
+	closed chan struct{}
+	once   *sync.Once
+}
+
+func newRecorder() *recorder {
+	return &recorder{mutex: new(sync.Mutex), closed: make(chan struct{}), once: new(sync.Once)}
+}
+
+func (recorder *recorder) ReadFrame() ([]byte, error) {
+	<-recorder.closed
+	return nil, io.EOF
+}
+
+func (recorder *recorder) WriteFrame(frame []byte) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.frames = append(recorder.frames, frame)
+	return nil
+}
+
+func (recorder *recorder) Close() error {
+	recorder.once.Do(func() { close(recorder.closed) })
+	return nil
+}
+
+// bpdus returns the BPDUs written since the last call.
+func (recorder *recorder) bpdus(t *testing.T) []*bpdu {
+	t.Helper()
+	recorder.mutex.Lock()
+	frames := recorder.frames
+	recorder.frames = nil
+	recorder.mutex.Unlock()
+
+	var messages []*bpdu
+	for _, data := range frames {
+		frame, err := ethernet.Deserialize(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.DstMAC != BridgeGroupAddress || !bytes.HasPrefix(frame.Data, llcHeader) {
+			t.Fatalf("frame to %x is not a BPDU", frame.DstMAC)
+		}
+		message, err := parseBPDU(frame.Data[len(llcHeader):])
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// stpBridge is a bridge whose spanning tree only moves on the BPDUs it is
+// given, its timers never running. The ports numbered in edges lead to
+// hosts.
+func stpBridge(version STPVersion, last byte, ports int, edges ...int) (*Bridge, []*recorder) {
+	bridge := NewBridge(NewFDB(DefaultFDBCapacity, DefaultAgingTime))
+	bridge.stp = newSTP(bridge, STPConfig{Version: version}, nic.MACAddress{0x02, 0, 0, 0, 0, last})
+	for _, number := range edges {
+		bridge.SetPortSTP(number, PortSTPConfig{Edge: true})
+	}
+	var wires []*recorder
+	for range ports {
+		wire := newRecorder()
+		bridge.AddPort(wire)
+		wires = append(wires, wire)
+	}
+	return bridge, wires
+}
+
+// designated is the BPDU of bridge last, designated for its port 1 with
+// the given root and cost.
+func designated(version STPVersion, root BridgeID, cost uint32, last byte) []byte {
+	message := &bpdu{
+		vector: priorityVector{rootID: root, rootPathCost: cost, designatedBridge: testBridgeID(DefaultBridgePriority, last), designatedPort: portID(DefaultPortPriority, 1)},
+		times:  STPConfig{}.withDefaults().ownTimes(),
+	}
+	if version == RSTP {
+		message.version, message.kind, message.flags = bpduVersionRSTP, bpduTypeRST, bpduRoleDesig<<flagRoleShift
+	}
+	return message.serialize()
+}
+
+func TestRoleElection(t *testing.T) {
+	root := testBridgeID(DefaultBridgePriority, 1)
+	type received struct {
+		port int
+		data []byte
+	}
+	tests := []struct {
+		name     string
+		bpdus    []received
+		cost     map[int]uint32
+		roles    []PortRole
+		rootPort int
+		rootCost uint32
+	}{
+		{
+			name:     "alone",
+			roles:    []PortRole{RoleDesignated, RoleDesignated, RoleDesignated},
+			rootPort: -1,
+		},
+		{
+			name:     "better root",
+			bpdus:    []received{{0, designated(STPLegacy, root, 0, 1)}},
+			roles:    []PortRole{RoleRoot, RoleDesignated, RoleDesignated},
+			rootPort: 0,
+			rootCost: DefaultPathCost,
+		},
+		{
+			name:     "worse root",
+			bpdus:    []received{{0, designated(STPLegacy, testBridgeID(DefaultBridgePriority, 9), 0, 9)}},
+			roles:    []PortRole{RoleDesignated, RoleDesignated, RoleDesignated},
+			rootPort: -1,
+		},
+		{
+			name: "cheapest path",
+			bpdus: []received{
+				{0, designated(STPLegacy, root, 20000, 2)},
+				{1, designated(STPLegacy, root, 0, 1)},
+			},
+			roles:    []PortRole{RoleAlternate, RoleRoot, RoleDesignated},
+			rootPort: 1,
+			rootCost: DefaultPathCost,
+		},
+		{
+			name: "port path cost",
+			bpdus: []received{
+				{0, designated(STPLegacy, root, 0, 1)},
+				{1, designated(STPLegacy, root, 0, 3)},
+			},
+			cost:     map[int]uint32{0: 100000},
+			roles:    []PortRole{RoleAlternate, RoleRoot, RoleDesignated},
+			rootPort: 1,
+			rootCost: DefaultPathCost,
+		},
+		{
+			name: "lowest designated bridge on a tie",
+			bpdus: []received{
+				{0, designated(STPLegacy, root, 20000, 4)},
+				{1, designated(STPLegacy, root, 20000, 3)},
+			},
+			roles:    []PortRole{RoleAlternate, RoleRoot, RoleDesignated},
+			rootPort: 1,
+			rootCost: 2 * DefaultPathCost,
+		},
+		{
+			name: "designated over a worse bridge",
+			bpdus: []received{
+				{0, designated(STPLegacy, root, 0, 1)},
+				{1, designated(STPLegacy, root, 20000, 9)},
+			},
+			roles:    []PortRole{RoleRoot, RoleDesignated, RoleDesignated},
+			rootPort: 0,
+			rootCost: DefaultPathCost,
+		},
+		{
+			name: "alternate to a better bridge",
+			bpdus: []received{
+				{0, designated(STPLegacy, root, 0, 1)},
+				{1, designated(STPLegacy, root, 20000, 2)},
+			},
+			roles:    []PortRole{RoleRoot, RoleAlternate, RoleDesignated},
+			rootPort: 0,
+			rootCost: DefaultPathCost,
+		},
+		{
+			name: "backup on a shared LAN",
+			bpdus: []received{
+				{1, (&bpdu{kind: bpduTypeConfig, vector: priorityVector{
+					rootID:           testBridgeID(DefaultBridgePriority, 5),
+					designatedBridge: testBridgeID(DefaultBridgePriority, 5),
+					designatedPort:   portID(DefaultPortPriority, 0),
+				}, times: STPConfig{}.withDefaults().ownTimes()}).serialize()},
+			},
+			roles:    []PortRole{RoleDesignated, RoleBackup, RoleDesignated},
+			rootPort: -1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bridge, _ := stpBridge(STPLegacy, 5, 3)
+			for number, cost := range test.cost {
+				bridge.SetPortSTP(number, PortSTPConfig{PathCost: cost})
+			}
+			for _, message := range test.bpdus {
+				bridge.stp.receive(bridge.port(message.port), message.data)
+			}
+			for i, port := range bridge.Ports() {
+				if role := port.Role(); role != test.roles[i] {
+					t.Errorf("port %d is %v, want %v", i, role, test.roles[i])
+				}
+			}
+			status, _ := bridge.STPStatus()
+			if status.RootPort != test.rootPort || status.RootPathCost != test.rootCost {
+				t.Errorf("status %v, want root port %d at cost %d", status, test.rootPort, test.rootCost)
+			}
+		})
+	}
+}
+
+func TestLegacyRootPortListens(t *testing.T) {
+	bridge, _ := stpBridge(STPLegacy, 5, 2)
+	bridge.stp.receive(bridge.port(0), designated(STPLegacy, testBridgeID(DefaultBridgePriority, 1), 0, 1))
+	if state := bridge.port(0).State(); state != StateListening {
+		t.Errorf("802.1D root port %v, want listening for a forward delay", state)
+	}
+}
+
+func TestProposalAgreement(t *testing.T) {
+	bridge, wires := stpBridge(RSTP, 5, 3, 2)
+	for _, wire := range wires {
+		wire.bpdus(t)
+	}
+
+	proposal := designated(RSTP, testBridgeID(DefaultBridgePriority, 1), 0, 1)
+	proposal[4] |= flagProposal
+	bridge.stp.receive(bridge.port(0), proposal)
+
+	// the root port agrees and forwards at once
+	if state := bridge.port(0).State(); state != StateForwarding {
+		t.Errorf("root port %v, want forwarding", state)
+	}
+	agreed := false
+	for _, message := range wires[0].bpdus(t) {
+		agreed = agreed || (message.flags&flagAgreement != 0 && message.role() == bpduRoleRoot)
+	}
+	if !agreed {
+		t.Errorf("no agreement sent on the root port")
+	}
+
+	// the other designated ports were synced and propose downstream
+	if state := bridge.port(1).State(); state != StateDiscarding {
+		t.Errorf("designated port %v, want discarding until it agrees", state)
+	}
+	proposed := false
+	for _, message := range wires[1].bpdus(t) {
+		proposed = proposed || (message.flags&flagProposal != 0 && message.role() == bpduRoleDesig)
+	}
+	if !proposed {
+		t.Errorf("no proposal sent on the designated port")
+	}
+
+	// edge ports are not synced
+	if state := bridge.port(2).State(); state != StateForwarding {
+		t.Errorf("edge port %v, want forwarding", state)
+	}
+}
+
+// TestTriangle elects the tree of three bridges wired in a ring: the one
+// with the lowest address becomes the root and the ring is broken at the
+// port of the highest bridge facing the middle one.
+func TestTriangle(t *testing.T) {
+	versions := []struct {
+		name    string
+		version STPVersion
+	}{
+		{"stp", STPLegacy},
+		{"rstp", RSTP},
+	}
+	for _, test := range versions {
+		t.Run(test.name, func(t *testing.T) {
+			config := STPConfig{Version: test.version, HelloTime: 100 * time.Millisecond, MaxAge: 6 * time.Second, ForwardDelay: 200 * time.Millisecond}
+			var bridges []*Bridge
+			for i := range byte(3) {
+				bridge := NewBridge(NewFDB(DefaultFDBCapacity, DefaultAgingTime))
+				bridge.EnableSTP(config, nic.MACAddress{0x02, 0, 0, 0, 0, i + 1})
+				bridges = append(bridges, bridge)
+			}
+			var wires []*link.PipeLink
+			for _, pair := range [][2]int{{0, 1}, {1, 2}, {2, 0}} {
+				a, b := link.Pipe()
+				wires = append(wires, a, b)
+				go bridges[pair[0]].AddPort(a).Serve()
+				go bridges[pair[1]].AddPort(b).Serve()
+			}
+			defer func() {
+				for _, wire := range wires {
+					wire.Close()
+				}
+			}()
+
+			// bridge 0 has ports 0 to 1 and 1 to 2, bridge 1 ports 0 to 0
+			// and 1 to 2, bridge 2 ports 0 to 1 and 1 to 0
+			want := [][]PortRole{
+				{RoleDesignated, RoleDesignated},
+				{RoleRoot, RoleDesignated},
+				{RoleAlternate, RoleRoot},
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				converged := true
+				for i, bridge := range bridges {
+					for j, port := range bridge.Ports() {
+						forwarding := want[i][j] != RoleAlternate
+						if port.Role() != want[i][j] || (port.State() == StateForwarding) != forwarding {
+							converged = false
+						}
+					}
+				}
+				if converged {
+					break
+				}
+				if time.Now().After(deadline) {
+					for i, bridge := range bridges {
+						for _, port := range bridge.Ports() {
+							t.Logf("bridge %d port %d: %v %v", i, port.Number(), port.Role(), port.State())
+						}
+					}
+					t.Fatal("the spanning tree did not converge")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if status, _ := bridges[2].STPStatus(); status.RootID != bridges[0].stp.id || status.RootPathCost != DefaultPathCost {
+				t.Errorf("bridge 2 status %v", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package bridge
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"tcp-ip/internal/ethernet"
+)
+
+// DefaultVLAN is the access VLAN of ports that were not configured.
+const DefaultVLAN = 1
+
+type PortMode int
+
+const (
+	ModeAccess PortMode = iota
+	ModeTrunk
+)
+
+// VLANConfig decides which VLANs a port belongs to and how their frames
+// look on its wire.
+type VLANConfig struct {
+	Mode PortMode
+	// PVID is the VLAN of untagged frames, the access VLAN or the native
+	// VLAN of a trunk. A trunk without one drops untagged frames.
+	PVID uint16
+	// Allowed lists the VLANs a trunk carries tagged, all when empty
+	Allowed []uint16
+	// TPID is the tag the port recognizes and pushes, 802.1Q when zero.
+	// With 802.1ad an access port tunnels the customer tags it receives.
+	TPID uint16
+}
+
+func (config VLANConfig) tpid() uint16 {
+	if config.TPID == 0 {
+		return ethernet.TPID8021Q
+	}
+	return config.TPID
+}
+
+func (config VLANConfig) member(vlan uint16) bool {
+	if vlan == config.PVID {
+		return true
+	}
+	return config.Mode == ModeTrunk && (len(config.Allowed) == 0 || slices.Contains(config.Allowed, vlan))
+}
+
+// classify finds the VLAN of a frame received on the port and strips the
+// tag that carried it, returning its priority. Frames the port does not
+// accept are reported as not ok.
+func (config VLANConfig) classify(frame *ethernet.Frame) (uint16, uint8, bool) {
+	vlan, priority := config.PVID, uint8(0)
+	if len(frame.Tags) > 0 && frame.Tags[0].TPID == config.tpid() {
+		tag := frame.Tags[0]
+		frame.Tags = frame.Tags[1:]
+		priority = tag.PCP
+		if tag.VID != 0 {
+			if config.Mode == ModeAccess {
+				return 0, 0, false
+			}
+			vlan = tag.VID
+		}
+	}
+	if vlan == 0 || !config.member(vlan) {
+		return 0, 0, false
+	}
+	return vlan, priority, true
+}
+
+// tag returns the frame as the port sends it for vlan, tagged unless vlan
+// is the one of untagged frames.
+func (config VLANConfig) tag(frame ethernet.Frame, vlan uint16, priority uint8) ethernet.Frame {
+	if vlan == config.PVID {
+		return frame
+	}
+	tag := ethernet.Tag{TPID: config.tpid(), PCP: priority, VID: vlan}
+	frame.Tags = append([]ethernet.Tag{tag}, frame.Tags...)
+	return frame
+}
+
+func (config VLANConfig) String() string {
+	tpid := ""
+	if config.tpid() == ethernet.TPID8021AD {
+		tpid = " 802.1ad"
+	}
+	if config.Mode == ModeAccess {
+		return fmt.Sprintf("access vlan %d%s", config.PVID, tpid)
+	}
+	allowed := "all"
+	if len(config.Allowed) > 0 {
+		vlans := make([]string, len(config.Allowed))
+		for i, vlan := range config.Allowed {
+			vlans[i] = strconv.Itoa(int(vlan))
+		}
+		allowed = strings.Join(vlans, ",")
+	}
+	return fmt.Sprintf("trunk native %d allowed %s%s", config.PVID, allowed, tpid)
+}
+
+func parseVID(value string, allowZero bool) (uint16, error) {
+	vid, err := strconv.Atoi(value)
+	if err != nil || vid > ethernet.MaxVID || vid < 0 || (vid == 0 && !allowZero) {
+		return 0, fmt.Errorf("invalid VLAN ID %q", value)
+	}
+	return uint16(vid), nil
+}
+
+// ParsePortVLAN parses a port configuration in the number,access,vid or
+// number,trunk,native,vid/vid/... format, where native may be 0 and the
+// list "all". A trailing ",qinq" makes the port use 802.1ad tags.
+func ParsePortVLAN(spec string) (int, VLANConfig, error) {
+	fields := strings.Split(spec, ",")
+	var config VLANConfig
+	if len(fields) > 0 && fields[len(fields)-1] == "qinq" {
+		config.TPID = ethernet.TPID8021AD
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) < 3 {
+		return 0, VLANConfig{}, fmt.Errorf("invalid port %q: expected number,access,vid or number,trunk,native,vids", spec)
+	}
+	port, err := strconv.Atoi(fields[0])
+	if err != nil || port < 0 {
+		return 0, VLANConfig{}, fmt.Errorf("invalid port number %q", fields[0])
+	}
+
+	switch fields[1] {
+	case "access":
+		if len(fields) != 3 {
+			return 0, VLANConfig{}, fmt.Errorf("invalid port %q: expected number,access,vid", spec)
+		}
+		config.Mode = ModeAccess
+		config.PVID, err = parseVID(fields[2], false)
+	case "trunk":
+		if len(fields) != 4 {
+			return 0, VLANConfig{}, fmt.Errorf("invalid port %q: expected number,trunk,native,vids", spec)
+		}
+		config.Mode = ModeTrunk
+		config.PVID, err = parseVID(fields[2], true)
+		if err != nil || fields[3] == "all" {
+			break
+		}
+		for _, value := range strings.Split(fields[3], "/") {
+			var vid uint16
+			vid, err = parseVID(value, false)
+			if err != nil {
+				break
+			}
+			config.Allowed = append(config.Allowed, vid)
+		}
+	default:
+		return 0, VLANConfig{}, fmt.Errorf("invalid port mode %q", fields[1])
+	}
+	if err != nil {
+		return 0, VLANConfig{}, err
+	}
+	return port, config, nil
+}
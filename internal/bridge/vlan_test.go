@@ -0,0 +1,117 @@
+package bridge
+
+import (
+	"slices"
+	"tcp-ip/internal/ethernet"
+	"testing"
+)
+
+func tagged(tags ...ethernet.Tag) *ethernet.Frame {
+	return &ethernet.Frame{Tags: tags, EtherType: ethernet.IPv4EtherType}
+}
+
+func TestClassify(t *testing.T) {
+	access := VLANConfig{Mode: ModeAccess, PVID: 10}
+	trunk := VLANConfig{Mode: ModeTrunk, PVID: 1, Allowed: []uint16{10, 20}}
+	nativeless := VLANConfig{Mode: ModeTrunk}
+	tunnel := VLANConfig{Mode: ModeAccess, PVID: 100, TPID: ethernet.TPID8021AD}
+	customer := ethernet.Tag{TPID: ethernet.TPID8021Q, PCP: 3, VID: 20}
+	service := ethernet.Tag{TPID: ethernet.TPID8021AD, PCP: 5, VID: 100}
+
+	tests := []struct {
+		name     string
+		config   VLANConfig
+		frame    *ethernet.Frame
+		vlan     uint16
+		priority uint8
+		ok       bool
+		// tags left on the frame
+		tags []ethernet.Tag
+	}{
+		{"access untagged", access, tagged(), 10, 0, true, nil},
+		{"access priority tagged", access, tagged(ethernet.Tag{TPID: ethernet.TPID8021Q, PCP: 4}), 10, 4, true, nil},
+		{"access tagged", access, tagged(customer), 0, 0, false, nil},
+		{"trunk native", trunk, tagged(), 1, 0, true, nil},
+		{"trunk allowed", trunk, tagged(customer), 20, 3, true, nil},
+		{"trunk not allowed", trunk, tagged(ethernet.Tag{TPID: ethernet.TPID8021Q, VID: 30}), 0, 0, false, nil},
+		{"trunk all allowed", VLANConfig{Mode: ModeTrunk, PVID: 1}, tagged(ethernet.Tag{TPID: ethernet.TPID8021Q, VID: 30}), 30, 0, true, nil},
+		{"trunk without native", nativeless, tagged(), 0, 0, false, nil},
+		{"trunk priority tagged without native", nativeless, tagged(ethernet.Tag{TPID: ethernet.TPID8021Q}), 0, 0, false, nil},
+		{"tunnel keeps the customer tag", tunnel, tagged(customer), 100, 0, true, []ethernet.Tag{customer}},
+		{"qinq trunk strips the service tag", VLANConfig{Mode: ModeTrunk, TPID: ethernet.TPID8021AD}, tagged(service, customer), 100, 5, true, []ethernet.Tag{customer}},
+		{"service tag on an 802.1Q trunk", trunk, tagged(service), 1, 0, true, []ethernet.Tag{service}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vlan, priority, ok := test.config.classify(test.frame)
+			if vlan != test.vlan || priority != test.priority || ok != test.ok {
+				t.Fatalf("classify = %d, %d, %t, want %d, %d, %t", vlan, priority, ok, test.vlan, test.priority, test.ok)
+			}
+			if ok && !slices.Equal(test.frame.Tags, test.tags) {
+				t.Errorf("tags left %v, want %v", test.frame.Tags, test.tags)
+			}
+		})
+	}
+}
+
+func TestTag(t *testing.T) {
+	customer := ethernet.Tag{TPID: ethernet.TPID8021Q, VID: 20}
+	tests := []struct {
+		name   string
+		config VLANConfig
+		tags   []ethernet.Tag
+		vlan   uint16
+		want   []ethernet.Tag
+	}{
+		{"access", VLANConfig{Mode: ModeAccess, PVID: 10}, nil, 10, nil},
+		{"trunk native", VLANConfig{Mode: ModeTrunk, PVID: 1}, nil, 1, nil},
+		{"trunk", VLANConfig{Mode: ModeTrunk, PVID: 1}, nil, 20, []ethernet.Tag{{TPID: ethernet.TPID8021Q, PCP: 6, VID: 20}}},
+		{"tunnel", VLANConfig{Mode: ModeAccess, PVID: 100, TPID: ethernet.TPID8021AD}, []ethernet.Tag{customer}, 100, []ethernet.Tag{customer}},
+		{"qinq trunk", VLANConfig{Mode: ModeTrunk, TPID: ethernet.TPID8021AD}, []ethernet.Tag{customer}, 100,
+			[]ethernet.Tag{{TPID: ethernet.TPID8021AD, PCP: 6, VID: 100}, customer}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frame := ethernet.Frame{Tags: test.tags, EtherType: ethernet.IPv4EtherType}
+			got := test.config.tag(frame, test.vlan, 6)
+			if !slices.Equal(got.Tags, test.want) {
+				t.Errorf("tags %v, want %v", got.Tags, test.want)
+			}
+			if !slices.Equal(frame.Tags, test.tags) {
+				t.Errorf("tag changed the original frame's tags to %v", frame.Tags)
+			}
+		})
+	}
+}
+
+func TestParsePortVLAN(t *testing.T) {
+	tests := []struct {
+		spec   string
+		port   int
+		config VLANConfig
+		valid  bool
+	}{
+		{"1,access,10", 1, VLANConfig{Mode: ModeAccess, PVID: 10}, true},
+		{"2,trunk,1,10/20", 2, VLANConfig{Mode: ModeTrunk, PVID: 1, Allowed: []uint16{10, 20}}, true},
+		{"3,trunk,0,all", 3, VLANConfig{Mode: ModeTrunk}, true},
+		{"4,access,100,qinq", 4, VLANConfig{Mode: ModeAccess, PVID: 100, TPID: ethernet.TPID8021AD}, true},
+		{"1,access,0", 0, VLANConfig{}, false},
+		{"1,access,4095", 0, VLANConfig{}, false},
+		{"1,access,10,20", 0, VLANConfig{}, false},
+		{"1,trunk,1,10/0", 0, VLANConfig{}, false},
+		{"1,trunk,1", 0, VLANConfig{}, false},
+		{"1,hybrid,1", 0, VLANConfig{}, false},
+		{"-1,access,1", 0, VLANConfig{}, false},
+	}
+	for _, test := range tests {
+		port, config, err := ParsePortVLAN(test.spec)
+		if (err == nil) != test.valid {
+			t.Errorf("ParsePortVLAN(%q) error %v, want valid %t", test.spec, err, test.valid)
+			continue
+		}
+		if port != test.port || config.Mode != test.config.Mode || config.PVID != test.config.PVID ||
+			config.TPID != test.config.TPID || !slices.Equal(config.Allowed, test.config.Allowed) {
+			t.Errorf("ParsePortVLAN(%q) = %d, %+v, want %d, %+v", test.spec, port, config, test.port, test.config)
+		}
+	}
+}
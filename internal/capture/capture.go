@@ -0,0 +1,70 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// LinkTypeEthernet is the libpcap link type of frames that start with
+	// the Ethernet header
+	LinkTypeEthernet = 1
+	SnapLength       = 65535
+	// fcsLength is the size of the FCS ending the frames of the links
+	fcsLength = 4
+)
+
+// Writer records the frames seen on a set of interfaces.
+type Writer interface {
+	// AddInterface describes a new interface and returns the ID to write
+	// its packets with.
+	AddInterface(name string) (int, error)
+	WritePacket(iface int, timestamp time.Time, frame []byte) error
+	Close() error
+}
+
+// Create opens a capture file at path, in pcapng format when it ends in
+// .pcapng and in libpcap format otherwise.
+func Create(path string) (Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	var writer Writer
+	if filepath.Ext(path) == ".pcapng" {
+		writer, err = NewPcapngWriter(file)
+	} else {
+		writer, err = NewPcapWriter(file)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("could not write capture header: %w", err)
+	}
+	return writer, nil
+}
+
+// Interface captures the frames of one interface of a Writer.
+type Interface struct {
+	writer Writer
+	id     int
+	name   string
+}
+
+func NewInterface(writer Writer, name string) (*Interface, error) {
+	id, err := writer.AddInterface(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Interface{writer: writer, id: id, name: name}, nil
+}
+
+// WriteFrame records frame as captured now.
+func (iface *Interface) WriteFrame(frame []byte) error {
+	return iface.writer.WritePacket(iface.id, time.Now(), frame)
+}
+
+func (iface *Interface) String() string {
+	return iface.name
+}
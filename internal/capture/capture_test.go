@@ -0,0 +1,77 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name  string
+		magic []byte
+	}{
+		{"capture.pcap", []byte{0x4d, 0x3c, 0xb2, 0xa1}},
+		{"capture.cap", []byte{0x4d, 0x3c, 0xb2, 0xa1}},
+		{"capture.pcapng", []byte{0x0a, 0x0d, 0x0d, 0x0a}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.name)
+			writer, err := Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			iface, err := NewInterface(writer, "port 0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := iface.WriteFrame(make([]byte, 64)); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(data, test.magic) {
+				t.Errorf("file starts with % x, want % x", data[:min(len(data), 4)], test.magic)
+			}
+		})
+	}
+}
+
+func TestCreateInvalidPath(t *testing.T) {
+	if _, err := Create(filepath.Join(t.TempDir(), "missing", "capture.pcap")); err == nil {
+		t.Errorf("created a capture in a directory that does not exist")
+	}
+}
+
+func TestInterfaceIDs(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer, err := NewPcapngWriter(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := NewInterface(writer, "port 0")
+	second, _ := NewInterface(writer, "port 1")
+	second.WriteFrame(make([]byte, 64))
+	first.WriteFrame(make([]byte, 64))
+
+	var ids []uint32
+	for _, block := range readBlocks(t, buffer.Bytes()) {
+		if block.kind == blockEnhancedPacket {
+			ids = append(ids, binary.LittleEndian.Uint32(block.body))
+		}
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 0 {
+		t.Errorf("packets on interfaces %v, want [1 0]", ids)
+	}
+	if second.String() != "port 1" {
+		t.Errorf("interface named %q", second.String())
+	}
+}
@@ -0,0 +1,73 @@
+package capture
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// pcapMagic announces nanosecond timestamps
+	pcapMagic        = 0xa1b23c4d
+	pcapVersionMajor = 2
+	pcapVersionMinor = 4
+	pcapHeaderSize   = 24
+	pcapRecordSize   = 16
+	// pcapFCSPresent flags a link type whose upper 4 bits give the length
+	// of the FCS ending every frame, in 16-bit words
+	pcapFCSPresent = 1 << 26
+	pcapFCSShift   = 28
+)
+
+// PcapWriter writes frames to a libpcap file. The format knows a single
+// interface, so the frames of every interface go to the same stream.
+// Frames are kept with their FCS, as they travel on the links, and the link
+// type says so, like the FCS length option of pcapng.
+type PcapWriter struct {
+	writer io.Writer
+	mutex  *sync.Mutex
+}
+
+// NewPcapWriter writes the file header to writer.
+func NewPcapWriter(writer io.Writer) (*PcapWriter, error) {
+	header := make([]byte, pcapHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:], pcapVersionMajor)
+	binary.LittleEndian.PutUint16(header[6:], pcapVersionMinor)
+	binary.LittleEndian.PutUint32(header[16:], SnapLength)
+	binary.LittleEndian.PutUint32(header[20:], LinkTypeEthernet|pcapFCSPresent|fcsLength/2<<pcapFCSShift)
+	_, err := writer.Write(header)
+	if err != nil {
+		return nil, err
+	}
+	return &PcapWriter{writer: writer, mutex: new(sync.Mutex)}, nil
+}
+
+func (pcap *PcapWriter) AddInterface(name string) (int, error) {
+	return 0, nil
+}
+
+func (pcap *PcapWriter) WritePacket(iface int, timestamp time.Time, frame []byte) error {
+	captured := min(len(frame), SnapLength)
+	record := make([]byte, pcapRecordSize+captured)
+	binary.LittleEndian.PutUint32(record[0:], uint32(timestamp.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(timestamp.Nanosecond()))
+	binary.LittleEndian.PutUint32(record[8:], uint32(captured))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(frame)))
+	copy(record[pcapRecordSize:], frame)
+
+	// a single write keeps records whole when several ports capture at once
+	pcap.mutex.Lock()
+	defer pcap.mutex.Unlock()
+	_, err := pcap.writer.Write(record)
+	return err
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (pcap *PcapWriter) Close() error {
+	if closer, ok := pcap.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestPcapHeader(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	if _, err := NewPcapWriter(buffer); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x4d, 0x3c, 0xb2, 0xa1, // magic, nanosecond timestamps
+		0x02, 0x00, 0x04, 0x00, // version 2.4
+		0x00, 0x00, 0x00, 0x00, // reserved
+		0x00, 0x00, 0x00, 0x00, // reserved
+		0xff, 0xff, 0x00, 0x00, // snap length
+		0x01, 0x00, 0x00, 0x24, // Ethernet, with a 4 byte FCS
+	}
+	if !bytes.Equal(buffer.Bytes(), want) {
+		t.Errorf("header\n% x, want\n% x", buffer.Bytes(), want)
+	}
+}
+
+func TestPcapRecord(t *testing.T) {
+	timestamp := time.Unix(1700000000, 123456789)
+	tests := []struct {
+		name     string
+		length   int
+		captured int
+	}{
+		{"small", 64, 64},
+		{"empty", 0, 0},
+		{"beyond the snap length", SnapLength + 10, SnapLength},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buffer := new(bytes.Buffer)
+			writer, err := NewPcapWriter(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frame := bytes.Repeat([]byte{0x5A}, test.length)
+			if err := writer.WritePacket(0, timestamp, frame); err != nil {
+				t.Fatal(err)
+			}
+
+			record := buffer.Bytes()[pcapHeaderSize:]
+			if len(record) != pcapRecordSize+test.captured {
+				t.Fatalf("record of %d bytes, want %d", len(record), pcapRecordSize+test.captured)
+			}
+			fields := []struct {
+				name  string
+				value uint32
+				want  uint32
+			}{
+				{"seconds", binary.LittleEndian.Uint32(record[0:]), 1700000000},
+				{"nanoseconds", binary.LittleEndian.Uint32(record[4:]), 123456789},
+				{"captured length", binary.LittleEndian.Uint32(record[8:]), uint32(test.captured)},
+				{"original length", binary.LittleEndian.Uint32(record[12:]), uint32(test.length)},
+			}
+			for _, field := range fields {
+				if field.value != field.want {
+					t.Errorf("%s %d, want %d", field.name, field.value, field.want)
+				}
+			}
+			if !bytes.Equal(record[pcapRecordSize:], frame[:test.captured]) {
+				t.Errorf("record data differs from the frame")
+			}
+		})
+	}
+}
+
+func TestPcapSingleInterface(t *testing.T) {
+	writer, err := NewPcapWriter(new(bytes.Buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if id, err := writer.AddInterface("port"); err != nil || id != 0 {
+			t.Errorf("AddInterface = %d, %v, want interface 0", id, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package capture
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	blockSectionHeader        = 0x0a0d0d0a
+	blockInterfaceDescription = 0x00000001
+	blockEnhancedPacket       = 0x00000006
+	byteOrderMagic            = 0x1a2b3c4d
+
+	optionEnd          = 0
+	optionName         = 2
+	optionTSResolution = 9
+	optionFCSLength    = 13
+	// nanosecondResolution is the if_tsresol value of 10^-9 seconds
+	nanosecondResolution = 9
+)
+
+// PcapngWriter writes frames to a pcapng file, in a single section with an
+// interface description block for each interface.
+type PcapngWriter struct {
+	writer     io.Writer
+	interfaces int
+	mutex      *sync.Mutex
+}
+
+// NewPcapngWriter writes the section header block to writer.
+func NewPcapngWriter(writer io.Writer) (*PcapngWriter, error) {
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(body[4:], 1)
+	binary.LittleEndian.PutUint16(body[6:], 0)
+	// the section length is not known in advance
+	binary.LittleEndian.PutUint64(body[8:], ^uint64(0))
+	_, err := writer.Write(block(blockSectionHeader, body))
+	if err != nil {
+		return nil, err
+	}
+	return &PcapngWriter{writer: writer, mutex: new(sync.Mutex)}, nil
+}
+
+// block frames body, padded to 32 bits, with the type and total lengths.
+func block(kind uint32, body []byte) []byte {
+	padded := (len(body) + 3) &^ 3
+	length := 12 + padded
+	data := make([]byte, length)
+	binary.LittleEndian.PutUint32(data[0:], kind)
+	binary.LittleEndian.PutUint32(data[4:], uint32(length))
+	copy(data[8:], body)
+	binary.LittleEndian.PutUint32(data[length-4:], uint32(length))
+	return data
+}
+
+func appendOption(options []byte, code uint16, value []byte) []byte {
+	options = binary.LittleEndian.AppendUint16(options, code)
+	options = binary.LittleEndian.AppendUint16(options, uint16(len(value)))
+	options = append(options, value...)
+	for len(options)%4 != 0 {
+		options = append(options, 0)
+	}
+	return options
+}
+
+func (pcapng *PcapngWriter) AddInterface(name string) (int, error) {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:], LinkTypeEthernet)
+	binary.LittleEndian.PutUint32(body[4:], SnapLength)
+	body = appendOption(body, optionName, []byte(name))
+	body = appendOption(body, optionTSResolution, []byte{nanosecondResolution})
+	body = appendOption(body, optionFCSLength, []byte{fcsLength})
+	body = appendOption(body, optionEnd, nil)
+
+	pcapng.mutex.Lock()
+	defer pcapng.mutex.Unlock()
+	_, err := pcapng.writer.Write(block(blockInterfaceDescription, body))
+	if err != nil {
+		return 0, err
+	}
+	pcapng.interfaces++
+	return pcapng.interfaces - 1, nil
+}
+
+func (pcapng *PcapngWriter) WritePacket(iface int, timestamp time.Time, frame []byte) error {
+	captured := min(len(frame), SnapLength)
+	nanoseconds := uint64(timestamp.UnixNano())
+	body := make([]byte, 20+captured)
+	binary.LittleEndian.PutUint32(body[0:], uint32(iface))
+	binary.LittleEndian.PutUint32(body[4:], uint32(nanoseconds>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(nanoseconds))
+	binary.LittleEndian.PutUint32(body[12:], uint32(captured))
+	binary.LittleEndian.PutUint32(body[16:], uint32(len(frame)))
+	copy(body[20:], frame)
+
+	pcapng.mutex.Lock()
+	defer pcapng.mutex.Unlock()
+	_, err := pcapng.writer.Write(block(blockEnhancedPacket, body))
+	return err
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (pcapng *PcapngWriter) Close() error {
+	if closer, ok := pcapng.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+type pcapngBlock struct {
+	kind uint32
+	body []byte
+}
+
+// readBlocks splits a pcapng stream into blocks, checking that the lengths
+// around each one agree.
+func readBlocks(t *testing.T, data []byte) []pcapngBlock {
+	t.Helper()
+	var blocks []pcapngBlock
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("%d bytes left after the last block", len(data))
+		}
+		length := int(binary.LittleEndian.Uint32(data[4:]))
+		if length%4 != 0 || length < 12 || length > len(data) {
+			t.Fatalf("block length %d", length)
+		}
+		if trailer := int(binary.LittleEndian.Uint32(data[length-4:])); trailer != length {
+			t.Fatalf("block length %d, trailing length %d", length, trailer)
+		}
+		blocks = append(blocks, pcapngBlock{kind: binary.LittleEndian.Uint32(data), body: data[8 : length-4]})
+		data = data[length:]
+	}
+	return blocks
+}
+
+// readOptions returns the value of every option up to the end option.
+func readOptions(t *testing.T, data []byte) map[uint16][]byte {
+	t.Helper()
+	options := make(map[uint16][]byte)
+	for {
+		if len(data) < 4 {
+			t.Fatalf("options end without an end option")
+		}
+		code := binary.LittleEndian.Uint16(data)
+		length := int(binary.LittleEndian.Uint16(data[2:]))
+		if code == optionEnd {
+			return options
+		}
+		padded := (length + 3) &^ 3
+		if 4+padded > len(data) {
+			t.Fatalf("option %d of %d bytes overflows the block", code, length)
+		}
+		options[code] = data[4 : 4+length]
+		data = data[4+padded:]
+	}
+}
+
+func TestPcapngSectionHeader(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	if _, err := NewPcapngWriter(buffer); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x0a, 0x0d, 0x0d, 0x0a, // block type
+		0x1c, 0x00, 0x00, 0x00, // block length
+		0x4d, 0x3c, 0x2b, 0x1a, // byte order magic
+		0x01, 0x00, 0x00, 0x00, // version 1.0
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, // unknown section length
+		0x1c, 0x00, 0x00, 0x00, // block length
+	}
+	if !bytes.Equal(buffer.Bytes(), want) {
+		t.Errorf("section header\n% x, want\n% x", buffer.Bytes(), want)
+	}
+}
+
+func TestPcapngInterfaces(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer, err := NewPcapngWriter(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"port 0", "a longer name"}
+	for i, name := range names {
+		if id, err := writer.AddInterface(name); err != nil || id != i {
+			t.Fatalf("AddInterface(%q) = %d, %v, want %d", name, id, err, i)
+		}
+	}
+
+	blocks := readBlocks(t, buffer.Bytes())
+	if len(blocks) != 1+len(names) {
+		t.Fatalf("%d blocks, want %d", len(blocks), 1+len(names))
+	}
+	for i, name := range names {
+		block := blocks[1+i]
+		if block.kind != blockInterfaceDescription {
+			t.Fatalf("block type %#x, want an interface description", block.kind)
+		}
+		if linkType := binary.LittleEndian.Uint16(block.body); linkType != LinkTypeEthernet {
+			t.Errorf("link type %d", linkType)
+		}
+		if snapLength := binary.LittleEndian.Uint32(block.body[4:]); snapLength != SnapLength {
+			t.Errorf("snap length %d", snapLength)
+		}
+		options := readOptions(t, block.body[8:])
+		if got := string(options[optionName]); got != name {
+			t.Errorf("if_name %q, want %q", got, name)
+		}
+		if got := options[optionTSResolution]; !bytes.Equal(got, []byte{nanosecondResolution}) {
+			t.Errorf("if_tsresol % x", got)
+		}
+		if got := options[optionFCSLength]; !bytes.Equal(got, []byte{fcsLength}) {
+			t.Errorf("if_fcslen % x", got)
+		}
+	}
+}
+
+func TestPcapngPacket(t *testing.T) {
+	timestamp := time.Unix(1700000000, 123456789)
+	tests := []struct {
+		name     string
+		length   int
+		captured int
+	}{
+		{"aligned", 64, 64},
+		{"padded", 61, 61},
+		{"beyond the snap length", SnapLength + 10, SnapLength},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buffer := new(bytes.Buffer)
+			writer, err := NewPcapngWriter(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writer.AddInterface("port 0")
+			writer.AddInterface("port 1")
+			frame := bytes.Repeat([]byte{0x5A}, test.length)
+			if err := writer.WritePacket(1, timestamp, frame); err != nil {
+				t.Fatal(err)
+			}
+
+			blocks := readBlocks(t, buffer.Bytes())
+			packet := blocks[len(blocks)-1]
+			if packet.kind != blockEnhancedPacket {
+				t.Fatalf("block type %#x, want an enhanced packet", packet.kind)
+			}
+			if len(packet.body) != 20+(test.captured+3)&^3 {
+				t.Fatalf("body of %d bytes for %d captured", len(packet.body), test.captured)
+			}
+			nanoseconds := uint64(binary.LittleEndian.Uint32(packet.body[4:]))<<32 | uint64(binary.LittleEndian.Uint32(packet.body[8:]))
+			fields := []struct {
+				name  string
+				value uint64
+				want  uint64
+			}{
+				{"interface", uint64(binary.LittleEndian.Uint32(packet.body[0:])), 1},
+				{"timestamp", nanoseconds, uint64(timestamp.UnixNano())},
+				{"captured length", uint64(binary.LittleEndian.Uint32(packet.body[12:])), uint64(test.captured)},
+				{"original length", uint64(binary.LittleEndian.Uint32(packet.body[16:])), uint64(test.length)},
+			}
+			for _, field := range fields {
+				if field.value != field.want {
+					t.Errorf("%s %d, want %d", field.name, field.value, field.want)
+				}
+			}
+			data := packet.body[20:]
+			if !bytes.Equal(data[:test.captured], frame[:test.captured]) {
+				t.Errorf("packet data differs from the frame")
+			}
+			if padding := data[test.captured:]; !bytes.Equal(padding, make([]byte, len(padding))) {
+				t.Errorf("padding % x, want zeros", padding)
+			}
+		})
+	}
+}
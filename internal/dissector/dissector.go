@@ -0,0 +1,114 @@
+package dissector
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"tcp-ip/internal/ethernet"
+)
+
+var ErrTruncated = fmt.Errorf("truncated")
+
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Layer is one header of a frame, from Ethernet inwards.
+type Layer struct {
+	Protocol string
+	// Summary describes the layer on the first line of its tree
+	Summary string
+	Fields  []Field
+}
+
+func (layer *Layer) add(name string, format string, args ...any) {
+	layer.Fields = append(layer.Fields, Field{Name: name, Value: fmt.Sprintf(format, args...)})
+}
+
+// Packet is a dissected frame: the headers it carries, outermost first,
+// and the payload left after the last one.
+type Packet struct {
+	Layers  []*Layer
+	Payload []byte
+	// Length is the size of the frame on the wire
+	Length int
+	// Err tells why dissection stopped before the end of the frame
+	Err error
+
+	summary string
+}
+
+// Dissect decodes a frame as it travels on a link, FCS included. Malformed
+// headers do not stop it: it decodes as much as it can and records the
+// problem in Err.
+func Dissect(data []byte) *Packet {
+	packet := &Packet{Length: len(data)}
+	packet.summary = packet.ethernet(data)
+	return packet
+}
+
+// DissectFrame decodes a deserialized frame.
+func DissectFrame(frame *ethernet.Frame) *Packet {
+	return Dissect(frame.Serialize())
+}
+
+func (packet *Packet) push(layer Layer) *Layer {
+	packet.Layers = append(packet.Layers, &layer)
+	return &layer
+}
+
+// Layer returns the layer of protocol, or nil when the frame has none.
+func (packet *Packet) Layer(protocol string) *Layer {
+	for _, layer := range packet.Layers {
+		if layer.Protocol == protocol {
+			return layer
+		}
+	}
+	return nil
+}
+
+// String is a one-line summary of the frame in the style of tcpdump.
+func (packet *Packet) String() string {
+	return packet.summary
+}
+
+// Tree describes every field of every layer, one per line, followed by a
+// hex dump of the payload.
+func (packet *Packet) Tree() string {
+	builder := new(strings.Builder)
+	fmt.Fprintf(builder, "Frame: %d bytes\n", packet.Length)
+	for _, layer := range packet.Layers {
+		fmt.Fprintf(builder, "%s: %s\n", layer.Protocol, layer.Summary)
+		for _, field := range layer.Fields {
+			fmt.Fprintf(builder, "    %s: %s\n", field.Name, field.Value)
+		}
+	}
+	if len(packet.Payload) > 0 {
+		fmt.Fprintf(builder, "Payload: %d bytes\n", len(packet.Payload))
+		for _, line := range strings.SplitAfter(strings.TrimSuffix(hex.Dump(packet.Payload), "\n"), "\n") {
+			builder.WriteString("    " + line)
+		}
+		builder.WriteString("\n")
+	}
+	if packet.Err != nil {
+		fmt.Fprintf(builder, "Error: %s\n", packet.Err.Error())
+	}
+	return builder.String()
+}
+
+// truncated records that the frame ended inside protocol and returns the
+// tcpdump marker for it.
+func (packet *Packet) truncated(protocol string) string {
+	if packet.Err == nil {
+		packet.Err = fmt.Errorf("%w %s header", ErrTruncated, protocol)
+	}
+	return fmt.Sprintf("[|%s]", strings.ToLower(protocol))
+}
+
+func checksumStatus(correct bool) string {
+	if correct {
+		return "correct"
+	}
+	return "incorrect"
+}
@@ -0,0 +1,183 @@
+package dissector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/icmp"
+	"tcp-ip/internal/ip"
+	"tcp-ip/internal/nic"
+	"tcp-ip/internal/tcp"
+	"tcp-ip/internal/udp"
+	"testing"
+)
+
+var (
+	testSrcMAC = nic.MACAddress{0x02, 0, 0, 0, 0, 1}
+	testDstMAC = nic.MACAddress{0x02, 0, 0, 0, 0, 2}
+	testSrcIP  = ip.IPAddress{10, 0, 0, 1}
+	testDstIP  = ip.IPAddress{10, 0, 0, 2}
+	testData   = bytes.Repeat([]byte("payload "), 8)
+)
+
+type sample struct {
+	name string
+	data []byte
+	// headers is the length of the headers before the FCS, shorter input
+	// being truncated
+	headers int
+	layers  []string
+	summary string
+}
+
+func frame(t *testing.T, etherType uint16, payload []byte, tags ...ethernet.Tag) []byte {
+	t.Helper()
+	frame, err := ethernet.NewFrame(testSrcMAC, testDstMAC, etherType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame.Tags = tags
+	return frame.Serialize()
+}
+
+func ipFrame(t *testing.T, protocol uint8, payload []byte, tags ...ethernet.Tag) []byte {
+	t.Helper()
+	packet, err := ip.NewPacket(testSrcIP, testDstIP, protocol, 1, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame(t, ethernet.IPv4EtherType, packet.Serialize(), tags...)
+}
+
+func samples(t *testing.T) []sample {
+	segment := &tcp.Segment{
+		SrcPort: 1234,
+		DstPort: 80,
+		Seq:     100,
+		Flags:   tcp.FlagSYN,
+		Window:  65535,
+		Options: []byte{optionMSS, 4, 0x05, 0xB4, optionNOP, optionWS, 3, 7},
+	}
+	datagram := &udp.Datagram{SrcPort: 5000, DstPort: 53, Data: testData}
+	echo := &icmp.Message{Type: icmp.TypeEchoRequest, Identifier: 7, Sequence: 3, Data: testData}
+	arp := make([]byte, arpSize)
+	binary.BigEndian.PutUint16(arp[0:], 1)
+	binary.BigEndian.PutUint16(arp[2:], uint16(ethernet.IPv4EtherType))
+	arp[4], arp[5] = 6, 4
+	binary.BigEndian.PutUint16(arp[6:], arpRequest)
+	copy(arp[8:], testSrcMAC[:])
+	copy(arp[14:], testSrcIP[:])
+	copy(arp[24:], testDstIP[:])
+	tag := ethernet.Tag{TPID: ethernet.TPID8021Q, PCP: 3, VID: 10}
+
+	tcpFrame := ipFrame(t, ip.ProtoTCP, segment.Serialize(testSrcIP, testDstIP))
+	udpFrame := ipFrame(t, ip.ProtoUDP, datagram.Serialize(testSrcIP, testDstIP))
+	icmpFrame := ipFrame(t, ip.ProtoICMP, echo.Serialize(), tag)
+	return []sample{
+		{
+			name:    "TCP",
+			data:    tcpFrame,
+			headers: len(tcpFrame) - fcsSize,
+			layers:  []string{"Ethernet", "IPv4", "TCP"},
+			summary: "10.0.0.1.1234 > 10.0.0.2.80: Flags [S], seq 100, win 65535, options [mss 1460,nop,wscale 7], length 0",
+		},
+		{
+			name:    "UDP",
+			data:    udpFrame,
+			headers: len(udpFrame) - fcsSize,
+			layers:  []string{"Ethernet", "IPv4", "UDP"},
+			summary: "10.0.0.1.5000 > 10.0.0.2.53: UDP, length 64",
+		},
+		{
+			name:    "ICMP in a VLAN",
+			data:    icmpFrame,
+			headers: len(icmpFrame) - fcsSize,
+			layers:  []string{"Ethernet", "802.1Q", "IPv4", "ICMP"},
+			summary: "vlan 10, p 3, IP 10.0.0.1 > 10.0.0.2: ICMP echo request, id 7, seq 3, length 72",
+		},
+		{
+			name:    "ARP",
+			data:    frame(t, ethernet.ARPEtherType, arp),
+			headers: ethernetHeaderSize + arpSize,
+			layers:  []string{"Ethernet", "ARP"},
+			summary: "ARP, Request who-has 10.0.0.2 tell 10.0.0.1, length 28",
+		},
+	}
+}
+
+func TestDissect(t *testing.T) {
+	for _, sample := range samples(t) {
+		t.Run(sample.name, func(t *testing.T) {
+			packet := Dissect(sample.data)
+			if packet.Err != nil {
+				t.Fatalf("Err = %v", packet.Err)
+			}
+			var layers []string
+			for _, layer := range packet.Layers {
+				layers = append(layers, layer.Protocol)
+			}
+			if strings.Join(layers, ",") != strings.Join(sample.layers, ",") {
+				t.Errorf("layers %v, want %v", layers, sample.layers)
+			}
+			if !strings.HasSuffix(packet.String(), sample.summary) {
+				t.Errorf("summary %q, want it to end in %q", packet.String(), sample.summary)
+			}
+			if strings.Contains(packet.String(), "bad") {
+				t.Errorf("summary %q reports a bad checksum", packet.String())
+			}
+		})
+	}
+}
+
+// TestTruncated cuts every sample at every length: dissection must not
+// panic, and must report truncation whenever a header is cut short.
+func TestTruncated(t *testing.T) {
+	for _, sample := range samples(t) {
+		t.Run(sample.name, func(t *testing.T) {
+			for length := range len(sample.data) {
+				packet := Dissect(sample.data[:length])
+				truncated := length < ethernetHeaderSize+fcsSize || length-fcsSize < sample.headers
+				if truncated && !errors.Is(packet.Err, ErrTruncated) {
+					t.Errorf("%d bytes: Err = %v, want ErrTruncated", length, packet.Err)
+				}
+				if !truncated && packet.Err != nil {
+					t.Errorf("%d bytes: Err = %v", length, packet.Err)
+				}
+				_ = packet.Tree()
+			}
+		})
+	}
+}
+
+func TestTruncatedHeader(t *testing.T) {
+	all := samples(t)
+	tcpFrame, udpFrame, icmpFrame := all[0].data, all[1].data, all[2].data
+	afterIP := ethernetHeaderSize + ip.MinHeaderSize
+	tests := []struct {
+		name   string
+		data   []byte
+		marker string
+	}{
+		{"Ethernet", tcpFrame[:ethernetHeaderSize], "[|ethernet]"},
+		{"EtherType", tcpFrame[:12+fcsSize], "[|ethernet]"},
+		{"VLAN tag", icmpFrame[:14+fcsSize], "[|802.1q]"},
+		{"IPv4", tcpFrame[:ethernetHeaderSize+10+fcsSize], "[|ipv4]"},
+		{"TCP", tcpFrame[:afterIP+10+fcsSize], "[|tcp]"},
+		{"TCP options", tcpFrame[:afterIP+tcp.HeaderSize+2+fcsSize], "[|tcp]"},
+		{"UDP", udpFrame[:afterIP+4+fcsSize], "[|udp]"},
+		{"ICMP", icmpFrame[:ethernet.TagSize+afterIP+4+fcsSize], "[|icmp]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packet := Dissect(test.data)
+			if !errors.Is(packet.Err, ErrTruncated) {
+				t.Errorf("Err = %v, want ErrTruncated", packet.Err)
+			}
+			if !strings.Contains(packet.String(), test.marker) {
+				t.Errorf("summary %q, want %s", packet.String(), test.marker)
+			}
+		})
+	}
+}
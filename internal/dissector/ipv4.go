@@ -0,0 +1,174 @@
+package dissector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"tcp-ip/internal/icmp"
+	"tcp-ip/internal/ip"
+)
+
+func protocolName(protocol uint8) string {
+	switch protocol {
+	case ip.ProtoICMP:
+		return "ICMP"
+	case ip.ProtoTCP:
+		return "TCP"
+	case ip.ProtoUDP:
+		return "UDP"
+	case ip.ProtoTest:
+		return "Test"
+	default:
+		return "Unknown"
+	}
+}
+
+func (packet *Packet) ipv4(data []byte) string {
+	if len(data) < ip.MinHeaderSize {
+		packet.push(Layer{Protocol: "IPv4"})
+		return "IP " + packet.truncated("IPv4")
+	}
+	version := data[0] >> 4
+	headerLength := int(data[0]&0x0F) * 4
+	totalLength := int(binary.BigEndian.Uint16(data[2:4]))
+	id := binary.BigEndian.Uint16(data[4:6])
+	flagsOffset := binary.BigEndian.Uint16(data[6:8])
+	flags := uint8(flagsOffset >> 13)
+	offset := flagsOffset & 0x1FFF
+	ttl := data[8]
+	protocol := data[9]
+	checksum := binary.BigEndian.Uint16(data[10:12])
+	src := ip.IPAddress(data[12:16])
+	dst := ip.IPAddress(data[16:20])
+
+	layer := packet.push(Layer{Protocol: "IPv4", Summary: fmt.Sprintf("%v > %v", src, dst)})
+	layer.add("Version", "%d", version)
+	layer.add("Header length", "%d bytes", headerLength)
+	layer.add("DSCP", "%d", data[1]>>2)
+	layer.add("ECN", "%d", data[1]&0x03)
+	layer.add("Total length", "%d", totalLength)
+	layer.add("Identification", "%#04x (%d)", id, id)
+	var flagNames []string
+	if flags&ip.FlagDontFrag != 0 {
+		flagNames = append(flagNames, "DF")
+	}
+	if flags&ip.FlagMoreFrags != 0 {
+		flagNames = append(flagNames, "MF")
+	}
+	if len(flagNames) == 0 {
+		flagNames = append(flagNames, "none")
+	}
+	layer.add("Flags", "%#x (%s)", flags, strings.Join(flagNames, ","))
+	layer.add("Fragment offset", "%d", int(offset)*8)
+	layer.add("TTL", "%d", ttl)
+	layer.add("Protocol", "%s (%d)", protocolName(protocol), protocol)
+
+	if version != ip.Version4 || headerLength < ip.MinHeaderSize {
+		packet.Err = fmt.Errorf("invalid IPv4 header: version %d, header length %d", version, headerLength)
+		packet.Payload = data
+		return fmt.Sprintf("IP %v > %v: [invalid header]", src, dst)
+	}
+	if headerLength > len(data) {
+		return fmt.Sprintf("IP %v > %v: %s", src, dst, packet.truncated("IPv4"))
+	}
+	correct := ip.Checksum(data[:headerLength]) == 0
+	layer.add("Checksum", "%#04x (%s)", checksum, checksumStatus(correct))
+	layer.add("Source", "%v", src)
+	layer.add("Destination", "%v", dst)
+	if headerLength > ip.MinHeaderSize {
+		layer.add("Options", "%d bytes", headerLength-ip.MinHeaderSize)
+	}
+
+	summary := "IP "
+	if !correct {
+		summary += "[bad cksum] "
+	}
+	if totalLength < headerLength || totalLength > len(data) {
+		packet.Err = fmt.Errorf("%w IPv4 packet: total length %d, %d bytes left", ErrTruncated, totalLength, len(data))
+		totalLength = max(headerLength, min(totalLength, len(data)))
+	}
+	// whatever follows the total length is Ethernet padding
+	payload := data[headerLength:totalLength]
+
+	if offset != 0 {
+		// only the first fragment carries the transport header
+		packet.Payload = payload
+		return summary + fmt.Sprintf("%v > %v: %s, frag %d:%d@%d, length %d",
+			src, dst, strings.ToLower(protocolName(protocol)), id, len(payload), int(offset)*8, totalLength)
+	}
+	switch protocol {
+	case ip.ProtoICMP:
+		return summary + fmt.Sprintf("%v > %v: ", src, dst) + packet.icmp(payload)
+	case ip.ProtoUDP:
+		return summary + packet.udp(payload, src, dst)
+	case ip.ProtoTCP:
+		return summary + packet.tcp(payload, src, dst)
+	default:
+		packet.Payload = payload
+		return summary + fmt.Sprintf("%v > %v: ip-proto-%d, length %d", src, dst, protocol, len(payload))
+	}
+}
+
+func icmpName(kind, code uint8, rest uint16) string {
+	switch kind {
+	case icmp.TypeEchoReply:
+		return "echo reply"
+	case icmp.TypeEchoRequest:
+		return "echo request"
+	case icmp.TypeDestUnreachable:
+		switch code {
+		case icmp.CodeNetUnreachable:
+			return "net unreachable"
+		case icmp.CodeHostUnreachable:
+			return "host unreachable"
+		case icmp.CodeProtoUnreachable:
+			return "protocol unreachable"
+		case icmp.CodePortUnreachable:
+			return "port unreachable"
+		case icmp.CodeFragNeeded:
+			return fmt.Sprintf("need to frag (mtu %d)", rest)
+		}
+		return fmt.Sprintf("unreachable, code %d", code)
+	case icmp.TypeTimeExceeded:
+		switch code {
+		case icmp.CodeTTLExceeded:
+			return "time exceeded in-transit"
+		case icmp.CodeReassemblyExceeded:
+			return "ip reassembly time exceeded"
+		}
+		return fmt.Sprintf("time exceeded, code %d", code)
+	default:
+		return fmt.Sprintf("type %d, code %d", kind, code)
+	}
+}
+
+func (packet *Packet) icmp(data []byte) string {
+	if len(data) < icmp.HeaderSize {
+		packet.push(Layer{Protocol: "ICMP"})
+		return "ICMP " + packet.truncated("ICMP")
+	}
+	kind := data[0]
+	code := data[1]
+	checksum := binary.BigEndian.Uint16(data[2:4])
+	identifier := binary.BigEndian.Uint16(data[4:6])
+	sequence := binary.BigEndian.Uint16(data[6:8])
+	name := icmpName(kind, code, sequence)
+
+	layer := packet.push(Layer{Protocol: "ICMP", Summary: name})
+	layer.add("Type", "%d", kind)
+	layer.add("Code", "%d", code)
+	correct := ip.Checksum(data) == 0
+	layer.add("Checksum", "%#04x (%s)", checksum, checksumStatus(correct))
+	packet.Payload = data[icmp.HeaderSize:]
+
+	summary := "ICMP " + name
+	if kind == icmp.TypeEchoRequest || kind == icmp.TypeEchoReply {
+		layer.add("Identifier", "%d", identifier)
+		layer.add("Sequence", "%d", sequence)
+		summary += fmt.Sprintf(", id %d, seq %d", identifier, sequence)
+	}
+	if !correct {
+		summary += " [bad icmp cksum]"
+	}
+	return summary + fmt.Sprintf(", length %d", len(data))
+}
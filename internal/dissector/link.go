@@ -0,0 +1,146 @@
+package dissector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"tcp-ip/internal/ethernet"
+	"tcp-ip/internal/ip"
+	"tcp-ip/internal/nic"
+)
+
+const (
+	ethernetHeaderSize = 14
+	fcsSize            = 4
+	arpSize            = 28
+	// maxLength is the largest EtherType field that is an 802.3 length
+	maxLength = 0x5DC
+)
+
+// ARP operations as RFC 826 numbers them
+const (
+	arpRequest uint16 = 1
+	arpReply   uint16 = 2
+)
+
+func macString(mac nic.MACAddress) string {
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", mac[0], mac[1], mac[2], mac[3], mac[4], mac[5])
+}
+
+func etherTypeName(etherType uint16) string {
+	switch etherType {
+	case ethernet.IPv4EtherType:
+		return "IPv4"
+	case ethernet.ARPEtherType:
+		return "ARP"
+	case ethernet.TPID8021Q:
+		return "802.1Q"
+	case ethernet.TPID8021AD:
+		return "802.1ad"
+	default:
+		return "Unknown"
+	}
+}
+
+func (packet *Packet) ethernet(data []byte) string {
+	if len(data) < ethernetHeaderSize+fcsSize {
+		packet.push(Layer{Protocol: "Ethernet", Summary: fmt.Sprintf("%d bytes", len(data))})
+		return packet.truncated("Ethernet")
+	}
+	dst := nic.MACAddress(data[0:6])
+	src := nic.MACAddress(data[6:12])
+	fcs := binary.BigEndian.Uint32(data[len(data)-fcsSize:])
+	layer := packet.push(Layer{
+		Protocol: "Ethernet",
+		Summary:  fmt.Sprintf("%s > %s", macString(src), macString(dst)),
+	})
+	layer.add("Destination", "%s", macString(dst))
+	layer.add("Source", "%s", macString(src))
+	correct := ethernet.CRC(data[:len(data)-fcsSize]) == fcs
+	layer.add("FCS", "%#08x (%s)", fcs, checksumStatus(correct))
+
+	summary := fmt.Sprintf("%s > %s, ", macString(src), macString(dst))
+	if !correct {
+		summary += "[bad fcs] "
+	}
+	return summary + packet.etherType(data[12:len(data)-fcsSize], layer)
+}
+
+// etherType decodes what follows the addresses or a tag, starting with the
+// EtherType, and adds the EtherType to the outer layer.
+func (packet *Packet) etherType(data []byte, outer *Layer) string {
+	if len(data) < 2 {
+		return packet.truncated(outer.Protocol)
+	}
+	etherType := binary.BigEndian.Uint16(data)
+	if etherType <= maxLength {
+		outer.add("Length", "%d", etherType)
+		packet.Payload = data[2:]
+		return fmt.Sprintf("802.3, length %d", etherType)
+	}
+	outer.add("Type", "%s (%#04x)", etherTypeName(etherType), etherType)
+	if ethernet.IsTPID(etherType) {
+		return packet.tag(data)
+	}
+
+	data = data[2:]
+	switch etherType {
+	case ethernet.ARPEtherType:
+		return packet.arp(data)
+	case ethernet.IPv4EtherType:
+		return packet.ipv4(data)
+	default:
+		packet.Payload = data
+		return fmt.Sprintf("ethertype %#04x, length %d", etherType, len(data))
+	}
+}
+
+// tag decodes a VLAN tag, given data from its TPID on.
+func (packet *Packet) tag(data []byte) string {
+	name := etherTypeName(binary.BigEndian.Uint16(data))
+	if len(data) < ethernet.TagSize {
+		packet.push(Layer{Protocol: name})
+		return packet.truncated(name)
+	}
+	tag := ethernet.ParseTag(data)
+	layer := packet.push(Layer{Protocol: name, Summary: fmt.Sprintf("VLAN %d, priority %d", tag.VID, tag.PCP)})
+	layer.add("Priority", "%d", tag.PCP)
+	layer.add("DEI", "%t", tag.DEI)
+	layer.add("ID", "%d", tag.VID)
+	return fmt.Sprintf("vlan %d, p %d, ", tag.VID, tag.PCP) + packet.etherType(data[ethernet.TagSize:], layer)
+}
+
+func (packet *Packet) arp(data []byte) string {
+	if len(data) < arpSize {
+		packet.push(Layer{Protocol: "ARP"})
+		return "ARP, " + packet.truncated("ARP")
+	}
+	operation := binary.BigEndian.Uint16(data[6:8])
+	senderMAC := nic.MACAddress(data[8:14])
+	senderIP := ip.IPAddress(data[14:18])
+	targetMAC := nic.MACAddress(data[18:24])
+	targetIP := ip.IPAddress(data[24:28])
+
+	var summary, operationName string
+	switch operation {
+	case arpRequest:
+		operationName = "Request"
+		summary = fmt.Sprintf("Request who-has %v tell %v", targetIP, senderIP)
+	case arpReply:
+		operationName = "Reply"
+		summary = fmt.Sprintf("Reply %v is-at %s", senderIP, macString(senderMAC))
+	default:
+		operationName = "Unknown"
+		summary = fmt.Sprintf("Unknown operation %d", operation)
+	}
+	layer := packet.push(Layer{Protocol: "ARP", Summary: summary})
+	layer.add("Hardware type", "%d", binary.BigEndian.Uint16(data[0:2]))
+	layer.add("Protocol type", "%#04x", binary.BigEndian.Uint16(data[2:4]))
+	layer.add("Hardware size", "%d", data[4])
+	layer.add("Protocol size", "%d", data[5])
+	layer.add("Operation", "%s (%d)", operationName, operation)
+	layer.add("Sender MAC", "%s", macString(senderMAC))
+	layer.add("Sender IP", "%v", senderIP)
+	layer.add("Target MAC", "%s", macString(targetMAC))
+	layer.add("Target IP", "%v", targetIP)
+	return fmt.Sprintf("ARP, %s, length %d", summary, arpSize)
+}
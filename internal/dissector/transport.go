@@ -0,0 +1,190 @@
+package dissector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"tcp-ip/internal/ip"
+	"tcp-ip/internal/tcp"
+	"tcp-ip/internal/udp"
+)
+
+// TCP option kinds
+const (
+	optionEnd           = 0
+	optionNOP           = 1
+	optionMSS           = 2
+	optionWS            = 3
+	optionSACKPermitted = 4
+	optionSACK          = 5
+	optionTimestamps    = 8
+)
+
+func transportChecksum(data []byte, src, dst ip.IPAddress, protocol uint8) bool {
+	sum := ip.PseudoHeaderSum(src, dst, protocol, len(data))
+	return ip.FinishChecksum(ip.Sum(sum, data)) == 0
+}
+
+func (packet *Packet) udp(data []byte, src, dst ip.IPAddress) string {
+	if len(data) < udp.HeaderSize {
+		packet.push(Layer{Protocol: "UDP"})
+		return fmt.Sprintf("%v > %v: UDP %s", src, dst, packet.truncated("UDP"))
+	}
+	srcPort := binary.BigEndian.Uint16(data[0:2])
+	dstPort := binary.BigEndian.Uint16(data[2:4])
+	length := int(binary.BigEndian.Uint16(data[4:6]))
+	checksum := binary.BigEndian.Uint16(data[6:8])
+
+	layer := packet.push(Layer{Protocol: "UDP", Summary: fmt.Sprintf("%d > %d", srcPort, dstPort)})
+	layer.add("Source port", "%d", srcPort)
+	layer.add("Destination port", "%d", dstPort)
+	layer.add("Length", "%d", length)
+	summary := fmt.Sprintf("%v.%d > %v.%d: UDP", src, srcPort, dst, dstPort)
+	if length < udp.HeaderSize || length > len(data) {
+		packet.Err = fmt.Errorf("%w UDP datagram: length %d, %d bytes left", ErrTruncated, length, len(data))
+		length = len(data)
+	}
+	data = data[:length]
+
+	switch {
+	case checksum == 0:
+		layer.add("Checksum", "none")
+	case transportChecksum(data, src, dst, ip.ProtoUDP):
+		layer.add("Checksum", "%#04x (correct)", checksum)
+	default:
+		layer.add("Checksum", "%#04x (incorrect)", checksum)
+		summary += " [bad udp cksum]"
+	}
+	packet.Payload = data[udp.HeaderSize:]
+	return summary + fmt.Sprintf(", length %d", len(packet.Payload))
+}
+
+// tcpFlags abbreviates flags the way tcpdump does, with a dot for ACK.
+func tcpFlags(flags uint8) string {
+	letters := []struct {
+		flag   uint8
+		letter string
+	}{
+		{tcp.FlagSYN, "S"}, {tcp.FlagFIN, "F"}, {tcp.FlagRST, "R"}, {tcp.FlagPSH, "P"},
+		{tcp.FlagURG, "U"}, {tcp.FlagECE, "E"}, {tcp.FlagCWR, "W"}, {tcp.FlagACK, "."},
+	}
+	var abbreviated string
+	for _, entry := range letters {
+		if flags&entry.flag != 0 {
+			abbreviated += entry.letter
+		}
+	}
+	if abbreviated == "" {
+		return "none"
+	}
+	return abbreviated
+}
+
+// tcpOptions describes the options the way tcpdump does. It stops at the
+// first malformed one.
+func tcpOptions(data []byte) ([]string, error) {
+	var described []string
+	for i := 0; i < len(data); {
+		kind := data[i]
+		if kind == optionEnd {
+			described = append(described, "eol")
+			break
+		}
+		if kind == optionNOP {
+			described = append(described, "nop")
+			i++
+			continue
+		}
+		if i+1 >= len(data) || data[i+1] < 2 || i+int(data[i+1]) > len(data) {
+			return described, fmt.Errorf("malformed TCP option %d", kind)
+		}
+		value := data[i+2 : i+int(data[i+1])]
+		i += int(data[i+1])
+
+		switch {
+		case kind == optionMSS && len(value) == 2:
+			described = append(described, fmt.Sprintf("mss %d", binary.BigEndian.Uint16(value)))
+		case kind == optionWS && len(value) == 1:
+			described = append(described, fmt.Sprintf("wscale %d", value[0]))
+		case kind == optionSACKPermitted && len(value) == 0:
+			described = append(described, "sackOK")
+		case kind == optionSACK && len(value)%8 == 0:
+			blocks := make([]string, 0, len(value)/8)
+			for j := 0; j < len(value); j += 8 {
+				blocks = append(blocks, fmt.Sprintf("{%d:%d}", binary.BigEndian.Uint32(value[j:]), binary.BigEndian.Uint32(value[j+4:])))
+			}
+			described = append(described, fmt.Sprintf("sack %d %s", len(blocks), strings.Join(blocks, "")))
+		case kind == optionTimestamps && len(value) == 8:
+			described = append(described, fmt.Sprintf("TS val %d ecr %d", binary.BigEndian.Uint32(value), binary.BigEndian.Uint32(value[4:])))
+		default:
+			described = append(described, fmt.Sprintf("opt-%d:%x", kind, value))
+		}
+	}
+	return described, nil
+}
+
+func (packet *Packet) tcp(data []byte, src, dst ip.IPAddress) string {
+	if len(data) < tcp.HeaderSize {
+		packet.push(Layer{Protocol: "TCP"})
+		return fmt.Sprintf("%v > %v: %s", src, dst, packet.truncated("TCP"))
+	}
+	srcPort := binary.BigEndian.Uint16(data[0:2])
+	dstPort := binary.BigEndian.Uint16(data[2:4])
+	seq := binary.BigEndian.Uint32(data[4:8])
+	ack := binary.BigEndian.Uint32(data[8:12])
+	headerLength := int(data[12]>>4) * 4
+	flags := data[13]
+	window := binary.BigEndian.Uint16(data[14:16])
+	checksum := binary.BigEndian.Uint16(data[16:18])
+	urgent := binary.BigEndian.Uint16(data[18:20])
+
+	layer := packet.push(Layer{
+		Protocol: "TCP",
+		Summary:  fmt.Sprintf("%d > %d [%s]", srcPort, dstPort, tcp.FlagsString(flags)),
+	})
+	layer.add("Source port", "%d", srcPort)
+	layer.add("Destination port", "%d", dstPort)
+	layer.add("Sequence number", "%d", seq)
+	layer.add("Acknowledgment number", "%d", ack)
+	layer.add("Header length", "%d bytes", headerLength)
+	layer.add("Flags", "%#03x (%s)", flags, tcp.FlagsString(flags))
+	layer.add("Window", "%d", window)
+	correct := transportChecksum(data, src, dst, ip.ProtoTCP)
+	layer.add("Checksum", "%#04x (%s)", checksum, checksumStatus(correct))
+	layer.add("Urgent pointer", "%d", urgent)
+
+	summary := fmt.Sprintf("%v.%d > %v.%d: Flags [%s]", src, srcPort, dst, dstPort, tcpFlags(flags))
+	if headerLength < tcp.HeaderSize {
+		packet.Err = fmt.Errorf("invalid TCP header length %d", headerLength)
+		return summary + " [bad hdr length]"
+	}
+	if headerLength > len(data) {
+		return summary + " " + packet.truncated("TCP")
+	}
+	options, err := tcpOptions(data[tcp.HeaderSize:headerLength])
+	if len(options) > 0 {
+		layer.add("Options", "%s", strings.Join(options, ","))
+	}
+	if err != nil {
+		packet.Err = err
+	}
+	payload := data[headerLength:]
+	packet.Payload = payload
+
+	if len(payload) > 0 {
+		summary += fmt.Sprintf(", seq %d:%d", seq, seq+uint32(len(payload)))
+	} else if flags&(tcp.FlagSYN|tcp.FlagFIN|tcp.FlagRST) != 0 {
+		summary += fmt.Sprintf(", seq %d", seq)
+	}
+	if flags&tcp.FlagACK != 0 {
+		summary += fmt.Sprintf(", ack %d", ack)
+	}
+	summary += fmt.Sprintf(", win %d", window)
+	if len(options) > 0 {
+		summary += fmt.Sprintf(", options [%s]", strings.Join(options, ","))
+	}
+	if !correct {
+		summary += " [bad tcp cksum]"
+	}
+	return summary + fmt.Sprintf(", length %d", len(payload))
+}
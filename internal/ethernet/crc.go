@@ -0,0 +1,18 @@
+package ethernet
+
+import (
+	"hash/crc32"
+)
+
+// CRC computes the FCS of frame, the IEEE 802.3 CRC-32. hash/crc32 sums it
+// with carry-less multiplication where the CPU has it and slicing-by-8
+// tables elsewhere.
+func CRC(frame []byte) uint32 {
+	return crc32.ChecksumIEEE(frame)
+}
+
+// UpdateCRC returns the FCS of the bytes summed into crc followed by data,
+// so that a frame can be summed in pieces starting from 0.
+func UpdateCRC(crc uint32, data []byte) uint32 {
+	return crc32.Update(crc, crc32.IEEETable, data)
+}
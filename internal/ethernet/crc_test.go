@@ -0,0 +1,108 @@
+package ethernet
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+// bitwiseCRC is the bit at a time FCS the table driven one replaced, kept
+// as the reference.
+func bitwiseCRC(frame []byte) uint32 {
+	result := uint32(0xFFFFFFFF)
+	for _, b := range frame {
+		result ^= uint32(b)
+		for range 8 {
+			if result&1 == 1 {
+				result = (result >> 1) ^ 0xEDB88320
+			} else {
+				result >>= 1
+			}
+		}
+	}
+	return ^result
+}
+
+func randomFrame(size int) []byte {
+	random := rand.New(rand.NewPCG(1, 2))
+	frame := make([]byte, size)
+	for i := range frame {
+		frame[i] = byte(random.Uint32())
+	}
+	return frame
+}
+
+var crcSizes = []struct {
+	name string
+	size int
+}{
+	{"minimum", MinFrame},
+	{"1518", 1518},
+	{"MTU", MTU},
+}
+
+func TestCRC(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want uint32
+	}{
+		{"empty", nil, 0},
+		// the CRC-32 check value
+		{"check", []byte("123456789"), 0xCBF43926},
+		{"one byte", []byte{0x00}, 0xD202EF8D},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CRC(test.data); got != test.want {
+				t.Errorf("CRC = %#08x, want %#08x", got, test.want)
+			}
+			if got := bitwiseCRC(test.data); got != test.want {
+				t.Errorf("bitwise reference = %#08x, want %#08x", got, test.want)
+			}
+		})
+	}
+
+	frame := randomFrame(MTU)
+	for _, test := range crcSizes {
+		t.Run(test.name, func(t *testing.T) {
+			data := frame[:test.size]
+			want := bitwiseCRC(data)
+			if got := CRC(data); got != want {
+				t.Errorf("CRC = %#08x, want %#08x", got, want)
+			}
+			// summing in pieces gives the same FCS wherever the frame is split
+			for _, split := range []int{0, 1, 14, test.size / 3, test.size - 1, test.size} {
+				crc := UpdateCRC(0, data[:split])
+				if got := UpdateCRC(crc, data[split:]); got != want {
+					t.Errorf("split at %d: UpdateCRC = %#08x, want %#08x", split, got, want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCRC(b *testing.B) {
+	frame := randomFrame(MTU)
+	for _, test := range crcSizes {
+		b.Run(test.name, func(b *testing.B) {
+			data := frame[:test.size]
+			b.SetBytes(int64(test.size))
+			for b.Loop() {
+				CRC(data)
+			}
+		})
+	}
+}
+
+func BenchmarkCRCBitwise(b *testing.B) {
+	frame := randomFrame(MTU)
+	for _, test := range crcSizes {
+		b.Run(test.name, func(b *testing.B) {
+			data := frame[:test.size]
+			b.SetBytes(int64(test.size))
+			for b.Loop() {
+				bitwiseCRC(data)
+			}
+		})
+	}
+}
@@ -1,15 +1,17 @@
 package ethernet
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"tcp-ip/internal/nic"
 )
 
 type Frame struct {
-	DstMAC    [6]byte
-	SrcMAC    [6]byte
+	DstMAC [6]byte
+	SrcMAC [6]byte
+	// Tags holds the VLAN tags between the addresses and the EtherType,
+	// outermost first
+	Tags      []Tag
 	EtherType uint16
 	Data      []byte
 	FCS       uint32
@@ -22,47 +24,49 @@ var (
 	IPv4EtherType    uint16 = 0x0800
 	TestEtherType    uint16 = 0x0000
 	MaxFramePayload         = MTU - frameOverhead
+	MaxTaggedFrame          = MTU + MaxTags*TagSize
 	MinFrame                = 46
 	frameOverhead           = 18
 )
 
-func CRC(frame []byte) uint32 {
-	polynomial := uint32(0xEDB88320)
-	result := uint32(0xFFFFFFFF)
-	for _, b := range frame {
-		result ^= uint32(b)
-		for range 8 {
-			lsb := result & 1
-			if lsb == 1 {
-				result = (result >> 1) ^ polynomial
-			} else {
-				result >>= 1
-			}
-		}
-	}
-	return ^result
-}
-
+// Serialize lays the frame out as it travels on the wire, summing the FCS
+// piece by piece as the header and the data are appended.
 func (frame *Frame) Serialize() []byte {
-	buf := new(bytes.Buffer)
-	buf.Write(frame.DstMAC[:])
-	buf.Write(frame.SrcMAC[:])
-	_ = binary.Write(buf, binary.BigEndian, frame.EtherType)
-	buf.Write(frame.Data)
-	frame.FCS = CRC(buf.Bytes())
-	_ = binary.Write(buf, binary.BigEndian, frame.FCS)
-	return buf.Bytes()
+	headerSize := 14 + len(frame.Tags)*TagSize
+	data := make([]byte, 0, headerSize+len(frame.Data)+4)
+	data = append(data, frame.DstMAC[:]...)
+	data = append(data, frame.SrcMAC[:]...)
+	for _, tag := range frame.Tags {
+		data = binary.BigEndian.AppendUint16(data, tag.TPID)
+		data = binary.BigEndian.AppendUint16(data, tag.TCI())
+	}
+	data = binary.BigEndian.AppendUint16(data, frame.EtherType)
+	crc := UpdateCRC(0, data)
+	data = append(data, frame.Data...)
+	frame.FCS = UpdateCRC(crc, frame.Data)
+	return binary.BigEndian.AppendUint32(data, frame.FCS)
 }
 
 func Deserialize(data []byte) (*Frame, error) {
-	if len(data) > MTU || len(data) < MinFrame {
+	if len(data) > MaxTaggedFrame || len(data) < MinFrame {
 		return nil, fmt.Errorf("invalid frame: invalid frame size")
 	}
 	frame := &Frame{}
 	copy(frame.DstMAC[:], data[:6])
 	copy(frame.SrcMAC[:], data[6:12])
-	frame.EtherType = binary.BigEndian.Uint16(data[12:14])
-	frame.Data = data[14 : len(data)-4]
+	offset := 12
+	for IsTPID(binary.BigEndian.Uint16(data[offset:])) {
+		if len(frame.Tags) == MaxTags || offset+TagSize+6 > len(data) {
+			return nil, fmt.Errorf("invalid frame: too many VLAN tags")
+		}
+		frame.Tags = append(frame.Tags, ParseTag(data[offset:offset+TagSize]))
+		offset += TagSize
+	}
+	if len(data) > MTU+len(frame.Tags)*TagSize {
+		return nil, fmt.Errorf("invalid frame: invalid frame size")
+	}
+	frame.EtherType = binary.BigEndian.Uint16(data[offset : offset+2])
+	frame.Data = data[offset+2 : len(data)-4]
 	frame.FCS = binary.BigEndian.Uint32(data[len(data)-4:])
 	calculatedFCS := CRC(data[:len(data)-4])
 	if calculatedFCS != frame.FCS {
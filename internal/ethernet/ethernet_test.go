@@ -0,0 +1,77 @@
+package ethernet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSerializeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"padded", []byte("short")},
+		{"minimum", bytes.Repeat([]byte{0x11}, MinFrame)},
+		{"largest", bytes.Repeat([]byte{0x22}, MaxFramePayload)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frame, err := NewFrame([6]byte{0x02, 0, 0, 0, 0, 1}, BroadcastAddress, IPv4EtherType, test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := frame.Serialize()
+			if frame.FCS != CRC(data[:len(data)-4]) {
+				t.Errorf("FCS %#08x does not cover the frame", frame.FCS)
+			}
+			got, err := Deserialize(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(got.Data, test.data) || got.FCS != frame.FCS || got.DstMAC != BroadcastAddress {
+				t.Errorf("Deserialize = %+v", got)
+			}
+		})
+	}
+}
+
+func TestNewFrameTooLarge(t *testing.T) {
+	if _, err := NewFrame([6]byte{}, BroadcastAddress, IPv4EtherType, make([]byte, MaxFramePayload+1)); err == nil {
+		t.Errorf("created a frame larger than the MTU")
+	}
+}
+
+// TestDeserializeCorrupted flips every bit of a frame in turn: the FCS
+// catches each one, wherever it falls.
+func TestDeserializeCorrupted(t *testing.T) {
+	frame, err := NewFrame([6]byte{0x02, 0, 0, 0, 0, 1}, [6]byte{0x02, 0, 0, 0, 0, 2}, IPv4EtherType, randomFrame(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := frame.Serialize()
+	for i := range len(data) * 8 {
+		corrupted := bytes.Clone(data)
+		corrupted[i/8] ^= 1 << (i % 8)
+		if got, err := Deserialize(corrupted); err == nil {
+			t.Fatalf("bit %d flipped: Deserialize = %+v, want an error", i, got)
+		}
+	}
+}
+
+func TestDeserializeInvalidSize(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"short", MinFrame - 1},
+		{"long", MaxTaggedFrame + 1},
+		{"long untagged", MTU + 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Deserialize(make([]byte, test.size)); err == nil {
+				t.Errorf("accepted a frame of %d bytes", test.size)
+			}
+		})
+	}
+}
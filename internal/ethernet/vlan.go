@@ -0,0 +1,62 @@
+package ethernet
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// TPID8021Q identifies a customer VLAN tag and TPID8021AD the service
+	// tag a provider bridge pushes in front of it
+	TPID8021Q  uint16 = 0x8100
+	TPID8021AD uint16 = 0x88A8
+
+	TagSize = 4
+	// MaxTags allows one service and one customer tag
+	MaxTags = 2
+
+	// MaxVID is the highest usable VLAN ID, 4095 being reserved
+	MaxVID = 4094
+)
+
+// Tag is an 802.1Q tag. VID 0 marks a priority tagged frame that belongs to
+// no particular VLAN.
+type Tag struct {
+	TPID uint16
+	PCP  uint8
+	DEI  bool
+	VID  uint16
+}
+
+func IsTPID(etherType uint16) bool {
+	return etherType == TPID8021Q || etherType == TPID8021AD
+}
+
+// TCI packs the priority, drop eligibility and VLAN ID into the tag
+// control information field.
+func (tag Tag) TCI() uint16 {
+	tci := uint16(tag.PCP&0x7)<<13 | tag.VID&0x0FFF
+	if tag.DEI {
+		tci |= 1 << 12
+	}
+	return tci
+}
+
+// ParseTag reads a tag from its 4 bytes on the wire.
+func ParseTag(data []byte) Tag {
+	tci := binary.BigEndian.Uint16(data[2:4])
+	return Tag{
+		TPID: binary.BigEndian.Uint16(data[0:2]),
+		PCP:  uint8(tci >> 13),
+		DEI:  tci&(1<<12) != 0,
+		VID:  tci & 0x0FFF,
+	}
+}
+
+func (tag Tag) String() string {
+	kind := "802.1Q"
+	if tag.TPID == TPID8021AD {
+		kind = "802.1ad"
+	}
+	return fmt.Sprintf("%s vlan %d, p %d", kind, tag.VID, tag.PCP)
+}
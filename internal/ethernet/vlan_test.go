@@ -0,0 +1,71 @@
+package ethernet
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestTagRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  Tag
+		wire []byte
+	}{
+		{"802.1Q", Tag{TPID: TPID8021Q, PCP: 5, VID: 100}, []byte{0x81, 0x00, 0xA0, 0x64}},
+		{"802.1ad", Tag{TPID: TPID8021AD, PCP: 0, VID: MaxVID}, []byte{0x88, 0xA8, 0x0F, 0xFE}},
+		{"drop eligible", Tag{TPID: TPID8021Q, PCP: 7, DEI: true, VID: 1}, []byte{0x81, 0x00, 0xF0, 0x01}},
+		{"priority tagged", Tag{TPID: TPID8021Q, PCP: 3, VID: 0}, []byte{0x81, 0x00, 0x60, 0x00}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if tci := test.tag.TCI(); tci != uint16(test.wire[2])<<8|uint16(test.wire[3]) {
+				t.Errorf("TCI = %#04x, want % x", tci, test.wire[2:])
+			}
+			if tag := ParseTag(test.wire); tag != test.tag {
+				t.Errorf("ParseTag = %+v, want %+v", tag, test.tag)
+			}
+		})
+	}
+}
+
+func TestTaggedFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []Tag
+	}{
+		{"untagged", nil},
+		{"802.1Q", []Tag{{TPID: TPID8021Q, PCP: 2, VID: 10}}},
+		{"QinQ", []Tag{{TPID: TPID8021AD, VID: 200}, {TPID: TPID8021Q, PCP: 6, VID: 10}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frame := &Frame{
+				DstMAC:    [6]byte{0x02, 0, 0, 0, 0, 1},
+				SrcMAC:    [6]byte{0x02, 0, 0, 0, 0, 2},
+				Tags:      test.tags,
+				EtherType: IPv4EtherType,
+				Data:      bytes.Repeat([]byte{0xAB}, MinFrame),
+			}
+			data := frame.Serialize()
+			if len(data) != 18+len(test.tags)*TagSize+MinFrame {
+				t.Fatalf("serialized %d bytes", len(data))
+			}
+			got, err := Deserialize(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.Tags, test.tags) || got.EtherType != IPv4EtherType || !bytes.Equal(got.Data, frame.Data) {
+				t.Errorf("Deserialize = %+v, want %+v", got, frame)
+			}
+		})
+	}
+}
+
+func TestTooManyTags(t *testing.T) {
+	tag := Tag{TPID: TPID8021Q, VID: 1}
+	frame := &Frame{Tags: []Tag{tag, tag, tag}, EtherType: IPv4EtherType, Data: make([]byte, MinFrame)}
+	if _, err := Deserialize(frame.Serialize()); err == nil {
+		t.Errorf("accepted a frame with %d tags", len(frame.Tags))
+	}
+}
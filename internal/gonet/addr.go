@@ -0,0 +1,46 @@
+package gonet
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"tcp-ip/internal/ip"
+)
+
+var (
+	ErrUnsupportedNetwork = fmt.Errorf("unsupported network")
+	ErrNotIPv4            = fmt.Errorf("not an IPv4 address")
+)
+
+func toNetIP(address ip.IPAddress) net.IP {
+	return net.IPv4(address[0], address[1], address[2], address[3])
+}
+
+func fromNetIP(address net.IP) (ip.IPAddress, error) {
+	v4 := address.To4()
+	if v4 == nil {
+		return ip.IPAddress{}, fmt.Errorf("%w: %v", ErrNotIPv4, address)
+	}
+	return ip.IPAddress(v4), nil
+}
+
+// parseAddress splits "host:port" where host is an IPv4 literal or empty,
+// as the simulated stack has no name resolution.
+func parseAddress(address string) (ip.IPAddress, uint16, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return ip.IPAddress{}, 0, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return ip.IPAddress{}, 0, fmt.Errorf("invalid port %q", portString)
+	}
+	if host == "" {
+		return ip.IPAddress{}, uint16(port), nil
+	}
+	addr, err := ip.ParseIP(host)
+	if err != nil {
+		return ip.IPAddress{}, 0, fmt.Errorf("%w: %s", ErrNotIPv4, host)
+	}
+	return addr, uint16(port), nil
+}
@@ -0,0 +1,199 @@
+package gonet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"tcp-ip/internal/tcp"
+	"time"
+)
+
+var (
+	_ net.Conn     = (*TCPConn)(nil)
+	_ net.Listener = (*TCPListener)(nil)
+)
+
+// TCPConn adapts a connection of the simulated TCP to net.Conn.
+type TCPConn struct {
+	conn   *tcp.Conn
+	closed atomic.Bool
+}
+
+func NewTCPConn(conn *tcp.Conn) *TCPConn {
+	return &TCPConn{conn: conn}
+}
+
+func tcpAddr(conn *tcp.Conn, remote bool) *net.TCPAddr {
+	address, port := conn.LocalAddr()
+	if remote {
+		address, port = conn.RemoteAddr()
+	}
+	return &net.TCPAddr{IP: toNetIP(address), Port: int(port)}
+}
+
+// opError wraps err the way the net package reports failed operations.
+// io.EOF stays unwrapped, since readers compare against it directly.
+func (conn *TCPConn) opError(op string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if errors.Is(err, tcp.ErrReadClosed) {
+		err = net.ErrClosed
+	}
+	return &net.OpError{Op: op, Net: "tcp", Source: conn.LocalAddr(), Addr: conn.RemoteAddr(), Err: err}
+}
+
+func (conn *TCPConn) Read(b []byte) (int, error) {
+	if conn.closed.Load() {
+		return 0, conn.opError("read", net.ErrClosed)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := conn.conn.Read(b)
+	return n, conn.opError("read", err)
+}
+
+func (conn *TCPConn) Write(b []byte) (int, error) {
+	if conn.closed.Load() {
+		return 0, conn.opError("write", net.ErrClosed)
+	}
+	n, err := conn.conn.Write(b)
+	return n, conn.opError("write", err)
+}
+
+// Close releases the connection and fails reads that are blocked or still
+// to come. The peer sees a FIN, or a reset if data it sent goes unread.
+func (conn *TCPConn) Close() error {
+	if !conn.closed.CompareAndSwap(false, true) {
+		return conn.opError("close", net.ErrClosed)
+	}
+	// a connection the peer already reset or closed has nothing left to
+	// release, which is not an error for the caller
+	_ = conn.conn.Release()
+	return nil
+}
+
+func (conn *TCPConn) CloseRead() error {
+	conn.conn.CloseRead()
+	return nil
+}
+
+func (conn *TCPConn) CloseWrite() error {
+	return conn.opError("close", conn.conn.Close())
+}
+
+func (conn *TCPConn) LocalAddr() net.Addr {
+	return tcpAddr(conn.conn, false)
+}
+
+func (conn *TCPConn) RemoteAddr() net.Addr {
+	return tcpAddr(conn.conn, true)
+}
+
+func (conn *TCPConn) SetDeadline(t time.Time) error {
+	conn.conn.SetReadDeadline(t)
+	conn.conn.SetWriteDeadline(t)
+	return nil
+}
+
+func (conn *TCPConn) SetReadDeadline(t time.Time) error {
+	conn.conn.SetReadDeadline(t)
+	return nil
+}
+
+func (conn *TCPConn) SetWriteDeadline(t time.Time) error {
+	conn.conn.SetWriteDeadline(t)
+	return nil
+}
+
+func (conn *TCPConn) SetNoDelay(noDelay bool) error {
+	conn.conn.SetNoDelay(noDelay)
+	return nil
+}
+
+// TCPListener adapts a listener of the simulated TCP to net.Listener.
+type TCPListener struct {
+	listener *tcp.Listener
+}
+
+func (listener *TCPListener) AcceptTCP() (*TCPConn, error) {
+	conn, err := listener.listener.Accept()
+	if err != nil {
+		if errors.Is(err, tcp.ErrListenerClosed) {
+			err = net.ErrClosed
+		}
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Addr: listener.Addr(), Err: err}
+	}
+	return NewTCPConn(conn), nil
+}
+
+func (listener *TCPListener) Accept() (net.Conn, error) {
+	return listener.AcceptTCP()
+}
+
+func (listener *TCPListener) Close() error {
+	err := listener.listener.Close()
+	if errors.Is(err, tcp.ErrListenerClosed) {
+		return &net.OpError{Op: "close", Net: "tcp", Addr: listener.Addr(), Err: net.ErrClosed}
+	}
+	return err
+}
+
+func (listener *TCPListener) Addr() net.Addr {
+	address, port := listener.listener.LocalAddr()
+	return &net.TCPAddr{IP: toNetIP(address), Port: int(port)}
+}
+
+// ListenTCP listens on "host:port", where host is empty or the address of
+// the module.
+func ListenTCP(module *tcp.TCPModule, address string) (*TCPListener, error) {
+	host, port, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if host != ([4]byte{}) && host != module.Addr() {
+		return nil, fmt.Errorf("cannot listen on %v: not a local address", host)
+	}
+	if port == 0 {
+		return nil, fmt.Errorf("cannot listen on port 0")
+	}
+	listener, err := module.Listen(port)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "tcp", Addr: &net.TCPAddr{IP: toNetIP(module.Addr()), Port: int(port)}, Err: err}
+	}
+	return &TCPListener{listener: listener}, nil
+}
+
+func DialTCP(module *tcp.TCPModule, address string) (*TCPConn, error) {
+	return DialContextTCP(context.Background(), module, address)
+}
+
+// DialContextTCP connects to "ip:port" and gives up when ctx is done.
+func DialContextTCP(ctx context.Context, module *tcp.TCPModule, address string) (*TCPConn, error) {
+	dst, port, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := module.DialContext(ctx, dst, port)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Addr: &net.TCPAddr{IP: toNetIP(dst), Port: int(port)}, Err: err}
+	}
+	return NewTCPConn(conn), nil
+}
+
+// Dialer has the DialContext method net/http.Transport and similar clients
+// take, so they can run over the simulated stack.
+type Dialer struct {
+	TCP *tcp.TCPModule
+}
+
+func (dialer Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedNetwork, network)
+	}
+	return DialContextTCP(ctx, dialer.TCP, address)
+}
@@ -0,0 +1,296 @@
+package gonet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"tcp-ip/internal/ip"
+	"tcp-ip/internal/link"
+	"tcp-ip/internal/tcp"
+	"tcp-ip/internal/udp"
+	"testing"
+	"time"
+)
+
+// testHost runs TCP and UDP directly over one end of a pipe link, with a
+// frame per IP packet.
+type testHost struct {
+	addr ip.IPAddress
+	tcp  *tcp.TCPModule
+	udp  *udp.UDPModule
+	wire link.Link
+	out  chan []byte
+}
+
+// SendToIP queues the packet like a NIC would and drops it when the queue
+// is full, so neither host blocks the other.
+func (host *testHost) SendToIP(message []byte, dst ip.IPAddress, protocol uint8) error {
+	packet, err := ip.NewPacket(host.addr, dst, protocol, 0, message)
+	if err != nil {
+		return err
+	}
+	select {
+	case host.out <- packet.Serialize():
+	default:
+	}
+	return nil
+}
+
+func (host *testHost) transmit() {
+	for frame := range host.out {
+		if host.wire.WriteFrame(frame) != nil {
+			return
+		}
+	}
+}
+
+func (host *testHost) receive() {
+	for {
+		frame, err := host.wire.ReadFrame()
+		if err != nil {
+			return
+		}
+		packet, err := ip.Deserialize(frame)
+		if err != nil {
+			continue
+		}
+		switch packet.Protocol {
+		case ip.ProtoTCP:
+			host.tcp.Receive(packet)
+		case ip.ProtoUDP:
+			host.udp.Receive(packet)
+		}
+	}
+}
+
+func newHostPair(t *testing.T) (*testHost, *testHost) {
+	t.Helper()
+	a, b := link.Pipe()
+	newHost := func(addr ip.IPAddress, wire link.Link) *testHost {
+		host := &testHost{addr: addr, wire: wire, out: make(chan []byte, 1024)}
+		host.tcp = tcp.NewTCPModule(addr, host, 1500)
+		host.udp = udp.NewUDPModule(addr, host)
+		go host.transmit()
+		go host.receive()
+		t.Cleanup(func() { wire.Close() })
+		return host
+	}
+	return newHost(ip.IPAddress{10, 0, 0, 1}, a), newHost(ip.IPAddress{10, 0, 0, 2}, b)
+}
+
+// connect opens a connection from client to a listener on server port 80.
+func connect(t *testing.T, client, server *testHost) (*TCPConn, *TCPConn) {
+	t.Helper()
+	listener, err := ListenTCP(server.tcp, ":80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	accepted := make(chan *TCPConn, 1)
+	go func() {
+		conn, err := listener.AcceptTCP()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- conn
+	}()
+	conn, err := DialTCP(client.tcp, "10.0.0.2:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, <-accepted
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestCopy(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	go func() {
+		io.Copy(serverConn, serverConn)
+		serverConn.Close()
+	}()
+
+	data := testData(200 * 1024)
+	go func() {
+		io.Copy(clientConn, bytes.NewReader(data))
+		clientConn.CloseWrite()
+	}()
+	got, err := io.ReadAll(clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("echoed %d bytes, want the %d sent", len(got), len(data))
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	client, server := newHostPair(t)
+	listener, err := ListenTCP(server.tcp, "10.0.0.2:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := &http.Server{Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, "hello "+request.URL.Path)
+	})}
+	go httpServer.Serve(listener)
+	defer httpServer.Close()
+
+	transport := &http.Transport{DialContext: Dialer{TCP: client.tcp}.DialContext}
+	defer transport.CloseIdleConnections()
+	httpClient := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	for _, path := range []string{"/a", "/b"} {
+		response, err := httpClient.Get("http://10.0.0.2" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "hello "+path {
+			t.Errorf("GET %s = %q, want %q", path, body, "hello "+path)
+		}
+	}
+}
+
+func TestDeadlines(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, _ := connect(t, client, server)
+
+	clientConn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := clientConn.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read() error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Read() error %v is not a timeout", err)
+	}
+
+	// the server never reads, so the windows and the send buffer fill up
+	clientConn.SetWriteDeadline(time.Now().Add(200 * time.Millisecond))
+	data := testData(1024 * 1024)
+	n, err := clientConn.Write(data)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write() error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	if n >= len(data) {
+		t.Errorf("Write() = %d, want fewer bytes than %d", n, len(data))
+	}
+}
+
+func TestCloseUnblocks(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, _ := connect(t, client, server)
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := clientConn.Read(make([]byte, 1))
+		read <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	clientConn.Close()
+	select {
+	case err := <-read:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Read() error = %v, want %v", err, net.ErrClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not unblock Read")
+	}
+
+	listener, err := ListenTCP(server.tcp, ":81")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accept := make(chan error, 1)
+	go func() {
+		_, err := listener.Accept()
+		accept <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	listener.Close()
+	select {
+	case err := <-accept:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Accept() error = %v, want %v", err, net.ErrClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not unblock Accept")
+	}
+}
+
+// TestCloseLosingData checks that a close which loses received data resets
+// the connection, as RFC 9293 section 3.6.1 asks, instead of sending a FIN.
+func TestCloseLosingData(t *testing.T) {
+	waitReset := func(t *testing.T, conn *TCPConn) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			_, err := conn.Write([]byte("x"))
+			if errors.Is(err, tcp.ErrConnectionReset) {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Errorf("%v was not reset", conn.LocalAddr())
+	}
+
+	t.Run("unread", func(t *testing.T) {
+		client, server := newHostPair(t)
+		clientConn, serverConn := connect(t, client, server)
+		serverConn.Write([]byte("ab"))
+		// the second byte stays unread
+		if _, err := io.ReadFull(clientConn, make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		clientConn.Close()
+		_, err := serverConn.Read(make([]byte, 1))
+		if !errors.Is(err, tcp.ErrConnectionReset) {
+			t.Errorf("Read() error = %v, want %v", err, tcp.ErrConnectionReset)
+		}
+	})
+
+	t.Run("late", func(t *testing.T) {
+		client, server := newHostPair(t)
+		clientConn, serverConn := connect(t, client, server)
+		clientConn.Close()
+		if _, err := serverConn.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("Read() error = %v, want %v", err, io.EOF)
+		}
+		waitReset(t, serverConn)
+	})
+
+	t.Run("read", func(t *testing.T) {
+		client, server := newHostPair(t)
+		clientConn, serverConn := connect(t, client, server)
+		serverConn.Write([]byte("ab"))
+		if _, err := io.ReadFull(clientConn, make([]byte, 2)); err != nil {
+			t.Fatal(err)
+		}
+		clientConn.Close()
+		if _, err := serverConn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("Read() error = %v, want %v", err, io.EOF)
+		}
+	})
+}
+
+func TestDialContext(t *testing.T) {
+	client, _ := newHostPair(t)
+	if _, err := (Dialer{TCP: client.tcp}).DialContext(context.Background(), "udp", "10.0.0.2:80"); !errors.Is(err, ErrUnsupportedNetwork) {
+		t.Errorf("DialContext() error = %v, want %v", err, ErrUnsupportedNetwork)
+	}
+}
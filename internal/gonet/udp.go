@@ -0,0 +1,104 @@
+package gonet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"tcp-ip/internal/udp"
+	"time"
+)
+
+var _ net.PacketConn = (*UDPConn)(nil)
+
+// UDPConn adapts a socket of the simulated UDP to net.PacketConn.
+type UDPConn struct {
+	socket        *udp.Socket
+	writeDeadline atomic.Pointer[time.Time]
+}
+
+// ListenUDP binds "host:port", where host is empty or the address of the
+// module and port 0 picks an ephemeral port.
+func ListenUDP(module *udp.UDPModule, address string) (*UDPConn, error) {
+	host, port, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if host != ([4]byte{}) && host != module.Addr() {
+		return nil, fmt.Errorf("cannot listen on %v: not a local address", host)
+	}
+	socket, err := module.Bind(port)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udp", Addr: &net.UDPAddr{IP: toNetIP(module.Addr()), Port: int(port)}, Err: err}
+	}
+	return &UDPConn{socket: socket}, nil
+}
+
+func (conn *UDPConn) opError(op string, addr net.Addr, err error) error {
+	if errors.Is(err, udp.ErrSocketClosed) {
+		err = net.ErrClosed
+	}
+	return &net.OpError{Op: op, Net: "udp", Source: conn.LocalAddr(), Addr: addr, Err: err}
+}
+
+// ReadFrom reads one datagram, discarding what does not fit into p.
+func (conn *UDPConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	data, src, srcPort, err := conn.socket.RecvFrom()
+	if err != nil {
+		return 0, nil, conn.opError("read", nil, err)
+	}
+	return copy(p, data), &net.UDPAddr{IP: toNetIP(src), Port: int(srcPort)}, nil
+}
+
+func (conn *UDPConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, conn.opError("write", addr, fmt.Errorf("%w: %T", ErrUnsupportedNetwork, addr))
+	}
+	dst, err := fromNetIP(udpAddr.IP)
+	if err != nil {
+		return 0, conn.opError("write", addr, err)
+	}
+	if deadline := conn.writeDeadline.Load(); deadline != nil && !time.Now().Before(*deadline) {
+		return 0, conn.opError("write", addr, os.ErrDeadlineExceeded)
+	}
+	err = conn.socket.SendTo(p, dst, uint16(udpAddr.Port))
+	if err != nil {
+		return 0, conn.opError("write", addr, err)
+	}
+	return len(p), nil
+}
+
+func (conn *UDPConn) Close() error {
+	err := conn.socket.Close()
+	if err != nil {
+		return conn.opError("close", nil, err)
+	}
+	return nil
+}
+
+func (conn *UDPConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: toNetIP(conn.socket.LocalIP()), Port: int(conn.socket.LocalPort())}
+}
+
+func (conn *UDPConn) SetDeadline(t time.Time) error {
+	conn.SetReadDeadline(t)
+	return conn.SetWriteDeadline(t)
+}
+
+func (conn *UDPConn) SetReadDeadline(t time.Time) error {
+	conn.socket.SetReadDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline only fails later writes, since sending a datagram never
+// blocks.
+func (conn *UDPConn) SetWriteDeadline(t time.Time) error {
+	if t.IsZero() {
+		conn.writeDeadline.Store(nil)
+	} else {
+		conn.writeDeadline.Store(&t)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package gonet
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUDPRoundTrip(t *testing.T) {
+	client, server := newHostPair(t)
+	serverConn, err := ListenUDP(server.udp, ":53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close()
+	clientConn, err := ListenUDP(client.udp, ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+
+	serverAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 53}
+	if _, err := clientConn.WriteTo([]byte("query"), serverAddr); err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 64)
+	n, from, err := serverConn.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buffer[:n]) != "query" || from.String() != clientConn.LocalAddr().String() {
+		t.Errorf("ReadFrom() = %q from %v, want %q from %v", buffer[:n], from, "query", clientConn.LocalAddr())
+	}
+
+	if _, err := serverConn.WriteTo([]byte("answer"), from); err != nil {
+		t.Fatal(err)
+	}
+	n, from, err = clientConn.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buffer[:n]) != "answer" || from.String() != serverAddr.String() {
+		t.Errorf("ReadFrom() = %q from %v, want %q from %v", buffer[:n], from, "answer", serverAddr)
+	}
+}
+
+func TestUDPDeadlines(t *testing.T) {
+	_, server := newHostPair(t)
+	conn, err := ListenUDP(server.udp, ":53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, err := conn.ReadFrom(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("ReadFrom() error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	if _, err := conn.WriteTo([]byte("late"), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 53}); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("WriteTo() error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+}
+
+func TestUDPCloseUnblocks(t *testing.T) {
+	_, server := newHostPair(t)
+	conn, err := ListenUDP(server.udp, ":53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadFrom(make([]byte, 1))
+		read <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-read:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("ReadFrom() error = %v, want %v", err, net.ErrClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not unblock ReadFrom")
+	}
+}
@@ -0,0 +1,212 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"tcp-ip/internal/ip"
+	"time"
+)
+
+var (
+	ErrDestUnreachable = fmt.Errorf("destination unreachable")
+	ErrTimeExceeded    = fmt.Errorf("time exceeded")
+	ErrEchoTimeout     = fmt.Errorf("request timed out")
+)
+
+const (
+	HeaderSize  = 8
+	quotedBytes = 8
+)
+
+const (
+	TypeEchoReply       uint8 = 0
+	TypeDestUnreachable uint8 = 3
+	TypeEchoRequest     uint8 = 8
+	TypeTimeExceeded    uint8 = 11
+)
+
+const (
+	CodeNetUnreachable uint8 = iota
+	CodeHostUnreachable
+	CodeProtoUnreachable
+	CodePortUnreachable
+	CodeFragNeeded
+)
+
+const (
+	CodeTTLExceeded uint8 = iota
+	CodeReassemblyExceeded
+)
+
+type sender interface {
+	SendToIP(message []byte, dst ip.IPAddress, protocol uint8) error
+	// IsBroadcast reports whether address is the broadcast address of a
+	// subnet the node is attached to
+	IsBroadcast(address ip.IPAddress) bool
+}
+
+type EchoResult struct {
+	From     ip.IPAddress
+	Sequence uint16
+	TTL      uint8
+	Size     int
+	Err      error
+}
+
+type echoKey struct {
+	identifier uint16
+	sequence   uint16
+}
+
+type ICMPModule struct {
+	sender  sender
+	waiting map[echoKey]chan EchoResult
+	mutex   *sync.Mutex
+}
+
+func NewICMPModule(sender sender) *ICMPModule {
+	return &ICMPModule{
+		sender:  sender,
+		waiting: make(map[echoKey]chan EchoResult),
+		mutex:   new(sync.Mutex),
+	}
+}
+
+func (icmp *ICMPModule) send(message *Message, dst ip.IPAddress) error {
+	return icmp.sender.SendToIP(message.Serialize(), dst, ip.ProtoICMP)
+}
+
+// Echo sends an echo request and returns a channel that receives the reply,
+// or the error reported by an intermediate node, exactly once.
+func (icmp *ICMPModule) Echo(dst ip.IPAddress, identifier, sequence uint16, payload []byte) (<-chan EchoResult, error) {
+	key := echoKey{identifier: identifier, sequence: sequence}
+	ch := make(chan EchoResult, 1)
+	icmp.mutex.Lock()
+	icmp.waiting[key] = ch
+	icmp.mutex.Unlock()
+
+	message := &Message{Type: TypeEchoRequest, Identifier: identifier, Sequence: sequence, Data: payload}
+	err := icmp.send(message, dst)
+	if err != nil {
+		icmp.CancelEcho(identifier, sequence)
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (icmp *ICMPModule) CancelEcho(identifier, sequence uint16) {
+	icmp.mutex.Lock()
+	delete(icmp.waiting, echoKey{identifier: identifier, sequence: sequence})
+	icmp.mutex.Unlock()
+}
+
+func (icmp *ICMPModule) AwaitEcho(ch <-chan EchoResult, identifier, sequence uint16, timeout time.Duration) EchoResult {
+	select {
+	case result := <-ch:
+		return result
+	case <-time.After(timeout):
+		icmp.CancelEcho(identifier, sequence)
+		return EchoResult{Sequence: sequence, Err: ErrEchoTimeout}
+	}
+}
+
+func (icmp *ICMPModule) deliver(key echoKey, result EchoResult) {
+	icmp.mutex.Lock()
+	ch, ok := icmp.waiting[key]
+	delete(icmp.waiting, key)
+	icmp.mutex.Unlock()
+	if ok {
+		ch <- result
+	}
+}
+
+// groupAddress reports whether address names more than one host.
+func (icmp *ICMPModule) groupAddress(address ip.IPAddress) bool {
+	return address == ip.LimitedBroadcast || address.IsMulticast() || icmp.sender.IsBroadcast(address)
+}
+
+// sendError reports a problem with original back to its source, following
+// the RFC 1122 rules on which datagrams must never trigger an ICMP error.
+func (icmp *ICMPModule) sendError(errType, code uint8, rest uint16, original *ip.Packet) error {
+	if original.FragmentOffset != 0 || original.SrcIP == (ip.IPAddress{}) {
+		return nil
+	}
+	// a datagram to many hosts would draw an error from each of them, and
+	// one from a group address has nobody to report to
+	if icmp.groupAddress(original.DstIP) || icmp.groupAddress(original.SrcIP) {
+		return nil
+	}
+	if original.Protocol == ip.ProtoICMP {
+		if len(original.Data) < 1 || (original.Data[0] != TypeEchoRequest && original.Data[0] != TypeEchoReply) {
+			return nil
+		}
+	}
+
+	quoted := original.Serialize()
+	quoted = quoted[:min(len(quoted), original.HeaderLength()+quotedBytes)]
+	message := &Message{Type: errType, Code: code, Sequence: rest, Data: quoted}
+	return icmp.send(message, original.SrcIP)
+}
+
+func (icmp *ICMPModule) SendDestUnreachable(code uint8, original *ip.Packet) error {
+	return icmp.sendError(TypeDestUnreachable, code, 0, original)
+}
+
+func (icmp *ICMPModule) SendFragNeeded(mtu int, original *ip.Packet) error {
+	return icmp.sendError(TypeDestUnreachable, CodeFragNeeded, uint16(mtu), original)
+}
+
+func (icmp *ICMPModule) SendTimeExceeded(code uint8, original *ip.Packet) error {
+	return icmp.sendError(TypeTimeExceeded, code, 0, original)
+}
+
+func (icmp *ICMPModule) handleError(packet *ip.Packet, message *Message, err error) error {
+	// the quoted datagram is truncated, so only its header is inspected
+	if len(message.Data) < ip.MinHeaderSize {
+		return fmt.Errorf("invalid message: quoted datagram too short")
+	}
+	headerLength := int(message.Data[0]&0x0F) * 4
+	protocol := message.Data[9]
+	if protocol != ip.ProtoICMP || len(message.Data) < headerLength+HeaderSize {
+		return nil
+	}
+
+	quoted := message.Data[headerLength:]
+	if quoted[0] != TypeEchoRequest {
+		return nil
+	}
+	key := echoKey{
+		identifier: binary.BigEndian.Uint16(quoted[4:6]),
+		sequence:   binary.BigEndian.Uint16(quoted[6:8]),
+	}
+	icmp.deliver(key, EchoResult{From: packet.SrcIP, Sequence: key.sequence, Err: fmt.Errorf("%w (code %d)", err, message.Code)})
+	return nil
+}
+
+func (icmp *ICMPModule) Receive(packet *ip.Packet) error {
+	message, err := Deserialize(packet.Data)
+	if err != nil {
+		return err
+	}
+
+	switch message.Type {
+	case TypeEchoRequest:
+		reply := &Message{Type: TypeEchoReply, Identifier: message.Identifier, Sequence: message.Sequence, Data: message.Data}
+		return icmp.send(reply, packet.SrcIP)
+
+	case TypeEchoReply:
+		key := echoKey{identifier: message.Identifier, sequence: message.Sequence}
+		icmp.deliver(key, EchoResult{From: packet.SrcIP, Sequence: message.Sequence, TTL: packet.TTL, Size: len(packet.Data)})
+		return nil
+
+	case TypeDestUnreachable:
+		return icmp.handleError(packet, message, ErrDestUnreachable)
+
+	case TypeTimeExceeded:
+		return icmp.handleError(packet, message, ErrTimeExceeded)
+
+	default:
+		return fmt.Errorf("unrecognized ICMP type %d", message.Type)
+	}
+}
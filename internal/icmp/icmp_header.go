@@ -0,0 +1,51 @@
+package icmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"tcp-ip/internal/ip"
+)
+
+// Message is an ICMP message. Identifier and Sequence hold the second header
+// word, which error messages leave unused except for the next-hop MTU of a
+// fragmentation needed error, stored in Sequence.
+type Message struct {
+	Type       uint8
+	Code       uint8
+	Checksum   uint16
+	Identifier uint16
+	Sequence   uint16
+	Data       []byte
+}
+
+func (message *Message) Serialize() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(message.Type)
+	buf.WriteByte(message.Code)
+	_ = binary.Write(buf, binary.BigEndian, uint16(0))
+	_ = binary.Write(buf, binary.BigEndian, message.Identifier)
+	_ = binary.Write(buf, binary.BigEndian, message.Sequence)
+	buf.Write(message.Data)
+	data := buf.Bytes()
+	message.Checksum = ip.Checksum(data)
+	binary.BigEndian.PutUint16(data[2:4], message.Checksum)
+	return data
+}
+
+func Deserialize(data []byte) (*Message, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("invalid message: message shorter than the header")
+	}
+	if ip.Checksum(data) != 0 {
+		return nil, fmt.Errorf("invalid message: checksum doesn't match")
+	}
+	message := &Message{}
+	message.Type = data[0]
+	message.Code = data[1]
+	message.Checksum = binary.BigEndian.Uint16(data[2:4])
+	message.Identifier = binary.BigEndian.Uint16(data[4:6])
+	message.Sequence = binary.BigEndian.Uint16(data[6:8])
+	message.Data = data[HeaderSize:]
+	return message, nil
+}
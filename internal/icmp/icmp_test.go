@@ -0,0 +1,235 @@
+package icmp
+
+import (
+	"bytes"
+	"errors"
+	"tcp-ip/internal/ip"
+	"testing"
+	"time"
+)
+
+var (
+	local  = ip.IPAddress{10, 0, 0, 1}
+	remote = ip.IPAddress{10, 0, 1, 1}
+)
+
+type sent struct {
+	message *Message
+	dst     ip.IPAddress
+}
+
+type fakeSender struct {
+	sent []sent
+}
+
+// the fake sender is attached to 10.0.0.0/24
+var directedBroadcast = ip.IPAddress{10, 0, 0, 255}
+
+func (sender *fakeSender) IsBroadcast(address ip.IPAddress) bool {
+	return address == ip.LimitedBroadcast || address == directedBroadcast
+}
+
+func (sender *fakeSender) SendToIP(data []byte, dst ip.IPAddress, protocol uint8) error {
+	message, err := Deserialize(data)
+	if err != nil || protocol != ip.ProtoICMP {
+		return errors.New("sent an invalid ICMP message")
+	}
+	sender.sent = append(sender.sent, sent{message, dst})
+	return nil
+}
+
+func packetOf(t *testing.T, src, dst ip.IPAddress, protocol uint8, data []byte) *ip.Packet {
+	t.Helper()
+	packet, err := ip.NewPacket(src, dst, protocol, 1, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	message := &Message{Type: TypeEchoRequest, Identifier: 0x1234, Sequence: 7, Data: []byte("ping")}
+	data := message.Serialize()
+	if ip.Checksum(data) != 0 {
+		t.Fatalf("serialized message does not check out")
+	}
+	got, err := Deserialize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != message.Type || got.Identifier != message.Identifier || got.Sequence != message.Sequence ||
+		!bytes.Equal(got.Data, message.Data) {
+		t.Errorf("Deserialize() = %+v, want %+v", got, message)
+	}
+
+	if _, err := Deserialize(data[:HeaderSize-1]); err == nil {
+		t.Errorf("Deserialize() accepted a truncated header")
+	}
+	data[len(data)-1] ^= 1
+	if _, err := Deserialize(data); err == nil {
+		t.Errorf("Deserialize() accepted a bad checksum")
+	}
+}
+
+func TestEcho(t *testing.T) {
+	sender := new(fakeSender)
+	module := NewICMPModule(sender)
+	ch, err := module.Echo(remote, 3, 1, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.sent) != 1 || sender.sent[0].message.Type != TypeEchoRequest || sender.sent[0].dst != remote {
+		t.Fatalf("sent %+v, want one echo request", sender.sent)
+	}
+
+	// the remote end answers with what it was sent
+	remoteSender := new(fakeSender)
+	request := sender.sent[0].message.Serialize()
+	if err := NewICMPModule(remoteSender).Receive(packetOf(t, local, remote, ip.ProtoICMP, request)); err != nil {
+		t.Fatal(err)
+	}
+	if len(remoteSender.sent) != 1 || remoteSender.sent[0].dst != local {
+		t.Fatalf("remote sent %+v, want one reply", remoteSender.sent)
+	}
+	reply := remoteSender.sent[0].message
+	if reply.Type != TypeEchoReply || reply.Identifier != 3 || reply.Sequence != 1 || string(reply.Data) != "hello" {
+		t.Fatalf("reply = %+v", reply)
+	}
+
+	if err := module.Receive(packetOf(t, remote, local, ip.ProtoICMP, reply.Serialize())); err != nil {
+		t.Fatal(err)
+	}
+	result := module.AwaitEcho(ch, 3, 1, time.Second)
+	if result.Err != nil || result.From != remote || result.Sequence != 1 {
+		t.Errorf("AwaitEcho() = %+v", result)
+	}
+}
+
+func TestEchoTimeout(t *testing.T) {
+	module := NewICMPModule(new(fakeSender))
+	ch, err := module.Echo(remote, 1, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := module.AwaitEcho(ch, 1, 1, time.Millisecond); !errors.Is(result.Err, ErrEchoTimeout) {
+		t.Errorf("AwaitEcho() error = %v, want %v", result.Err, ErrEchoTimeout)
+	}
+	if len(module.waiting) != 0 {
+		t.Errorf("timed out echo still waiting")
+	}
+}
+
+func TestEchoError(t *testing.T) {
+	tests := []struct {
+		name string
+		kind uint8
+		code uint8
+		want error
+	}{
+		{"unreachable", TypeDestUnreachable, CodeHostUnreachable, ErrDestUnreachable},
+		{"time exceeded", TypeTimeExceeded, CodeTTLExceeded, ErrTimeExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sender := new(fakeSender)
+			module := NewICMPModule(sender)
+			ch, err := module.Echo(remote, 9, 4, []byte("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := packetOf(t, local, remote, ip.ProtoICMP, sender.sent[0].message.Serialize())
+
+			// a router on the way reports the request
+			routerSender := new(fakeSender)
+			router := NewICMPModule(routerSender)
+			if err := router.sendError(test.kind, test.code, 0, request); err != nil {
+				t.Fatal(err)
+			}
+			if len(routerSender.sent) != 1 {
+				t.Fatalf("router sent %d messages, want 1", len(routerSender.sent))
+			}
+			report := routerSender.sent[0].message
+			if len(report.Data) != ip.MinHeaderSize+quotedBytes {
+				t.Errorf("quoted %d bytes, want %d", len(report.Data), ip.MinHeaderSize+quotedBytes)
+			}
+
+			hop := ip.IPAddress{10, 0, 0, 254}
+			if err := module.Receive(packetOf(t, hop, local, ip.ProtoICMP, report.Serialize())); err != nil {
+				t.Fatal(err)
+			}
+			result := module.AwaitEcho(ch, 9, 4, time.Second)
+			if !errors.Is(result.Err, test.want) || result.From != hop {
+				t.Errorf("AwaitEcho() = %+v, want %v from %v", result, test.want, hop)
+			}
+		})
+	}
+}
+
+func TestSendErrorRules(t *testing.T) {
+	errorMessage := (&Message{Type: TypeDestUnreachable, Code: CodePortUnreachable}).Serialize()
+	echo := (&Message{Type: TypeEchoRequest}).Serialize()
+	tests := []struct {
+		name   string
+		packet func(t *testing.T) *ip.Packet
+		report bool
+	}{
+		{"udp datagram", func(t *testing.T) *ip.Packet {
+			return packetOf(t, remote, local, ip.ProtoUDP, make([]byte, 100))
+		}, true},
+		{"echo request", func(t *testing.T) *ip.Packet {
+			return packetOf(t, remote, local, ip.ProtoICMP, echo)
+		}, true},
+		{"icmp error", func(t *testing.T) *ip.Packet {
+			return packetOf(t, remote, local, ip.ProtoICMP, errorMessage)
+		}, false},
+		{"later fragment", func(t *testing.T) *ip.Packet {
+			packet := packetOf(t, remote, local, ip.ProtoUDP, make([]byte, 100))
+			packet.FragmentOffset = 10
+			return packet
+		}, false},
+		{"unspecified source", func(t *testing.T) *ip.Packet {
+			return packetOf(t, ip.IPAddress{}, local, ip.ProtoUDP, make([]byte, 100))
+		}, false},
+		{"limited broadcast", func(t *testing.T) *ip.Packet {
+			return packetOf(t, remote, ip.LimitedBroadcast, ip.ProtoUDP, make([]byte, 100))
+		}, false},
+		{"directed broadcast", func(t *testing.T) *ip.Packet {
+			return packetOf(t, remote, directedBroadcast, ip.ProtoUDP, make([]byte, 100))
+		}, false},
+		{"multicast", func(t *testing.T) *ip.Packet {
+			return packetOf(t, remote, ip.IPAddress{224, 0, 0, 1}, ip.ProtoUDP, make([]byte, 100))
+		}, false},
+		{"multicast source", func(t *testing.T) *ip.Packet {
+			return packetOf(t, ip.IPAddress{239, 1, 2, 3}, local, ip.ProtoUDP, make([]byte, 100))
+		}, false},
+		{"broadcast source", func(t *testing.T) *ip.Packet {
+			return packetOf(t, directedBroadcast, local, ip.ProtoUDP, make([]byte, 100))
+		}, false},
+		{"last unicast before multicast", func(t *testing.T) *ip.Packet {
+			return packetOf(t, remote, ip.IPAddress{223, 255, 255, 254}, ip.ProtoUDP, make([]byte, 100))
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sender := new(fakeSender)
+			if err := NewICMPModule(sender).SendDestUnreachable(CodePortUnreachable, test.packet(t)); err != nil {
+				t.Fatal(err)
+			}
+			if reported := len(sender.sent) == 1; reported != test.report {
+				t.Errorf("reported = %t, want %t", reported, test.report)
+			}
+		})
+	}
+}
+
+func TestSendFragNeeded(t *testing.T) {
+	sender := new(fakeSender)
+	packet := packetOf(t, remote, local, ip.ProtoUDP, make([]byte, 1500))
+	if err := NewICMPModule(sender).SendFragNeeded(1400, packet); err != nil {
+		t.Fatal(err)
+	}
+	message := sender.sent[0].message
+	if message.Type != TypeDestUnreachable || message.Code != CodeFragNeeded || message.Sequence != 1400 {
+		t.Errorf("sent %+v, want fragmentation needed with mtu 1400", message)
+	}
+}
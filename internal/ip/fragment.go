@@ -0,0 +1,103 @@
+package ip
+
+import (
+	"fmt"
+)
+
+var ErrFragmentationNeeded = fmt.Errorf("packet exceeds the MTU and has the don't fragment flag set")
+
+const optionCopied = 0x80
+
+const (
+	optionEnd = iota
+	optionNOP
+)
+
+// copiedOptions returns the options that RFC 791 requires to be repeated in
+// every fragment, padded to a multiple of 4 bytes.
+func copiedOptions(options []byte) []byte {
+	var copied []byte
+	for i := 0; i < len(options); {
+		optionType := options[i]
+		if optionType == optionEnd {
+			break
+		}
+		if optionType == optionNOP {
+			i++
+			continue
+		}
+		if i+1 >= len(options) {
+			break
+		}
+		length := int(options[i+1])
+		if length < 2 || i+length > len(options) {
+			break
+		}
+		if optionType&optionCopied != 0 {
+			copied = append(copied, options[i:i+length]...)
+		}
+		i += length
+	}
+	for len(copied)%4 != 0 {
+		copied = append(copied, optionEnd)
+	}
+	return copied
+}
+
+// Fragment splits packet into fragments whose total length fits in mtu. The
+// packet is returned as is when it already fits.
+func Fragment(packet *Packet, mtu int) ([]*Packet, error) {
+	if int(packet.TotalLength) <= mtu {
+		return []*Packet{packet}, nil
+	}
+	if packet.Flags&FlagDontFrag != 0 {
+		return nil, ErrFragmentationNeeded
+	}
+
+	firstHeader := packet.HeaderLength()
+	restOptions := copiedOptions(packet.Options)
+	restHeader := MinHeaderSize + len(restOptions)
+	if (mtu-firstHeader)&^7 <= 0 {
+		return nil, fmt.Errorf("mtu %d too small to fragment packet", mtu)
+	}
+
+	var fragments []*Packet
+	data := packet.Data
+	offset := 0
+	for offset < len(data) {
+		headerLength, options := restHeader, restOptions
+		if offset == 0 {
+			headerLength, options = firstHeader, packet.Options
+		}
+
+		size := len(data) - offset
+		moreFragments := packet.Flags & FlagMoreFrags
+		if headerLength+size > mtu {
+			size = (mtu - headerLength) &^ 7
+			moreFragments = FlagMoreFrags
+		}
+
+		fragments = append(fragments, &Packet{
+			Version:        packet.Version,
+			IHL:            uint8(headerLength / 4),
+			DSCP:           packet.DSCP,
+			ECN:            packet.ECN,
+			TotalLength:    uint16(headerLength + size),
+			ID:             packet.ID,
+			Flags:          packet.Flags&^FlagMoreFrags | moreFragments,
+			FragmentOffset: packet.FragmentOffset + uint16(offset/8),
+			TTL:            packet.TTL,
+			Protocol:       packet.Protocol,
+			SrcIP:          packet.SrcIP,
+			DstIP:          packet.DstIP,
+			Options:        options,
+			Data:           data[offset : offset+size],
+		})
+		offset += size
+	}
+	return fragments, nil
+}
+
+func (packet *Packet) IsFragment() bool {
+	return packet.Flags&FlagMoreFrags != 0 || packet.FragmentOffset != 0
+}
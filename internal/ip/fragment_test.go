@@ -0,0 +1,103 @@
+package ip
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testPacket(t *testing.T, size int) *Packet {
+	t.Helper()
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	packet, err := NewPacket(IPAddress{10, 0, 0, 1}, IPAddress{10, 0, 1, 1}, ProtoTest, 7, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func TestFragment(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		mtu   int
+		sizes []int
+	}{
+		{"fits", 100, 1500, []int{100}},
+		{"exactly the mtu", 1480, 1500, []int{1480}},
+		{"two fragments", 1481, 1500, []int{1480, 1}},
+		{"size rounded down to 8", 100, 47, []int{24, 24, 24, 24, 4}},
+		{"many fragments", 4000, 576, []int{552, 552, 552, 552, 552, 552, 552, 136}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packet := testPacket(t, test.size)
+			fragments, err := Fragment(packet, test.mtu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fragments) != len(test.sizes) {
+				t.Fatalf("got %d fragments, want %d", len(fragments), len(test.sizes))
+			}
+			offset := 0
+			for i, fragment := range fragments {
+				if len(fragment.Data) != test.sizes[i] {
+					t.Errorf("fragment %d carries %d bytes, want %d", i, len(fragment.Data), test.sizes[i])
+				}
+				if int(fragment.TotalLength) > test.mtu || int(fragment.TotalLength) != fragment.HeaderLength()+len(fragment.Data) {
+					t.Errorf("fragment %d has total length %d", i, fragment.TotalLength)
+				}
+				if int(fragment.FragmentOffset)*8 != offset {
+					t.Errorf("fragment %d at offset %d, want %d", i, int(fragment.FragmentOffset)*8, offset)
+				}
+				last := i == len(fragments)-1
+				if (fragment.Flags&FlagMoreFrags != 0) == last {
+					t.Errorf("fragment %d has flags %#x", i, fragment.Flags)
+				}
+				if !bytes.Equal(fragment.Data, packet.Data[offset:offset+len(fragment.Data)]) {
+					t.Errorf("fragment %d carries the wrong data", i)
+				}
+				offset += len(fragment.Data)
+			}
+		})
+	}
+}
+
+func TestFragmentDontFragment(t *testing.T) {
+	packet := testPacket(t, 1500)
+	packet.Flags = FlagDontFrag
+	if _, err := Fragment(packet, 1500); !errors.Is(err, ErrFragmentationNeeded) {
+		t.Errorf("Fragment() error = %v, want %v", err, ErrFragmentationNeeded)
+	}
+	if _, err := Fragment(testPacket(t, 100), MinHeaderSize+7); err == nil {
+		t.Errorf("Fragment() accepted an mtu that leaves no room for data")
+	}
+}
+
+func TestFragmentOptions(t *testing.T) {
+	packet := testPacket(t, 64)
+	// a copied security option, a NOP and a record route option that is not
+	// copied
+	packet.Options = []byte{0x82, 4, 0xAA, 0xBB, optionNOP, 0x07, 3, 0, optionEnd, optionEnd, optionEnd, optionEnd}
+	packet.IHL = uint8((MinHeaderSize + len(packet.Options)) / 4)
+	packet.TotalLength = uint16(packet.HeaderLength() + len(packet.Data))
+
+	fragments, err := Fragment(packet, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fragments[0].Options, packet.Options) {
+		t.Errorf("first fragment options = %x, want %x", fragments[0].Options, packet.Options)
+	}
+	for _, fragment := range fragments[1:] {
+		if !bytes.Equal(fragment.Options, []byte{0x82, 4, 0xAA, 0xBB}) {
+			t.Errorf("later fragment options = %x, want only the copied option", fragment.Options)
+		}
+		if fragment.HeaderLength() != MinHeaderSize+4 {
+			t.Errorf("later fragment header length = %d", fragment.HeaderLength())
+		}
+	}
+}
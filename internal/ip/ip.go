@@ -6,6 +6,15 @@ import (
 
 type IPAddress [4]byte
 
+func (ip IPAddress) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d", ip[0], ip[1], ip[2], ip[3])
+}
+
+// IsMulticast reports whether ip is in the class D range, 224.0.0.0/4.
+func (ip IPAddress) IsMulticast() bool {
+	return ip[0]&0xF0 == 0xE0
+}
+
 func ParseIP(ipString string) (IPAddress, error) {
 	var ip IPAddress
 
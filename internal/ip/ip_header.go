@@ -0,0 +1,170 @@
+package ip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	Version4       uint8 = 4
+	MinHeaderSize        = 20
+	MaxHeaderSize        = 60
+	MaxPacketSize        = 65535
+	DefaultTTL     uint8 = 64
+	FlagDontFrag   uint8 = 0x2
+	FlagMoreFrags  uint8 = 0x1
+	fragOffsetMask       = 0x1FFF
+)
+
+const (
+	ProtoICMP uint8 = 1
+	ProtoTCP  uint8 = 6
+	ProtoUDP  uint8 = 17
+	ProtoTest uint8 = 253
+)
+
+type Packet struct {
+	Version        uint8
+	IHL            uint8
+	DSCP           uint8
+	ECN            uint8
+	TotalLength    uint16
+	ID             uint16
+	Flags          uint8
+	FragmentOffset uint16
+	TTL            uint8
+	Protocol       uint8
+	Checksum       uint16
+	SrcIP          IPAddress
+	DstIP          IPAddress
+	Options        []byte
+	Data           []byte
+}
+
+// Checksum computes the RFC 1071 internet checksum, the one's complement of
+// the one's complement sum of the 16 bit words in data.
+func Checksum(data []byte) uint16 {
+	return ^foldSum(Sum(0, data))
+}
+
+// Sum adds data to a running 32 bit one's complement accumulator so that
+// pseudo-headers and payloads can be summed without being concatenated.
+func Sum(sum uint32, data []byte) uint32 {
+	for len(data) >= 2 {
+		sum += uint32(binary.BigEndian.Uint16(data))
+		data = data[2:]
+	}
+	if len(data) == 1 {
+		sum += uint32(data[0]) << 8
+	}
+	return sum
+}
+
+// PseudoHeaderSum sums the RFC 768 pseudo-header that the transport
+// checksums cover along with the segment itself.
+func PseudoHeaderSum(src, dst IPAddress, protocol uint8, length int) uint32 {
+	sum := Sum(0, src[:])
+	sum = Sum(sum, dst[:])
+	return sum + uint32(protocol) + uint32(length)
+}
+
+func FinishChecksum(sum uint32) uint16 {
+	return ^foldSum(sum)
+}
+
+func foldSum(sum uint32) uint16 {
+	for sum>>16 != 0 {
+		sum = (sum & 0xFFFF) + (sum >> 16)
+	}
+	return uint16(sum)
+}
+
+func (packet *Packet) HeaderLength() int {
+	return int(packet.IHL) * 4
+}
+
+func (packet *Packet) serializeHeader() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(packet.Version<<4 | packet.IHL&0x0F)
+	buf.WriteByte(packet.DSCP<<2 | packet.ECN&0x03)
+	_ = binary.Write(buf, binary.BigEndian, packet.TotalLength)
+	_ = binary.Write(buf, binary.BigEndian, packet.ID)
+	_ = binary.Write(buf, binary.BigEndian, uint16(packet.Flags)<<13|packet.FragmentOffset&fragOffsetMask)
+	buf.WriteByte(packet.TTL)
+	buf.WriteByte(packet.Protocol)
+	_ = binary.Write(buf, binary.BigEndian, uint16(0))
+	buf.Write(packet.SrcIP[:])
+	buf.Write(packet.DstIP[:])
+	buf.Write(packet.Options)
+	return buf.Bytes()
+}
+
+func (packet *Packet) Serialize() []byte {
+	header := packet.serializeHeader()
+	packet.Checksum = Checksum(header)
+	binary.BigEndian.PutUint16(header[10:12], packet.Checksum)
+	return append(header, packet.Data...)
+}
+
+func Deserialize(data []byte) (*Packet, error) {
+	if len(data) < MinHeaderSize {
+		return nil, fmt.Errorf("invalid packet: packet shorter than the minimum header")
+	}
+	packet := &Packet{}
+	packet.Version = data[0] >> 4
+	packet.IHL = data[0] & 0x0F
+	if packet.Version != Version4 {
+		return nil, fmt.Errorf("invalid packet: unsupported version %d", packet.Version)
+	}
+	headerLength := packet.HeaderLength()
+	if headerLength < MinHeaderSize {
+		return nil, fmt.Errorf("invalid packet: header length too small")
+	}
+	if headerLength > len(data) {
+		return nil, fmt.Errorf("invalid packet: truncated header")
+	}
+	packet.DSCP = data[1] >> 2
+	packet.ECN = data[1] & 0x03
+	packet.TotalLength = binary.BigEndian.Uint16(data[2:4])
+	if int(packet.TotalLength) < headerLength || int(packet.TotalLength) > len(data) {
+		return nil, fmt.Errorf("invalid packet: invalid total length")
+	}
+	packet.ID = binary.BigEndian.Uint16(data[4:6])
+	flagsOffset := binary.BigEndian.Uint16(data[6:8])
+	packet.Flags = uint8(flagsOffset >> 13)
+	packet.FragmentOffset = flagsOffset & fragOffsetMask
+	if packet.Flags&0x4 != 0 {
+		return nil, fmt.Errorf("invalid packet: reserved flag set")
+	}
+	packet.TTL = data[8]
+	packet.Protocol = data[9]
+	packet.Checksum = binary.BigEndian.Uint16(data[10:12])
+	if Checksum(data[:headerLength]) != 0 {
+		return nil, fmt.Errorf("invalid packet: checksum doesn't match")
+	}
+	packet.SrcIP = IPAddress(data[12:16])
+	packet.DstIP = IPAddress(data[16:20])
+	packet.Options = data[MinHeaderSize:headerLength]
+	// frames shorter than the ethernet minimum are padded, so the payload
+	// is bounded by the total length and not by the buffer
+	packet.Data = data[headerLength:packet.TotalLength]
+	return packet, nil
+}
+
+func NewPacket(src, dst IPAddress, protocol uint8, id uint16, data []byte) (*Packet, error) {
+	if len(data)+MinHeaderSize > MaxPacketSize {
+		return nil, fmt.Errorf("data length exceeds the maximum packet size")
+	}
+	return &Packet{
+		Version:     Version4,
+		IHL:         MinHeaderSize / 4,
+		TotalLength: uint16(MinHeaderSize + len(data)),
+		ID:          id,
+		TTL:         DefaultTTL,
+		Protocol:    protocol,
+		SrcIP:       src,
+		DstIP:       dst,
+		Data:        data,
+	}, nil
+}
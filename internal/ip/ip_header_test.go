@@ -0,0 +1,107 @@
+package ip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want uint16
+	}{
+		{"empty", nil, 0xFFFF},
+		// the example of RFC 1071 section 3
+		{"rfc 1071", []byte{0x00, 0x01, 0xF2, 0x03, 0xF4, 0xF5, 0xF6, 0xF7}, 0x220D},
+		{"ipv4 header", []byte{
+			0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11,
+			0x00, 0x00, 0xC0, 0xA8, 0x00, 0x01, 0xC0, 0xA8, 0x00, 0xC7,
+		}, 0xB861},
+		{"odd length", []byte{0x01, 0x02, 0x03}, ^uint16(0x0102 + 0x0300)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Checksum(test.data); got != test.want {
+				t.Errorf("Checksum() = %#04x, want %#04x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSumInPieces(t *testing.T) {
+	data := []byte{0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11}
+	sum := Sum(Sum(0, data[:4]), data[4:])
+	if FinishChecksum(sum) != Checksum(data) {
+		t.Errorf("summing in pieces gives %#04x, want %#04x", FinishChecksum(sum), Checksum(data))
+	}
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	packet, err := NewPacket(IPAddress{10, 0, 0, 1}, IPAddress{10, 0, 0, 2}, ProtoUDP, 42, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet.Flags = FlagDontFrag
+	data := packet.Serialize()
+	if Checksum(data[:MinHeaderSize]) != 0 {
+		t.Fatalf("serialized header does not check out")
+	}
+
+	// ethernet padding after the datagram must not reach the payload
+	got, err := Deserialize(append(data, 0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SrcIP != packet.SrcIP || got.DstIP != packet.DstIP || got.ID != 42 || got.TTL != DefaultTTL ||
+		got.Protocol != ProtoUDP || got.Flags != FlagDontFrag || !bytes.Equal(got.Data, []byte("payload")) {
+		t.Errorf("Deserialize() = %+v, want %+v", got, packet)
+	}
+}
+
+func TestDeserializeInvalid(t *testing.T) {
+	packet, _ := NewPacket(IPAddress{10, 0, 0, 1}, IPAddress{10, 0, 0, 2}, ProtoTest, 1, []byte("data"))
+	valid := packet.Serialize()
+
+	// reseal recomputes the header checksum after a change
+	reseal := func(data []byte) []byte {
+		binary.BigEndian.PutUint16(data[10:12], 0)
+		binary.BigEndian.PutUint16(data[10:12], Checksum(data[:MinHeaderSize]))
+		return data
+	}
+	tests := []struct {
+		name   string
+		mangle func(data []byte) []byte
+	}{
+		{"shorter than a header", func(data []byte) []byte { return data[:MinHeaderSize-1] }},
+		{"version 6", func(data []byte) []byte { data[0] = 6<<4 | 5; return reseal(data) }},
+		{"header length below minimum", func(data []byte) []byte { data[0] = 4<<4 | 4; return data }},
+		{"header past the buffer", func(data []byte) []byte { data[0] = 4<<4 | 15; return data }},
+		{"total length past the buffer", func(data []byte) []byte {
+			binary.BigEndian.PutUint16(data[2:4], uint16(len(data)+1))
+			return reseal(data)
+		}},
+		{"total length inside the header", func(data []byte) []byte {
+			binary.BigEndian.PutUint16(data[2:4], MinHeaderSize-1)
+			return reseal(data)
+		}},
+		{"reserved flag", func(data []byte) []byte { data[6] |= 0x80; return reseal(data) }},
+		{"bad checksum", func(data []byte) []byte { data[8]--; return data }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.mangle(bytes.Clone(valid))
+			if _, err := Deserialize(data); err == nil {
+				t.Errorf("Deserialize() accepted an invalid packet")
+			}
+		})
+	}
+}
+
+func TestNewPacketTooLarge(t *testing.T) {
+	_, err := NewPacket(IPAddress{}, IPAddress{}, ProtoTest, 0, make([]byte, MaxPacketSize-MinHeaderSize+1))
+	if err == nil {
+		t.Errorf("NewPacket() accepted a payload past the maximum packet size")
+	}
+}
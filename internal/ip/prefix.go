@@ -0,0 +1,75 @@
+package ip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Prefix is an address with a CIDR prefix length. The address keeps its host
+// bits so an interface configuration like 10.0.0.5/24 fits in one value.
+type Prefix struct {
+	Address IPAddress
+	Length  int
+}
+
+var LimitedBroadcast = IPAddress{255, 255, 255, 255}
+
+func ParsePrefix(prefixString string) (Prefix, error) {
+	address, length, found := strings.Cut(prefixString, "/")
+	if !found {
+		return Prefix{}, fmt.Errorf("invalid prefix: missing prefix length")
+	}
+	if len(length) == 0 || len(length) > 2 || (len(length) == 2 && length[0] == '0') {
+		return Prefix{}, fmt.Errorf("invalid prefix: invalid prefix length")
+	}
+	prefixLen, err := strconv.Atoi(length)
+	if err != nil || prefixLen < 0 || prefixLen > 32 {
+		return Prefix{}, fmt.Errorf("invalid prefix: invalid prefix length")
+	}
+	parsed, err := ParseIP(address)
+	if err != nil {
+		return Prefix{}, err
+	}
+	return Prefix{Address: parsed, Length: prefixLen}, nil
+}
+
+func (ip IPAddress) Uint32() uint32 {
+	return binary.BigEndian.Uint32(ip[:])
+}
+
+func FromUint32(value uint32) IPAddress {
+	var ip IPAddress
+	binary.BigEndian.PutUint32(ip[:], value)
+	return ip
+}
+
+func (prefix Prefix) maskBits() uint32 {
+	if prefix.Length <= 0 {
+		return 0
+	}
+	return ^uint32(0) << (32 - prefix.Length)
+}
+
+func (prefix Prefix) Mask() IPAddress {
+	return FromUint32(prefix.maskBits())
+}
+
+// Masked returns the prefix with its host bits cleared.
+func (prefix Prefix) Masked() Prefix {
+	return Prefix{Address: FromUint32(prefix.Address.Uint32() & prefix.maskBits()), Length: prefix.Length}
+}
+
+func (prefix Prefix) Broadcast() IPAddress {
+	return FromUint32(prefix.Address.Uint32() | ^prefix.maskBits())
+}
+
+func (prefix Prefix) Contains(address IPAddress) bool {
+	mask := prefix.maskBits()
+	return address.Uint32()&mask == prefix.Address.Uint32()&mask
+}
+
+func (prefix Prefix) String() string {
+	return fmt.Sprintf("%v/%d", prefix.Address, prefix.Length)
+}
@@ -0,0 +1,261 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrReassemblyLimit = fmt.Errorf("reassembly memory limit reached")
+
+const (
+	ReassemblyTimeout    = time.Second * 30
+	MaxReassemblyBytes   = 1 << 20
+	MaxReassemblyBuffers = 64
+	reassemblyGCTick     = time.Second
+)
+
+type fragKey struct {
+	src      IPAddress
+	dst      IPAddress
+	protocol uint8
+	id       uint16
+}
+
+type fragRange struct {
+	start int
+	end   int
+}
+
+type fragBuffer struct {
+	first       *Packet
+	data        []byte
+	received    []fragRange
+	totalLength int
+	created     time.Time
+}
+
+type Reassembler struct {
+	buffers    map[fragKey]*fragBuffer
+	bytesHeld  int
+	timeout    time.Duration
+	maxBytes   int
+	maxBuffers int
+	mutex      *sync.Mutex
+}
+
+func NewReassembler(timeout time.Duration, maxBytes int, maxBuffers int) *Reassembler {
+	return &Reassembler{
+		buffers:    make(map[fragKey]*fragBuffer),
+		timeout:    timeout,
+		maxBytes:   maxBytes,
+		maxBuffers: maxBuffers,
+		mutex:      new(sync.Mutex),
+	}
+}
+
+// holes returns the parts of [start, end) not yet covered by received, so
+// overlapping fragments never overwrite data that already arrived.
+func (buffer *fragBuffer) holes(start, end int) []fragRange {
+	var result []fragRange
+	for _, r := range buffer.received {
+		if r.end <= start {
+			continue
+		}
+		if r.start >= end {
+			break
+		}
+		if r.start > start {
+			result = append(result, fragRange{start, r.start})
+		}
+		start = max(start, r.end)
+	}
+	if start < end {
+		result = append(result, fragRange{start, end})
+	}
+	return result
+}
+
+func (buffer *fragBuffer) insert(start, end int) {
+	merged := fragRange{start, end}
+	var result []fragRange
+	inserted := false
+	for _, r := range buffer.received {
+		switch {
+		case r.end < merged.start:
+			result = append(result, r)
+		case r.start > merged.end:
+			if !inserted {
+				result = append(result, merged)
+				inserted = true
+			}
+			result = append(result, r)
+		default:
+			merged.start = min(merged.start, r.start)
+			merged.end = max(merged.end, r.end)
+		}
+	}
+	if !inserted {
+		result = append(result, merged)
+	}
+	buffer.received = result
+}
+
+func (buffer *fragBuffer) complete() bool {
+	return buffer.totalLength >= 0 && len(buffer.received) == 1 &&
+		buffer.received[0].start == 0 && buffer.received[0].end == buffer.totalLength
+}
+
+func (reassembler *Reassembler) drop(key fragKey) {
+	buffer, ok := reassembler.buffers[key]
+	if !ok {
+		return
+	}
+	reassembler.bytesHeld -= len(buffer.data)
+	delete(reassembler.buffers, key)
+}
+
+// evictOldest drops the oldest datagram other than keep.
+func (reassembler *Reassembler) evictOldest(keep fragKey) bool {
+	var oldestKey fragKey
+	var oldest *fragBuffer
+	for key, buffer := range reassembler.buffers {
+		if key == keep {
+			continue
+		}
+		if oldest == nil || buffer.created.Before(oldest.created) {
+			oldestKey, oldest = key, buffer
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	reassembler.drop(oldestKey)
+	return true
+}
+
+// Add stores a fragment and returns the reassembled packet once every
+// fragment of the datagram arrived, or nil while it is still incomplete.
+func (reassembler *Reassembler) Add(packet *Packet) (*Packet, error) {
+	if !packet.IsFragment() {
+		return packet, nil
+	}
+
+	start := int(packet.FragmentOffset) * 8
+	end := start + len(packet.Data)
+	moreFragments := packet.Flags&FlagMoreFrags != 0
+	if moreFragments && len(packet.Data)%8 != 0 {
+		return nil, fmt.Errorf("invalid fragment: length not a multiple of 8")
+	}
+	if end+MinHeaderSize > MaxPacketSize {
+		return nil, fmt.Errorf("invalid fragment: datagram exceeds the maximum packet size")
+	}
+
+	key := fragKey{src: packet.SrcIP, dst: packet.DstIP, protocol: packet.Protocol, id: packet.ID}
+	reassembler.mutex.Lock()
+	defer reassembler.mutex.Unlock()
+
+	buffer, ok := reassembler.buffers[key]
+	if !ok {
+		for len(reassembler.buffers) >= reassembler.maxBuffers {
+			if !reassembler.evictOldest(key) {
+				return nil, ErrReassemblyLimit
+			}
+		}
+		buffer = &fragBuffer{totalLength: -1, created: time.Now()}
+		reassembler.buffers[key] = buffer
+	}
+
+	if !moreFragments {
+		if buffer.totalLength >= 0 && buffer.totalLength != end {
+			reassembler.drop(key)
+			return nil, fmt.Errorf("invalid fragment: conflicting datagram lengths")
+		}
+		buffer.totalLength = end
+	}
+	if buffer.totalLength >= 0 && (end > buffer.totalLength ||
+		(len(buffer.received) > 0 && buffer.received[len(buffer.received)-1].end > buffer.totalLength)) {
+		reassembler.drop(key)
+		return nil, fmt.Errorf("invalid fragment: data beyond the end of the datagram")
+	}
+
+	if end > len(buffer.data) {
+		grow := end - len(buffer.data)
+		for reassembler.bytesHeld+grow > reassembler.maxBytes {
+			if !reassembler.evictOldest(key) {
+				reassembler.drop(key)
+				return nil, ErrReassemblyLimit
+			}
+		}
+		buffer.data = append(buffer.data, make([]byte, grow)...)
+		reassembler.bytesHeld += grow
+	}
+
+	for _, hole := range buffer.holes(start, end) {
+		copy(buffer.data[hole.start:hole.end], packet.Data[hole.start-start:hole.end-start])
+	}
+	buffer.insert(start, end)
+	if start == 0 {
+		buffer.first = packet
+	}
+
+	if !buffer.complete() {
+		return nil, nil
+	}
+
+	reassembler.drop(key)
+	first := buffer.first
+	return &Packet{
+		Version:     first.Version,
+		IHL:         first.IHL,
+		DSCP:        first.DSCP,
+		ECN:         first.ECN,
+		TotalLength: uint16(first.HeaderLength() + buffer.totalLength),
+		ID:          first.ID,
+		Flags:       first.Flags &^ FlagMoreFrags,
+		TTL:         first.TTL,
+		Protocol:    first.Protocol,
+		SrcIP:       first.SrcIP,
+		DstIP:       first.DstIP,
+		Options:     first.Options,
+		Data:        buffer.data,
+	}, nil
+}
+
+// RunGC discards datagrams that did not complete within the timeout, passing
+// the first fragment, when it arrived, to onTimeout. It returns once ctx is
+// done.
+func (reassembler *Reassembler) RunGC(ctx context.Context, onTimeout func(first *Packet)) {
+	ticker := time.NewTicker(reassemblyGCTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, first := range reassembler.expire(now) {
+				if onTimeout != nil {
+					onTimeout(first)
+				}
+			}
+		}
+	}
+}
+
+// expire drops the datagrams older than the timeout at now and returns the
+// first fragments of those that had one.
+func (reassembler *Reassembler) expire(now time.Time) []*Packet {
+	var expired []*Packet
+	reassembler.mutex.Lock()
+	defer reassembler.mutex.Unlock()
+	for key, buffer := range reassembler.buffers {
+		if now.Sub(buffer.created) > reassembler.timeout {
+			if buffer.first != nil {
+				expired = append(expired, buffer.first)
+			}
+			reassembler.drop(key)
+		}
+	}
+	return expired
+}
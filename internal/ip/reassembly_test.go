@@ -0,0 +1,184 @@
+package ip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func fragments(t *testing.T, size, mtu int) (*Packet, []*Packet) {
+	t.Helper()
+	packet := testPacket(t, size)
+	fragments, err := Fragment(packet, mtu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet, fragments
+}
+
+func TestReassemble(t *testing.T) {
+	tests := []struct {
+		name  string
+		order []int
+	}{
+		{"in order", []int{0, 1, 2, 3}},
+		{"reversed", []int{3, 2, 1, 0}},
+		{"last first", []int{3, 0, 1, 2}},
+		{"duplicates", []int{0, 1, 1, 0, 2, 3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packet, parts := fragments(t, 400, 124)
+			reassembler := NewReassembler(ReassemblyTimeout, MaxReassemblyBytes, MaxReassemblyBuffers)
+			var result *Packet
+			for i, index := range test.order {
+				got, err := reassembler.Add(parts[index])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != nil && i != len(test.order)-1 {
+					t.Fatalf("datagram complete after %d fragments", i+1)
+				}
+				result = got
+			}
+			if result == nil {
+				t.Fatal("datagram not reassembled")
+			}
+			if !bytes.Equal(result.Data, packet.Data) || result.TotalLength != packet.TotalLength || result.IsFragment() {
+				t.Errorf("reassembled %+v, want %+v", result, packet)
+			}
+			if reassembler.bytesHeld != 0 || len(reassembler.buffers) != 0 {
+				t.Errorf("reassembler still holds %d bytes in %d buffers", reassembler.bytesHeld, len(reassembler.buffers))
+			}
+		})
+	}
+}
+
+func TestReassembleOverlap(t *testing.T) {
+	packet := testPacket(t, 32)
+	first := *packet
+	first.Flags = FlagMoreFrags
+	first.Data = packet.Data[:24]
+	// the overlapping part of the second fragment must not overwrite the first
+	second := *packet
+	second.FragmentOffset = 2
+	second.Data = bytes.Repeat([]byte{0xFF}, 16)
+
+	reassembler := NewReassembler(ReassemblyTimeout, MaxReassemblyBytes, MaxReassemblyBuffers)
+	if _, err := reassembler.Add(&first); err != nil {
+		t.Fatal(err)
+	}
+	result, err := reassembler.Add(&second)
+	if err != nil || result == nil {
+		t.Fatalf("Add() = %v, %v", result, err)
+	}
+	want := append(bytes.Clone(packet.Data[:24]), bytes.Repeat([]byte{0xFF}, 8)...)
+	if !bytes.Equal(result.Data, want) {
+		t.Errorf("reassembled %x, want %x", result.Data, want)
+	}
+}
+
+func TestReassembleInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		mangle func(parts []*Packet) []*Packet
+	}{
+		{"length not a multiple of 8", func(parts []*Packet) []*Packet {
+			parts[0].Data = parts[0].Data[:len(parts[0].Data)-1]
+			return parts[:1]
+		}},
+		{"conflicting lengths", func(parts []*Packet) []*Packet {
+			other := *parts[len(parts)-1]
+			other.Data = other.Data[:len(other.Data)-1]
+			return []*Packet{parts[len(parts)-1], &other}
+		}},
+		{"data past the end", func(parts []*Packet) []*Packet {
+			last := parts[len(parts)-1]
+			return []*Packet{last, parts[len(parts)-2], parts[0], &Packet{
+				Flags:          FlagMoreFrags,
+				FragmentOffset: last.FragmentOffset + uint16(len(last.Data)/8) + 1,
+				Protocol:       last.Protocol, SrcIP: last.SrcIP, DstIP: last.DstIP, ID: last.ID,
+				Data: make([]byte, 8),
+			}}
+		}},
+		{"past the maximum packet size", func(parts []*Packet) []*Packet {
+			parts[0].FragmentOffset = 0x1FFF
+			return parts[:1]
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, parts := fragments(t, 400, 124)
+			reassembler := NewReassembler(ReassemblyTimeout, MaxReassemblyBytes, MaxReassemblyBuffers)
+			var err error
+			for _, part := range test.mangle(parts) {
+				if _, err = reassembler.Add(part); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				t.Errorf("Add() accepted an invalid fragment")
+			}
+		})
+	}
+}
+
+func TestReassemblyLimits(t *testing.T) {
+	reassembler := NewReassembler(ReassemblyTimeout, MaxReassemblyBytes, 2)
+	for id := range uint16(3) {
+		_, parts := fragments(t, 400, 124)
+		for _, part := range parts {
+			part.ID = id
+		}
+		if _, err := reassembler.Add(parts[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(reassembler.buffers) != 2 {
+		t.Errorf("holding %d datagrams, want 2", len(reassembler.buffers))
+	}
+	if _, ok := reassembler.buffers[fragKey{IPAddress{10, 0, 0, 1}, IPAddress{10, 0, 1, 1}, ProtoTest, 0}]; ok {
+		t.Errorf("the oldest datagram was not evicted")
+	}
+
+	reassembler = NewReassembler(ReassemblyTimeout, 100, MaxReassemblyBuffers)
+	_, parts := fragments(t, 400, 124)
+	if _, err := reassembler.Add(parts[1]); !errors.Is(err, ErrReassemblyLimit) {
+		t.Errorf("Add() error = %v, want %v", err, ErrReassemblyLimit)
+	}
+}
+
+func TestReassemblyExpire(t *testing.T) {
+	reassembler := NewReassembler(time.Minute, MaxReassemblyBytes, MaxReassemblyBuffers)
+	_, parts := fragments(t, 400, 124)
+	reassembler.Add(parts[1])
+	if expired := reassembler.expire(time.Now()); len(expired) != 0 {
+		t.Fatalf("expired %d datagrams before the timeout", len(expired))
+	}
+	reassembler.Add(parts[0])
+	expired := reassembler.expire(time.Now().Add(2 * time.Minute))
+	if len(expired) != 1 || expired[0] != parts[0] {
+		t.Errorf("expire() = %v, want the first fragment", expired)
+	}
+	if len(reassembler.buffers) != 0 || reassembler.bytesHeld != 0 {
+		t.Errorf("expired datagram still held")
+	}
+}
+
+func TestRunGCStops(t *testing.T) {
+	reassembler := NewReassembler(ReassemblyTimeout, MaxReassemblyBytes, MaxReassemblyBuffers)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		reassembler.RunGC(ctx, nil)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunGC did not return after the context was canceled")
+	}
+}
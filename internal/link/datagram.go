@@ -0,0 +1,237 @@
+package link
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// datagramQueueDepth is how many frames a peer of a UDP listener may have
+// waiting before further ones are dropped, as a congested wire would.
+const datagramQueueDepth = 64
+
+// DatagramLink carries one frame per UDP datagram. An empty datagram tells
+// the other end that the link was closed.
+type DatagramLink struct {
+	conn *net.UDPConn
+}
+
+func DialUDP(address string) (*DatagramLink, error) {
+	remote, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, remote)
+	if err != nil {
+		return nil, err
+	}
+	return &DatagramLink{conn: conn}, nil
+}
+
+func (link *DatagramLink) String() string {
+	return "udp://" + link.conn.RemoteAddr().String()
+}
+
+func (link *DatagramLink) ReadFrame() ([]byte, error) {
+	err := link.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := link.conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, io.EOF
+		}
+		if checkLength(n) == nil {
+			return buf[:n], nil
+		}
+	}
+}
+
+func (link *DatagramLink) WriteFrame(frame []byte) error {
+	err := checkLength(len(frame))
+	if err != nil {
+		return err
+	}
+	_, err = link.conn.Write(frame)
+	return err
+}
+
+func (link *DatagramLink) Close() error {
+	_, _ = link.conn.Write(nil)
+	return link.conn.Close()
+}
+
+// maxDatagram leaves room to notice frames longer than allowed instead of
+// silently truncating them.
+const maxDatagram = 1 << 16
+
+// udpListener tells peers apart by their source address, since a single
+// socket receives the datagrams of all of them.
+type udpListener struct {
+	conn    *net.UDPConn
+	peers   map[string]*udpPeer
+	accepts chan *udpPeer
+	mutex   *sync.Mutex
+}
+
+func ListenUDP(address string) (Listener, error) {
+	local, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return nil, err
+	}
+	listener := &udpListener{
+		conn:    conn,
+		peers:   make(map[string]*udpPeer),
+		accepts: make(chan *udpPeer, datagramQueueDepth),
+		mutex:   new(sync.Mutex),
+	}
+	go listener.demultiplex()
+	return listener, nil
+}
+
+func (listener *udpListener) demultiplex() {
+	defer func() {
+		listener.mutex.Lock()
+		for _, peer := range listener.peers {
+			peer.shut()
+		}
+		listener.peers = nil
+		listener.mutex.Unlock()
+		close(listener.accepts)
+	}()
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := listener.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+
+		listener.mutex.Lock()
+		peer, known := listener.peers[addr.String()]
+		switch {
+		case n == 0 && known:
+			delete(listener.peers, addr.String())
+			peer.shut()
+		case n == 0, checkLength(n) != nil:
+		case !known:
+			peer = newUDPPeer(listener, addr)
+			peer.deliver(buf[:n])
+			select {
+			case listener.accepts <- peer:
+				listener.peers[addr.String()] = peer
+			default:
+				// nobody is accepting, so the peer is turned away
+			}
+		default:
+			peer.deliver(buf[:n])
+		}
+		listener.mutex.Unlock()
+	}
+}
+
+func (listener *udpListener) Accept() (Link, error) {
+	peer, ok := <-listener.accepts
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return peer, nil
+}
+
+func (listener *udpListener) Close() error {
+	return listener.conn.Close()
+}
+
+func (listener *udpListener) Addr() net.Addr {
+	return listener.conn.LocalAddr()
+}
+
+func (listener *udpListener) forget(peer *udpPeer) {
+	listener.mutex.Lock()
+	if listener.peers[peer.addr.String()] == peer {
+		delete(listener.peers, peer.addr.String())
+	}
+	listener.mutex.Unlock()
+}
+
+type udpPeer struct {
+	listener *udpListener
+	addr     *net.UDPAddr
+	frames   chan []byte
+	done     chan struct{}
+	once     *sync.Once
+}
+
+func newUDPPeer(listener *udpListener, addr *net.UDPAddr) *udpPeer {
+	return &udpPeer{
+		listener: listener,
+		addr:     addr,
+		frames:   make(chan []byte, datagramQueueDepth),
+		done:     make(chan struct{}),
+		once:     new(sync.Once),
+	}
+}
+
+func (peer *udpPeer) String() string {
+	return "udp://" + peer.addr.String()
+}
+
+func (peer *udpPeer) deliver(frame []byte) {
+	select {
+	case peer.frames <- append([]byte(nil), frame...):
+	default:
+	}
+}
+
+func (peer *udpPeer) shut() {
+	peer.once.Do(func() { close(peer.done) })
+}
+
+func (peer *udpPeer) ReadFrame() ([]byte, error) {
+	timer := time.NewTimer(idleTimeout)
+	defer timer.Stop()
+	select {
+	case frame := <-peer.frames:
+		return frame, nil
+	case <-peer.done:
+		return nil, io.EOF
+	case <-timer.C:
+		return nil, &net.OpError{Op: "read", Net: "udp", Addr: peer.addr, Err: os.ErrDeadlineExceeded}
+	}
+}
+
+func (peer *udpPeer) WriteFrame(frame []byte) error {
+	err := checkLength(len(frame))
+	if err != nil {
+		return err
+	}
+	select {
+	case <-peer.done:
+		return ErrClosed
+	default:
+	}
+	_, err = peer.listener.conn.WriteToUDP(frame, peer.addr)
+	return err
+}
+
+func (peer *udpPeer) Close() error {
+	peer.listener.forget(peer)
+	peer.shut()
+	_, _ = peer.listener.conn.WriteToUDP(nil, peer.addr)
+	return nil
+}
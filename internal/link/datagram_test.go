@@ -0,0 +1,54 @@
+package link
+
+import (
+	"net"
+	"tcp-ip/internal/ethernet"
+	"testing"
+)
+
+// TestDatagramOversize checks that both ends of a UDP link skip datagrams
+// longer than a frame instead of handing them on.
+func TestDatagramOversize(t *testing.T) {
+	listener, err := ListenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	raw, err := net.DialUDP("udp", nil, listener.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+
+	oversize := make([]byte, ethernet.MaxTaggedFrame+1)
+	raw.Write(oversize)
+	raw.Write([]byte("first"))
+	raw.Write(oversize)
+	raw.Write([]byte("second"))
+	peer, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readFrame(t, peer, []byte("first"))
+	readFrame(t, peer, []byte("second"))
+
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	dialed, err := DialUDP(server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialed.Close()
+	dialed.WriteFrame([]byte("hello"))
+	buffer := make([]byte, maxDatagram)
+	_, client, err := server.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.WriteToUDP(oversize, client)
+	server.WriteToUDP([]byte("answer"), client)
+	readFrame(t, dialed, []byte("answer"))
+}
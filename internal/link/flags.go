@@ -0,0 +1,87 @@
+package link
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+// Flags are the command line flags that shape and impair every link a
+// program opens.
+type Flags struct {
+	egressSpec  *string
+	ingressSpec *string
+	seed        *uint64
+	rateSpec    *string
+	burst       *int
+	queueLimit  *int
+	redSpec     *string
+	egress      Impairment
+	ingress     Impairment
+	shaping     Shaping
+	links       atomic.Uint64
+}
+
+func RegisterFlags(flags *flag.FlagSet) *Flags {
+	return &Flags{
+		egressSpec:  flags.String("egress", "", "impairment of sent frames, e.g. loss=1%,delay=20ms,jitter=5ms"),
+		ingressSpec: flags.String("ingress", "", "impairment of received frames, in the -egress format"),
+		seed:        flags.Uint64("seed", 0, "seed of the impairment RNG, random when 0"),
+		rateSpec:    flags.String("rate", "", "link rate in bits/s such as 10M, unlimited when empty"),
+		burst:       flags.Int("burst", 0, "token bucket size in bytes, one frame when 0"),
+		queueLimit:  flags.Int("queue", DefaultQueueLimit, "transmit queue length in frames"),
+		redSpec:     flags.String("red", "", "use RED instead of tail drop, as min:max:maxprobability[:weight]"),
+	}
+}
+
+// Parse validates the flags once the flag set has been parsed.
+func (flags *Flags) Parse() error {
+	var err error
+	flags.egress, err = ParseImpairment(*flags.egressSpec)
+	if err != nil {
+		return fmt.Errorf("invalid -egress: %w", err)
+	}
+	flags.ingress, err = ParseImpairment(*flags.ingressSpec)
+	if err != nil {
+		return fmt.Errorf("invalid -ingress: %w", err)
+	}
+	if *flags.seed == 0 {
+		*flags.seed = rand.Uint64()
+	}
+
+	if *flags.rateSpec != "" {
+		flags.shaping.Rate, err = ParseRate(*flags.rateSpec)
+		if err != nil {
+			return fmt.Errorf("invalid -rate: %w", err)
+		}
+	}
+	if *flags.burst < 0 || *flags.queueLimit <= 0 {
+		return fmt.Errorf("-burst and -queue must be positive")
+	}
+	flags.shaping.Burst = *flags.burst
+	flags.shaping.QueueLimit = *flags.queueLimit
+	if *flags.redSpec != "" {
+		flags.shaping.RED, err = ParseRED(*flags.redSpec)
+		if err != nil {
+			return fmt.Errorf("invalid -red: %w", err)
+		}
+	}
+	// a random seed only makes a run reproducible once it is known
+	if !flags.egress.isZero() || !flags.ingress.isZero() || flags.shaping.RED != nil {
+		fmt.Printf("Link impairment seed: %d\n", *flags.seed)
+	}
+	return nil
+}
+
+// Wrap shapes and impairs inner. Every link gets its own seed derived from
+// the flag, so the links of a run are independent yet reproducible. The
+// transmit queue comes first and the impaired wire after it.
+func (flags *Flags) Wrap(inner Link) Link {
+	seed := *flags.seed + 3*flags.links.Add(1)
+	wrapped := Impair(inner, flags.egress, flags.ingress, seed)
+	if flags.shaping.Rate > 0 {
+		wrapped = NewShapedLink(wrapped, flags.shaping, seed+2)
+	}
+	return wrapped
+}
@@ -0,0 +1,90 @@
+package link
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"tcp-ip/internal/ethernet"
+	"time"
+)
+
+var (
+	ErrClosed         = fmt.Errorf("link closed")
+	ErrAddressInUse   = fmt.Errorf("address already in use")
+	ErrInvalidLength  = fmt.Errorf("invalid frame length")
+	ErrUnknownNetwork = fmt.Errorf("unknown link network")
+)
+
+// idleTimeout bounds how long a link may stay silent before reads fail.
+const idleTimeout = 10 * time.Minute
+
+// Link is the wire between two network interfaces. Every ReadFrame returns
+// exactly one frame written by a WriteFrame on the other end.
+type Link interface {
+	ReadFrame() ([]byte, error)
+	WriteFrame(frame []byte) error
+	Close() error
+}
+
+// Listener hands out a Link for every peer that plugs into it.
+type Listener interface {
+	Accept() (Link, error)
+	Close() error
+	Addr() net.Addr
+}
+
+func checkLength(length int) error {
+	if length <= 0 || length > ethernet.MaxTaggedFrame {
+		return fmt.Errorf("%w: %d", ErrInvalidLength, length)
+	}
+	return nil
+}
+
+// splitAddress separates the network of an address written as
+// network://address. Addresses without one use TCP, as they always did.
+func splitAddress(address string) (string, string) {
+	network, rest, found := strings.Cut(address, "://")
+	if !found {
+		return "tcp", address
+	}
+	return network, rest
+}
+
+// Dial connects to an address such as "localhost:8080", "tcp://host:port",
+// "unix:///tmp/switch.sock", "udp://host:port" or "pipe://name".
+func Dial(address string) (Link, error) {
+	network, address := splitAddress(address)
+	switch network {
+	case "tcp", "unix":
+		conn, err := net.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		return NewStreamLink(conn), nil
+	case "udp":
+		return DialUDP(address)
+	case "pipe":
+		return DialPipe(address)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNetwork, network)
+	}
+}
+
+// Listen accepts links on an address in the format Dial takes.
+func Listen(address string) (Listener, error) {
+	network, address := splitAddress(address)
+	switch network {
+	case "tcp", "unix":
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+		return &streamListener{listener: listener}, nil
+	case "udp":
+		return ListenUDP(address)
+	case "pipe":
+		return ListenPipe(address)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNetwork, network)
+	}
+}
@@ -0,0 +1,135 @@
+package link
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"tcp-ip/internal/ethernet"
+	"testing"
+)
+
+// linkPair listens on address and dials the listener, returning the dialed
+// end and the accepted one.
+func linkPair(t *testing.T, address string) (Link, Link) {
+	t.Helper()
+	listener, err := Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	addr := listener.Addr()
+	dialed, err := Dial(addr.Network() + "://" + addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dialed.Close() })
+	// a UDP listener only learns of a peer from its first datagram
+	err = dialed.WriteFrame([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { accepted.Close() })
+	readFrame(t, accepted, []byte("hello"))
+	return dialed, accepted
+}
+
+func readFrame(t *testing.T, link Link, want []byte) {
+	t.Helper()
+	got, err := link.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame() error = %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("ReadFrame() = %d bytes, want the %d written", len(got), len(want))
+	}
+}
+
+func testFrame(size int) []byte {
+	frame := make([]byte, size)
+	for i := range frame {
+		frame[i] = byte(i * 7)
+	}
+	return frame
+}
+
+func linkAddresses(t *testing.T) []string {
+	return []string{
+		"127.0.0.1:0",
+		"tcp://127.0.0.1:0",
+		"unix://" + filepath.Join(t.TempDir(), "switch.sock"),
+		"udp://127.0.0.1:0",
+		"pipe://" + t.Name(),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, address := range linkAddresses(t) {
+		t.Run(address, func(t *testing.T) {
+			dialed, accepted := linkPair(t, address)
+			for _, size := range []int{1, ethernet.MinFrame, 1000, ethernet.MaxTaggedFrame} {
+				frame := testFrame(size)
+				if err := dialed.WriteFrame(frame); err != nil {
+					t.Fatal(err)
+				}
+				readFrame(t, accepted, frame)
+				if err := accepted.WriteFrame(frame); err != nil {
+					t.Fatal(err)
+				}
+				readFrame(t, dialed, frame)
+			}
+		})
+	}
+}
+
+func TestInvalidLength(t *testing.T) {
+	for _, address := range linkAddresses(t) {
+		t.Run(address, func(t *testing.T) {
+			dialed, accepted := linkPair(t, address)
+			for _, size := range []int{0, ethernet.MaxTaggedFrame + 1} {
+				if err := dialed.WriteFrame(make([]byte, size)); !errors.Is(err, ErrInvalidLength) {
+					t.Errorf("WriteFrame() of %d bytes error = %v, want %v", size, err, ErrInvalidLength)
+				}
+				if err := accepted.WriteFrame(make([]byte, size)); !errors.Is(err, ErrInvalidLength) {
+					t.Errorf("WriteFrame() of %d bytes error = %v, want %v", size, err, ErrInvalidLength)
+				}
+			}
+			// nothing was sent, so the next frame is the first to arrive
+			dialed.WriteFrame([]byte("next"))
+			readFrame(t, accepted, []byte("next"))
+		})
+	}
+}
+
+func TestPeerClose(t *testing.T) {
+	for _, side := range []string{"dialer", "listener"} {
+		t.Run(side, func(t *testing.T) {
+			for _, address := range linkAddresses(t) {
+				t.Run(address, func(t *testing.T) {
+					dialed, accepted := linkPair(t, address)
+					closing, reading := dialed, accepted
+					if side == "listener" {
+						closing, reading = accepted, dialed
+					}
+					closing.Close()
+					if _, err := reading.ReadFrame(); !errors.Is(err, io.EOF) {
+						t.Errorf("ReadFrame() error = %v, want %v", err, io.EOF)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestUnknownNetwork(t *testing.T) {
+	if _, err := Dial("sctp://127.0.0.1:1"); !errors.Is(err, ErrUnknownNetwork) {
+		t.Errorf("Dial() error = %v, want %v", err, ErrUnknownNetwork)
+	}
+	if _, err := Listen("sctp://127.0.0.1:0"); !errors.Is(err, ErrUnknownNetwork) {
+		t.Errorf("Listen() error = %v, want %v", err, ErrUnknownNetwork)
+	}
+}
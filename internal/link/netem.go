@@ -0,0 +1,394 @@
+package link
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GilbertElliott is the two state bursty loss model. The link moves from
+// the good to the bad state with probability P and back with probability R
+// on every frame, and loses frames with the probability of its state.
+type GilbertElliott struct {
+	P        float64
+	R        float64
+	LossGood float64
+	LossBad  float64
+}
+
+// Impairment describes what happens to the frames crossing a link in one
+// direction, in the manner of Linux netem.
+type Impairment struct {
+	// Loss is the probability of losing a frame, unless Burst is set
+	Loss  float64
+	Burst *GilbertElliott
+	// every frame waits Delay plus a uniform random Jitter in either
+	// direction, so jitter larger than the gap between frames reorders them
+	Delay  time.Duration
+	Jitter time.Duration
+	// Reorder is the probability that a frame skips the delay and overtakes
+	// the ones still waiting
+	Reorder   float64
+	Duplicate float64
+	// Corrupt is the probability of flipping one random bit of a frame
+	Corrupt float64
+}
+
+func (impairment Impairment) isZero() bool {
+	return impairment == Impairment{}
+}
+
+// ParseImpairment reads a comma separated list such as
+// "loss=1%,delay=20ms,jitter=5ms,reorder=2%,duplicate=0.5%,corrupt=0.1%".
+// Bursty loss is written gemodel=p:r:lossgood:lossbad.
+func ParseImpairment(spec string) (Impairment, error) {
+	var impairment Impairment
+	if spec == "" {
+		return impairment, nil
+	}
+	for _, field := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			return Impairment{}, fmt.Errorf("invalid impairment %q: expected key=value", field)
+		}
+		var err error
+		switch key {
+		case "loss":
+			impairment.Loss, err = parseProbability(value)
+		case "gemodel":
+			impairment.Burst, err = parseGilbertElliott(value)
+		case "delay":
+			impairment.Delay, err = time.ParseDuration(value)
+		case "jitter":
+			impairment.Jitter, err = time.ParseDuration(value)
+		case "reorder":
+			impairment.Reorder, err = parseProbability(value)
+		case "duplicate":
+			impairment.Duplicate, err = parseProbability(value)
+		case "corrupt":
+			impairment.Corrupt, err = parseProbability(value)
+		default:
+			return Impairment{}, fmt.Errorf("unknown impairment %q", key)
+		}
+		if err != nil {
+			return Impairment{}, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	if impairment.Delay < 0 || impairment.Jitter < 0 {
+		return Impairment{}, fmt.Errorf("delay and jitter must not be negative")
+	}
+	return impairment, nil
+}
+
+// parseProbability accepts a fraction or a percentage.
+func parseProbability(value string) (float64, error) {
+	percent := strings.HasSuffix(value, "%")
+	probability, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if percent {
+		probability /= 100
+	}
+	if probability < 0 || probability > 1 {
+		return 0, fmt.Errorf("probability %s out of range", value)
+	}
+	return probability, nil
+}
+
+func parseGilbertElliott(value string) (*GilbertElliott, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("expected p:r:lossgood:lossbad")
+	}
+	var probabilities [4]float64
+	for i, field := range fields {
+		var err error
+		probabilities[i], err = parseProbability(field)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &GilbertElliott{P: probabilities[0], R: probabilities[1], LossGood: probabilities[2], LossBad: probabilities[3]}, nil
+}
+
+// impairer applies an Impairment to the frames of one direction.
+type impairer struct {
+	impairment Impairment
+	rng        *rand.Rand
+	bad        bool
+	line       *delayLine
+	mutex      *sync.Mutex
+}
+
+func newImpairer(impairment Impairment, seed uint64, deliver func([]byte)) *impairer {
+	return &impairer{
+		impairment: impairment,
+		rng:        rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)),
+		line:       newDelayLine(deliver),
+		mutex:      new(sync.Mutex),
+	}
+}
+
+func (impairer *impairer) lost() bool {
+	burst := impairer.impairment.Burst
+	if burst == nil {
+		return impairer.rng.Float64() < impairer.impairment.Loss
+	}
+	if impairer.bad {
+		impairer.bad = impairer.rng.Float64() >= burst.R
+	} else {
+		impairer.bad = impairer.rng.Float64() < burst.P
+	}
+	if impairer.bad {
+		return impairer.rng.Float64() < burst.LossBad
+	}
+	return impairer.rng.Float64() < burst.LossGood
+}
+
+func (impairer *impairer) delay() time.Duration {
+	impairment := impairer.impairment
+	if impairer.rng.Float64() < impairment.Reorder {
+		return 0
+	}
+	delay := impairment.Delay
+	if impairment.Jitter > 0 {
+		delay += time.Duration(impairer.rng.Int64N(int64(2*impairment.Jitter+1))) - impairment.Jitter
+	}
+	return max(delay, 0)
+}
+
+func (impairer *impairer) corrupt(frame []byte) []byte {
+	if impairer.rng.Float64() >= impairer.impairment.Corrupt {
+		return frame
+	}
+	corrupted := append([]byte(nil), frame...)
+	bit := impairer.rng.IntN(8 * len(corrupted))
+	corrupted[bit/8] ^= 1 << (bit % 8)
+	return corrupted
+}
+
+// pass decides the fate of frame and hands every copy that survives to the
+// delay line.
+func (impairer *impairer) pass(frame []byte) {
+	impairer.mutex.Lock()
+	defer impairer.mutex.Unlock()
+	if impairer.lost() {
+		return
+	}
+	copies := 1
+	if impairer.rng.Float64() < impairer.impairment.Duplicate {
+		copies = 2
+	}
+	now := time.Now()
+	for range copies {
+		impairer.line.schedule(impairer.corrupt(frame), now.Add(impairer.delay()))
+	}
+}
+
+func (impairer *impairer) close() {
+	impairer.line.close()
+}
+
+type delayedFrame struct {
+	frame []byte
+	due   time.Time
+	// order keeps frames due at the same time in the order they came
+	order uint64
+}
+
+type frameHeap []*delayedFrame
+
+func (frames frameHeap) Len() int {
+	return len(frames)
+}
+
+func (frames frameHeap) Less(i, j int) bool {
+	if frames[i].due.Equal(frames[j].due) {
+		return frames[i].order < frames[j].order
+	}
+	return frames[i].due.Before(frames[j].due)
+}
+
+func (frames frameHeap) Swap(i, j int) {
+	frames[i], frames[j] = frames[j], frames[i]
+}
+
+func (frames *frameHeap) Push(x any) {
+	*frames = append(*frames, x.(*delayedFrame))
+}
+
+func (frames *frameHeap) Pop() any {
+	old := *frames
+	last := old[len(old)-1]
+	*frames = old[:len(old)-1]
+	return last
+}
+
+// delayLine hands frames to deliver once they are due, from a single
+// goroutine so deliver never runs concurrently.
+type delayLine struct {
+	deliver func([]byte)
+	pending frameHeap
+	order   uint64
+	wakeup  chan struct{}
+	done    chan struct{}
+	mutex   *sync.Mutex
+}
+
+func newDelayLine(deliver func([]byte)) *delayLine {
+	line := &delayLine{
+		deliver: deliver,
+		wakeup:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		mutex:   new(sync.Mutex),
+	}
+	go line.run()
+	return line
+}
+
+func (line *delayLine) schedule(frame []byte, due time.Time) {
+	line.mutex.Lock()
+	line.order++
+	heap.Push(&line.pending, &delayedFrame{frame: frame, due: due, order: line.order})
+	line.mutex.Unlock()
+	select {
+	case line.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (line *delayLine) run() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		line.mutex.Lock()
+		var ready [][]byte
+		for len(line.pending) > 0 && !line.pending[0].due.After(time.Now()) {
+			ready = append(ready, heap.Pop(&line.pending).(*delayedFrame).frame)
+		}
+		wait := time.Duration(-1)
+		if len(line.pending) > 0 {
+			wait = time.Until(line.pending[0].due)
+		}
+		line.mutex.Unlock()
+
+		for _, frame := range ready {
+			line.deliver(frame)
+		}
+
+		var expired <-chan time.Time
+		if wait >= 0 {
+			timer.Reset(wait)
+			expired = timer.C
+		}
+		select {
+		case <-expired:
+		case <-line.wakeup:
+			timer.Stop()
+		case <-line.done:
+			return
+		}
+	}
+}
+
+func (line *delayLine) close() {
+	select {
+	case <-line.done:
+	default:
+		close(line.done)
+	}
+}
+
+// ImpairedLink wraps a link with an Impairment for the frames it writes and
+// another for the frames it reads.
+type ImpairedLink struct {
+	inner   Link
+	egress  *impairer
+	ingress *impairer
+	frames  chan []byte
+	err     error
+	done    chan struct{}
+}
+
+// NewImpairedLink starts impairing inner. Runs with the same seed make the
+// same decisions for the same sequence of frames.
+func NewImpairedLink(inner Link, egress, ingress Impairment, seed uint64) *ImpairedLink {
+	link := &ImpairedLink{
+		inner:  inner,
+		frames: make(chan []byte, pipeQueueDepth),
+		done:   make(chan struct{}),
+	}
+	link.egress = newImpairer(egress, seed, func(frame []byte) {
+		_ = inner.WriteFrame(frame)
+	})
+	link.ingress = newImpairer(ingress, seed+1, func(frame []byte) {
+		select {
+		case link.frames <- frame:
+		case <-link.done:
+		}
+	})
+	go link.receive()
+	return link
+}
+
+// Impair wraps inner only when there is something to impair.
+func Impair(inner Link, egress, ingress Impairment, seed uint64) Link {
+	if egress.isZero() && ingress.isZero() {
+		return inner
+	}
+	return NewImpairedLink(inner, egress, ingress, seed)
+}
+
+func (link *ImpairedLink) String() string {
+	return fmt.Sprint(link.inner)
+}
+
+func (link *ImpairedLink) receive() {
+	defer close(link.done)
+	for {
+		frame, err := link.inner.ReadFrame()
+		if err != nil {
+			link.err = err
+			return
+		}
+		link.ingress.pass(frame)
+	}
+}
+
+// ReadFrame returns the error of the wrapped link once it fails. Frames
+// still held back by the delay are lost with it, as on a cut wire.
+func (link *ImpairedLink) ReadFrame() ([]byte, error) {
+	select {
+	case frame := <-link.frames:
+		return frame, nil
+	case <-link.done:
+		return nil, link.err
+	}
+}
+
+// WriteFrame cannot report failures of the wrapped link for frames it
+// delays, just as a frame lost on the wire goes unnoticed.
+func (link *ImpairedLink) WriteFrame(frame []byte) error {
+	err := checkLength(len(frame))
+	if err != nil {
+		return err
+	}
+	select {
+	case <-link.done:
+		return link.err
+	default:
+	}
+	link.egress.pass(append([]byte(nil), frame...))
+	return nil
+}
+
+func (link *ImpairedLink) Close() error {
+	link.egress.close()
+	link.ingress.close()
+	return link.inner.Close()
+}
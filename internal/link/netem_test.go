@@ -0,0 +1,228 @@
+package link
+
+import (
+	"bytes"
+	"flag"
+	"math"
+	"math/bits"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseImpairment(t *testing.T) {
+	tests := []struct {
+		spec  string
+		want  Impairment
+		valid bool
+	}{
+		{"", Impairment{}, true},
+		{"loss=1%,delay=20ms,jitter=5ms", Impairment{Loss: 0.01, Delay: 20 * time.Millisecond, Jitter: 5 * time.Millisecond}, true},
+		{"reorder=0.25,duplicate=50%,corrupt=0", Impairment{Reorder: 0.25, Duplicate: 0.5}, true},
+		{"loss=100%", Impairment{Loss: 1}, true},
+		{"loss=101%", Impairment{}, false},
+		{"loss=-0.1", Impairment{}, false},
+		{"loss", Impairment{}, false},
+		{"latency=1ms", Impairment{}, false},
+		{"delay=-1ms", Impairment{}, false},
+		{"delay=10", Impairment{}, false},
+		{"gemodel=1%:10%", Impairment{}, false},
+		{"gemodel=1%:10%:0:200%", Impairment{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			got, err := ParseImpairment(test.spec)
+			if (err == nil) != test.valid {
+				t.Fatalf("ParseImpairment() error = %v, want valid %t", err, test.valid)
+			}
+			if test.valid && got != test.want {
+				t.Errorf("ParseImpairment() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	got, err := ParseImpairment("gemodel=1%:10%:0:50%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got.Burst != (GilbertElliott{P: 0.01, R: 0.1, LossGood: 0, LossBad: 0.5}) {
+		t.Errorf("gemodel parsed as %+v", *got.Burst)
+	}
+}
+
+const frames = 200_000
+
+func TestBernoulliLoss(t *testing.T) {
+	impairer := newImpairer(Impairment{Loss: 0.1}, 1, nil)
+	defer impairer.close()
+	lost := 0
+	for range frames {
+		if impairer.lost() {
+			lost++
+		}
+	}
+	if rate := float64(lost) / frames; math.Abs(rate-0.1) > 0.005 {
+		t.Errorf("loss rate %.4f, want 0.1", rate)
+	}
+}
+
+// TestGilbertElliott compares the loss rate and the length of loss bursts
+// with what the Markov chain predicts. The chain spends P/(P+R) of the time
+// in the bad state and stays there for 1/R frames on average.
+func TestGilbertElliott(t *testing.T) {
+	tests := []struct {
+		name  string
+		model GilbertElliott
+	}{
+		{"simple", GilbertElliott{P: 0.01, R: 0.3, LossGood: 0, LossBad: 1}},
+		{"gilbert", GilbertElliott{P: 0.02, R: 0.25, LossGood: 0, LossBad: 0.5}},
+		{"gilbert elliott", GilbertElliott{P: 0.05, R: 0.5, LossGood: 0.01, LossBad: 0.8}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			model := test.model
+			impairer := newImpairer(Impairment{Burst: &model}, 7, nil)
+			defer impairer.close()
+			lost, bad, badRuns := 0, 0, 0
+			wasBad := false
+			for range frames {
+				if impairer.lost() {
+					lost++
+				}
+				if impairer.bad {
+					bad++
+					if !wasBad {
+						badRuns++
+					}
+				}
+				wasBad = impairer.bad
+			}
+
+			badShare := model.P / (model.P + model.R)
+			want := badShare*model.LossBad + (1-badShare)*model.LossGood
+			if rate := float64(lost) / frames; math.Abs(rate-want) > 0.1*want {
+				t.Errorf("loss rate %.4f, want %.4f", rate, want)
+			}
+			if stay := float64(bad) / float64(badRuns); math.Abs(stay-1/model.R) > 0.1/model.R {
+				t.Errorf("bad state lasts %.2f frames, want %.2f", stay, 1/model.R)
+			}
+		})
+	}
+}
+
+func TestDelay(t *testing.T) {
+	delay, jitter := 20*time.Millisecond, 5*time.Millisecond
+	impairer := newImpairer(Impairment{Delay: delay, Jitter: jitter, Reorder: 0.1}, 3, nil)
+	defer impairer.close()
+	var sum time.Duration
+	skipped := 0
+	for range frames {
+		got := impairer.delay()
+		if got == 0 {
+			skipped++
+			continue
+		}
+		if got < delay-jitter || got > delay+jitter {
+			t.Fatalf("delay %v outside %v ± %v", got, delay, jitter)
+		}
+		sum += got
+	}
+	if rate := float64(skipped) / frames; math.Abs(rate-0.1) > 0.005 {
+		t.Errorf("reordered %.4f of the frames, want 0.1", rate)
+	}
+	if mean := sum / time.Duration(frames-skipped); (mean - delay).Abs() > 100*time.Microsecond {
+		t.Errorf("mean delay %v, want %v", mean, delay)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	impairer := newImpairer(Impairment{Corrupt: 1}, 5, nil)
+	defer impairer.close()
+	frame := make([]byte, 64)
+	for range 1000 {
+		corrupted := impairer.corrupt(frame)
+		flipped := 0
+		for i := range corrupted {
+			flipped += bits.OnesCount8(corrupted[i] ^ frame[i])
+		}
+		if flipped != 1 {
+			t.Fatalf("corrupted %d bits, want 1", flipped)
+		}
+	}
+	if !bytes.Equal(frame, make([]byte, 64)) {
+		t.Errorf("corrupt modified the original frame")
+	}
+}
+
+func TestImpairedLink(t *testing.T) {
+	a, b := Pipe()
+	delay := 30 * time.Millisecond
+	impaired := NewImpairedLink(a, Impairment{Delay: delay, Duplicate: 1}, Impairment{}, 1)
+	defer impaired.Close()
+	defer b.Close()
+
+	frame := bytes.Repeat([]byte{0xAB}, 64)
+	start := time.Now()
+	if err := impaired.WriteFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		got, err := b.ReadFrame()
+		if err != nil || !bytes.Equal(got, frame) {
+			t.Fatalf("copy %d: %v, %v", i, got, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("frame arrived after %v, want at least %v", elapsed, delay)
+	}
+
+	// the ingress direction is not impaired
+	if err := b.WriteFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := impaired.ReadFrame(); err != nil || !bytes.Equal(got, frame) {
+		t.Errorf("ReadFrame() = %v, %v", got, err)
+	}
+}
+
+func TestImpairedLinkReproducible(t *testing.T) {
+	run := func(seed uint64) []bool {
+		impairer := newImpairer(Impairment{Loss: 0.3, Duplicate: 0.2, Jitter: time.Millisecond}, seed, nil)
+		defer impairer.close()
+		var decisions []bool
+		for range 1000 {
+			decisions = append(decisions, impairer.lost(), impairer.delay() > 0)
+		}
+		return decisions
+	}
+	first, second, other := run(42), run(42), run(43)
+	if !slices.Equal(first, second) {
+		t.Errorf("the same seed made different decisions")
+	}
+	if slices.Equal(first, other) {
+		t.Errorf("different seeds made the same decisions")
+	}
+}
+
+func TestFlagsSeed(t *testing.T) {
+	tests := []struct {
+		args []string
+		seed uint64
+	}{
+		{[]string{"-egress", "loss=1%", "-seed", "99"}, 99},
+		{[]string{"-egress", "loss=1%"}, 0},
+	}
+	for _, test := range tests {
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags := RegisterFlags(set)
+		if err := set.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := flags.Parse(); err != nil {
+			t.Fatal(err)
+		}
+		if *flags.seed == 0 || (test.seed != 0 && *flags.seed != test.seed) {
+			t.Errorf("%v: seed %d", test.args, *flags.seed)
+		}
+	}
+}
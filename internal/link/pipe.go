@@ -0,0 +1,183 @@
+package link
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// pipeQueueDepth is how many frames a pipe buffers in each direction before
+// writers block.
+const pipeQueueDepth = 64
+
+// PipeLink is one end of an in-memory link, for running a whole network
+// inside a single process.
+type PipeLink struct {
+	name   string
+	in     <-chan []byte
+	out    chan<- []byte
+	closed chan struct{}
+	// peerClosed is closed when the other end is
+	peerClosed <-chan struct{}
+	once       *sync.Once
+}
+
+// Pipe returns the two ends of a new in-memory link.
+func Pipe() (*PipeLink, *PipeLink) {
+	return newPipe("pipe")
+}
+
+func newPipe(name string) (*PipeLink, *PipeLink) {
+	aToB := make(chan []byte, pipeQueueDepth)
+	bToA := make(chan []byte, pipeQueueDepth)
+	aClosed := make(chan struct{})
+	bClosed := make(chan struct{})
+	a := &PipeLink{name: name, in: bToA, out: aToB, closed: aClosed, peerClosed: bClosed, once: new(sync.Once)}
+	b := &PipeLink{name: name, in: aToB, out: bToA, closed: bClosed, peerClosed: aClosed, once: new(sync.Once)}
+	return a, b
+}
+
+func (link *PipeLink) String() string {
+	return "pipe://" + link.name
+}
+
+// ReadFrame still returns the frames written before the other end closed.
+func (link *PipeLink) ReadFrame() ([]byte, error) {
+	if link.closedErr() == ErrClosed {
+		return nil, ErrClosed
+	}
+	select {
+	case frame := <-link.in:
+		return frame, nil
+	case <-link.closed:
+		return nil, ErrClosed
+	case <-link.peerClosed:
+	}
+	select {
+	case frame := <-link.in:
+		return frame, nil
+	default:
+		return nil, io.EOF
+	}
+}
+
+func (link *PipeLink) WriteFrame(frame []byte) error {
+	err := checkLength(len(frame))
+	if err != nil {
+		return err
+	}
+	// select picks among ready cases at random, so a closed pipe would
+	// otherwise still take frames while the queue has room
+	err = link.closedErr()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-link.closed:
+		return ErrClosed
+	case <-link.peerClosed:
+		return io.ErrClosedPipe
+	case link.out <- append([]byte(nil), frame...):
+		return nil
+	}
+}
+
+// closedErr reports which end, if any, closed the pipe, this one first.
+func (link *PipeLink) closedErr() error {
+	select {
+	case <-link.closed:
+		return ErrClosed
+	default:
+	}
+	select {
+	case <-link.peerClosed:
+		return io.ErrClosedPipe
+	default:
+		return nil
+	}
+}
+
+func (link *PipeLink) Close() error {
+	link.once.Do(func() { close(link.closed) })
+	return nil
+}
+
+type pipeAddr string
+
+func (addr pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (addr pipeAddr) String() string {
+	return string(addr)
+}
+
+var (
+	pipeListeners = make(map[string]*pipeListener)
+	pipeMutex     = new(sync.Mutex)
+)
+
+type pipeListener struct {
+	name    string
+	accepts chan *PipeLink
+	closed  chan struct{}
+	once    *sync.Once
+}
+
+// ListenPipe registers name so that DialPipe can reach it from the same
+// process.
+func ListenPipe(name string) (Listener, error) {
+	pipeMutex.Lock()
+	defer pipeMutex.Unlock()
+	if _, used := pipeListeners[name]; used {
+		return nil, fmt.Errorf("%w: pipe://%s", ErrAddressInUse, name)
+	}
+	listener := &pipeListener{
+		name:    name,
+		accepts: make(chan *PipeLink, pipeQueueDepth),
+		closed:  make(chan struct{}),
+		once:    new(sync.Once),
+	}
+	pipeListeners[name] = listener
+	return listener, nil
+}
+
+func DialPipe(name string) (*PipeLink, error) {
+	pipeMutex.Lock()
+	listener, ok := pipeListeners[name]
+	pipeMutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("dial pipe://%s: no listener", name)
+	}
+	local, remote := newPipe(name)
+	select {
+	case listener.accepts <- remote:
+		return local, nil
+	case <-listener.closed:
+		return nil, fmt.Errorf("dial pipe://%s: %w", name, net.ErrClosed)
+	}
+}
+
+func (listener *pipeListener) Accept() (Link, error) {
+	select {
+	case link := <-listener.accepts:
+		return link, nil
+	case <-listener.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (listener *pipeListener) Close() error {
+	listener.once.Do(func() {
+		pipeMutex.Lock()
+		delete(pipeListeners, listener.name)
+		pipeMutex.Unlock()
+		close(listener.closed)
+	})
+	return nil
+}
+
+func (listener *pipeListener) Addr() net.Addr {
+	return pipeAddr(listener.name)
+}
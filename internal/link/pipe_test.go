@@ -0,0 +1,69 @@
+package link
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestPipeClose(t *testing.T) {
+	a, b := Pipe()
+	a.WriteFrame([]byte("first"))
+	a.WriteFrame([]byte("second"))
+	a.Close()
+
+	// frames written before the close are still delivered
+	readFrame(t, b, []byte("first"))
+	readFrame(t, b, []byte("second"))
+	if _, err := b.ReadFrame(); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadFrame() after the peer closed error = %v, want %v", err, io.EOF)
+	}
+	if err := b.WriteFrame([]byte("late")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("WriteFrame() after the peer closed error = %v, want %v", err, io.ErrClosedPipe)
+	}
+	if _, err := a.ReadFrame(); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadFrame() after Close error = %v, want %v", err, ErrClosed)
+	}
+	if err := a.WriteFrame([]byte("late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("WriteFrame() after Close error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestPipeListener(t *testing.T) {
+	if _, err := DialPipe("nowhere"); err == nil {
+		t.Errorf("DialPipe() without a listener succeeded")
+	}
+	listener, err := ListenPipe("lan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenPipe("lan"); !errors.Is(err, ErrAddressInUse) {
+		t.Errorf("ListenPipe() of a used name error = %v, want %v", err, ErrAddressInUse)
+	}
+	if got := listener.Addr().String(); got != "lan" {
+		t.Errorf("Addr() = %q, want %q", got, "lan")
+	}
+
+	dialed, err := DialPipe("lan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialed.WriteFrame([]byte("hello"))
+	readFrame(t, accepted, []byte("hello"))
+
+	listener.Close()
+	if _, err := listener.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept() after Close error = %v, want %v", err, net.ErrClosed)
+	}
+	// the name is free again once the listener closed
+	listener, err = ListenPipe("lan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+}
@@ -0,0 +1,312 @@
+package link
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"tcp-ip/internal/ethernet"
+	"time"
+)
+
+const (
+	// DefaultQueueLimit is the transmit queue length in frames when none is
+	// configured, about what a small switch buffers per port
+	DefaultQueueLimit = 100
+	defaultREDWeight  = 0.002
+)
+
+// RED configures random early detection from Floyd and Jacobson. Between
+// the thresholds, given in frames of average queue length, frames are
+// dropped with a probability that grows up to MaxProbability.
+type RED struct {
+	MinThreshold   float64
+	MaxThreshold   float64
+	MaxProbability float64
+	// Weight of the newest sample in the average queue length
+	Weight float64
+}
+
+// Shaping limits the rate of the frames written to a link. Frames leave
+// the transmit queue as a token bucket of Burst bytes filled at Rate allows
+// and reach the other end once the wire has carried all their bits.
+type Shaping struct {
+	// Rate in bits per second, zero meaning unlimited
+	Rate int64
+	// Burst in bytes, one frame of the largest size when zero
+	Burst int
+	// QueueLimit in frames, beyond which frames are tail dropped
+	QueueLimit int
+	// RED drops frames early instead, when set
+	RED *RED
+}
+
+func (shaping Shaping) serialization(length int) time.Duration {
+	return time.Duration(int64(length) * 8 * int64(time.Second) / shaping.Rate)
+}
+
+// ParseRate reads a rate in bits per second with an optional k, M or G
+// suffix, such as 10M.
+func ParseRate(value string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "k"):
+		multiplier = 1_000
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1_000_000
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1_000_000_000
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 {
+		return 0, fmt.Errorf("invalid rate %q", value)
+	}
+	return int64(rate * float64(multiplier)), nil
+}
+
+// ParseRED reads min:max:maxprobability[:weight].
+func ParseRED(value string) (*RED, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) < 3 || len(fields) > 4 {
+		return nil, fmt.Errorf("invalid RED %q: expected min:max:maxprobability[:weight]", value)
+	}
+	red := &RED{Weight: defaultREDWeight}
+	var err error
+	red.MinThreshold, err = strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RED minimum: %w", err)
+	}
+	red.MaxThreshold, err = strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RED maximum: %w", err)
+	}
+	red.MaxProbability, err = parseProbability(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid RED probability: %w", err)
+	}
+	if len(fields) == 4 {
+		red.Weight, err = parseProbability(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid RED weight: %w", err)
+		}
+	}
+	if red.MinThreshold < 0 || red.MaxThreshold <= red.MinThreshold {
+		return nil, fmt.Errorf("invalid RED %q: thresholds out of order", value)
+	}
+	return red, nil
+}
+
+// ShapingStats counts what happened to the frames written to a shaped
+// link.
+type ShapingStats struct {
+	Sent      uint64
+	TailDrops uint64
+	REDDrops  uint64
+	Queued    int
+	MaxQueued int
+}
+
+// ShapedLink queues the frames written to it and sends them on the wrapped
+// link no faster than the configured rate.
+type ShapedLink struct {
+	inner   Link
+	shaping Shaping
+	queue   [][]byte
+	// average queue length and frames since the last drop, for RED, and
+	// when the queue went idle, over which the average decays
+	average   float64
+	count     int
+	idleSince time.Time
+	rng       *rand.Rand
+	// wire delivers the frames in the order they left the queue
+	wire   *delayLine
+	stats  ShapingStats
+	ready  *sync.Cond
+	closed bool
+	mutex  *sync.Mutex
+}
+
+func NewShapedLink(inner Link, shaping Shaping, seed uint64) *ShapedLink {
+	if shaping.QueueLimit <= 0 {
+		shaping.QueueLimit = DefaultQueueLimit
+	}
+	if shaping.Burst <= 0 {
+		shaping.Burst = ethernet.MTU
+	}
+	mutex := new(sync.Mutex)
+	link := &ShapedLink{
+		inner:   inner,
+		shaping: shaping,
+		wire: newDelayLine(func(frame []byte) {
+			_ = inner.WriteFrame(frame)
+		}),
+		rng:   rand.New(rand.NewPCG(seed, seed^0x6a09e667f3bcc909)),
+		count: -1,
+		ready: sync.NewCond(mutex),
+		mutex: mutex,
+	}
+	go link.transmit()
+	return link
+}
+
+func (link *ShapedLink) String() string {
+	return fmt.Sprint(link.inner)
+}
+
+func (link *ShapedLink) ReadFrame() ([]byte, error) {
+	return link.inner.ReadFrame()
+}
+
+// WriteFrame queues frame, or drops it when the queue is full or RED picks
+// it, without telling the caller, as a router drops packets.
+func (link *ShapedLink) WriteFrame(frame []byte) error {
+	err := checkLength(len(frame))
+	if err != nil {
+		return err
+	}
+	link.mutex.Lock()
+	defer link.mutex.Unlock()
+	if link.closed {
+		return ErrClosed
+	}
+	if link.earlyDrop() {
+		link.stats.REDDrops++
+		return nil
+	}
+	if len(link.queue) >= link.shaping.QueueLimit {
+		link.stats.TailDrops++
+		return nil
+	}
+	link.queue = append(link.queue, append([]byte(nil), frame...))
+	link.stats.MaxQueued = max(link.stats.MaxQueued, len(link.queue))
+	link.ready.Signal()
+	return nil
+}
+
+// earlyDrop runs the RED algorithm for an arriving frame. count spreads the
+// drops out evenly instead of letting them cluster.
+func (link *ShapedLink) earlyDrop() bool {
+	red := link.shaping.RED
+	if red == nil {
+		return false
+	}
+	if len(link.queue) == 0 && link.shaping.Rate > 0 {
+		// Floyd and Jacobson age the average as if m frames had found the
+		// queue empty while it was idle, m being how many could have been
+		// sent in the meantime
+		idle := max(time.Since(link.idleSince), 0)
+		m := float64(idle) / float64(link.shaping.serialization(ethernet.MTU))
+		link.average *= math.Pow(1-red.Weight, m)
+	} else {
+		link.average += red.Weight * (float64(len(link.queue)) - link.average)
+	}
+	switch {
+	case link.average < red.MinThreshold:
+		link.count = -1
+		return false
+	case link.average >= red.MaxThreshold:
+		link.count = 0
+		return true
+	}
+	link.count++
+	probability := red.MaxProbability * (link.average - red.MinThreshold) / (red.MaxThreshold - red.MinThreshold)
+	if denominator := 1 - float64(link.count)*probability; denominator > 0 {
+		probability /= denominator
+	} else {
+		probability = 1
+	}
+	if link.rng.Float64() < probability {
+		link.count = 0
+		return true
+	}
+	return false
+}
+
+// transmit drains the queue, waiting for tokens and for the wire to carry
+// the previous frame before each frame departs, and delivering it once its
+// last bit is on the wire. A frame stays in the queue while it waits, so
+// the queue limit and RED see the backlog.
+func (link *ShapedLink) transmit() {
+	burst := float64(link.shaping.Burst)
+	tokens := burst
+	last := time.Now()
+	var free time.Time
+	for {
+		link.mutex.Lock()
+		for len(link.queue) == 0 && !link.closed {
+			link.ready.Wait()
+		}
+		if link.closed {
+			link.mutex.Unlock()
+			return
+		}
+		frame := link.queue[0]
+		link.mutex.Unlock()
+
+		var start time.Time
+		if link.shaping.Rate > 0 {
+			now := time.Now()
+			tokens = min(tokens+now.Sub(last).Seconds()*float64(link.shaping.Rate)/8, burst)
+			last = now
+			start = now
+			if missing := float64(len(frame)) - tokens; missing > 0 {
+				start = now.Add(time.Duration(missing * 8 / float64(link.shaping.Rate) * float64(time.Second)))
+			}
+			// the wire carries one frame at a time, so a frame never
+			// arrives before the one sent ahead of it
+			start = later(start, free)
+			time.Sleep(time.Until(start))
+			tokens = min(tokens+start.Sub(last).Seconds()*float64(link.shaping.Rate)/8, burst) - float64(len(frame))
+			last = start
+			free = start.Add(link.shaping.serialization(len(frame)))
+		}
+
+		link.mutex.Lock()
+		if link.closed {
+			link.mutex.Unlock()
+			return
+		}
+		link.queue = link.queue[1:]
+		link.stats.Sent++
+		if len(link.queue) == 0 {
+			link.idleSince = later(free, time.Now())
+		}
+		link.mutex.Unlock()
+
+		if link.shaping.Rate == 0 {
+			_ = link.inner.WriteFrame(frame)
+			continue
+		}
+		link.wire.schedule(frame, free)
+	}
+}
+
+func (link *ShapedLink) Stats() ShapingStats {
+	link.mutex.Lock()
+	defer link.mutex.Unlock()
+	stats := link.stats
+	stats.Queued = len(link.queue)
+	return stats
+}
+
+func (link *ShapedLink) Close() error {
+	link.mutex.Lock()
+	link.closed = true
+	link.queue = nil
+	link.ready.Broadcast()
+	link.mutex.Unlock()
+	link.wire.close()
+	return link.inner.Close()
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
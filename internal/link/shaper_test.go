@@ -0,0 +1,248 @@
+package link
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"tcp-ip/internal/ethernet"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		valid bool
+	}{
+		{"9600", 9600, true},
+		{"64k", 64_000, true},
+		{"1.5M", 1_500_000, true},
+		{"10G", 10_000_000_000, true},
+		{"0", 0, true},
+		{"10m", 0, false},
+		{"-1M", 0, false},
+		{"M", 0, false},
+	}
+	for _, test := range tests {
+		got, err := ParseRate(test.value)
+		if (err == nil) != test.valid || got != test.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", test.value, got, err, test.want)
+		}
+	}
+}
+
+func TestParseRED(t *testing.T) {
+	tests := []struct {
+		value string
+		want  RED
+		valid bool
+	}{
+		{"5:15:10%", RED{MinThreshold: 5, MaxThreshold: 15, MaxProbability: 0.1, Weight: defaultREDWeight}, true},
+		{"5:15:0.1:0.5", RED{MinThreshold: 5, MaxThreshold: 15, MaxProbability: 0.1, Weight: 0.5}, true},
+		{"5:15", RED{}, false},
+		{"5:15:0.1:0.5:1", RED{}, false},
+		{"15:5:0.1", RED{}, false},
+		{"5:5:0.1", RED{}, false},
+		{"-1:5:0.1", RED{}, false},
+		{"5:15:2", RED{}, false},
+		{"a:15:0.1", RED{}, false},
+	}
+	for _, test := range tests {
+		got, err := ParseRED(test.value)
+		if (err == nil) != test.valid || (test.valid && *got != test.want) {
+			t.Errorf("ParseRED(%q) = %v, %v, want %+v", test.value, got, err, test.want)
+		}
+	}
+}
+
+func TestSerialization(t *testing.T) {
+	shaping := Shaping{Rate: 8_000_000}
+	if got := shaping.serialization(1000); got != time.Millisecond {
+		t.Errorf("serialization of 1000 bytes at 8M = %v, want 1ms", got)
+	}
+}
+
+// redLink is a shaped link without its transmitter, whose queue holds a
+// fixed number of frames. A weight of one makes the average the current
+// length.
+func redLink(red RED, queued int) *ShapedLink {
+	return &ShapedLink{
+		shaping: Shaping{RED: &red},
+		queue:   make([][]byte, queued),
+		rng:     rand.New(rand.NewPCG(1, 2)),
+		count:   -1,
+	}
+}
+
+func TestEarlyDrop(t *testing.T) {
+	red := RED{MinThreshold: 10, MaxThreshold: 30, MaxProbability: 0.2, Weight: 1}
+	tests := []struct {
+		name   string
+		queued int
+		rate   float64
+	}{
+		{"below the minimum", 9, 0},
+		{"at the maximum", 30, 1},
+		// count makes the gap between drops uniform between 1 and 1/pb-1
+		// frames, so the drop rate is 2pb
+		{"halfway", 20, 2 * 0.1},
+		{"near the minimum", 12, 2 * 0.02},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			link := redLink(red, test.queued)
+			probability := red.MaxProbability * (float64(test.queued) - red.MinThreshold) / (red.MaxThreshold - red.MinThreshold)
+			dropped, gap := 0, 0
+			for range frames {
+				gap++
+				if !link.earlyDrop() {
+					continue
+				}
+				dropped++
+				if test.rate < 1 && gap > int(math.Round(1/probability)) {
+					t.Fatalf("%d frames between drops, more than 1/pb", gap)
+				}
+				gap = 0
+			}
+			if rate := float64(dropped) / frames; math.Abs(rate-test.rate) > 0.01 {
+				t.Errorf("drop rate %.4f, want %.4f", rate, test.rate)
+			}
+		})
+	}
+}
+
+func TestREDAverage(t *testing.T) {
+	link := redLink(RED{MinThreshold: 10, MaxThreshold: 30, MaxProbability: 0.2, Weight: 0.1}, 40)
+	// a sudden burst does not trigger drops until the average catches up
+	if link.earlyDrop() {
+		t.Fatalf("dropped on the first frame of a burst")
+	}
+	for range 100 {
+		link.earlyDrop()
+	}
+	if math.Abs(link.average-40) > 0.1 {
+		t.Errorf("average %.2f, want 40", link.average)
+	}
+}
+
+func TestREDIdleDecay(t *testing.T) {
+	red := RED{MinThreshold: 10, MaxThreshold: 30, MaxProbability: 0.2, Weight: 0.002}
+	link := redLink(red, 0)
+	link.shaping.Rate = 8_000_000
+	link.average = 20
+	// long enough to send 1000 frames of the largest size
+	link.idleSince = time.Now().Add(-1000 * link.shaping.serialization(ethernet.MTU))
+	if link.earlyDrop() {
+		t.Errorf("dropped a frame arriving at an idle queue")
+	}
+	if want := 20 * math.Pow(1-red.Weight, 1000); math.Abs(link.average-want) > 0.05 {
+		t.Errorf("average after idling %.2f, want %.2f", link.average, want)
+	}
+
+	// a queue that just went empty has not been idle yet
+	link.average = 20
+	link.idleSince = time.Now().Add(time.Second)
+	link.earlyDrop()
+	if link.average != 20 {
+		t.Errorf("average %.2f, want 20 before the queue idled", link.average)
+	}
+}
+
+// collector reads every frame arriving at the end of a pipe.
+func collector(t *testing.T, end *PipeLink) (wait func(count int) []time.Time) {
+	var arrivals []time.Time
+	mutex := new(sync.Mutex)
+	go func() {
+		for {
+			if _, err := end.ReadFrame(); err != nil {
+				return
+			}
+			mutex.Lock()
+			arrivals = append(arrivals, time.Now())
+			mutex.Unlock()
+		}
+	}()
+	return func(count int) []time.Time {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mutex.Lock()
+			got := append([]time.Time(nil), arrivals...)
+			mutex.Unlock()
+			if len(got) >= count {
+				return got
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%d frames arrived, want %d", len(got), count)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestShapedRate(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	// 1000 byte frames at 4 Mbit/s take 2ms each on the wire
+	link := NewShapedLink(a, Shaping{Rate: 4_000_000, QueueLimit: 100}, 1)
+	defer link.Close()
+	wait := collector(t, b)
+
+	const count = 50
+	start := time.Now()
+	for range count {
+		if err := link.WriteFrame(make([]byte, 1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	arrivals := wait(count)
+	if elapsed := arrivals[count-1].Sub(start); elapsed < count*2*time.Millisecond-5*time.Millisecond {
+		t.Errorf("%d frames took %v, faster than the rate allows", count, elapsed)
+	}
+	if stats := link.Stats(); stats.Sent != count || stats.TailDrops != 0 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+// TestBacklogQueued checks that frames wait in the queue, not on the
+// wire, while the wire still carries an earlier frame.
+func TestBacklogQueued(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	// the burst covers every frame, but each takes a second on the wire
+	link := NewShapedLink(a, Shaping{Rate: 8000, Burst: 10_000, QueueLimit: 5}, 1)
+	defer link.Close()
+	for range 3 {
+		if err := link.WriteFrame(make([]byte, 1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if stats := link.Stats(); stats.Sent != 1 || stats.Queued != 2 {
+		t.Errorf("stats %+v, want 1 frame sent and 2 queued", stats)
+	}
+}
+
+func TestTailDrop(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	// a frame takes a second at 8 kbit/s, so once the first has left on
+	// the burst the queue fills up and stays full
+	link := NewShapedLink(a, Shaping{Rate: 8000, QueueLimit: 5}, 1)
+	defer link.Close()
+
+	const count = 20
+	for range count {
+		if err := link.WriteFrame(make([]byte, 1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := link.Stats()
+	if stats.MaxQueued != 5 || stats.Queued != 5 || stats.TailDrops < count-5-2 {
+		t.Errorf("stats %+v, want the queue capped at 5", stats)
+	}
+	if total := stats.Sent + stats.TailDrops + uint64(stats.Queued); total != count {
+		t.Errorf("%d frames accounted for, want %d", total, count)
+	}
+}
@@ -0,0 +1,92 @@
+package link
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// StreamLink carries frames over a stream connection, such as TCP or a
+// Unix domain socket, each one preceded by its 2 byte length.
+type StreamLink struct {
+	conn  net.Conn
+	mutex *sync.Mutex
+}
+
+func NewStreamLink(conn net.Conn) *StreamLink {
+	return &StreamLink{conn: conn, mutex: new(sync.Mutex)}
+}
+
+func (link *StreamLink) String() string {
+	return link.conn.RemoteAddr().Network() + "://" + link.conn.RemoteAddr().String()
+}
+
+func (link *StreamLink) ReadFrame() ([]byte, error) {
+	err := link.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	var length uint16
+	err = binary.Read(link.conn, binary.BigEndian, &length)
+	if err != nil {
+		return nil, err
+	}
+	err = checkLength(int(length))
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, length)
+	_, err = io.ReadFull(link.conn, frame)
+	if err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// WriteFrame writes the length and the frame in one call, so frames sent
+// from several goroutines never interleave.
+func (link *StreamLink) WriteFrame(frame []byte) error {
+	err := checkLength(len(frame))
+	if err != nil {
+		return err
+	}
+	data := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(frame)), uint16(len(frame)))
+	data = append(data, frame...)
+
+	link.mutex.Lock()
+	defer link.mutex.Unlock()
+	err = link.conn.SetWriteDeadline(time.Now().Add(idleTimeout))
+	if err != nil {
+		return err
+	}
+	_, err = link.conn.Write(data)
+	return err
+}
+
+func (link *StreamLink) Close() error {
+	return link.conn.Close()
+}
+
+type streamListener struct {
+	listener net.Listener
+}
+
+func (listener *streamListener) Accept() (Link, error) {
+	conn, err := listener.listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamLink(conn), nil
+}
+
+func (listener *streamListener) Close() error {
+	return listener.listener.Close()
+}
+
+func (listener *streamListener) Addr() net.Addr {
+	return listener.listener.Addr()
+}
@@ -0,0 +1,76 @@
+package link
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"tcp-ip/internal/ethernet"
+	"testing"
+)
+
+// TestStreamFrameBoundaries writes frames from several goroutines and the
+// length prefixed bytes of others a few at a time, which the reader must
+// still split into the frames written.
+func TestStreamFrameBoundaries(t *testing.T) {
+	local, remote := net.Pipe()
+	writer, reader := NewStreamLink(local), NewStreamLink(remote)
+	defer writer.Close()
+	defer reader.Close()
+
+	sizes := []int{1, ethernet.MinFrame, 1000, ethernet.MaxTaggedFrame}
+	var group sync.WaitGroup
+	for _, size := range sizes {
+		group.Go(func() {
+			if err := writer.WriteFrame(testFrame(size)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	got := make(map[int]bool)
+	for range sizes {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(frame) != string(testFrame(len(frame))) {
+			t.Errorf("frame of %d bytes mixes in other frames", len(frame))
+		}
+		got[len(frame)] = true
+	}
+	group.Wait()
+	for _, size := range sizes {
+		if !got[size] {
+			t.Errorf("no frame of %d bytes read", size)
+		}
+	}
+
+	var stream []byte
+	for _, size := range sizes {
+		stream = binary.BigEndian.AppendUint16(stream, uint16(size))
+		stream = append(stream, testFrame(size)...)
+	}
+	go func() {
+		for len(stream) > 0 {
+			chunk := min(len(stream), 3)
+			local.Write(stream[:chunk])
+			stream = stream[chunk:]
+		}
+	}()
+	for _, size := range sizes {
+		readFrame(t, reader, testFrame(size))
+	}
+}
+
+func TestStreamInvalidLength(t *testing.T) {
+	for _, length := range []int{0, ethernet.MaxTaggedFrame + 1} {
+		local, remote := net.Pipe()
+		reader := NewStreamLink(remote)
+		go local.Write(binary.BigEndian.AppendUint16(nil, uint16(length)))
+		if _, err := reader.ReadFrame(); !errors.Is(err, ErrInvalidLength) {
+			t.Errorf("ReadFrame() of a %d byte frame error = %v, want %v", length, err, ErrInvalidLength)
+		}
+		local.Close()
+		reader.Close()
+	}
+}
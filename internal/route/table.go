@@ -0,0 +1,181 @@
+package route
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"tcp-ip/internal/ip"
+)
+
+var ErrNoRoute = fmt.Errorf("no route to host")
+
+type Kind int
+
+const (
+	KindConnected Kind = iota
+	KindStatic
+)
+
+const (
+	ConnectedMetric = 0
+	StaticMetric    = 1
+)
+
+type Route struct {
+	Prefix    ip.Prefix
+	Gateway   ip.IPAddress
+	Interface int
+	Metric    int
+	Kind      Kind
+}
+
+// NextHop returns the address to resolve on the link, the gateway for
+// routes through one and dst itself for connected routes.
+func (route Route) NextHop(dst ip.IPAddress) ip.IPAddress {
+	if route.Gateway == (ip.IPAddress{}) {
+		return dst
+	}
+	return route.Gateway
+}
+
+func (route Route) String() string {
+	kind := "static"
+	if route.Kind == KindConnected {
+		kind = "connected"
+	}
+	if route.Gateway == (ip.IPAddress{}) {
+		return fmt.Sprintf("%v dev %d %s metric %d", route.Prefix, route.Interface, kind, route.Metric)
+	}
+	return fmt.Sprintf("%v via %v dev %d %s metric %d", route.Prefix, route.Gateway, route.Interface, kind, route.Metric)
+}
+
+func (route Route) sameAs(other Route) bool {
+	return route.Gateway == other.Gateway && route.Interface == other.Interface
+}
+
+type node struct {
+	children [2]*node
+	routes   []Route
+}
+
+// Table is a binary trie keyed by prefix bits, so a lookup walks at most 32
+// nodes and remembers the deepest one holding routes.
+type Table struct {
+	root  *node
+	mutex *sync.RWMutex
+}
+
+func NewTable() *Table {
+	return &Table{root: &node{}, mutex: new(sync.RWMutex)}
+}
+
+func bit(address ip.IPAddress, index int) int {
+	return int(address.Uint32()>>(31-index)) & 1
+}
+
+func (table *Table) Add(route Route) {
+	route.Prefix = route.Prefix.Masked()
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	current := table.root
+	for i := range route.Prefix.Length {
+		b := bit(route.Prefix.Address, i)
+		if current.children[b] == nil {
+			current.children[b] = &node{}
+		}
+		current = current.children[b]
+	}
+
+	// a route is identified by its prefix, gateway and interface, so adding
+	// it again only changes its metric
+	index := slices.IndexFunc(current.routes, route.sameAs)
+	if index >= 0 {
+		current.routes[index] = route
+	} else {
+		current.routes = append(current.routes, route)
+	}
+	slices.SortStableFunc(current.routes, func(a, b Route) int { return a.Metric - b.Metric })
+}
+
+// AddConnected installs the route to the subnet of an interface configured
+// with the given address and prefix length.
+func (table *Table) AddConnected(address ip.Prefix, iface int) {
+	table.Add(Route{Prefix: address.Masked(), Interface: iface, Metric: ConnectedMetric, Kind: KindConnected})
+}
+
+func (table *Table) AddStatic(prefix ip.Prefix, gateway ip.IPAddress, metric int) error {
+	connected, err := table.Lookup(gateway)
+	if err != nil || connected.Kind != KindConnected {
+		return fmt.Errorf("gateway %v is not on a connected subnet", gateway)
+	}
+	table.Add(Route{Prefix: prefix, Gateway: gateway, Interface: connected.Interface, Metric: metric, Kind: KindStatic})
+	return nil
+}
+
+func (table *Table) AddDefault(gateway ip.IPAddress, metric int) error {
+	return table.AddStatic(ip.Prefix{}, gateway, metric)
+}
+
+// Remove deletes the route with the prefix, gateway and interface of route,
+// whatever its metric.
+func (table *Table) Remove(route Route) bool {
+	prefix := route.Prefix.Masked()
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	current := table.root
+	for i := range prefix.Length {
+		current = current.children[bit(prefix.Address, i)]
+		if current == nil {
+			return false
+		}
+	}
+	index := slices.IndexFunc(current.routes, route.sameAs)
+	if index < 0 {
+		return false
+	}
+	current.routes = slices.Delete(current.routes, index, index+1)
+	return true
+}
+
+// Lookup returns the lowest metric route among those with the longest
+// prefix containing dst.
+func (table *Table) Lookup(dst ip.IPAddress) (Route, error) {
+	table.mutex.RLock()
+	defer table.mutex.RUnlock()
+
+	var best []Route
+	current := table.root
+	for i := 0; current != nil; i++ {
+		if len(current.routes) > 0 {
+			best = current.routes
+		}
+		if i == 32 {
+			break
+		}
+		current = current.children[bit(dst, i)]
+	}
+	if len(best) == 0 {
+		return Route{}, fmt.Errorf("%w %v", ErrNoRoute, dst)
+	}
+	return best[0], nil
+}
+
+func (table *Table) Routes() []Route {
+	table.mutex.RLock()
+	defer table.mutex.RUnlock()
+
+	var routes []Route
+	var walk func(current *node)
+	walk = func(current *node) {
+		if current == nil {
+			return
+		}
+		routes = append(routes, current.routes...)
+		walk(current.children[0])
+		walk(current.children[1])
+	}
+	walk(table.root)
+	return routes
+}
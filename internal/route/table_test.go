@@ -0,0 +1,143 @@
+package route
+
+import (
+	"errors"
+	"tcp-ip/internal/ip"
+	"testing"
+)
+
+func prefix(t *testing.T, text string) ip.Prefix {
+	t.Helper()
+	prefix, err := ip.ParsePrefix(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prefix
+}
+
+func address(t *testing.T, text string) ip.IPAddress {
+	t.Helper()
+	address, err := ip.ParseIP(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return address
+}
+
+func TestLookup(t *testing.T) {
+	table := NewTable()
+	table.AddConnected(prefix(t, "10.0.0.1/24"), 0)
+	table.AddConnected(prefix(t, "10.0.1.1/24"), 1)
+	for _, route := range []struct {
+		prefix  string
+		gateway string
+		metric  int
+	}{
+		{"0.0.0.0/0", "10.0.0.254", 10},
+		{"192.168.0.0/16", "10.0.0.2", 1},
+		{"192.168.5.0/24", "10.0.1.2", 1},
+		// an LPM tie, settled by the metric
+		{"172.16.0.0/12", "10.0.0.3", 5},
+		{"172.16.0.0/12", "10.0.1.3", 2},
+		{"10.0.1.7/32", "10.0.0.4", 1},
+	} {
+		if err := table.AddStatic(prefix(t, route.prefix), address(t, route.gateway), route.metric); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		dst       string
+		gateway   string
+		iface     int
+		connected bool
+	}{
+		{"10.0.0.9", "0.0.0.0", 0, true},
+		{"10.0.1.9", "0.0.0.0", 1, true},
+		{"10.0.1.7", "10.0.0.4", 0, false},
+		{"192.168.9.9", "10.0.0.2", 0, false},
+		{"192.168.5.9", "10.0.1.2", 1, false},
+		{"172.20.0.1", "10.0.1.3", 1, false},
+		{"8.8.8.8", "10.0.0.254", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.dst, func(t *testing.T) {
+			route, err := table.Lookup(address(t, test.dst))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if route.Gateway != address(t, test.gateway) || route.Interface != test.iface ||
+				(route.Kind == KindConnected) != test.connected {
+				t.Errorf("Lookup() = %v", route)
+			}
+		})
+	}
+}
+
+func TestLookupNoRoute(t *testing.T) {
+	table := NewTable()
+	table.AddConnected(prefix(t, "10.0.0.1/24"), 0)
+	if _, err := table.Lookup(address(t, "10.0.1.1")); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("Lookup() error = %v, want %v", err, ErrNoRoute)
+	}
+	if err := table.AddStatic(prefix(t, "192.168.0.0/16"), address(t, "10.9.9.9"), 1); err == nil {
+		t.Errorf("AddStatic() accepted a gateway off the connected subnets")
+	}
+}
+
+func TestMetricUpdate(t *testing.T) {
+	table := NewTable()
+	table.AddConnected(prefix(t, "10.0.0.1/24"), 0)
+	first, second := address(t, "10.0.0.2"), address(t, "10.0.0.3")
+	table.AddDefault(first, 1)
+	table.AddDefault(second, 2)
+	dst := address(t, "8.8.8.8")
+
+	if route, _ := table.Lookup(dst); route.Gateway != first {
+		t.Fatalf("Lookup() = %v, want via %v", route, first)
+	}
+	// raising the metric of the preferred route hands over to the other
+	table.AddDefault(first, 3)
+	if route, _ := table.Lookup(dst); route.Gateway != second {
+		t.Errorf("after the metric update Lookup() = %v, want via %v", route, second)
+	}
+	if routes := table.Routes(); len(routes) != 3 {
+		t.Errorf("Routes() = %v, want the update to replace the route", routes)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	table := NewTable()
+	table.AddConnected(prefix(t, "10.0.0.1/24"), 0)
+	table.AddConnected(prefix(t, "10.0.1.1/24"), 1)
+	dst := address(t, "192.168.1.1")
+	gateway := address(t, "10.0.0.2")
+	routes := []Route{
+		{Prefix: prefix(t, "192.168.0.0/16"), Gateway: gateway, Interface: 0, Metric: 1, Kind: KindStatic},
+		{Prefix: prefix(t, "192.168.0.0/16"), Gateway: gateway, Interface: 1, Metric: 2, Kind: KindStatic},
+	}
+	for _, route := range routes {
+		table.Add(route)
+	}
+
+	tests := []struct {
+		name    string
+		route   Route
+		removed bool
+	}{
+		{"unknown prefix", Route{Prefix: prefix(t, "172.16.0.0/12"), Gateway: gateway}, false},
+		{"other gateway", Route{Prefix: routes[0].Prefix, Gateway: address(t, "10.0.0.3")}, false},
+		{"other interface", Route{Prefix: routes[0].Prefix, Gateway: gateway, Interface: 2}, false},
+		{"any metric", Route{Prefix: prefix(t, "192.168.7.7/16"), Gateway: gateway, Interface: 0, Metric: 9}, true},
+		{"already removed", routes[0], false},
+	}
+	for _, test := range tests {
+		if removed := table.Remove(test.route); removed != test.removed {
+			t.Errorf("%s: Remove() = %t, want %t", test.name, removed, test.removed)
+		}
+	}
+	// the same gateway through the other interface is still there
+	if route, err := table.Lookup(dst); err != nil || route.Interface != 1 {
+		t.Errorf("Lookup() = %v, %v, want the route through interface 1", route, err)
+	}
+}
@@ -0,0 +1,104 @@
+package tcp
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrUnknownCongestionControl = fmt.Errorf("unknown congestion control")
+
+const (
+	DefaultCongestionControl = "newreno"
+
+	// maxCwndHistory bounds the samples a connection keeps for plotting
+	maxCwndHistory = 8192
+)
+
+// AckEvent describes an ACK that acknowledged new data.
+type AckEvent struct {
+	// Ack is SEG.ACK, which tells a partial from a full acknowledgment
+	// during fast recovery
+	Ack uint32
+	// Acked is the number of octets newly acknowledged
+	Acked int
+	// InFlight is the number of octets outstanding before the ACK
+	InFlight int
+	// SRTT is the smoothed round trip time, zero before the first sample
+	SRTT time.Duration
+	Now  time.Time
+}
+
+// CongestionControl decides how much data a connection may have in flight.
+// Windows are in octets. The connection serializes every call.
+type CongestionControl interface {
+	Name() string
+	Window() int
+	Threshold() int
+	InRecovery() bool
+	// OnAck handles an ACK for new data. It reports whether the ACK is
+	// partial, so the next unacknowledged segment must be resent at once.
+	OnAck(event AckEvent) bool
+	// OnFastRetransmit runs when enough duplicate ACKs signal a loss.
+	// recover is SND.NXT at that moment, which ends fast recovery.
+	OnFastRetransmit(inFlight int, recover uint32)
+	// OnDupAck runs for every further duplicate ACK during fast recovery.
+	OnDupAck()
+	OnTimeout(inFlight int)
+}
+
+// CwndSample records the congestion window at a point in time.
+type CwndSample struct {
+	Time      time.Time
+	Window    int
+	Threshold int
+}
+
+var (
+	congestionControls = map[string]func(mss int) CongestionControl{
+		"reno":    newReno,
+		"newreno": newNewReno,
+		"cubic":   newCubic,
+	}
+	congestionMutex = new(sync.RWMutex)
+)
+
+// RegisterCongestionControl makes an algorithm selectable by name. The
+// constructor receives the sender MSS of the connection.
+func RegisterCongestionControl(name string, constructor func(mss int) CongestionControl) {
+	congestionMutex.Lock()
+	defer congestionMutex.Unlock()
+	congestionControls[name] = constructor
+}
+
+func CongestionControls() []string {
+	congestionMutex.RLock()
+	defer congestionMutex.RUnlock()
+	names := make([]string, 0, len(congestionControls))
+	for name := range congestionControls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newCongestionControl(name string, mss int) (CongestionControl, error) {
+	congestionMutex.RLock()
+	constructor, ok := congestionControls[name]
+	congestionMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCongestionControl, name)
+	}
+	return constructor(mss), nil
+}
+
+// initialWindow is IW from RFC 5681 section 3.1.
+func initialWindow(mss int) int {
+	return min(4*mss, max(2*mss, 4380))
+}
+
+// lossThreshold is the ssthresh of RFC 5681 equation 4 after a loss.
+func lossThreshold(inFlight int, mss int) int {
+	return max(inFlight/2, 2*mss)
+}
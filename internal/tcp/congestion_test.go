@@ -0,0 +1,257 @@
+package tcp
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testMSS = 1000
+
+func TestInitialWindow(t *testing.T) {
+	tests := []struct {
+		mss  int
+		want int
+	}{
+		{536, 2144},
+		{1000, 4000},
+		{1460, 4380},
+		{2190, 4380},
+		{4000, 8000},
+	}
+	for _, test := range tests {
+		if got := initialWindow(test.mss); got != test.want {
+			t.Errorf("initialWindow(%d) = %d, want %d", test.mss, got, test.want)
+		}
+	}
+}
+
+func TestCongestionControls(t *testing.T) {
+	names := CongestionControls()
+	for _, name := range []string{"cubic", "newreno", "reno"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("CongestionControls() = %v, missing %s", names, name)
+		}
+	}
+	if !slices.IsSorted(names) {
+		t.Errorf("CongestionControls() = %v, not sorted", names)
+	}
+	for _, name := range names {
+		congestion, err := newCongestionControl(name, testMSS)
+		if err != nil || congestion.Name() != name || congestion.Window() != initialWindow(testMSS) {
+			t.Errorf("newCongestionControl(%s) = %v, %v", name, congestion, err)
+		}
+	}
+	if _, err := newCongestionControl("vegas", testMSS); !errors.Is(err, ErrUnknownCongestionControl) {
+		t.Errorf("newCongestionControl() error = %v, want %v", err, ErrUnknownCongestionControl)
+	}
+}
+
+// ackEvents acknowledges count full segments one at a time.
+func ackEvents(congestion CongestionControl, count int, now time.Time) {
+	for range count {
+		congestion.OnAck(AckEvent{Acked: testMSS, InFlight: congestion.Window(), Now: now})
+	}
+}
+
+func TestRenoGrowth(t *testing.T) {
+	congestion := newReno(testMSS)
+	// slow start adds a segment per acknowledged segment
+	ackEvents(congestion, 4, time.Now())
+	if congestion.Window() != 8*testMSS {
+		t.Errorf("window after slow start = %d, want %d", congestion.Window(), 8*testMSS)
+	}
+	// an ACK for less than a segment adds only what it acknowledged
+	congestion.OnAck(AckEvent{Acked: 100, InFlight: congestion.Window()})
+	if congestion.Window() != 8*testMSS+100 {
+		t.Errorf("window = %d, want %d", congestion.Window(), 8*testMSS+100)
+	}
+
+	// congestion avoidance adds one segment per window
+	congestion.OnTimeout(20 * testMSS)
+	congestion.(*reno).cwnd = 10 * testMSS
+	ackEvents(congestion, 9, time.Now())
+	if congestion.Window() != 10*testMSS {
+		t.Errorf("window grew to %d before a full window was acknowledged", congestion.Window())
+	}
+	ackEvents(congestion, 1, time.Now())
+	if congestion.Window() != 11*testMSS {
+		t.Errorf("window after a full window = %d, want %d", congestion.Window(), 11*testMSS)
+	}
+}
+
+func TestRenoLoss(t *testing.T) {
+	tests := []struct {
+		name      string
+		newReno   bool
+		partial   bool
+		resend    bool
+		window    int
+		recovered int
+	}{
+		// a partial ACK ends Reno recovery at ssthresh
+		{"reno partial", false, true, false, 10 * testMSS, 10 * testMSS},
+		// NewReno stays in recovery, deflates and resends
+		{"newreno partial", true, true, true, 14*testMSS - 5*testMSS + testMSS, 0},
+		{"newreno full", true, false, false, 10 * testMSS, 10 * testMSS},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			congestion := newReno(testMSS)
+			if test.newReno {
+				congestion = newNewReno(testMSS)
+			}
+			congestion.OnFastRetransmit(20*testMSS, 20_000)
+			if congestion.Threshold() != 10*testMSS || congestion.Window() != 13*testMSS || !congestion.InRecovery() {
+				t.Fatalf("after fast retransmit: window %d, threshold %d", congestion.Window(), congestion.Threshold())
+			}
+			congestion.OnDupAck()
+			if congestion.Window() != 14*testMSS {
+				t.Errorf("duplicate ACK inflated the window to %d, want %d", congestion.Window(), 14*testMSS)
+			}
+
+			ack := uint32(20_000)
+			if test.partial {
+				ack = 5000
+			}
+			resend := congestion.OnAck(AckEvent{Ack: ack, Acked: 5 * testMSS, InFlight: 20 * testMSS})
+			if resend != test.resend || congestion.InRecovery() != test.resend {
+				t.Errorf("OnAck() = %t, in recovery %t, want %t", resend, congestion.InRecovery(), test.resend)
+			}
+			if test.resend {
+				if congestion.Window() != test.window {
+					t.Errorf("window after a partial ACK = %d, want %d", congestion.Window(), test.window)
+				}
+			} else if congestion.Window() != test.recovered {
+				t.Errorf("window after recovery = %d, want %d", congestion.Window(), test.recovered)
+			}
+		})
+	}
+}
+
+func TestRenoTimeout(t *testing.T) {
+	tests := []struct {
+		inFlight  int
+		threshold int
+	}{
+		{20 * testMSS, 10 * testMSS},
+		// never below two segments
+		{testMSS, 2 * testMSS},
+	}
+	for _, name := range CongestionControls() {
+		for _, test := range tests {
+			congestion, _ := newCongestionControl(name, testMSS)
+			congestion.OnFastRetransmit(test.inFlight, 0)
+			congestion.OnTimeout(test.inFlight)
+			if congestion.Window() != testMSS || congestion.InRecovery() {
+				t.Errorf("%s: window after timeout = %d, want one segment", name, congestion.Window())
+			}
+			if name != "cubic" && congestion.Threshold() != test.threshold {
+				t.Errorf("%s: threshold after timeout = %d, want %d", name, congestion.Threshold(), test.threshold)
+			}
+		}
+	}
+}
+
+func TestCubicReduction(t *testing.T) {
+	congestion := newCubic(testMSS).(*cubic)
+	congestion.cwnd = 100
+	congestion.OnFastRetransmit(100*testMSS, 0)
+	if congestion.wMax != 100 || congestion.ssthresh != 70 || congestion.Window() != 73*testMSS {
+		t.Errorf("after a loss: wMax %v, ssthresh %v, window %d", congestion.wMax, congestion.ssthresh, congestion.Window())
+	}
+	congestion.OnAck(AckEvent{Acked: testMSS})
+	if congestion.InRecovery() || congestion.cwnd != 70 {
+		t.Errorf("after recovery: window %v, want 70", congestion.cwnd)
+	}
+
+	// a loss below the previous maximum releases bandwidth faster, RFC 9438
+	// section 4.7
+	congestion.cwnd = 80
+	congestion.OnFastRetransmit(80*testMSS, 0)
+	if want := 80 * (1 + cubicBeta) / 2; congestion.wMax != want {
+		t.Errorf("wMax after fast convergence = %v, want %v", congestion.wMax, want)
+	}
+}
+
+func TestCubicGrowth(t *testing.T) {
+	congestion := newCubic(testMSS).(*cubic)
+	congestion.cwnd = 100
+	congestion.OnFastRetransmit(100*testMSS, 0)
+	congestion.OnAck(AckEvent{Acked: testMSS})
+
+	start := time.Now()
+	srtt := 100 * time.Millisecond
+	ack := func(at time.Duration) {
+		for range int(congestion.cwnd) {
+			congestion.OnAck(AckEvent{Acked: testMSS, SRTT: srtt, Now: start.Add(at)})
+		}
+	}
+	ack(0)
+	// K is the time the cubic function takes to climb back to wMax
+	k := math.Cbrt(100 * (1 - cubicBeta) / cubicC)
+	if math.Abs(congestion.k-k) > 1e-9 {
+		t.Fatalf("K = %v, want %v", congestion.k, k)
+	}
+
+	previous := congestion.cwnd
+	var atK float64
+	for at := srtt; at < 2*time.Duration(k*float64(time.Second)); at += srtt {
+		ack(at)
+		if congestion.cwnd < previous {
+			t.Fatalf("window shrank from %v to %v at %v", previous, congestion.cwnd, at)
+		}
+		previous = congestion.cwnd
+		if atK == 0 && at.Seconds() >= k {
+			atK = congestion.cwnd
+		}
+	}
+	// concave up to wMax, where it plateaus, then convex beyond
+	if math.Abs(atK-100) > 5 {
+		t.Errorf("window at K = %v, want close to wMax 100", atK)
+	}
+	if congestion.cwnd <= 105 {
+		t.Errorf("window at 2K = %v, want past wMax", congestion.cwnd)
+	}
+}
+
+func TestLossyTransfer(t *testing.T) {
+	for _, name := range CongestionControls() {
+		t.Run(name, func(t *testing.T) {
+			client, server := newHostPair(t)
+			if err := client.tcp.SetCongestionControl(name); err != nil {
+				t.Fatal(err)
+			}
+			clientConn, serverConn := connect(t, client, server)
+			if clientConn.CongestionControl() != name {
+				t.Fatalf("connection uses %s", clientConn.CongestionControl())
+			}
+			// drop the first transmission of every 20th data segment
+			count := 0
+			dropped := make(map[uint32]bool)
+			client.setDrop(func(segment *Segment) bool {
+				if len(segment.Data) == 0 || dropped[segment.Seq] {
+					return false
+				}
+				count++
+				if count%20 == 0 {
+					dropped[segment.Seq] = true
+					return true
+				}
+				return false
+			})
+			transfer(t, clientConn, serverConn, testData(512*1024))
+
+			history := clientConn.CwndHistory()
+			shrank := false
+			for i := 1; i < len(history); i++ {
+				shrank = shrank || history[i].Window < history[i-1].Window
+			}
+			if !shrank {
+				t.Errorf("the congestion window never shrank on loss")
+			}
+		})
+	}
+}
@@ -0,0 +1,625 @@
+package tcp
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"tcp-ip/internal/ip"
+	"time"
+)
+
+// Conn is a TCP connection and its transmission control block. Every field
+// below the mutex is guarded by it.
+type Conn struct {
+	tcp      *TCPModule
+	key      connKey
+	listener *Listener
+
+	mutex *sync.Mutex
+	cond  *sync.Cond
+	state State
+	err   error
+
+	iss    uint32
+	sndUna uint32
+	sndNxt uint32
+	sndWnd uint32
+	sndWl1 uint32
+	sndWl2 uint32
+	sndMSS int
+	// maxSndWnd is the largest window the peer offered so far
+	maxSndWnd uint32
+	// sndShift and rcvShift are the window scales of RFC 7323, both zero
+	// unless the peer agreed to scaling
+	sndShift uint8
+	rcvShift uint8
+
+	irs    uint32
+	rcvNxt uint32
+	// rcvAdv is the right edge of the last advertised window, which must
+	// not move left
+	rcvAdv uint32
+
+	// sackOK and tsOK record whether the peer agreed to SACK and to
+	// timestamps in its SYN
+	sackOK      bool
+	tsOK        bool
+	tsOffset    uint32
+	tsRecent    uint32
+	tsRecentAge time.Time
+	lastAckSent uint32
+
+	// sendBuffer holds the data from sndBase on, both in flight and unsent
+	sendBuffer []byte
+	sndBase    uint32
+	finQueued  bool
+	finSent    bool
+
+	recvBuffer     []byte
+	recvBufferSize int
+	finRecv        bool
+	// outOfOrder holds segments beyond rcvNxt sorted by sequence number
+	outOfOrder []*Segment
+	// lastOutOfOrder starts the latest of them, which SACK reports first
+	lastOutOfOrder uint32
+
+	retransmitQueue []*sentSegment
+	dupAcks         int
+	// recoveryEpoch counts loss recoveries, so a segment is retransmitted
+	// at most once in each. rtoRecovery is the recovery after a timeout
+	// with SACK, which lasts until recoveryPoint is acknowledged.
+	recoveryEpoch   uint64
+	rtoRecovery     bool
+	recoveryPoint   uint32
+	congestionName  string
+	congestion      CongestionControl
+	cwndHistory     []CwndSample
+	rtt             rttEstimator
+	retransmitTimer *time.Timer
+	retransmitGen   uint64
+	retries         int
+	persistTimer    *time.Timer
+	persistGen      uint64
+	persistBackoffs int
+	timeWaitTimer   *time.Timer
+	noDelay         bool
+
+	readClosed    bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readTimer     *time.Timer
+	writeTimer    *time.Timer
+	// released is set by Release, after which arriving data is lost
+	released bool
+
+	// out holds the segments sent while the mutex was held, which unlock
+	// hands to IP, so ARP resolution never blocks with the mutex held.
+	// flushing is set while a caller does so, which keeps them in order.
+	out      []outgoing
+	flushing bool
+}
+
+type outgoing struct {
+	flags uint8
+	data  []byte
+}
+
+// newConn creates a connection using the module default congestion
+// control, so the module mutex must be held.
+func newConn(tcp *TCPModule, key connKey) *Conn {
+	conn := &Conn{
+		tcp:            tcp,
+		key:            key,
+		mutex:          new(sync.Mutex),
+		state:          StateClosed,
+		sndMSS:         DefaultMSS,
+		rtt:            newRTTEstimator(),
+		congestionName: tcp.congestionControl,
+		recvBufferSize: DefaultReceiveBuffer,
+		tsOffset:       rand.Uint32(),
+	}
+	conn.rcvShift = windowShift(conn.recvBufferSize)
+	conn.cond = sync.NewCond(conn.mutex)
+	return conn
+}
+
+func (conn *Conn) String() string {
+	return fmt.Sprintf("%v:%d <-> %v:%d", conn.tcp.addr, conn.key.localPort, conn.key.remoteIP, conn.key.remotePort)
+}
+
+func (conn *Conn) LocalAddr() (ip.IPAddress, uint16) {
+	return conn.tcp.addr, conn.key.localPort
+}
+
+func (conn *Conn) RemoteAddr() (ip.IPAddress, uint16) {
+	return conn.key.remoteIP, conn.key.remotePort
+}
+
+func (conn *Conn) State() State {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.state
+}
+
+func (conn *Conn) setState(state State) {
+	conn.state = state
+	conn.cond.Broadcast()
+}
+
+// synOptions lists the options of our SYN. A SYN-ACK may only agree to the
+// options the peer SYN offered, which applySynOptions recorded.
+func (conn *Conn) synOptions() []byte {
+	offer := conn.state != StateSynReceived
+	opts := options{mss: uint16(conn.tcp.mss), sackPermitted: offer || conn.sackOK}
+	if offer || conn.rcvShift != 0 {
+		opts.windowScale = conn.rcvShift
+		opts.hasWindowScale = true
+	}
+	if offer || conn.tsOK {
+		opts.hasTimestamps = true
+		opts.tsVal = conn.tsClock()
+		opts.tsEcr = conn.tsRecent
+	}
+	return opts.serialize()
+}
+
+func (conn *Conn) applySynOptions(segment *Segment) error {
+	opts := segment.opts
+	if opts.mss != 0 {
+		conn.sndMSS = min(int(opts.mss), conn.tcp.mss)
+	}
+	if opts.hasWindowScale {
+		conn.sndShift = opts.windowScale
+	} else {
+		conn.rcvShift = 0
+		conn.sndShift = 0
+	}
+	conn.sackOK = opts.sackPermitted
+	conn.tsOK = opts.hasTimestamps
+	if conn.tsOK {
+		conn.tsRecent = opts.tsVal
+		conn.tsRecentAge = time.Now()
+		// every segment carries the option, which leaves less for data
+		conn.sndMSS -= timestampsSize
+	}
+	// the initial window depends on the MSS, so the algorithm starts here
+	return conn.startCongestionControl()
+}
+
+func (conn *Conn) startCongestionControl() error {
+	congestion, err := newCongestionControl(conn.congestionName, conn.sndMSS)
+	if err != nil {
+		return err
+	}
+	conn.congestion = congestion
+	conn.recordCwnd()
+	return nil
+}
+
+// SetCongestionControl selects the congestion control algorithm by name.
+// On an open connection the new algorithm starts over from the initial
+// window.
+func (conn *Conn) SetCongestionControl(name string) error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	previous := conn.congestionName
+	conn.congestionName = name
+	if conn.congestion == nil {
+		_, err := newCongestionControl(name, conn.sndMSS)
+		if err != nil {
+			conn.congestionName = previous
+		}
+		return err
+	}
+	err := conn.startCongestionControl()
+	if err != nil {
+		conn.congestionName = previous
+	}
+	return err
+}
+
+func (conn *Conn) CongestionControl() string {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.congestionName
+}
+
+// recordCwnd adds a sample to the history when the window changed.
+func (conn *Conn) recordCwnd() {
+	sample := CwndSample{Time: time.Now(), Window: conn.congestion.Window(), Threshold: conn.congestion.Threshold()}
+	if count := len(conn.cwndHistory); count > 0 {
+		last := conn.cwndHistory[count-1]
+		if last.Window == sample.Window && last.Threshold == sample.Threshold {
+			return
+		}
+	}
+	if len(conn.cwndHistory) == maxCwndHistory {
+		conn.cwndHistory = append(conn.cwndHistory[:0], conn.cwndHistory[maxCwndHistory/2:]...)
+	}
+	conn.cwndHistory = append(conn.cwndHistory, sample)
+}
+
+// CwndHistory returns the congestion window every time it changed, oldest
+// first.
+func (conn *Conn) CwndHistory() []CwndSample {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return append([]CwndSample(nil), conn.cwndHistory...)
+}
+
+func (conn *Conn) inFlight() int {
+	return int(conn.sndNxt - conn.sndUna)
+}
+
+func (conn *Conn) openActive() {
+	conn.iss = initialSequence()
+	conn.sndUna = conn.iss
+	conn.sndNxt = conn.iss + 1
+	conn.sndBase = conn.iss + 1
+	conn.setState(StateSynSent)
+	conn.sendSyn()
+}
+
+func (conn *Conn) openPassive(syn *Segment) error {
+	err := conn.applySynOptions(syn)
+	if err != nil {
+		return err
+	}
+	conn.irs = syn.Seq
+	conn.rcvNxt = syn.Seq + 1
+	conn.rcvAdv = conn.rcvNxt
+	conn.iss = initialSequence()
+	conn.sndUna = conn.iss
+	conn.sndNxt = conn.iss + 1
+	conn.sndBase = conn.iss + 1
+	conn.setSendWindow(uint32(syn.Window))
+	conn.sndWl1 = syn.Seq
+	conn.setState(StateSynReceived)
+	conn.sendSyn()
+	return nil
+}
+
+func (conn *Conn) sendSyn() {
+	conn.retransmitQueue = append(conn.retransmitQueue, &sentSegment{
+		seq:    conn.iss,
+		length: 1,
+		flags:  FlagSYN,
+		sentAt: time.Now(),
+	})
+	conn.transmitSyn()
+	conn.startRetransmitTimer()
+}
+
+// transmitSyn sends the SYN, or the SYN-ACK in SYN-RECEIVED, which always
+// carries the initial sequence number.
+func (conn *Conn) transmitSyn() {
+	segment := &Segment{Seq: conn.iss, Flags: FlagSYN, Options: conn.synOptions()}
+	if conn.state == StateSynReceived {
+		segment.Flags |= FlagACK
+		segment.Ack = conn.rcvNxt
+	}
+	conn.send(segment)
+}
+
+// send fills in the addressing and window of segment and queues it.
+func (conn *Conn) send(segment *Segment) {
+	segment.SrcPort = conn.key.localPort
+	segment.DstPort = conn.key.remotePort
+	segment.Window = conn.advertise(segment.has(FlagSYN))
+	if !segment.has(FlagSYN | FlagRST) {
+		var opts options
+		if conn.tsOK {
+			opts.hasTimestamps = true
+			opts.tsVal = conn.tsClock()
+			opts.tsEcr = conn.tsRecent
+		}
+		// SACK blocks ride only on segments without data, whose size the
+		// MSS does not limit
+		if conn.sackOK && len(segment.Data) == 0 && segment.has(FlagACK) {
+			opts.sackBlocks = conn.sackBlocks(conn.maxSackBlocks())
+		}
+		segment.Options = opts.serialize()
+	}
+	if segment.has(FlagACK) {
+		conn.lastAckSent = segment.Ack
+	}
+	conn.queue(segment)
+}
+
+func (conn *Conn) queue(segment *Segment) {
+	data := segment.Serialize(conn.tcp.addr, conn.key.remoteIP)
+	conn.out = append(conn.out, outgoing{flags: segment.Flags, data: data})
+}
+
+// unlock releases the mutex and sends the segments queued while it was
+// held, unless another caller is already sending and takes them along.
+func (conn *Conn) unlock() {
+	if conn.flushing {
+		conn.mutex.Unlock()
+		return
+	}
+	conn.flushing = true
+	for len(conn.out) > 0 {
+		out := conn.out
+		conn.out = nil
+		conn.mutex.Unlock()
+		for _, segment := range out {
+			err := conn.tcp.sender.SendToIP(segment.data, conn.key.remoteIP, ip.ProtoTCP)
+			if err != nil {
+				fmt.Printf("TCP %v: could not send %s segment: %s\n", conn, FlagsString(segment.flags), err.Error())
+			}
+		}
+		conn.mutex.Lock()
+	}
+	conn.flushing = false
+	conn.mutex.Unlock()
+}
+
+// wait blocks on the condition, but first sends the queued segments, which
+// may be what the caller waits on. Sending releases the mutex, so it
+// returns without blocking then and callers check their condition again.
+func (conn *Conn) wait() {
+	if len(conn.out) > 0 && !conn.flushing {
+		conn.unlock()
+		conn.mutex.Lock()
+		return
+	}
+	conn.cond.Wait()
+}
+
+func (conn *Conn) sendAck() {
+	conn.send(&Segment{Seq: conn.sndNxt, Ack: conn.rcvNxt, Flags: FlagACK})
+}
+
+func (conn *Conn) sendRst(seq uint32) {
+	conn.send(&Segment{Seq: seq, Flags: FlagRST})
+}
+
+// finAcked reports whether the FIN was sent and acknowledged, which leaves
+// sndUna one past the emptied send buffer.
+func (conn *Conn) finAcked() bool {
+	return conn.finSent && len(conn.sendBuffer) == 0 && conn.sndUna == conn.sndBase+1
+}
+
+// output sends as much queued data as the peer and congestion windows
+// allow, followed by the FIN once the user closed and every byte went out.
+func (conn *Conn) output() {
+	if !conn.state.synchronized() {
+		return
+	}
+	if conn.sackOK && conn.recovering() {
+		conn.retransmitLost()
+	}
+	for {
+		offset := int(conn.sndNxt - conn.sndBase)
+		if offset > len(conn.sendBuffer) {
+			return
+		}
+		queued := len(conn.sendBuffer) - offset
+		window := max(min(int(conn.sndWnd)-conn.inFlight(), conn.congestion.Window()-conn.flightSize()), 0)
+		size := min(queued, window, conn.sndMSS)
+
+		if size > 0 && conn.worthSending(size, queued) {
+			conn.sendData(offset, size)
+			continue
+		}
+
+		if conn.finQueued && queued == 0 {
+			conn.sendQueued(&Segment{Seq: conn.sndNxt, Ack: conn.rcvNxt, Flags: FlagFIN | FlagACK})
+			conn.sndNxt++
+			conn.finSent = true
+		}
+		conn.updatePersistTimer(queued)
+		return
+	}
+}
+
+func (conn *Conn) sendData(offset int, size int) {
+	data := conn.sendBuffer[offset : offset+size]
+	conn.sendQueued(&Segment{Seq: conn.sndNxt, Ack: conn.rcvNxt, Flags: FlagACK | FlagPSH, Data: data})
+	conn.sndNxt += uint32(size)
+}
+
+// Write queues data for transmission, blocking while the send buffer is
+// full.
+func (conn *Conn) Write(data []byte) (int, error) {
+	conn.mutex.Lock()
+	defer conn.unlock()
+
+	written := 0
+	for written < len(data) {
+		for conn.err == nil && !expired(conn.writeDeadline) && (conn.state == StateSynSent || conn.state == StateSynReceived ||
+			(conn.state.canSend() && len(conn.sendBuffer) >= sendBufferSize)) {
+			conn.wait()
+		}
+		if conn.err != nil {
+			return written, conn.err
+		}
+		if expired(conn.writeDeadline) {
+			return written, os.ErrDeadlineExceeded
+		}
+		if !conn.state.canSend() || conn.finQueued {
+			return written, ErrConnectionClosing
+		}
+
+		size := min(len(data)-written, sendBufferSize-len(conn.sendBuffer))
+		conn.sendBuffer = append(conn.sendBuffer, data[written:written+size]...)
+		written += size
+		conn.output()
+	}
+	return written, nil
+}
+
+// Read blocks until data is available and returns io.EOF once the peer
+// closed its side and every byte was read.
+func (conn *Conn) Read(data []byte) (int, error) {
+	conn.mutex.Lock()
+	defer conn.unlock()
+
+	for len(conn.recvBuffer) == 0 && !conn.finRecv && conn.err == nil && conn.state != StateClosed &&
+		!conn.readClosed && !expired(conn.readDeadline) {
+		conn.cond.Wait()
+	}
+	if conn.readClosed {
+		return 0, ErrReadClosed
+	}
+	if len(conn.recvBuffer) == 0 {
+		if expired(conn.readDeadline) && !conn.finRecv && conn.err == nil {
+			return 0, os.ErrDeadlineExceeded
+		}
+		if conn.err != nil {
+			return 0, conn.err
+		}
+		return 0, io.EOF
+	}
+
+	n := copy(data, conn.recvBuffer)
+	conn.recvBuffer = conn.recvBuffer[n:]
+	// the window update goes out as soon as it is worth announcing
+	if conn.state.synchronized() && conn.receiveWindow() > conn.rcvWnd() {
+		conn.sendAck()
+	}
+	return n, nil
+}
+
+// CloseRead shuts down the receiving side. Blocked and later reads fail,
+// and data that still arrives is acknowledged but discarded.
+func (conn *Conn) CloseRead() {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.readClosed = true
+	conn.recvBuffer = nil
+	conn.cond.Broadcast()
+}
+
+// wake lets blocked callers check their deadlines and contexts again.
+func (conn *Conn) wake() {
+	conn.mutex.Lock()
+	conn.cond.Broadcast()
+	conn.mutex.Unlock()
+}
+
+func expired(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
+// setDeadline replaces the timer that wakes the callers blocked on a
+// deadline once it passes.
+func (conn *Conn) setDeadline(deadline *time.Time, timer **time.Timer, value time.Time) {
+	*deadline = value
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if !value.IsZero() {
+		*timer = time.AfterFunc(time.Until(value), conn.wake)
+	}
+	conn.cond.Broadcast()
+}
+
+// SetReadDeadline makes blocked and future reads fail with
+// os.ErrDeadlineExceeded once t passes. The zero time disables it.
+func (conn *Conn) SetReadDeadline(t time.Time) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.setDeadline(&conn.readDeadline, &conn.readTimer, t)
+}
+
+func (conn *Conn) SetWriteDeadline(t time.Time) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.setDeadline(&conn.writeDeadline, &conn.writeTimer, t)
+}
+
+// Close starts the orderly release of the connection. The local side stops
+// sending, but data from the peer can still be read until it closes too.
+func (conn *Conn) Close() error {
+	conn.mutex.Lock()
+	defer conn.unlock()
+	return conn.close()
+}
+
+func (conn *Conn) close() error {
+	switch conn.state {
+	case StateSynSent:
+		conn.terminate(nil)
+		return nil
+	case StateSynReceived:
+		// the FIN goes out once the handshake completes
+		conn.finQueued = true
+		return nil
+	case StateEstablished:
+		conn.finQueued = true
+		conn.setState(StateFinWait1)
+	case StateCloseWait:
+		conn.finQueued = true
+		conn.setState(StateLastAck)
+	case StateClosed:
+		if conn.err != nil {
+			return conn.err
+		}
+		return ErrConnectionClosing
+	default:
+		return ErrConnectionClosing
+	}
+	conn.output()
+	return nil
+}
+
+// Release closes both directions, as closing a socket does. Unread data,
+// and data arriving later, is lost, which RFC 9293 section 3.6.1 says to
+// report with a reset instead of the FIN of Close.
+func (conn *Conn) Release() error {
+	conn.mutex.Lock()
+	defer conn.unlock()
+	conn.readClosed = true
+	conn.released = true
+	conn.cond.Broadcast()
+	if len(conn.recvBuffer) > 0 || len(conn.outOfOrder) > 0 {
+		conn.abort()
+		return nil
+	}
+	return conn.close()
+}
+
+// Abort resets the connection, discarding any queued data.
+func (conn *Conn) Abort() {
+	conn.mutex.Lock()
+	defer conn.unlock()
+	conn.abort()
+}
+
+func (conn *Conn) abort() {
+	if conn.state == StateSynReceived || conn.state.synchronized() {
+		conn.sendRst(conn.sndNxt)
+	}
+	conn.terminate(ErrConnectionAborted)
+}
+
+// terminate moves the connection to CLOSED, releasing its timers and its
+// entry in the connection table. err is reported to blocked callers.
+func (conn *Conn) terminate(err error) {
+	if err != nil && conn.err == nil {
+		conn.err = err
+	}
+	if conn.state == StateClosed {
+		return
+	}
+	conn.stopRetransmitTimer()
+	conn.stopPersistTimer()
+	if conn.timeWaitTimer != nil {
+		conn.timeWaitTimer.Stop()
+	}
+	if conn.listener != nil {
+		conn.listener.release()
+		conn.listener = nil
+	}
+	conn.sendBuffer = nil
+	conn.retransmitQueue = nil
+	conn.outOfOrder = nil
+	conn.setState(StateClosed)
+	conn.tcp.remove(conn.key)
+}
@@ -0,0 +1,136 @@
+package tcp
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	cubicC    = 0.4
+	cubicBeta = 0.7
+	// cubicAlpha makes the Reno friendly estimate grow like Reno with the
+	// same average window, RFC 9438 section 4.3
+	cubicAlpha = 3 * (1 - cubicBeta) / (1 + cubicBeta)
+)
+
+// cubic implements CUBIC from RFC 9438 with fast convergence. Windows are
+// kept in segments as the RFC writes them. Losses are recovered like
+// NewReno.
+type cubic struct {
+	mss      int
+	cwnd     float64
+	ssthresh float64
+
+	wMax       float64
+	k          float64
+	epochStart time.Time
+	wEst       float64
+
+	recovery bool
+	recover  uint32
+}
+
+func newCubic(mss int) CongestionControl {
+	return &cubic{
+		mss:      mss,
+		cwnd:     float64(initialWindow(mss)) / float64(mss),
+		ssthresh: math.MaxInt32,
+	}
+}
+
+func (cubic *cubic) Name() string {
+	return "cubic"
+}
+
+func (cubic *cubic) Window() int {
+	return int(cubic.cwnd * float64(cubic.mss))
+}
+
+func (cubic *cubic) Threshold() int {
+	return int(min(cubic.ssthresh*float64(cubic.mss), math.MaxInt32))
+}
+
+func (cubic *cubic) InRecovery() bool {
+	return cubic.recovery
+}
+
+// window is W_cubic(t) of RFC 9438 equation 1.
+func (cubic *cubic) window(t float64) float64 {
+	return cubicC*math.Pow(t-cubic.k, 3) + cubic.wMax
+}
+
+func (cubic *cubic) OnAck(event AckEvent) bool {
+	segments := float64(event.Acked) / float64(cubic.mss)
+	if cubic.recovery {
+		if seqLT(event.Ack, cubic.recover) {
+			cubic.cwnd = max(cubic.cwnd-segments, 0) + 1
+			return true
+		}
+		cubic.recovery = false
+		cubic.cwnd = cubic.ssthresh
+		return false
+	}
+
+	if cubic.cwnd < cubic.ssthresh {
+		cubic.cwnd += min(segments, 1)
+		return false
+	}
+
+	if cubic.epochStart.IsZero() {
+		cubic.epochStart = event.Now
+		cubic.wEst = cubic.cwnd
+		if cubic.cwnd < cubic.wMax {
+			cubic.k = math.Cbrt((cubic.wMax - cubic.cwnd) / cubicC)
+		} else {
+			cubic.k = 0
+			cubic.wMax = cubic.cwnd
+		}
+	}
+
+	t := event.Now.Sub(cubic.epochStart).Seconds()
+	alpha := cubicAlpha
+	if cubic.wEst >= cubic.wMax {
+		alpha = 1
+	}
+	cubic.wEst += alpha * segments / cubic.cwnd
+
+	if cubic.window(t) < cubic.wEst {
+		// Reno friendly region
+		cubic.cwnd = max(cubic.cwnd, cubic.wEst)
+		return false
+	}
+	target := min(max(cubic.window(t+event.SRTT.Seconds()), cubic.cwnd), 1.5*cubic.cwnd)
+	cubic.cwnd += (target - cubic.cwnd) / cubic.cwnd * segments
+	return false
+}
+
+// reduce applies the multiplicative decrease of RFC 9438 section 4.6 and
+// fast convergence from section 4.7.
+func (cubic *cubic) reduce() {
+	cubic.epochStart = time.Time{}
+	if cubic.cwnd < cubic.wMax {
+		cubic.wMax = cubic.cwnd * (1 + cubicBeta) / 2
+	} else {
+		cubic.wMax = cubic.cwnd
+	}
+	cubic.ssthresh = max(cubic.cwnd*cubicBeta, 2)
+}
+
+func (cubic *cubic) OnFastRetransmit(inFlight int, recover uint32) {
+	cubic.reduce()
+	cubic.cwnd = cubic.ssthresh + dupAckThreshold
+	cubic.recovery = true
+	cubic.recover = recover
+}
+
+func (cubic *cubic) OnDupAck() {
+	if cubic.recovery {
+		cubic.cwnd++
+	}
+}
+
+func (cubic *cubic) OnTimeout(inFlight int) {
+	cubic.reduce()
+	cubic.cwnd = 1
+	cubic.recovery = false
+}
@@ -0,0 +1,383 @@
+package tcp
+
+import (
+	"time"
+)
+
+// segmentArrives processes an incoming segment following the event
+// processing steps of RFC 9293 section 3.10.7.
+func (conn *Conn) segmentArrives(segment *Segment) error {
+	conn.mutex.Lock()
+	defer conn.unlock()
+
+	switch conn.state {
+	case StateClosed:
+		reset := resetFor(segment)
+		if reset != nil {
+			conn.queue(reset)
+		}
+		return nil
+	case StateSynSent:
+		return conn.synSentArrives(segment)
+	}
+
+	if conn.pawsReject(segment) || !conn.acceptable(segment) {
+		if !segment.has(FlagRST) {
+			conn.sendAck()
+		}
+		return nil
+	}
+	conn.updateTSRecent(segment)
+	conn.trimToWindow(segment)
+
+	if segment.has(FlagRST) {
+		conn.resetArrives()
+		return nil
+	}
+
+	// a SYN in a synchronized state may be a spoofed attempt to reset the
+	// connection, so RFC 5961 answers it with a challenge ACK
+	if segment.has(FlagSYN) {
+		conn.sendAck()
+		return nil
+	}
+
+	if !segment.has(FlagACK) {
+		return nil
+	}
+	if !conn.ackArrives(segment) {
+		return nil
+	}
+
+	if conn.textArrives(segment) {
+		conn.finArrives()
+	}
+	conn.output()
+	return nil
+}
+
+func (conn *Conn) synSentArrives(segment *Segment) error {
+	if segment.has(FlagACK) && (seqLEQ(segment.Ack, conn.iss) || seqGT(segment.Ack, conn.sndNxt)) {
+		if !segment.has(FlagRST) {
+			conn.sendRst(segment.Ack)
+		}
+		return nil
+	}
+
+	if segment.has(FlagRST) {
+		if segment.has(FlagACK) {
+			conn.terminate(ErrConnectionRefused)
+		}
+		return nil
+	}
+
+	if !segment.has(FlagSYN) {
+		return nil
+	}
+	err := conn.applySynOptions(segment)
+	if err != nil {
+		return err
+	}
+	conn.irs = segment.Seq
+	conn.rcvNxt = segment.Seq + 1
+	conn.rcvAdv = conn.rcvNxt
+	// the window of a SYN is never scaled
+	conn.setSendWindow(uint32(segment.Window))
+	conn.sndWl1 = segment.Seq
+	conn.sndWl2 = segment.Ack
+
+	if !segment.has(FlagACK) {
+		// simultaneous open, the SYN goes out again as a SYN-ACK
+		conn.setState(StateSynReceived)
+		conn.resend(conn.retransmitQueue[0])
+		return nil
+	}
+
+	conn.acknowledge(segment.Ack, segment.opts.tsEcr)
+	conn.setState(StateEstablished)
+	conn.sendAck()
+	conn.output()
+	return nil
+}
+
+// acceptable runs the four case acceptability test on the segment sequence
+// space against the receive window.
+func (conn *Conn) acceptable(segment *Segment) bool {
+	length := segment.Length()
+	window := conn.rcvWnd()
+	switch {
+	case length == 0 && window == 0:
+		return segment.Seq == conn.rcvNxt
+	case length == 0:
+		return seqInWindow(segment.Seq, conn.rcvNxt, window)
+	case window == 0:
+		return false
+	default:
+		return seqInWindow(segment.Seq, conn.rcvNxt, window) ||
+			seqInWindow(segment.Seq+length-1, conn.rcvNxt, window)
+	}
+}
+
+// trimToWindow drops the part of the segment that was already received and
+// the part beyond the receive window, so it starts at rcvNxt.
+func (conn *Conn) trimToWindow(segment *Segment) {
+	if seqLT(segment.Seq, conn.rcvNxt) {
+		skip := conn.rcvNxt - segment.Seq
+		if segment.has(FlagSYN) {
+			segment.Flags &^= FlagSYN
+			skip--
+			segment.Seq++
+		}
+		skip = min(skip, uint32(len(segment.Data)))
+		segment.Data = segment.Data[skip:]
+		segment.Seq += skip
+	}
+
+	window := conn.rcvWnd()
+	if uint32(len(segment.Data)) > window {
+		segment.Data = segment.Data[:window]
+		segment.Flags &^= FlagFIN
+	}
+}
+
+func (conn *Conn) resetArrives() {
+	switch conn.state {
+	case StateSynReceived:
+		if conn.listener != nil {
+			// a passive open returns to LISTEN, which here means the
+			// half open connection is discarded
+			conn.terminate(nil)
+			return
+		}
+		conn.terminate(ErrConnectionRefused)
+	case StateClosing, StateLastAck, StateTimeWait:
+		conn.terminate(nil)
+	default:
+		conn.terminate(ErrConnectionReset)
+	}
+}
+
+// ackArrives processes the acknowledgment field and reports whether the
+// segment should be processed further.
+func (conn *Conn) ackArrives(segment *Segment) bool {
+	if conn.state == StateSynReceived {
+		if seqLEQ(segment.Ack, conn.sndUna) || seqGT(segment.Ack, conn.sndNxt) {
+			conn.sendRst(segment.Ack)
+			return false
+		}
+		conn.acknowledge(segment.Ack, segment.opts.tsEcr)
+		conn.setSendWindow(conn.peerWindow(segment))
+		conn.sndWl1 = segment.Seq
+		conn.sndWl2 = segment.Ack
+		conn.setState(StateEstablished)
+		if conn.listener != nil {
+			listener := conn.listener
+			conn.listener = nil
+			if !listener.established(conn) {
+				conn.sendRst(conn.sndNxt)
+				conn.terminate(ErrConnectionAborted)
+				return false
+			}
+		}
+		if conn.finQueued {
+			conn.setState(StateFinWait1)
+		}
+	}
+
+	if seqGT(segment.Ack, conn.sndNxt) {
+		conn.sendAck()
+		return false
+	}
+
+	// a duplicate ACK in the sense of RFC 5681 carries nothing but the
+	// same acknowledgment and window while data is outstanding
+	duplicate := segment.Ack == conn.sndUna && conn.sndUna != conn.sndNxt && len(segment.Data) == 0 &&
+		!segment.has(FlagSYN|FlagFIN) && conn.peerWindow(segment) == conn.sndWnd
+	if seqGT(segment.Ack, conn.sndUna) {
+		conn.acknowledge(segment.Ack, segment.opts.tsEcr)
+	}
+	if conn.sackOK {
+		conn.markSacked(segment.opts.sackBlocks)
+	}
+	if duplicate {
+		conn.duplicateAck()
+	}
+
+	if seqLT(conn.sndWl1, segment.Seq) || (conn.sndWl1 == segment.Seq && seqLEQ(conn.sndWl2, segment.Ack)) {
+		conn.setSendWindow(conn.peerWindow(segment))
+		conn.sndWl1 = segment.Seq
+		conn.sndWl2 = segment.Ack
+	}
+
+	finAcked := conn.finAcked()
+	switch conn.state {
+	case StateFinWait1:
+		if finAcked {
+			conn.setState(StateFinWait2)
+		}
+	case StateClosing:
+		if finAcked {
+			conn.enterTimeWait()
+			return false
+		}
+		// data written before the close may still wait for the window
+		conn.output()
+		return false
+	case StateLastAck:
+		if finAcked {
+			conn.terminate(nil)
+			return false
+		}
+		conn.output()
+		return false
+	case StateTimeWait:
+		if segment.has(FlagFIN) {
+			conn.sendAck()
+			conn.enterTimeWait()
+		}
+		return false
+	}
+	return true
+}
+
+// acknowledge removes the bytes up to ack from the send buffer and the
+// retransmission queue, taking a round trip time sample on the way. tsEcr
+// is the echoed timestamp, or zero.
+func (conn *Conn) acknowledge(ack uint32, tsEcr uint32) {
+	event := AckEvent{Ack: ack, Acked: int(ack - conn.sndUna), InFlight: conn.inFlight(), Now: time.Now()}
+
+	acked := int(ack - conn.sndBase)
+	if seqLT(ack, conn.sndBase) {
+		acked = 0
+	}
+	acked = min(acked, len(conn.sendBuffer))
+	conn.sendBuffer = conn.sendBuffer[acked:]
+	conn.sndBase += uint32(acked)
+	conn.sndUna = ack
+	conn.retries = 0
+	conn.dupAcks = 0
+	conn.rtt.resetBackoff()
+	rtt, ok := conn.ackQueue(ack)
+	if !ok {
+		rtt, ok = conn.echoedRTT(tsEcr)
+	}
+	if ok {
+		conn.rtt.sample(rtt)
+	}
+	if conn.rtoRecovery && seqGEQ(ack, conn.recoveryPoint) {
+		conn.rtoRecovery = false
+	}
+	// the ACK of our SYN is not data
+	if conn.state.synchronized() {
+		event.SRTT = conn.rtt.srtt
+		// with SACK the scoreboard picks what to resend after a partial ACK
+		if conn.congestion.OnAck(event) && !conn.sackOK && len(conn.retransmitQueue) > 0 {
+			conn.resend(conn.retransmitQueue[0])
+		}
+		conn.recordCwnd()
+	}
+
+	if conn.sndUna == conn.sndNxt {
+		conn.stopRetransmitTimer()
+	} else {
+		conn.restartRetransmitTimer()
+	}
+	conn.cond.Broadcast()
+}
+
+// textArrives appends in order data to the receive buffer, followed by
+// whatever the out of order queue can now supply, and reports whether the
+// FIN was reached. Data beyond a hole is queued and a duplicate ACK tells
+// the peer what is missing.
+func (conn *Conn) textArrives(segment *Segment) bool {
+	if !conn.state.canReceive() || (len(segment.Data) == 0 && !segment.has(FlagFIN)) {
+		return false
+	}
+	if conn.released && len(segment.Data) > 0 {
+		conn.abort()
+		return false
+	}
+	if segment.Seq != conn.rcvNxt {
+		conn.queueOutOfOrder(segment)
+		conn.sendAck()
+		return false
+	}
+
+	conn.recvBuffer = append(conn.recvBuffer, segment.Data...)
+	conn.rcvNxt += uint32(len(segment.Data))
+	fin := segment.has(FlagFIN)
+	if !fin {
+		fin = conn.drainOutOfOrder()
+	}
+	if conn.readClosed {
+		conn.recvBuffer = nil
+	}
+	if !fin {
+		conn.sendAck()
+	}
+	conn.cond.Broadcast()
+	return fin
+}
+
+func (conn *Conn) queueOutOfOrder(segment *Segment) {
+	index := 0
+	for index < len(conn.outOfOrder) && seqLT(conn.outOfOrder[index].Seq, segment.Seq) {
+		index++
+	}
+	if index < len(conn.outOfOrder) && conn.outOfOrder[index].Seq == segment.Seq &&
+		len(conn.outOfOrder[index].Data) >= len(segment.Data) {
+		return
+	}
+	conn.lastOutOfOrder = segment.Seq
+	// the segment data aliases the received frame, so it is copied
+	queued := &Segment{Seq: segment.Seq, Flags: segment.Flags, Data: append([]byte(nil), segment.Data...)}
+	if index < len(conn.outOfOrder) && conn.outOfOrder[index].Seq == segment.Seq {
+		conn.outOfOrder[index] = queued
+		return
+	}
+	conn.outOfOrder = append(conn.outOfOrder, nil)
+	copy(conn.outOfOrder[index+1:], conn.outOfOrder[index:])
+	conn.outOfOrder[index] = queued
+}
+
+// drainOutOfOrder moves queued segments that became contiguous into the
+// receive buffer and reports whether the FIN was reached.
+func (conn *Conn) drainOutOfOrder() bool {
+	for len(conn.outOfOrder) > 0 {
+		next := conn.outOfOrder[0]
+		if seqGT(next.Seq, conn.rcvNxt) {
+			return false
+		}
+		conn.outOfOrder = conn.outOfOrder[1:]
+		end := next.Seq + uint32(len(next.Data))
+		if seqGT(end, conn.rcvNxt) {
+			conn.recvBuffer = append(conn.recvBuffer, next.Data[conn.rcvNxt-next.Seq:]...)
+			conn.rcvNxt = end
+		}
+		if next.has(FlagFIN) && end == conn.rcvNxt {
+			conn.outOfOrder = nil
+			return true
+		}
+	}
+	return false
+}
+
+func (conn *Conn) finArrives() {
+	conn.rcvNxt++
+	conn.finRecv = true
+	conn.sendAck()
+
+	switch conn.state {
+	case StateSynReceived, StateEstablished:
+		conn.setState(StateCloseWait)
+	case StateFinWait1:
+		if conn.finAcked() {
+			conn.enterTimeWait()
+		} else {
+			conn.setState(StateClosing)
+		}
+	case StateFinWait2:
+		conn.enterTimeWait()
+	}
+	conn.cond.Broadcast()
+}
@@ -0,0 +1,127 @@
+package tcp
+
+import (
+	"sync"
+	"tcp-ip/internal/ip"
+)
+
+type Listener struct {
+	tcp     *TCPModule
+	port    uint16
+	backlog chan *Conn
+	pending int
+	closed  chan struct{}
+	once    sync.Once
+	mutex   *sync.Mutex
+}
+
+func newListener(tcp *TCPModule, port uint16) *Listener {
+	return &Listener{
+		tcp:     tcp,
+		port:    port,
+		backlog: make(chan *Conn, listenBacklog),
+		closed:  make(chan struct{}),
+		mutex:   new(sync.Mutex),
+	}
+}
+
+func (listener *Listener) Port() uint16 {
+	return listener.port
+}
+
+func (listener *Listener) LocalAddr() (ip.IPAddress, uint16) {
+	return listener.tcp.addr, listener.port
+}
+
+// Accept blocks until a connection completes the handshake.
+func (listener *Listener) Accept() (*Conn, error) {
+	select {
+	case conn := <-listener.backlog:
+		return conn, nil
+	case <-listener.closed:
+		return nil, ErrListenerClosed
+	}
+}
+
+func (listener *Listener) Close() error {
+	err := ErrListenerClosed
+	listener.once.Do(func() {
+		close(listener.closed)
+		listener.tcp.mutex.Lock()
+		delete(listener.tcp.listeners, listener.port)
+		listener.tcp.mutex.Unlock()
+		err = nil
+	})
+
+	for {
+		select {
+		case conn := <-listener.backlog:
+			conn.Abort()
+		default:
+			return err
+		}
+	}
+}
+
+func (listener *Listener) release() {
+	listener.mutex.Lock()
+	listener.pending--
+	listener.mutex.Unlock()
+}
+
+// established hands a connection that completed the handshake to Accept.
+// It reports false when the backlog is full or the listener is closed.
+func (listener *Listener) established(conn *Conn) bool {
+	listener.release()
+
+	select {
+	case <-listener.closed:
+		return false
+	case listener.backlog <- conn:
+		return true
+	default:
+		return false
+	}
+}
+
+// segmentArrives handles a segment addressed to the listening port that
+// matches no connection, as described for the LISTEN state in RFC 9293.
+func (listener *Listener) segmentArrives(segment *Segment, key connKey) error {
+	tcp := listener.tcp
+	if segment.has(FlagRST) {
+		return nil
+	}
+	if segment.has(FlagACK) || !segment.has(FlagSYN) {
+		return tcp.sendReset(segment, key.remoteIP)
+	}
+
+	listener.mutex.Lock()
+	if listener.pending+len(listener.backlog) >= listenBacklog {
+		listener.mutex.Unlock()
+		return nil
+	}
+	listener.pending++
+	listener.mutex.Unlock()
+
+	tcp.mutex.Lock()
+	if _, exists := tcp.conns[key]; exists {
+		tcp.mutex.Unlock()
+		listener.release()
+		return nil
+	}
+	conn := newConn(tcp, key)
+	conn.listener = listener
+	tcp.conns[key] = conn
+	tcp.mutex.Unlock()
+
+	conn.mutex.Lock()
+	defer conn.unlock()
+	err := conn.openPassive(segment)
+	if err != nil {
+		// the connection never left CLOSED, so terminate would skip this
+		tcp.remove(key)
+		conn.listener = nil
+		listener.release()
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	optionEnd           uint8 = 0
+	optionNOP           uint8 = 1
+	optionMSS           uint8 = 2
+	optionWS            uint8 = 3
+	optionSACKPermitted uint8 = 4
+	optionSACK          uint8 = 5
+	optionTimestamps    uint8 = 8
+
+	maxOptionsSize = 40
+	// timestampsSize is the space the timestamps option takes in every
+	// segment once negotiated, NOP padding included
+	timestampsSize = 12
+
+	// maxWindowShift is the largest window scale RFC 7323 allows
+	maxWindowShift = 14
+)
+
+// sackBlock is a contiguous block of data the receiver holds beyond
+// RCV.NXT, from left up to but not including right.
+type sackBlock struct {
+	left  uint32
+	right uint32
+}
+
+type options struct {
+	mss            uint16
+	windowScale    uint8
+	hasWindowScale bool
+	sackPermitted  bool
+	sackBlocks     []sackBlock
+	hasTimestamps  bool
+	tsVal          uint32
+	tsEcr          uint32
+}
+
+func parseOptions(data []byte) (options, error) {
+	var parsed options
+	for i := 0; i < len(data); {
+		kind := data[i]
+		if kind == optionEnd {
+			break
+		}
+		if kind == optionNOP {
+			i++
+			continue
+		}
+		if i+1 >= len(data) || data[i+1] < 2 || i+int(data[i+1]) > len(data) {
+			return parsed, fmt.Errorf("invalid segment: malformed options")
+		}
+		length := int(data[i+1])
+		value := data[i+2 : i+length]
+
+		switch kind {
+		case optionMSS:
+			if length != 4 {
+				return parsed, fmt.Errorf("invalid segment: malformed MSS option")
+			}
+			parsed.mss = binary.BigEndian.Uint16(value)
+		case optionWS:
+			if length != 3 {
+				return parsed, fmt.Errorf("invalid segment: malformed window scale option")
+			}
+			parsed.windowScale = min(value[0], maxWindowShift)
+			parsed.hasWindowScale = true
+		case optionSACKPermitted:
+			if length != 2 {
+				return parsed, fmt.Errorf("invalid segment: malformed SACK permitted option")
+			}
+			parsed.sackPermitted = true
+		case optionSACK:
+			if (length-2)%8 != 0 || length == 2 {
+				return parsed, fmt.Errorf("invalid segment: malformed SACK option")
+			}
+			for block := value; len(block) > 0; block = block[8:] {
+				parsed.sackBlocks = append(parsed.sackBlocks, sackBlock{
+					left:  binary.BigEndian.Uint32(block[0:4]),
+					right: binary.BigEndian.Uint32(block[4:8]),
+				})
+			}
+		case optionTimestamps:
+			if length != 10 {
+				return parsed, fmt.Errorf("invalid segment: malformed timestamps option")
+			}
+			parsed.tsVal = binary.BigEndian.Uint32(value[0:4])
+			parsed.tsEcr = binary.BigEndian.Uint32(value[4:8])
+			parsed.hasTimestamps = true
+		}
+		i += length
+	}
+	return parsed, nil
+}
+
+// serialize lays the options out the way Linux does, padded with NOPs so
+// that the 32 bit fields stay aligned.
+func (opts options) serialize() []byte {
+	var data []byte
+	if opts.mss != 0 {
+		data = append(data, optionMSS, 4)
+		data = binary.BigEndian.AppendUint16(data, opts.mss)
+	}
+	switch {
+	case opts.sackPermitted && opts.hasTimestamps:
+		data = append(data, optionSACKPermitted, 2)
+	case opts.sackPermitted:
+		data = append(data, optionNOP, optionNOP, optionSACKPermitted, 2)
+	case opts.hasTimestamps:
+		data = append(data, optionNOP, optionNOP)
+	}
+	if opts.hasTimestamps {
+		data = append(data, optionTimestamps, 10)
+		data = binary.BigEndian.AppendUint32(data, opts.tsVal)
+		data = binary.BigEndian.AppendUint32(data, opts.tsEcr)
+	}
+	if opts.hasWindowScale {
+		data = append(data, optionNOP, optionWS, 3, opts.windowScale)
+	}
+	if len(opts.sackBlocks) > 0 {
+		data = append(data, optionNOP, optionNOP, optionSACK, uint8(2+8*len(opts.sackBlocks)))
+		for _, block := range opts.sackBlocks {
+			data = binary.BigEndian.AppendUint32(data, block.left)
+			data = binary.BigEndian.AppendUint32(data, block.right)
+		}
+	}
+	return data
+}
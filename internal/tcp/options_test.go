@@ -0,0 +1,212 @@
+package tcp
+
+import (
+	"bytes"
+	"reflect"
+	"tcp-ip/internal/ip"
+	"testing"
+	"time"
+)
+
+func TestOptionsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		opts options
+		size int
+	}{
+		{"none", options{}, 0},
+		{"mss", options{mss: 1460}, 4},
+		{"syn", options{mss: 1460, sackPermitted: true, hasTimestamps: true, tsVal: 1, tsEcr: 2,
+			windowScale: 7, hasWindowScale: true}, 20},
+		{"syn without timestamps", options{mss: 1460, sackPermitted: true, windowScale: 2, hasWindowScale: true}, 12},
+		{"timestamps", options{hasTimestamps: true, tsVal: 0xFFFFFFFF, tsEcr: 3}, timestampsSize},
+		{"sack blocks", options{hasTimestamps: true, tsVal: 5, tsEcr: 6,
+			sackBlocks: []sackBlock{{100, 200}, {300, 400}, {500, 600}}}, maxOptionsSize},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.opts.serialize()
+			if len(data) != test.size {
+				t.Errorf("serialized to %d bytes, want %d", len(data), test.size)
+			}
+			got, err := parseOptions(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.opts) {
+				t.Errorf("parseOptions() = %+v, want %+v", got, test.opts)
+			}
+		})
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		want  options
+		valid bool
+	}{
+		{"stops at the end option", []byte{optionEnd, optionMSS, 4, 0, 1}, options{}, true},
+		{"skips unknown options", []byte{30, 4, 0, 0, optionMSS, 4, 0x05, 0xB4}, options{mss: 1460}, true},
+		{"caps the window scale", []byte{optionWS, 3, 20}, options{windowScale: maxWindowShift, hasWindowScale: true}, true},
+		{"length past the data", []byte{optionMSS, 4, 0}, options{}, false},
+		{"length below two", []byte{30, 1}, options{}, false},
+		{"missing length", []byte{optionNOP, optionMSS}, options{}, false},
+		{"bad mss length", []byte{optionMSS, 3, 0}, options{}, false},
+		{"bad window scale length", []byte{optionWS, 4, 0, 0}, options{}, false},
+		{"bad sack permitted length", []byte{optionSACKPermitted, 3, 0}, options{}, false},
+		{"empty sack", []byte{optionSACK, 2}, options{}, false},
+		{"partial sack block", []byte{optionSACK, 6, 0, 0, 0, 0}, options{}, false},
+		{"bad timestamps length", []byte{optionTimestamps, 6, 0, 0, 0, 0}, options{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseOptions(test.data)
+			if (err == nil) != test.valid {
+				t.Fatalf("parseOptions() error = %v, want valid %t", err, test.valid)
+			}
+			if test.valid && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseOptions() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPAWS(t *testing.T) {
+	tests := []struct {
+		name   string
+		tsVal  uint32
+		flags  uint8
+		age    time.Duration
+		reject bool
+	}{
+		{"newer", 1001, FlagACK, 0, false},
+		{"same", 1000, FlagACK, 0, false},
+		{"older", 999, FlagACK, 0, true},
+		{"across the wrap around", 1000 + 1<<31 - 1, FlagACK, 0, false},
+		{"older reset", 999, FlagRST, 0, false},
+		{"older after a long idle", 999, FlagACK, pawsIdle + time.Hour, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := testConn(t)
+			conn.tsOK = true
+			conn.tsRecent = 1000
+			conn.tsRecentAge = time.Now().Add(-test.age)
+			segment := &Segment{Flags: test.flags, opts: options{hasTimestamps: true, tsVal: test.tsVal}}
+			if got := conn.pawsReject(segment); got != test.reject {
+				t.Errorf("pawsReject() = %t, want %t", got, test.reject)
+			}
+		})
+	}
+}
+
+func TestUpdateTSRecent(t *testing.T) {
+	tests := []struct {
+		name   string
+		seq    uint32
+		tsVal  uint32
+		recent uint32
+	}{
+		{"covered by the last ACK", 500, 1001, 1001},
+		{"beyond the last ACK", 501, 1001, 1000},
+		{"older timestamp", 400, 999, 1000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := testConn(t)
+			conn.tsOK = true
+			conn.tsRecent = 1000
+			conn.lastAckSent = 500
+			conn.updateTSRecent(&Segment{Seq: test.seq, opts: options{hasTimestamps: true, tsVal: test.tsVal}})
+			if conn.tsRecent != test.recent {
+				t.Errorf("TS.Recent = %d, want %d", conn.tsRecent, test.recent)
+			}
+		})
+	}
+}
+
+func TestEchoedRTT(t *testing.T) {
+	conn := testConn(t)
+	if _, ok := conn.echoedRTT(conn.tsClock()); ok {
+		t.Errorf("echoedRTT() measured without timestamps negotiated")
+	}
+	conn.tsOK = true
+	rtt, ok := conn.echoedRTT(conn.tsClock() - 40)
+	if !ok || rtt < 40*time.Millisecond || rtt > 100*time.Millisecond {
+		t.Errorf("echoedRTT() = %v, %t, want about 40ms", rtt, ok)
+	}
+	if _, ok := conn.echoedRTT(conn.tsClock() + 1000); ok {
+		t.Errorf("echoedRTT() measured a timestamp from the future")
+	}
+	if _, ok := conn.echoedRTT(0); ok {
+		t.Errorf("echoedRTT() measured an empty echo")
+	}
+}
+
+func TestOptionNegotiation(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	for _, conn := range []*Conn{clientConn, serverConn} {
+		conn.mutex.Lock()
+		if !conn.sackOK || !conn.tsOK {
+			t.Errorf("%v: SACK %t, timestamps %t, want both", conn, conn.sackOK, conn.tsOK)
+		}
+		if conn.sndMSS != 1500-20-HeaderSize-timestampsSize {
+			t.Errorf("%v: MSS %d leaves no room for timestamps", conn, conn.sndMSS)
+		}
+		conn.mutex.Unlock()
+	}
+
+	// every segment after the handshake carries timestamps
+	transfer(t, clientConn, serverConn, []byte("data"))
+	for _, segment := range client.segments()[1:] {
+		if !segment.opts.hasTimestamps {
+			t.Errorf("%s segment without timestamps", FlagsString(segment.Flags))
+		}
+	}
+}
+
+// TestSynOptionsAnswer checks that a SYN-ACK only agrees to what the SYN
+// offered.
+func TestSynOptionsAnswer(t *testing.T) {
+	client, server := newHostPair(t)
+	listener, err := server.tcp.Listen(80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	syn := &Segment{SrcPort: 1000, DstPort: 80, Seq: 1, Flags: FlagSYN, Window: 1000, Options: options{mss: 1000}.serialize()}
+	server.tcp.Receive(packetFrom(t, client, server, syn))
+	waitSegments(t, server, 1)
+	synAck := server.segments()[0]
+	if synAck.Flags != FlagSYN|FlagACK || synAck.opts.sackPermitted || synAck.opts.hasTimestamps || synAck.opts.hasWindowScale {
+		t.Errorf("SYN-ACK options %+v, want none agreed", synAck.opts)
+	}
+	if !bytes.Equal(synAck.Options[:2], []byte{optionMSS, 4}) {
+		t.Errorf("SYN-ACK without MSS option")
+	}
+}
+
+// packetFrom wraps a segment as if from sent it to to.
+func packetFrom(t *testing.T, from, to *testHost, segment *Segment) *ip.Packet {
+	t.Helper()
+	packet, err := ip.NewPacket(from.addr, to.addr, ip.ProtoTCP, 0, segment.Serialize(from.addr, to.addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func waitSegments(t *testing.T, host *testHost, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(host.segments()) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v sent %d segments, want %d", host.addr, len(host.segments()), count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
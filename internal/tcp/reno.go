@@ -0,0 +1,98 @@
+package tcp
+
+import (
+	"math"
+)
+
+// reno implements the slow start, congestion avoidance and fast recovery
+// of RFC 5681. With newReno set, fast recovery follows RFC 6582 and only
+// ends once everything outstanding at the loss is acknowledged, resending
+// one segment for every partial acknowledgment on the way.
+type reno struct {
+	mss      int
+	cwnd     int
+	ssthresh int
+	// acked counts octets towards the next increase in congestion avoidance
+	acked    int
+	recovery bool
+	recover  uint32
+	newReno  bool
+}
+
+func newReno(mss int) CongestionControl {
+	return &reno{mss: mss, cwnd: initialWindow(mss), ssthresh: math.MaxInt32}
+}
+
+func newNewReno(mss int) CongestionControl {
+	return &reno{mss: mss, cwnd: initialWindow(mss), ssthresh: math.MaxInt32, newReno: true}
+}
+
+func (reno *reno) Name() string {
+	if reno.newReno {
+		return "newreno"
+	}
+	return "reno"
+}
+
+func (reno *reno) Window() int {
+	return reno.cwnd
+}
+
+func (reno *reno) Threshold() int {
+	return reno.ssthresh
+}
+
+func (reno *reno) InRecovery() bool {
+	return reno.recovery
+}
+
+func (reno *reno) OnAck(event AckEvent) bool {
+	if reno.recovery {
+		if reno.newReno && seqLT(event.Ack, reno.recover) {
+			// deflate by what was acknowledged and add back one segment
+			// for the retransmission the partial ACK triggers
+			reno.cwnd = max(reno.cwnd-event.Acked, 0) + reno.mss
+			return true
+		}
+		reno.recovery = false
+		if reno.newReno {
+			reno.cwnd = min(reno.ssthresh, max(event.InFlight-event.Acked, reno.mss)+reno.mss)
+		} else {
+			reno.cwnd = reno.ssthresh
+		}
+		return false
+	}
+
+	if reno.cwnd < reno.ssthresh {
+		reno.cwnd += min(event.Acked, reno.mss)
+		return false
+	}
+	// about one segment per window of acknowledged data
+	reno.acked += event.Acked
+	if reno.acked >= reno.cwnd {
+		reno.acked -= reno.cwnd
+		reno.cwnd += reno.mss
+	}
+	return false
+}
+
+func (reno *reno) OnFastRetransmit(inFlight int, recover uint32) {
+	reno.ssthresh = lossThreshold(inFlight, reno.mss)
+	reno.cwnd = reno.ssthresh + dupAckThreshold*reno.mss
+	reno.acked = 0
+	reno.recovery = true
+	reno.recover = recover
+}
+
+func (reno *reno) OnDupAck() {
+	if reno.recovery {
+		reno.cwnd += reno.mss
+	}
+}
+
+func (reno *reno) OnTimeout(inFlight int) {
+	reno.ssthresh = lossThreshold(inFlight, reno.mss)
+	reno.cwnd = reno.mss
+	reno.acked = 0
+	reno.recovery = false
+}
@@ -0,0 +1,117 @@
+package tcp
+
+import (
+	"time"
+)
+
+// dupAckThreshold is the number of duplicate ACKs that trigger a fast
+// retransmit, as in RFC 5681.
+const dupAckThreshold = 3
+
+// sentSegment is an entry of the retransmission queue. The data itself
+// stays in the send buffer and is found again through the sequence number.
+type sentSegment struct {
+	seq           uint32
+	length        uint32
+	flags         uint8
+	sentAt        time.Time
+	retransmitted bool
+	// retransmitEpoch is the recovery in which it was last retransmitted
+	retransmitEpoch uint64
+
+	// scoreboard state, only used with SACK
+	sacked   bool
+	lost     bool
+	timedOut bool
+}
+
+func (entry *sentSegment) end() uint32 {
+	return entry.seq + entry.length
+}
+
+func (entry *sentSegment) dataLength() uint32 {
+	length := entry.length
+	if entry.flags&(FlagSYN|FlagFIN) != 0 {
+		length--
+	}
+	return length
+}
+
+// sendQueued transmits a segment that occupies sequence space and keeps it
+// on the retransmission queue until it is acknowledged.
+func (conn *Conn) sendQueued(segment *Segment) {
+	conn.retransmitQueue = append(conn.retransmitQueue, &sentSegment{
+		seq:    segment.Seq,
+		length: segment.Length(),
+		flags:  segment.Flags,
+		sentAt: time.Now(),
+	})
+	conn.send(segment)
+	conn.startRetransmitTimer()
+}
+
+// resend transmits a queued segment again with the current acknowledgment.
+func (conn *Conn) resend(entry *sentSegment) {
+	entry.retransmitted = true
+	entry.retransmitEpoch = conn.recoveryEpoch
+	if entry.flags&FlagSYN != 0 {
+		conn.transmitSyn()
+		return
+	}
+	segment := &Segment{Seq: entry.seq, Ack: conn.rcvNxt, Flags: entry.flags}
+	if length := entry.dataLength(); length > 0 {
+		offset := entry.seq - conn.sndBase
+		segment.Data = conn.sendBuffer[offset : offset+length]
+	}
+	conn.send(segment)
+}
+
+// ackQueue drops the entries covered by ack. It returns a round trip time
+// sample unless one of them was retransmitted, since Karn's algorithm
+// cannot tell which transmission the ACK answers.
+func (conn *Conn) ackQueue(ack uint32) (time.Duration, bool) {
+	var newest *sentSegment
+	retransmitted := false
+	for len(conn.retransmitQueue) > 0 {
+		entry := conn.retransmitQueue[0]
+		if seqLEQ(entry.end(), ack) {
+			newest = entry
+			retransmitted = retransmitted || entry.retransmitted
+			conn.retransmitQueue = conn.retransmitQueue[1:]
+			continue
+		}
+		if seqGT(ack, entry.seq) {
+			// the peer took only part of the segment
+			entry.length -= ack - entry.seq
+			entry.seq = ack
+			retransmitted = retransmitted || entry.retransmitted
+		}
+		break
+	}
+	if newest == nil || retransmitted {
+		return 0, false
+	}
+	return time.Since(newest.sentAt), true
+}
+
+// duplicateAck counts an ACK that repeats sndUna and retransmits the first
+// unacknowledged segment once the count reaches the threshold, without
+// waiting for the timer. Further duplicates during fast recovery let the
+// congestion control inflate its window.
+func (conn *Conn) duplicateAck() {
+	conn.dupAcks++
+	switch {
+	case conn.congestion.InRecovery():
+		// with SACK the shrinking pipe already makes room
+		if !conn.sackOK {
+			conn.congestion.OnDupAck()
+		}
+	case len(conn.retransmitQueue) == 0:
+	case conn.dupAcks == dupAckThreshold:
+		conn.enterRecovery()
+	case conn.sackOK && conn.firstLost():
+		// the scoreboard may detect the loss before the third duplicate
+		conn.enterRecovery()
+	}
+	conn.recordCwnd()
+}
@@ -0,0 +1,152 @@
+package tcp
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		srtt    time.Duration
+		rttvar  time.Duration
+		rto     time.Duration
+	}{
+		{"no sample", nil, 0, 0, initialRTO},
+		{"first sample", []time.Duration{time.Second}, time.Second, 500 * time.Millisecond, 3 * time.Second},
+		{"steady", []time.Duration{time.Second, time.Second}, time.Second, 375 * time.Millisecond, 2500 * time.Millisecond},
+		{"jump", []time.Duration{time.Second, 3 * time.Second}, 1250 * time.Millisecond, 875 * time.Millisecond, 4750 * time.Millisecond},
+		{"clamped to the minimum", []time.Duration{time.Millisecond}, time.Millisecond, 500 * time.Microsecond, minRTO},
+		{"clamped to the maximum", []time.Duration{30 * time.Second}, 30 * time.Second, 15 * time.Second, maxRTO},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			estimator := newRTTEstimator()
+			for _, sample := range test.samples {
+				estimator.sample(sample)
+			}
+			if estimator.srtt != test.srtt || estimator.rttvar != test.rttvar || estimator.timeout() != test.rto {
+				t.Errorf("srtt %v, rttvar %v, rto %v, want %v, %v, %v",
+					estimator.srtt, estimator.rttvar, estimator.timeout(), test.srtt, test.rttvar, test.rto)
+			}
+		})
+	}
+}
+
+func TestRTOBackoff(t *testing.T) {
+	estimator := newRTTEstimator()
+	want := initialRTO
+	for range 10 {
+		estimator.backoff()
+		want = min(2*want, maxRTO)
+		if estimator.timeout() != want {
+			t.Fatalf("timeout after %d backoffs = %v, want %v", estimator.backoffs, estimator.timeout(), want)
+		}
+	}
+	estimator.resetBackoff()
+	if estimator.timeout() != initialRTO {
+		t.Errorf("timeout after reset = %v, want %v", estimator.timeout(), initialRTO)
+	}
+	estimator.backoff()
+	estimator.sample(time.Second)
+	if estimator.backoffs != 0 {
+		t.Errorf("a new sample kept the backoff")
+	}
+}
+
+func TestAckQueue(t *testing.T) {
+	sentAt := time.Now().Add(-time.Second)
+	tests := []struct {
+		name          string
+		retransmitted bool
+		ack           uint32
+		sample        bool
+		left          []uint32
+	}{
+		{"nothing acknowledged", false, 100, false, []uint32{100, 200, 300}},
+		{"whole segments", false, 300, true, []uint32{300}},
+		{"part of a segment", false, 250, true, []uint32{250, 300}},
+		// Karn's algorithm: no sample from a retransmitted segment
+		{"retransmitted", true, 300, false, []uint32{300}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &Conn{}
+			for _, seq := range []uint32{100, 200, 300} {
+				conn.retransmitQueue = append(conn.retransmitQueue, &sentSegment{seq: seq, length: 100, sentAt: sentAt})
+			}
+			conn.retransmitQueue[1].retransmitted = test.retransmitted
+			rtt, ok := conn.ackQueue(test.ack)
+			if ok != test.sample || (ok && rtt < time.Second) {
+				t.Errorf("ackQueue() = %v, %t, want a sample %t", rtt, ok, test.sample)
+			}
+			var left []uint32
+			for _, entry := range conn.retransmitQueue {
+				left = append(left, entry.seq)
+			}
+			if !slices.Equal(left, test.left) {
+				t.Errorf("queue holds %v, want %v", left, test.left)
+			}
+			if end := conn.retransmitQueue[0].end(); end%100 != 0 {
+				t.Errorf("first entry ends at %d, inside the next segment", end)
+			}
+		})
+	}
+}
+
+// dropOnce drops the first transmission of the data segment at offset
+// from the start of the data and records when it was sent again.
+func dropOnce(host *testHost, conn *Conn, offset uint32) (resent func() time.Duration) {
+	seq := conn.sndBase + offset
+	var dropped, again time.Time
+	host.setDrop(func(segment *Segment) bool {
+		if segment.Seq != seq || len(segment.Data) == 0 {
+			return false
+		}
+		if dropped.IsZero() {
+			dropped = time.Now()
+			return true
+		}
+		if again.IsZero() {
+			again = time.Now()
+		}
+		return false
+	})
+	return func() time.Duration {
+		host.mutex.Lock()
+		defer host.mutex.Unlock()
+		if again.IsZero() {
+			return -1
+		}
+		return again.Sub(dropped)
+	}
+}
+
+func TestFastRetransmit(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	resent := dropOnce(client, clientConn, uint32(4*clientConn.sndMSS))
+	transfer(t, clientConn, serverConn, testData(64*1024))
+
+	// the retransmission timer never fires within minRTO of a send, so an
+	// earlier retransmission came from the duplicate ACKs
+	if delay := resent(); delay < 0 || delay >= minRTO {
+		t.Errorf("lost segment sent again after %v, want a fast retransmit", delay)
+	}
+}
+
+func TestRetransmitTimeout(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	// with the last segment lost no duplicate ACK follows, so only the
+	// timer recovers it
+	data := testData(4 * clientConn.sndMSS)
+	resent := dropOnce(client, clientConn, uint32(3*clientConn.sndMSS))
+	transfer(t, clientConn, serverConn, data)
+
+	if delay := resent(); delay < minRTO {
+		t.Errorf("lost tail sent again after %v, want the retransmission timer", delay)
+	}
+}
@@ -0,0 +1,68 @@
+package tcp
+
+import (
+	"time"
+)
+
+const (
+	initialRTO = time.Second
+	// RFC 6298 asks for at least one second, which is tuned for the
+	// internet. Simulated links answer within milliseconds, so the lower
+	// bound Linux uses keeps recovery from a lost tail fast.
+	minRTO = 200 * time.Millisecond
+	maxRTO = 60 * time.Second
+	// clockGranularity is G in the RTO formula.
+	clockGranularity = time.Millisecond
+)
+
+// rttEstimator computes the retransmission timeout from round trip time
+// samples as described in RFC 6298.
+type rttEstimator struct {
+	srtt     time.Duration
+	rttvar   time.Duration
+	rto      time.Duration
+	backoffs int
+	measured bool
+}
+
+func newRTTEstimator() rttEstimator {
+	return rttEstimator{rto: initialRTO}
+}
+
+func (estimator *rttEstimator) sample(rtt time.Duration) {
+	if !estimator.measured {
+		estimator.srtt = rtt
+		estimator.rttvar = rtt / 2
+		estimator.measured = true
+	} else {
+		delta := estimator.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		estimator.rttvar = (3*estimator.rttvar + delta) / 4
+		estimator.srtt = (7*estimator.srtt + rtt) / 8
+	}
+	estimator.rto = min(max(estimator.srtt+max(clockGranularity, 4*estimator.rttvar), minRTO), maxRTO)
+	estimator.backoffs = 0
+}
+
+// timeout is the RTO doubled once for every expiry since the last sample.
+func (estimator *rttEstimator) timeout() time.Duration {
+	timeout := estimator.rto
+	for range estimator.backoffs {
+		timeout = min(2*timeout, maxRTO)
+	}
+	return timeout
+}
+
+func (estimator *rttEstimator) backoff() {
+	estimator.backoffs++
+}
+
+// resetBackoff runs when new data is acknowledged. Karn's algorithm takes
+// no sample from retransmitted segments, so after a loss the backed off
+// timeout could otherwise stay until fresh data is sent. Like Linux, an
+// ACK that advances the window is taken as proof the path works again.
+func (estimator *rttEstimator) resetBackoff() {
+	estimator.backoffs = 0
+}
@@ -0,0 +1,125 @@
+package tcp
+
+// sackBlocks describes the out of order queue for the SACK option of
+// RFC 2018. The first block covers the most recently received segment, the
+// others follow in sequence order, and limit caps the count to what fits
+// in the option space.
+func (conn *Conn) sackBlocks(limit int) []sackBlock {
+	var blocks []sackBlock
+	for _, segment := range conn.outOfOrder {
+		left := segment.Seq
+		right := segment.Seq + uint32(len(segment.Data))
+		if count := len(blocks); count > 0 && seqGEQ(blocks[count-1].right, left) {
+			if seqGT(right, blocks[count-1].right) {
+				blocks[count-1].right = right
+			}
+			continue
+		}
+		if left != right {
+			blocks = append(blocks, sackBlock{left: left, right: right})
+		}
+	}
+
+	for i, block := range blocks {
+		if seqInWindow(conn.lastOutOfOrder, block.left, block.right-block.left) {
+			copy(blocks[1:i+1], blocks[:i])
+			blocks[0] = block
+			break
+		}
+	}
+	return blocks[:min(len(blocks), limit)]
+}
+
+// maxSackBlocks is how many blocks fit next to the other options of a
+// segment without data.
+func (conn *Conn) maxSackBlocks() int {
+	space := maxOptionsSize - 4
+	if conn.tsOK {
+		space -= timestampsSize
+	}
+	return space / 8
+}
+
+// markSacked records the blocks of an incoming SACK option on the
+// retransmission queue, ignoring blocks outside the outstanding data.
+func (conn *Conn) markSacked(blocks []sackBlock) {
+	for _, block := range blocks {
+		if !seqLT(block.left, block.right) || seqLT(block.left, conn.sndUna) || seqGT(block.right, conn.sndNxt) {
+			continue
+		}
+		for _, entry := range conn.retransmitQueue {
+			if seqGEQ(entry.seq, block.left) && seqLEQ(entry.end(), block.right) {
+				entry.sacked = true
+			}
+		}
+	}
+}
+
+// scoreboard runs IsLost on every queued segment and returns the pipe, the
+// estimate of octets still in the network, as RFC 6675 defines them. A
+// segment counts as lost once more than DupThresh-1 segments worth of data
+// above it were SACKed, or when the retransmission timer expired on it.
+func (conn *Conn) scoreboard() int {
+	sackedAbove := 0
+	pipe := 0
+	for i := len(conn.retransmitQueue) - 1; i >= 0; i-- {
+		entry := conn.retransmitQueue[i]
+		if entry.sacked {
+			sackedAbove += int(entry.length)
+			continue
+		}
+		entry.lost = entry.timedOut || sackedAbove > (dupAckThreshold-1)*conn.sndMSS
+		if !entry.lost {
+			pipe += int(entry.length)
+		}
+		if entry.retransmitted && entry.retransmitEpoch == conn.recoveryEpoch {
+			pipe += int(entry.length)
+		}
+	}
+	return pipe
+}
+
+// flightSize is what the congestion window limits, the pipe when SACK
+// tells which segments left the network.
+func (conn *Conn) flightSize() int {
+	if conn.sackOK {
+		return conn.scoreboard()
+	}
+	return conn.inFlight()
+}
+
+// firstLost reports whether the scoreboard considers the segment at
+// sndUna lost.
+func (conn *Conn) firstLost() bool {
+	conn.scoreboard()
+	return len(conn.retransmitQueue) > 0 && conn.retransmitQueue[0].lost
+}
+
+func (conn *Conn) recovering() bool {
+	return conn.congestion.InRecovery() || conn.rtoRecovery
+}
+
+// retransmitLost resends the segments the scoreboard considers lost while
+// the congestion window has room, rule 1 of NextSeg in RFC 6675. Each
+// segment goes out once per recovery.
+func (conn *Conn) retransmitLost() {
+	pipe := conn.scoreboard()
+	for _, entry := range conn.retransmitQueue {
+		if conn.congestion.Window()-pipe < conn.sndMSS {
+			return
+		}
+		if entry.sacked || !entry.lost || (entry.retransmitted && entry.retransmitEpoch == conn.recoveryEpoch) {
+			continue
+		}
+		conn.resend(entry)
+		pipe += int(entry.length)
+	}
+}
+
+// enterRecovery starts fast recovery with the first unacknowledged segment.
+func (conn *Conn) enterRecovery() {
+	conn.recoveryEpoch++
+	conn.rtoRecovery = false
+	conn.resend(conn.retransmitQueue[0])
+	conn.congestion.OnFastRetransmit(conn.inFlight(), conn.sndNxt)
+}
@@ -0,0 +1,159 @@
+package tcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSackBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments [][2]uint32
+		last     uint32
+		limit    int
+		want     []sackBlock
+	}{
+		{"none", nil, 0, 4, nil},
+		{"one", [][2]uint32{{200, 300}}, 200, 4, []sackBlock{{200, 300}}},
+		{"adjacent merged", [][2]uint32{{200, 300}, {300, 400}}, 300, 4, []sackBlock{{200, 400}}},
+		{"overlapping merged", [][2]uint32{{200, 300}, {250, 350}}, 250, 4, []sackBlock{{200, 350}}},
+		// the block holding the latest segment comes first, RFC 2018
+		{"latest first", [][2]uint32{{200, 300}, {400, 500}, {600, 700}}, 400, 4,
+			[]sackBlock{{400, 500}, {200, 300}, {600, 700}}},
+		{"limited", [][2]uint32{{200, 300}, {400, 500}, {600, 700}}, 600, 2,
+			[]sackBlock{{600, 700}, {200, 300}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := testConn(t)
+			for _, segment := range test.segments {
+				conn.outOfOrder = append(conn.outOfOrder, &Segment{Seq: segment[0], Data: make([]byte, segment[1]-segment[0])})
+			}
+			conn.lastOutOfOrder = test.last
+			if got := conn.sackBlocks(test.limit); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("sackBlocks() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMaxSackBlocks(t *testing.T) {
+	conn := testConn(t)
+	if conn.maxSackBlocks() != 4 {
+		t.Errorf("maxSackBlocks() = %d without timestamps, want 4", conn.maxSackBlocks())
+	}
+	conn.tsOK = true
+	if conn.maxSackBlocks() != 3 {
+		t.Errorf("maxSackBlocks() = %d with timestamps, want 3", conn.maxSackBlocks())
+	}
+}
+
+func TestQueueOutOfOrder(t *testing.T) {
+	conn := testConn(t)
+	conn.rcvNxt = 100
+	for _, segment := range []*Segment{
+		{Seq: 300, Data: make([]byte, 100)},
+		{Seq: 200, Data: make([]byte, 100)},
+		// a shorter duplicate is ignored
+		{Seq: 300, Data: make([]byte, 50)},
+		{Seq: 400, Data: make([]byte, 10), Flags: FlagFIN},
+	} {
+		conn.queueOutOfOrder(segment)
+	}
+	if len(conn.outOfOrder) != 3 || conn.outOfOrder[0].Seq != 200 || len(conn.outOfOrder[1].Data) != 100 {
+		t.Fatalf("out of order queue %v", conn.outOfOrder)
+	}
+
+	if conn.drainOutOfOrder() || len(conn.recvBuffer) != 0 {
+		t.Fatalf("drained across the hole at %d", conn.rcvNxt)
+	}
+	conn.rcvNxt = 200
+	if !conn.drainOutOfOrder() || conn.rcvNxt != 410 || len(conn.recvBuffer) != 210 {
+		t.Errorf("drain reached %d with %d bytes, want the FIN at 410", conn.rcvNxt, len(conn.recvBuffer))
+	}
+}
+
+// scoreboardConn has ten segments of testMSS outstanding from 1000.
+func scoreboardConn(t *testing.T) *Conn {
+	t.Helper()
+	conn := testConn(t)
+	conn.sndMSS = testMSS
+	conn.sackOK = true
+	conn.sndUna = 1000
+	for i := range uint32(10) {
+		conn.retransmitQueue = append(conn.retransmitQueue, &sentSegment{seq: 1000 + i*testMSS, length: testMSS})
+	}
+	conn.sndNxt = 1000 + 10*testMSS
+	return conn
+}
+
+func TestScoreboard(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []sackBlock
+		sacked []int
+		lost   []int
+		pipe   int
+	}{
+		{"nothing sacked", nil, nil, nil, 10 * testMSS},
+		// two segments above are not enough to declare the first lost
+		{"two above", []sackBlock{{1000 + testMSS, 1000 + 3*testMSS}}, []int{1, 2}, nil, 8 * testMSS},
+		{"three above", []sackBlock{{1000 + testMSS, 1000 + 4*testMSS}}, []int{1, 2, 3}, []int{0}, 6 * testMSS},
+		{"two blocks", []sackBlock{{1000 + 2*testMSS, 1000 + 3*testMSS}, {1000 + 5*testMSS, 1000 + 8*testMSS}},
+			[]int{2, 5, 6, 7}, []int{0, 1, 3, 4}, 2 * testMSS},
+		// blocks outside the outstanding data or covering part of a
+		// segment are ignored
+		{"ignored", []sackBlock{{500, 1500}, {1000 + 9*testMSS, 1000 + 11*testMSS}, {1100, 1500}}, nil, nil, 10 * testMSS},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := scoreboardConn(t)
+			conn.markSacked(test.blocks)
+			pipe := conn.scoreboard()
+			var sacked, lost []int
+			for i, entry := range conn.retransmitQueue {
+				if entry.sacked {
+					sacked = append(sacked, i)
+				}
+				if entry.lost {
+					lost = append(lost, i)
+				}
+			}
+			if !reflect.DeepEqual(sacked, test.sacked) || !reflect.DeepEqual(lost, test.lost) || pipe != test.pipe {
+				t.Errorf("sacked %v, lost %v, pipe %d, want %v, %v, %d", sacked, lost, pipe, test.sacked, test.lost, test.pipe)
+			}
+		})
+	}
+}
+
+func TestScoreboardRetransmitted(t *testing.T) {
+	conn := scoreboardConn(t)
+	conn.markSacked([]sackBlock{{1000 + testMSS, 1000 + 4*testMSS}})
+	conn.recoveryEpoch = 1
+	conn.retransmitQueue[0].retransmitted = true
+	conn.retransmitQueue[0].retransmitEpoch = 1
+	// the lost segment left the network, its retransmission is in it
+	if pipe := conn.scoreboard(); pipe != 7*testMSS {
+		t.Errorf("pipe = %d, want %d", pipe, 7*testMSS)
+	}
+}
+
+func TestSackRecovery(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	// the receiver reports what arrived beyond the hole, so the loss is
+	// repaired without waiting for the timer
+	first := dropOnce(client, clientConn, uint32(4*clientConn.sndMSS))
+	transfer(t, clientConn, serverConn, testData(64*1024))
+
+	sacked := false
+	for _, segment := range server.segments() {
+		sacked = sacked || len(segment.opts.sackBlocks) > 0
+	}
+	if !sacked {
+		t.Errorf("the receiver sent no SACK blocks")
+	}
+	if delay := first(); delay < 0 || delay >= minRTO {
+		t.Errorf("lost segment sent again after %v, want SACK recovery", delay)
+	}
+}
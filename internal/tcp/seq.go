@@ -0,0 +1,25 @@
+package tcp
+
+// Sequence numbers wrap around, so they are compared through the sign of
+// their 32 bit difference as described in RFC 9293 section 3.4.
+
+func seqLT(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+func seqLEQ(a, b uint32) bool {
+	return int32(a-b) <= 0
+}
+
+func seqGT(a, b uint32) bool {
+	return int32(a-b) > 0
+}
+
+func seqGEQ(a, b uint32) bool {
+	return int32(a-b) >= 0
+}
+
+// seqInWindow reports whether start <= seq < start+size.
+func seqInWindow(seq, start uint32, size uint32) bool {
+	return seqLEQ(start, seq) && seqLT(seq, start+size)
+}
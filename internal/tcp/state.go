@@ -0,0 +1,62 @@
+package tcp
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateListen
+	StateSynSent
+	StateSynReceived
+	StateEstablished
+	StateFinWait1
+	StateFinWait2
+	StateCloseWait
+	StateClosing
+	StateLastAck
+	StateTimeWait
+)
+
+func (state State) String() string {
+	switch state {
+	case StateClosed:
+		return "CLOSED"
+	case StateListen:
+		return "LISTEN"
+	case StateSynSent:
+		return "SYN-SENT"
+	case StateSynReceived:
+		return "SYN-RECEIVED"
+	case StateEstablished:
+		return "ESTABLISHED"
+	case StateFinWait1:
+		return "FIN-WAIT-1"
+	case StateFinWait2:
+		return "FIN-WAIT-2"
+	case StateCloseWait:
+		return "CLOSE-WAIT"
+	case StateClosing:
+		return "CLOSING"
+	case StateLastAck:
+		return "LAST-ACK"
+	case StateTimeWait:
+		return "TIME-WAIT"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// synchronized reports whether the state is past the handshake, where
+// sequence numbers of both sides are known.
+func (state State) synchronized() bool {
+	return state >= StateEstablished
+}
+
+// canReceive reports whether data from the peer is still expected.
+func (state State) canReceive() bool {
+	return state == StateEstablished || state == StateFinWait1 || state == StateFinWait2
+}
+
+// canSend reports whether the user may still queue data.
+func (state State) canSend() bool {
+	return state == StateEstablished || state == StateCloseWait
+}
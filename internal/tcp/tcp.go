@@ -0,0 +1,245 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"tcp-ip/internal/ip"
+	"time"
+)
+
+var (
+	ErrPortInUse         = fmt.Errorf("port already in use")
+	ErrNoFreePorts       = fmt.Errorf("no ephemeral ports available")
+	ErrConnectionRefused = fmt.Errorf("connection refused")
+	ErrConnectionReset   = fmt.Errorf("connection reset by peer")
+	ErrConnectionAborted = fmt.Errorf("connection aborted")
+	ErrConnectionClosing = fmt.Errorf("connection closing")
+	ErrTimeout           = fmt.Errorf("connection timed out")
+	ErrListenerClosed    = fmt.Errorf("listener closed")
+	ErrReadClosed        = fmt.Errorf("connection closed for reading")
+)
+
+const (
+	HeaderSize     = 20
+	DefaultMSS     = 536
+	EphemeralFirst = 49152
+	EphemeralLast  = 65535
+
+	msl            = time.Second * 30
+	listenBacklog  = 16
+	sendBufferSize = 64 * 1024
+	// DefaultReceiveBuffer is larger than an unscaled window can describe,
+	// so connections need the window scale option to use all of it
+	DefaultReceiveBuffer = 256 * 1024
+)
+
+type sender interface {
+	SendToIP(message []byte, dst ip.IPAddress, protocol uint8) error
+}
+
+type connKey struct {
+	localPort  uint16
+	remoteIP   ip.IPAddress
+	remotePort uint16
+}
+
+type TCPModule struct {
+	addr          ip.IPAddress
+	sender        sender
+	mss           int
+	conns         map[connKey]*Conn
+	listeners     map[uint16]*Listener
+	nextEphemeral uint16
+	// congestionControl is the algorithm new connections start with
+	congestionControl string
+	// start is the epoch of the timestamps clock
+	start time.Time
+	mutex *sync.Mutex
+}
+
+// NewTCPModule creates the TCP layer of a host. mtu is the largest IP
+// datagram the host sends, from which the advertised MSS is derived.
+func NewTCPModule(addr ip.IPAddress, sender sender, mtu int) *TCPModule {
+	return &TCPModule{
+		addr:              addr,
+		sender:            sender,
+		mss:               max(DefaultMSS, mtu-ip.MinHeaderSize-HeaderSize),
+		conns:             make(map[connKey]*Conn),
+		listeners:         make(map[uint16]*Listener),
+		nextEphemeral:     EphemeralFirst,
+		congestionControl: DefaultCongestionControl,
+		start:             time.Now(),
+		mutex:             new(sync.Mutex),
+	}
+}
+
+func (tcp *TCPModule) Addr() ip.IPAddress {
+	return tcp.addr
+}
+
+// SetCongestionControl selects the algorithm for connections opened from
+// now on.
+func (tcp *TCPModule) SetCongestionControl(name string) error {
+	_, err := newCongestionControl(name, DefaultMSS)
+	if err != nil {
+		return err
+	}
+	tcp.mutex.Lock()
+	tcp.congestionControl = name
+	tcp.mutex.Unlock()
+	return nil
+}
+
+// initialSequence picks an ISN from a 4 microsecond clock, as RFC 9293
+// suggests, plus a random offset so restarted hosts do not repeat it.
+func initialSequence() uint32 {
+	return uint32(time.Now().UnixMicro()/4) + rand.Uint32N(1<<16)
+}
+
+func (tcp *TCPModule) portInUse(port uint16) bool {
+	if _, ok := tcp.listeners[port]; ok {
+		return true
+	}
+	for key := range tcp.conns {
+		if key.localPort == port {
+			return true
+		}
+	}
+	return false
+}
+
+func (tcp *TCPModule) allocatePort() (uint16, error) {
+	for range EphemeralLast - EphemeralFirst + 1 {
+		port := tcp.nextEphemeral
+		if tcp.nextEphemeral == EphemeralLast {
+			tcp.nextEphemeral = EphemeralFirst
+		} else {
+			tcp.nextEphemeral++
+		}
+		if !tcp.portInUse(port) {
+			return port, nil
+		}
+	}
+	return 0, ErrNoFreePorts
+}
+
+func (tcp *TCPModule) Listen(port uint16) (*Listener, error) {
+	tcp.mutex.Lock()
+	defer tcp.mutex.Unlock()
+	if _, ok := tcp.listeners[port]; ok {
+		return nil, fmt.Errorf("%w: %d", ErrPortInUse, port)
+	}
+	listener := newListener(tcp, port)
+	tcp.listeners[port] = listener
+	return listener, nil
+}
+
+// Dial performs an active open and blocks until the connection is
+// established or the handshake fails.
+func (tcp *TCPModule) Dial(dst ip.IPAddress, port uint16) (*Conn, error) {
+	return tcp.DialContext(context.Background(), dst, port)
+}
+
+// DialContext is Dial that aborts the handshake when ctx is done.
+func (tcp *TCPModule) DialContext(ctx context.Context, dst ip.IPAddress, port uint16) (*Conn, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	tcp.mutex.Lock()
+	localPort, err := tcp.allocatePort()
+	if err != nil {
+		tcp.mutex.Unlock()
+		return nil, err
+	}
+	conn := newConn(tcp, connKey{localPort: localPort, remoteIP: dst, remotePort: port})
+	tcp.conns[conn.key] = conn
+	tcp.mutex.Unlock()
+
+	conn.mutex.Lock()
+	defer conn.unlock()
+	conn.openActive()
+	stop := context.AfterFunc(ctx, conn.wake)
+	defer stop()
+	for (conn.state == StateSynSent || conn.state == StateSynReceived) && ctx.Err() == nil {
+		conn.wait()
+	}
+	if conn.state == StateSynSent || conn.state == StateSynReceived {
+		if conn.state == StateSynReceived {
+			conn.sendRst(conn.sndNxt)
+		}
+		conn.terminate(ctx.Err())
+	}
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	return conn, nil
+}
+
+func (tcp *TCPModule) Conns() []*Conn {
+	tcp.mutex.Lock()
+	defer tcp.mutex.Unlock()
+	conns := make([]*Conn, 0, len(tcp.conns))
+	for _, conn := range tcp.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+func (tcp *TCPModule) remove(key connKey) {
+	tcp.mutex.Lock()
+	delete(tcp.conns, key)
+	tcp.mutex.Unlock()
+}
+
+func (tcp *TCPModule) transmit(segment *Segment, dst ip.IPAddress) error {
+	return tcp.sender.SendToIP(segment.Serialize(tcp.addr, dst), dst, ip.ProtoTCP)
+}
+
+// resetFor builds the answer to a segment that belongs to no connection,
+// following the reset generation rules of RFC 9293 section 3.10.7.1. A
+// reset is never answered, so it returns nil for one.
+func resetFor(segment *Segment) *Segment {
+	if segment.has(FlagRST) {
+		return nil
+	}
+	reset := &Segment{SrcPort: segment.DstPort, DstPort: segment.SrcPort, Flags: FlagRST}
+	if segment.has(FlagACK) {
+		reset.Seq = segment.Ack
+	} else {
+		reset.Flags |= FlagACK
+		reset.Ack = segment.Seq + segment.Length()
+	}
+	return reset
+}
+
+func (tcp *TCPModule) sendReset(segment *Segment, src ip.IPAddress) error {
+	reset := resetFor(segment)
+	if reset == nil {
+		return nil
+	}
+	return tcp.transmit(reset, src)
+}
+
+func (tcp *TCPModule) Receive(packet *ip.Packet) error {
+	segment, err := Deserialize(packet.Data, packet.SrcIP, packet.DstIP)
+	if err != nil {
+		return err
+	}
+	key := connKey{localPort: segment.DstPort, remoteIP: packet.SrcIP, remotePort: segment.SrcPort}
+
+	tcp.mutex.Lock()
+	conn, ok := tcp.conns[key]
+	listener, listening := tcp.listeners[segment.DstPort]
+	tcp.mutex.Unlock()
+
+	if ok {
+		return conn.segmentArrives(segment)
+	}
+	if listening {
+		return listener.segmentArrives(segment, key)
+	}
+	return tcp.sendReset(segment, packet.SrcIP)
+}
@@ -0,0 +1,123 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"tcp-ip/internal/ip"
+)
+
+const (
+	FlagFIN uint8 = 1 << iota
+	FlagSYN
+	FlagRST
+	FlagPSH
+	FlagACK
+	FlagURG
+	FlagECE
+	FlagCWR
+)
+
+type Segment struct {
+	SrcPort    uint16
+	DstPort    uint16
+	Seq        uint32
+	Ack        uint32
+	DataOffset uint8
+	Flags      uint8
+	Window     uint16
+	Checksum   uint16
+	Urgent     uint16
+	Options    []byte
+	Data       []byte
+
+	opts options
+}
+
+func (segment *Segment) has(flag uint8) bool {
+	return segment.Flags&flag != 0
+}
+
+// Length is SEG.LEN, the sequence space the segment occupies, where SYN and
+// FIN count as one octet each.
+func (segment *Segment) Length() uint32 {
+	length := uint32(len(segment.Data))
+	if segment.has(FlagSYN) {
+		length++
+	}
+	if segment.has(FlagFIN) {
+		length++
+	}
+	return length
+}
+
+func FlagsString(flags uint8) string {
+	names := []string{"FIN", "SYN", "RST", "PSH", "ACK", "URG", "ECE", "CWR"}
+	var set []string
+	for i, name := range names {
+		if flags&(1<<i) != 0 {
+			set = append(set, name)
+		}
+	}
+	return strings.Join(set, ",")
+}
+
+func (segment *Segment) Serialize(src, dst ip.IPAddress) []byte {
+	for len(segment.Options)%4 != 0 {
+		segment.Options = append(segment.Options, optionEnd)
+	}
+	segment.DataOffset = uint8((HeaderSize + len(segment.Options)) / 4)
+
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.BigEndian, segment.SrcPort)
+	_ = binary.Write(buf, binary.BigEndian, segment.DstPort)
+	_ = binary.Write(buf, binary.BigEndian, segment.Seq)
+	_ = binary.Write(buf, binary.BigEndian, segment.Ack)
+	buf.WriteByte(segment.DataOffset << 4)
+	buf.WriteByte(segment.Flags)
+	_ = binary.Write(buf, binary.BigEndian, segment.Window)
+	_ = binary.Write(buf, binary.BigEndian, uint16(0))
+	_ = binary.Write(buf, binary.BigEndian, segment.Urgent)
+	buf.Write(segment.Options)
+	buf.Write(segment.Data)
+	data := buf.Bytes()
+
+	sum := ip.PseudoHeaderSum(src, dst, ip.ProtoTCP, len(data))
+	segment.Checksum = ip.FinishChecksum(ip.Sum(sum, data))
+	binary.BigEndian.PutUint16(data[16:18], segment.Checksum)
+	return data
+}
+
+func Deserialize(data []byte, src, dst ip.IPAddress) (*Segment, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("invalid segment: segment shorter than the header")
+	}
+	sum := ip.PseudoHeaderSum(src, dst, ip.ProtoTCP, len(data))
+	if ip.FinishChecksum(ip.Sum(sum, data)) != 0 {
+		return nil, fmt.Errorf("invalid segment: checksum doesn't match")
+	}
+
+	segment := &Segment{}
+	segment.SrcPort = binary.BigEndian.Uint16(data[0:2])
+	segment.DstPort = binary.BigEndian.Uint16(data[2:4])
+	segment.Seq = binary.BigEndian.Uint32(data[4:8])
+	segment.Ack = binary.BigEndian.Uint32(data[8:12])
+	segment.DataOffset = data[12] >> 4
+	headerLength := int(segment.DataOffset) * 4
+	if headerLength < HeaderSize || headerLength > len(data) {
+		return nil, fmt.Errorf("invalid segment: invalid data offset")
+	}
+	segment.Flags = data[13]
+	segment.Window = binary.BigEndian.Uint16(data[14:16])
+	segment.Checksum = binary.BigEndian.Uint16(data[16:18])
+	segment.Urgent = binary.BigEndian.Uint16(data[18:20])
+	segment.Options = data[HeaderSize:headerLength]
+	segment.Data = data[headerLength:]
+	opts, err := parseOptions(segment.Options)
+	if err != nil {
+		return nil, err
+	}
+	segment.opts = opts
+	return segment, nil
+}
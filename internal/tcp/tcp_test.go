@@ -0,0 +1,406 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"tcp-ip/internal/ip"
+	"testing"
+	"time"
+)
+
+// testHost is one end of a point to point link between two TCP modules.
+// Segments are delivered in order by a goroutine per host, unless drop
+// discards them on the way.
+type testHost struct {
+	addr    ip.IPAddress
+	peer    *testHost
+	tcp     *TCPModule
+	packets chan *ip.Packet
+	done    chan struct{}
+
+	mutex *sync.Mutex
+	drop  func(segment *Segment) bool
+	sent  []*Segment
+}
+
+func (host *testHost) SendToIP(message []byte, dst ip.IPAddress, protocol uint8) error {
+	segment, err := Deserialize(message, host.addr, dst)
+	if err != nil {
+		return err
+	}
+	host.mutex.Lock()
+	host.sent = append(host.sent, segment)
+	drop := host.drop != nil && host.drop(segment)
+	host.mutex.Unlock()
+	if drop {
+		return nil
+	}
+	packet, err := ip.NewPacket(host.addr, dst, protocol, 0, bytes.Clone(message))
+	if err != nil {
+		return err
+	}
+	select {
+	case host.peer.packets <- packet:
+	case <-host.done:
+	}
+	return nil
+}
+
+func (host *testHost) run() {
+	for {
+		select {
+		case packet := <-host.packets:
+			host.tcp.Receive(packet)
+		case <-host.done:
+			return
+		}
+	}
+}
+
+// setDrop discards the segments host sends for which drop returns true.
+func (host *testHost) setDrop(drop func(segment *Segment) bool) {
+	host.mutex.Lock()
+	host.drop = drop
+	host.mutex.Unlock()
+}
+
+// segments returns the segments host sent, dropped ones included.
+func (host *testHost) segments() []*Segment {
+	host.mutex.Lock()
+	defer host.mutex.Unlock()
+	return append([]*Segment(nil), host.sent...)
+}
+
+func newHostPair(t *testing.T) (*testHost, *testHost) {
+	t.Helper()
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	newHost := func(addr ip.IPAddress) *testHost {
+		host := &testHost{addr: addr, packets: make(chan *ip.Packet, 4096), done: done, mutex: new(sync.Mutex)}
+		host.tcp = NewTCPModule(addr, host, 1500)
+		return host
+	}
+	client, server := newHost(ip.IPAddress{10, 0, 0, 1}), newHost(ip.IPAddress{10, 0, 0, 2})
+	client.peer, server.peer = server, client
+	go client.run()
+	go server.run()
+	return client, server
+}
+
+// connect opens a connection from client to a listener on server.
+func connect(t *testing.T, client, server *testHost) (*Conn, *Conn) {
+	t.Helper()
+	listener, err := server.tcp.Listen(80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	accepted := make(chan *Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- conn
+	}()
+	conn, err := client.tcp.Dial(server.addr, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, <-accepted
+}
+
+func waitState(t *testing.T, conn *Conn, state State) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for conn.State() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v in %v, want %v", conn, conn.State(), state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+// transfer writes data from one end and checks it all arrives at the other
+// before the writer closes.
+func transfer(t *testing.T, from, to *Conn, data []byte) {
+	t.Helper()
+	received := make(chan []byte, 1)
+	go func() {
+		got, err := io.ReadAll(to)
+		if err != nil {
+			t.Error(err)
+		}
+		received <- got
+	}()
+	if _, err := from.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := from.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if !bytes.Equal(got, data) {
+			t.Fatalf("received %d bytes differing from the %d sent", len(got), len(data))
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("transfer did not complete")
+	}
+}
+
+func TestSegmentRoundTrip(t *testing.T) {
+	src, dst := ip.IPAddress{10, 0, 0, 1}, ip.IPAddress{10, 0, 0, 2}
+	segment := &Segment{
+		SrcPort: 1234, DstPort: 80, Seq: 0xFFFFFFF0, Ack: 7, Flags: FlagSYN | FlagACK, Window: 1000,
+		Options: options{mss: 1460}.serialize(), Data: []byte("data"),
+	}
+	data := segment.Serialize(src, dst)
+	got, err := Deserialize(data, src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SrcPort != 1234 || got.DstPort != 80 || got.Seq != segment.Seq || got.Ack != 7 ||
+		got.Flags != segment.Flags || got.Window != 1000 || got.opts.mss != 1460 || string(got.Data) != "data" {
+		t.Errorf("Deserialize() = %+v", got)
+	}
+	if got.Length() != 5 {
+		t.Errorf("Length() = %d, want the data plus one for the SYN", got.Length())
+	}
+
+	tests := []struct {
+		name   string
+		mangle func(data []byte) []byte
+	}{
+		{"shorter than a header", func(data []byte) []byte { return data[:HeaderSize-1] }},
+		{"bad checksum", func(data []byte) []byte { data[len(data)-1] ^= 1; return data }},
+		{"data offset past the segment", func(data []byte) []byte {
+			return (&Segment{Options: make([]byte, 8)}).Serialize(src, dst)[:HeaderSize+4]
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Deserialize(test.mangle(bytes.Clone(data)), src, dst); err == nil {
+				t.Errorf("Deserialize() accepted an invalid segment")
+			}
+		})
+	}
+}
+
+func TestSequenceComparison(t *testing.T) {
+	tests := []struct {
+		a, b           uint32
+		less, lessOrEq bool
+	}{
+		{1, 2, true, true},
+		{2, 2, false, true},
+		{3, 2, false, false},
+		// across the wrap around
+		{0xFFFFFFFF, 0, true, true},
+		{0, 0xFFFFFFFF, false, false},
+		{0xFFFFFF00, 0x100, true, true},
+	}
+	for _, test := range tests {
+		if seqLT(test.a, test.b) != test.less || seqLEQ(test.a, test.b) != test.lessOrEq ||
+			seqGT(test.a, test.b) != !test.lessOrEq || seqGEQ(test.a, test.b) != !test.less {
+			t.Errorf("comparing %#x with %#x", test.a, test.b)
+		}
+	}
+	if !seqInWindow(2, 0xFFFFFFFE, 8) || seqInWindow(6, 0xFFFFFFFE, 8) {
+		t.Errorf("seqInWindow() across the wrap around")
+	}
+}
+
+func TestHandshakeAndClose(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	waitState(t, clientConn, StateEstablished)
+	waitState(t, serverConn, StateEstablished)
+
+	// the client closes first and ends in TIME-WAIT, the server passes
+	// through CLOSE-WAIT and LAST-ACK to CLOSED
+	transfer(t, clientConn, serverConn, []byte("request"))
+	waitState(t, clientConn, StateFinWait2)
+	waitState(t, serverConn, StateCloseWait)
+	if _, err := serverConn.Write([]byte("response")); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverConn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(clientConn)
+	if err != nil || string(got) != "response" {
+		t.Errorf("client read %q, %v", got, err)
+	}
+	waitState(t, serverConn, StateClosed)
+	waitState(t, clientConn, StateTimeWait)
+	if len(server.tcp.Conns()) != 0 {
+		t.Errorf("server still has connections %v", server.tcp.Conns())
+	}
+
+	// the handshake took a SYN, a SYN-ACK and an ACK
+	first := client.segments()[0]
+	if first.Flags != FlagSYN || server.segments()[0].Flags != FlagSYN|FlagACK {
+		t.Errorf("handshake started with %s and %s",
+			FlagsString(first.Flags), FlagsString(server.segments()[0].Flags))
+	}
+}
+
+func TestSimultaneousClose(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	clientConn.Close()
+	serverConn.Close()
+	waitState(t, clientConn, StateTimeWait)
+	waitState(t, serverConn, StateTimeWait)
+}
+
+// TestDataBeforeLastAck checks that data Nagle held back when the user
+// closed still goes out once acknowledgments arrive in LAST-ACK.
+func TestDataBeforeLastAck(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	clientConn.Close()
+	waitState(t, serverConn, StateCloseWait)
+
+	// losing the first acknowledgment leaves it to a retransmission, so
+	// the close certainly comes first
+	dropped := false
+	client.setDrop(func(segment *Segment) bool {
+		drop := !dropped && segment.has(FlagACK)
+		dropped = dropped || drop
+		return drop
+	})
+	serverConn.mutex.Lock()
+	data := testData(serverConn.sndMSS + 100)
+	serverConn.mutex.Unlock()
+	if _, err := serverConn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	serverConn.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		got, _ := io.ReadAll(clientConn)
+		received <- got
+	}()
+	select {
+	case got := <-received:
+		if !bytes.Equal(got, data) {
+			t.Errorf("received %d bytes, want %d", len(got), len(data))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("data held in %v never arrived", serverConn.State())
+	}
+	waitState(t, serverConn, StateClosed)
+}
+
+func TestConnectionRefused(t *testing.T) {
+	client, server := newHostPair(t)
+	if _, err := client.tcp.Dial(server.addr, 81); !errors.Is(err, ErrConnectionRefused) {
+		t.Errorf("Dial() error = %v, want %v", err, ErrConnectionRefused)
+	}
+	if len(client.tcp.Conns()) != 0 {
+		t.Errorf("refused connection still in the table")
+	}
+}
+
+func TestAbort(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	clientConn.Abort()
+	if _, err := serverConn.Read(make([]byte, 1)); !errors.Is(err, ErrConnectionReset) {
+		t.Errorf("Read() error = %v, want %v", err, ErrConnectionReset)
+	}
+	waitState(t, serverConn, StateClosed)
+	if _, err := clientConn.Write([]byte("late")); err == nil {
+		t.Errorf("Write() on an aborted connection succeeded")
+	}
+}
+
+func TestListen(t *testing.T) {
+	_, server := newHostPair(t)
+	listener, err := server.tcp.Listen(80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.tcp.Listen(80); !errors.Is(err, ErrPortInUse) {
+		t.Errorf("Listen() error = %v, want %v", err, ErrPortInUse)
+	}
+	listener.Close()
+	if _, err := listener.Accept(); !errors.Is(err, ErrListenerClosed) {
+		t.Errorf("Accept() error = %v, want %v", err, ErrListenerClosed)
+	}
+}
+
+func TestFailedPassiveOpen(t *testing.T) {
+	client, server := newHostPair(t)
+	listener, err := server.tcp.Listen(80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// an unknown algorithm makes every passive open fail
+	server.tcp.congestionControl = "unknown"
+	for port := range uint16(listenBacklog + 1) {
+		syn := &Segment{SrcPort: EphemeralFirst + port, DstPort: 80, Seq: 1, Flags: FlagSYN, Window: 1024}
+		if err := server.tcp.Receive(packetFrom(t, client, server, syn)); err == nil {
+			t.Fatalf("Receive() of SYN %d succeeded", port)
+		}
+	}
+	if conns := server.tcp.Conns(); len(conns) != 0 {
+		t.Errorf("%d failed connections still in the table", len(conns))
+	}
+
+	server.tcp.congestionControl = DefaultCongestionControl
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.tcp.DialContext(ctx, server.addr, 80); err != nil {
+		t.Errorf("Dial() after failed opens error = %v", err)
+	}
+}
+
+// TestSendUnlocked checks that segments reach IP after the connection
+// mutex is released, since sending may block on ARP resolution.
+func TestSendUnlocked(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	// another goroutine may hold the mutex for a moment, but never until
+	// the segment is sent
+	locked := func(conn *Conn) func(*Segment) bool {
+		return func(*Segment) bool {
+			acquired := make(chan struct{})
+			go func() {
+				conn.mutex.Lock()
+				conn.mutex.Unlock()
+				close(acquired)
+			}()
+			select {
+			case <-acquired:
+			case <-time.After(time.Second):
+				t.Errorf("%v sent a segment holding its mutex", conn)
+			}
+			return false
+		}
+	}
+	client.setDrop(locked(clientConn))
+	server.setDrop(locked(serverConn))
+	transfer(t, clientConn, serverConn, testData(8*1024))
+}
+
+func TestBulkTransfer(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	transfer(t, clientConn, serverConn, testData(DefaultReceiveBuffer*2))
+}
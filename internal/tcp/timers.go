@@ -0,0 +1,145 @@
+package tcp
+
+import (
+	"time"
+)
+
+const maxRetries = 8
+
+// startRetransmitTimer arms the retransmission timer with the current RTO
+// unless it is already running for an earlier segment.
+func (conn *Conn) startRetransmitTimer() {
+	if conn.retransmitTimer != nil {
+		return
+	}
+	// a callback that lost the race with a restart sees a newer generation
+	conn.retransmitGen++
+	generation := conn.retransmitGen
+	conn.retransmitTimer = time.AfterFunc(conn.rtt.timeout(), func() { conn.retransmit(generation) })
+}
+
+func (conn *Conn) restartRetransmitTimer() {
+	conn.stopRetransmitTimer()
+	conn.startRetransmitTimer()
+}
+
+func (conn *Conn) stopRetransmitTimer() {
+	if conn.retransmitTimer != nil {
+		conn.retransmitTimer.Stop()
+		conn.retransmitTimer = nil
+	}
+}
+
+// retransmit runs when the timer expires. Following RFC 6298 it resends the
+// earliest unacknowledged segment, backs the timeout off and rearms it.
+func (conn *Conn) retransmit(generation uint64) {
+	conn.mutex.Lock()
+	defer conn.unlock()
+
+	if conn.retransmitTimer == nil || conn.retransmitGen != generation {
+		return
+	}
+	conn.retransmitTimer = nil
+	if conn.state == StateClosed || conn.state == StateTimeWait || len(conn.retransmitQueue) == 0 {
+		return
+	}
+
+	conn.retries++
+	if conn.retries > maxRetries {
+		if conn.state.synchronized() {
+			conn.sendRst(conn.sndNxt)
+		}
+		conn.terminate(ErrTimeout)
+		return
+	}
+
+	conn.rtt.backoff()
+	conn.dupAcks = 0
+	if conn.sackOK {
+		// everything not SACKed is resent as the window grows back
+		conn.recoveryEpoch++
+		conn.rtoRecovery = true
+		conn.recoveryPoint = conn.sndNxt
+		for _, entry := range conn.retransmitQueue {
+			entry.timedOut = !entry.sacked
+		}
+	}
+	if conn.congestion != nil {
+		conn.congestion.OnTimeout(conn.inFlight())
+		conn.recordCwnd()
+	}
+	conn.resend(conn.retransmitQueue[0])
+	conn.startRetransmitTimer()
+}
+
+// updatePersistTimer runs the persist timer while unsent data waits and
+// nothing is in flight, the one case where no ACK will arrive to reopen a
+// closed window or release data held back by silly window avoidance.
+func (conn *Conn) updatePersistTimer(queued int) {
+	if queued == 0 || conn.sndUna != conn.sndNxt {
+		conn.stopPersistTimer()
+		conn.persistBackoffs = 0
+		return
+	}
+	if conn.persistTimer != nil {
+		return
+	}
+	timeout := conn.rtt.timeout()
+	for range conn.persistBackoffs {
+		timeout = min(2*timeout, maxRTO)
+	}
+	conn.persistGen++
+	generation := conn.persistGen
+	conn.persistTimer = time.AfterFunc(timeout, func() { conn.persist(generation) })
+}
+
+func (conn *Conn) stopPersistTimer() {
+	if conn.persistTimer != nil {
+		conn.persistTimer.Stop()
+		conn.persistTimer = nil
+	}
+}
+
+// persist probes a zero window with a segment carrying an already
+// acknowledged sequence number, which the peer must answer with an ACK
+// showing its current window, as Linux does. A small but open window gets
+// whatever data fits. Unlike retransmissions, probes never give up while
+// the peer answers.
+func (conn *Conn) persist(generation uint64) {
+	conn.mutex.Lock()
+	defer conn.unlock()
+
+	if conn.persistTimer == nil || conn.persistGen != generation {
+		return
+	}
+	conn.persistTimer = nil
+	if !conn.state.synchronized() || conn.state == StateTimeWait {
+		return
+	}
+
+	offset := int(conn.sndNxt - conn.sndBase)
+	queued := len(conn.sendBuffer) - offset
+	size := min(queued, int(conn.sndWnd), conn.sndMSS)
+	if size > 0 {
+		conn.sendData(offset, size)
+	} else {
+		conn.send(&Segment{Seq: conn.sndUna - 1, Ack: conn.rcvNxt, Flags: FlagACK})
+	}
+	conn.persistBackoffs++
+	conn.updatePersistTimer(queued - size)
+}
+
+func (conn *Conn) enterTimeWait() {
+	conn.stopRetransmitTimer()
+	conn.setState(StateTimeWait)
+	if conn.timeWaitTimer != nil {
+		conn.timeWaitTimer.Stop()
+	}
+	conn.timeWaitTimer = time.AfterFunc(2*msl, func() {
+		conn.mutex.Lock()
+		defer conn.unlock()
+		if conn.state == StateTimeWait {
+			conn.terminate(nil)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package tcp
+
+import (
+	"time"
+)
+
+// pawsIdle is how long TS.Recent stays valid on an idle connection, after
+// which RFC 7323 lets any timestamp replace it.
+const pawsIdle = 24 * 24 * time.Hour
+
+// tsClock is the timestamp clock, ticking once per millisecond from a
+// random offset per connection.
+func (conn *Conn) tsClock() uint32 {
+	return uint32(time.Since(conn.tcp.start).Milliseconds()) + conn.tsOffset
+}
+
+// pawsReject implements Protection Against Wrapped Sequences from RFC 7323
+// section 5.3: a segment whose timestamp is older than TS.Recent is a
+// duplicate from an earlier wrap of the sequence space.
+func (conn *Conn) pawsReject(segment *Segment) bool {
+	if !conn.tsOK || !segment.opts.hasTimestamps || segment.has(FlagRST) {
+		return false
+	}
+	if seqGEQ(segment.opts.tsVal, conn.tsRecent) {
+		return false
+	}
+	if time.Since(conn.tsRecentAge) > pawsIdle {
+		conn.tsRecent = segment.opts.tsVal
+		conn.tsRecentAge = time.Now()
+		return false
+	}
+	return true
+}
+
+// updateTSRecent keeps the timestamp to echo, taken from the segment that
+// the last ACK sent covers, as RFC 7323 section 4.3 describes.
+func (conn *Conn) updateTSRecent(segment *Segment) {
+	if !conn.tsOK || !segment.opts.hasTimestamps {
+		return
+	}
+	if seqGEQ(segment.opts.tsVal, conn.tsRecent) && seqLEQ(segment.Seq, conn.lastAckSent) {
+		conn.tsRecent = segment.opts.tsVal
+		conn.tsRecentAge = time.Now()
+	}
+}
+
+// echoedRTT measures the round trip time from the timestamp the peer
+// echoed, which unlike the retransmission queue stays unambiguous for
+// retransmitted segments.
+func (conn *Conn) echoedRTT(tsEcr uint32) (time.Duration, bool) {
+	if !conn.tsOK || tsEcr == 0 {
+		return 0, false
+	}
+	elapsed := int32(conn.tsClock() - tsEcr)
+	if elapsed < 0 {
+		return 0, false
+	}
+	return time.Duration(elapsed) * time.Millisecond, true
+}
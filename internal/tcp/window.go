@@ -0,0 +1,94 @@
+package tcp
+
+// windowShift picks the smallest window scale that lets the advertised
+// window cover the whole receive buffer.
+func windowShift(buffer int) uint8 {
+	shift := uint8(0)
+	for buffer>>shift > 0xFFFF && shift < maxWindowShift {
+		shift++
+	}
+	return shift
+}
+
+// rcvWnd is RCV.WND, what is left of the last advertised window.
+func (conn *Conn) rcvWnd() uint32 {
+	if seqGT(conn.rcvAdv, conn.rcvNxt) {
+		return conn.rcvAdv - conn.rcvNxt
+	}
+	return 0
+}
+
+// receiveWindow is the window worth advertising. Following the receiver
+// side silly window avoidance of RFC 9293 section 3.8.6.2.2, the right
+// edge only moves once the free buffer space grew by a full segment or
+// half the buffer, so a slow reader does not invite tiny segments.
+func (conn *Conn) receiveWindow() uint32 {
+	available := uint32(max(conn.recvBufferSize-len(conn.recvBuffer), 0))
+	current := conn.rcvWnd()
+	threshold := uint32(min(conn.recvBufferSize/2, conn.tcp.mss))
+	if available >= current+threshold {
+		return available
+	}
+	return current
+}
+
+// advertise returns the window field of an outgoing segment and records
+// the right edge it announces. The field is rounded up to the window scale
+// so the edge never moves left, overcommitting the buffer by less than one
+// scale unit at most.
+func (conn *Conn) advertise(syn bool) uint16 {
+	shift := conn.rcvShift
+	if syn {
+		shift = 0
+	}
+	window := conn.receiveWindow()
+	field := min((window+1<<shift-1)>>shift, 0xFFFF)
+	// rcvNxt is unknown until the peer SYN arrived
+	if conn.state != StateSynSent {
+		edge := conn.rcvNxt + field<<shift
+		if seqGT(edge, conn.rcvAdv) {
+			conn.rcvAdv = edge
+		}
+	}
+	return uint16(field)
+}
+
+// peerWindow is the send window a segment offers, which is never scaled on
+// a SYN.
+func (conn *Conn) peerWindow(segment *Segment) uint32 {
+	if segment.has(FlagSYN) {
+		return uint32(segment.Window)
+	}
+	return uint32(segment.Window) << conn.sndShift
+}
+
+func (conn *Conn) setSendWindow(window uint32) {
+	conn.sndWnd = window
+	conn.maxSndWnd = max(conn.maxSndWnd, window)
+}
+
+// worthSending applies the sender side silly window avoidance of RFC 9293
+// section 3.8.6.2.1. A segment smaller than the MSS only goes out when it
+// empties the send buffer and nothing is unacknowledged, which is Nagle's
+// algorithm unless noDelay is set, or when it fills half the largest
+// window the peer ever offered. The persist timer sends anything else that
+// gets stuck.
+func (conn *Conn) worthSending(size int, queued int) bool {
+	switch {
+	case size >= conn.sndMSS:
+		return true
+	case size == queued && (conn.noDelay || conn.sndUna == conn.sndNxt):
+		return true
+	default:
+		return conn.maxSndWnd > 0 && size >= int(conn.maxSndWnd/2)
+	}
+}
+
+// SetNoDelay disables Nagle's algorithm, so small writes go out at once
+// even while earlier data is unacknowledged.
+func (conn *Conn) SetNoDelay(noDelay bool) {
+	conn.mutex.Lock()
+	defer conn.unlock()
+	conn.noDelay = noDelay
+	conn.output()
+}
@@ -0,0 +1,217 @@
+package tcp
+
+import (
+	"bytes"
+	"io"
+	"tcp-ip/internal/ip"
+	"testing"
+	"time"
+)
+
+func testConn(t *testing.T) *Conn {
+	t.Helper()
+	module := NewTCPModule(ip.IPAddress{10, 0, 0, 1}, nil, 1500)
+	return newConn(module, connKey{localPort: 1, remoteIP: ip.IPAddress{10, 0, 0, 2}, remotePort: 2})
+}
+
+func TestWindowShift(t *testing.T) {
+	tests := []struct {
+		buffer int
+		want   uint8
+	}{
+		{0, 0},
+		{0xFFFF, 0},
+		{0x10000, 1},
+		{DefaultReceiveBuffer, 3},
+		{1 << 30, maxWindowShift},
+		{1 << 40, maxWindowShift},
+	}
+	for _, test := range tests {
+		if got := windowShift(test.buffer); got != test.want {
+			t.Errorf("windowShift(%d) = %d, want %d", test.buffer, got, test.want)
+		}
+	}
+}
+
+func TestAdvertise(t *testing.T) {
+	conn := testConn(t)
+	conn.state = StateEstablished
+	conn.rcvShift = 3
+	conn.rcvNxt = 1000
+	conn.rcvAdv = 1000
+
+	// a SYN never carries a scaled window
+	if field := conn.advertise(true); field != 0xFFFF {
+		t.Errorf("SYN window = %d, want %d", field, 0xFFFF)
+	}
+	field := conn.advertise(false)
+	if uint32(field)<<3 != DefaultReceiveBuffer || conn.rcvWnd() != DefaultReceiveBuffer {
+		t.Errorf("window field %d, RCV.WND %d, want the whole buffer", field, conn.rcvWnd())
+	}
+
+	// a window that is not a multiple of the scale is rounded up, so the
+	// right edge does not move left
+	conn.recvBuffer = make([]byte, 1)
+	conn.rcvAdv = conn.rcvNxt
+	field = conn.advertise(false)
+	if uint32(field)<<3 < DefaultReceiveBuffer-1 {
+		t.Errorf("window field %d rounded down", field)
+	}
+
+	// data that arrived and fills the buffer shrinks the window, but not
+	// the edge already advertised
+	edge := conn.rcvAdv
+	conn.recvBuffer = make([]byte, DefaultReceiveBuffer)
+	conn.rcvNxt += DefaultReceiveBuffer / 2
+	conn.advertise(false)
+	if conn.rcvAdv != edge {
+		t.Errorf("right edge moved from %d to %d", edge, conn.rcvAdv)
+	}
+}
+
+func TestReceiveSillyWindow(t *testing.T) {
+	conn := testConn(t)
+	conn.state = StateEstablished
+	conn.recvBuffer = make([]byte, DefaultReceiveBuffer)
+	conn.advertise(false)
+	if conn.rcvWnd() != 0 {
+		t.Fatalf("RCV.WND = %d with a full buffer", conn.rcvWnd())
+	}
+	tests := []struct {
+		read int
+		want uint32
+	}{
+		// less than a segment freed keeps the window closed
+		{100, 0},
+		{conn.tcp.mss - 101, 0},
+		{1, uint32(conn.tcp.mss)},
+	}
+	for _, test := range tests {
+		conn.recvBuffer = conn.recvBuffer[test.read:]
+		if got := conn.receiveWindow(); got != test.want {
+			t.Errorf("after reading %d more, window = %d, want %d", test.read, got, test.want)
+		}
+	}
+}
+
+func TestWorthSending(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		queued    int
+		inFlight  bool
+		noDelay   bool
+		maxSndWnd uint32
+		want      bool
+	}{
+		{"full segment", 1000, 5000, true, false, 0, true},
+		{"last bytes, nothing in flight", 10, 10, false, false, 0, true},
+		// Nagle's algorithm holds the small segment back
+		{"last bytes, data in flight", 10, 10, true, false, 0, false},
+		{"last bytes, no delay", 10, 10, true, true, 0, true},
+		{"window limited", 10, 5000, false, false, 0, false},
+		{"half the largest window", 600, 5000, true, false, 1200, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := testConn(t)
+			conn.sndMSS = 1000
+			conn.noDelay = test.noDelay
+			conn.maxSndWnd = test.maxSndWnd
+			conn.sndUna = 1
+			conn.sndNxt = 1
+			if test.inFlight {
+				conn.sndNxt = 100
+			}
+			if got := conn.worthSending(test.size, test.queued); got != test.want {
+				t.Errorf("worthSending() = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPeerWindow(t *testing.T) {
+	conn := testConn(t)
+	conn.sndShift = 4
+	if got := conn.peerWindow(&Segment{Window: 100, Flags: FlagACK}); got != 1600 {
+		t.Errorf("peerWindow() = %d, want %d", got, 1600)
+	}
+	if got := conn.peerWindow(&Segment{Window: 100, Flags: FlagSYN | FlagACK}); got != 100 {
+		t.Errorf("SYN peerWindow() = %d, want the window unscaled", got)
+	}
+}
+
+func TestWindowScaleNegotiation(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	// the window of the SYN-ACK is unscaled, the first segment after it
+	// offers the whole buffer
+	if _, err := serverConn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clientConn.Read(make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := windowShift(DefaultReceiveBuffer)
+	clientConn.mutex.Lock()
+	defer clientConn.mutex.Unlock()
+	serverConn.mutex.Lock()
+	defer serverConn.mutex.Unlock()
+	if clientConn.rcvShift != want || serverConn.sndShift != want ||
+		serverConn.rcvShift != want || clientConn.sndShift != want {
+		t.Errorf("shifts %d/%d and %d/%d, want %d", clientConn.rcvShift, clientConn.sndShift,
+			serverConn.rcvShift, serverConn.sndShift, want)
+	}
+	if clientConn.sndWnd != DefaultReceiveBuffer {
+		t.Errorf("send window = %d, want the whole peer buffer %d", clientConn.sndWnd, DefaultReceiveBuffer)
+	}
+}
+
+func TestZeroWindow(t *testing.T) {
+	client, server := newHostPair(t)
+	clientConn, serverConn := connect(t, client, server)
+	data := testData(DefaultReceiveBuffer + sendBufferSize/2)
+	written := make(chan error, 1)
+	go func() {
+		_, err := clientConn.Write(data)
+		written <- err
+	}()
+
+	// nothing is read until the window closed and a probe went out, which
+	// carries an acknowledged sequence number and no data
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		closed, probed := false, false
+		for _, segment := range server.segments() {
+			closed = closed || (segment.Window == 0 && !segment.has(FlagSYN))
+		}
+		var end uint32
+		for _, segment := range client.segments() {
+			if segment.has(FlagSYN) {
+				end = segment.Seq + 1
+				continue
+			}
+			probed = probed || (closed && len(segment.Data) == 0 && seqLT(segment.Seq, end))
+			if seqGT(segment.Seq+segment.Length(), end) {
+				end = segment.Seq + segment.Length()
+			}
+		}
+		if closed && probed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("window closed %t, probed %t", closed, probed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	clientConn.Close()
+	got, err := io.ReadAll(serverConn)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("read %d bytes, %v, want the %d written", len(got), err, len(data))
+	}
+}
@@ -0,0 +1,130 @@
+package udp
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"tcp-ip/internal/ip"
+	"time"
+)
+
+type message struct {
+	data    []byte
+	src     ip.IPAddress
+	srcPort uint16
+}
+
+type Socket struct {
+	udp    *UDPModule
+	port   uint16
+	queue  chan message
+	closed chan struct{}
+	once   sync.Once
+
+	// wakeup is closed and replaced whenever the read deadline changes or
+	// passes, so blocked readers look at it again
+	mutex        *sync.Mutex
+	readDeadline time.Time
+	readTimer    *time.Timer
+	wakeup       chan struct{}
+}
+
+func newSocket(udp *UDPModule, port uint16) *Socket {
+	return &Socket{
+		udp:    udp,
+		port:   port,
+		queue:  make(chan message, socketQueueDepth),
+		closed: make(chan struct{}),
+		mutex:  new(sync.Mutex),
+		wakeup: make(chan struct{}),
+	}
+}
+
+func (socket *Socket) LocalPort() uint16 {
+	return socket.port
+}
+
+func (socket *Socket) LocalIP() ip.IPAddress {
+	return socket.udp.addr
+}
+
+// enqueue drops the datagram when the application does not keep up, as UDP
+// gives no delivery guarantee.
+func (socket *Socket) enqueue(msg message) {
+	select {
+	case <-socket.closed:
+	case socket.queue <- msg:
+	default:
+		fmt.Printf("UDP port %d receive queue full, dropping datagram\n", socket.port)
+	}
+}
+
+func (socket *Socket) SendTo(data []byte, dst ip.IPAddress, dstPort uint16) error {
+	select {
+	case <-socket.closed:
+		return ErrSocketClosed
+	default:
+	}
+	return socket.udp.send(data, socket.port, dst, dstPort)
+}
+
+// RecvFrom blocks until a datagram arrives and returns its payload and
+// source address. It fails with os.ErrDeadlineExceeded once the read
+// deadline passes.
+func (socket *Socket) RecvFrom() ([]byte, ip.IPAddress, uint16, error) {
+	for {
+		socket.mutex.Lock()
+		deadline, wakeup := socket.readDeadline, socket.wakeup
+		socket.mutex.Unlock()
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, ip.IPAddress{}, 0, os.ErrDeadlineExceeded
+		}
+
+		select {
+		case msg := <-socket.queue:
+			return msg.data, msg.src, msg.srcPort, nil
+		case <-socket.closed:
+			return nil, ip.IPAddress{}, 0, ErrSocketClosed
+		case <-wakeup:
+		}
+	}
+}
+
+// SetReadDeadline applies to blocked and future calls of RecvFrom. The
+// zero time disables it.
+func (socket *Socket) SetReadDeadline(t time.Time) {
+	socket.mutex.Lock()
+	defer socket.mutex.Unlock()
+
+	socket.readDeadline = t
+	if socket.readTimer != nil {
+		socket.readTimer.Stop()
+		socket.readTimer = nil
+	}
+	socket.wake()
+	if !t.IsZero() {
+		wakeup := socket.wakeup
+		socket.readTimer = time.AfterFunc(time.Until(t), func() {
+			socket.mutex.Lock()
+			defer socket.mutex.Unlock()
+			if socket.wakeup == wakeup {
+				socket.wake()
+			}
+		})
+	}
+}
+
+func (socket *Socket) wake() {
+	close(socket.wakeup)
+	socket.wakeup = make(chan struct{})
+}
+
+func (socket *Socket) Close() error {
+	err := ErrSocketClosed
+	socket.once.Do(func() {
+		close(socket.closed)
+		socket.udp.unbind(socket.port)
+		err = nil
+	})
+	return err
+}
@@ -0,0 +1,118 @@
+package udp
+
+import (
+	"fmt"
+	"sync"
+	"tcp-ip/internal/ip"
+)
+
+var (
+	ErrPortInUse       = fmt.Errorf("port already in use")
+	ErrNoFreePorts     = fmt.Errorf("no ephemeral ports available")
+	ErrPortUnreachable = fmt.Errorf("port unreachable")
+	ErrSocketClosed    = fmt.Errorf("socket closed")
+)
+
+const (
+	HeaderSize       = 8
+	EphemeralFirst   = 49152
+	EphemeralLast    = 65535
+	socketQueueDepth = 64
+)
+
+type sender interface {
+	SendToIP(message []byte, dst ip.IPAddress, protocol uint8) error
+}
+
+type UDPModule struct {
+	addr          ip.IPAddress
+	sender        sender
+	sockets       map[uint16]*Socket
+	nextEphemeral uint16
+	mutex         *sync.Mutex
+}
+
+func NewUDPModule(addr ip.IPAddress, sender sender) *UDPModule {
+	return &UDPModule{
+		addr:          addr,
+		sender:        sender,
+		sockets:       make(map[uint16]*Socket),
+		nextEphemeral: EphemeralFirst,
+		mutex:         new(sync.Mutex),
+	}
+}
+
+func (udp *UDPModule) Addr() ip.IPAddress {
+	return udp.addr
+}
+
+// allocatePort walks the ephemeral range from where the previous allocation
+// stopped so recently closed ports are not reused right away.
+func (udp *UDPModule) allocatePort() (uint16, error) {
+	for range EphemeralLast - EphemeralFirst + 1 {
+		port := udp.nextEphemeral
+		if udp.nextEphemeral == EphemeralLast {
+			udp.nextEphemeral = EphemeralFirst
+		} else {
+			udp.nextEphemeral++
+		}
+		if _, used := udp.sockets[port]; !used {
+			return port, nil
+		}
+	}
+	return 0, ErrNoFreePorts
+}
+
+// Bind opens a socket on port, or on a free ephemeral port when port is 0.
+func (udp *UDPModule) Bind(port uint16) (*Socket, error) {
+	udp.mutex.Lock()
+	defer udp.mutex.Unlock()
+
+	if port == 0 {
+		var err error
+		port, err = udp.allocatePort()
+		if err != nil {
+			return nil, err
+		}
+	} else if _, used := udp.sockets[port]; used {
+		return nil, fmt.Errorf("%w: %d", ErrPortInUse, port)
+	}
+
+	socket := newSocket(udp, port)
+	udp.sockets[port] = socket
+	return socket, nil
+}
+
+func (udp *UDPModule) unbind(port uint16) {
+	udp.mutex.Lock()
+	delete(udp.sockets, port)
+	udp.mutex.Unlock()
+}
+
+func (udp *UDPModule) send(data []byte, srcPort uint16, dst ip.IPAddress, dstPort uint16) error {
+	if HeaderSize+len(data) > ip.MaxPacketSize-ip.MinHeaderSize {
+		return fmt.Errorf("datagram exceeds the maximum packet size")
+	}
+	datagram := &Datagram{SrcPort: srcPort, DstPort: dstPort, Data: data}
+	return udp.sender.SendToIP(datagram.Serialize(udp.addr, dst), dst, ip.ProtoUDP)
+}
+
+// Receive delivers a datagram to the socket bound to its port. It returns
+// ErrPortUnreachable when no socket is bound so the caller can answer with
+// an ICMP port unreachable.
+func (udp *UDPModule) Receive(packet *ip.Packet) error {
+	datagram, err := Deserialize(packet.Data, packet.SrcIP, packet.DstIP)
+	if err != nil {
+		return err
+	}
+
+	udp.mutex.Lock()
+	socket, ok := udp.sockets[datagram.DstPort]
+	udp.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrPortUnreachable, datagram.DstPort)
+	}
+
+	socket.enqueue(message{data: datagram.Data, src: packet.SrcIP, srcPort: datagram.SrcPort})
+	return nil
+}
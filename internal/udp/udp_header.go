@@ -0,0 +1,59 @@
+package udp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"tcp-ip/internal/ip"
+)
+
+type Datagram struct {
+	SrcPort  uint16
+	DstPort  uint16
+	Length   uint16
+	Checksum uint16
+	Data     []byte
+}
+
+func (datagram *Datagram) Serialize(src, dst ip.IPAddress) []byte {
+	buf := new(bytes.Buffer)
+	datagram.Length = uint16(HeaderSize + len(datagram.Data))
+	_ = binary.Write(buf, binary.BigEndian, datagram.SrcPort)
+	_ = binary.Write(buf, binary.BigEndian, datagram.DstPort)
+	_ = binary.Write(buf, binary.BigEndian, datagram.Length)
+	_ = binary.Write(buf, binary.BigEndian, uint16(0))
+	buf.Write(datagram.Data)
+	data := buf.Bytes()
+
+	sum := ip.PseudoHeaderSum(src, dst, ip.ProtoUDP, len(data))
+	datagram.Checksum = ip.FinishChecksum(ip.Sum(sum, data))
+	// a computed zero is sent as all ones, zero means no checksum
+	if datagram.Checksum == 0 {
+		datagram.Checksum = 0xFFFF
+	}
+	binary.BigEndian.PutUint16(data[6:8], datagram.Checksum)
+	return data
+}
+
+func Deserialize(data []byte, src, dst ip.IPAddress) (*Datagram, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("invalid datagram: datagram shorter than the header")
+	}
+	datagram := &Datagram{}
+	datagram.SrcPort = binary.BigEndian.Uint16(data[0:2])
+	datagram.DstPort = binary.BigEndian.Uint16(data[2:4])
+	datagram.Length = binary.BigEndian.Uint16(data[4:6])
+	datagram.Checksum = binary.BigEndian.Uint16(data[6:8])
+	if int(datagram.Length) < HeaderSize || int(datagram.Length) > len(data) {
+		return nil, fmt.Errorf("invalid datagram: invalid length")
+	}
+	data = data[:datagram.Length]
+	if datagram.Checksum != 0 {
+		sum := ip.PseudoHeaderSum(src, dst, ip.ProtoUDP, len(data))
+		if ip.FinishChecksum(ip.Sum(sum, data)) != 0 {
+			return nil, fmt.Errorf("invalid datagram: checksum doesn't match")
+		}
+	}
+	datagram.Data = data[HeaderSize:]
+	return datagram, nil
+}
@@ -0,0 +1,210 @@
+package udp
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"tcp-ip/internal/ip"
+	"testing"
+	"time"
+)
+
+var (
+	local  = ip.IPAddress{10, 0, 0, 1}
+	remote = ip.IPAddress{10, 0, 1, 1}
+)
+
+// loopback hands what a module sends to the module at the destination.
+type loopback struct {
+	src     ip.IPAddress
+	modules map[ip.IPAddress]*UDPModule
+	err     error
+}
+
+func (sender *loopback) SendToIP(data []byte, dst ip.IPAddress, protocol uint8) error {
+	packet, err := ip.NewPacket(sender.src, dst, protocol, 0, data)
+	if err != nil {
+		return err
+	}
+	sender.err = sender.modules[dst].Receive(packet)
+	return nil
+}
+
+func modulePair() (*UDPModule, *UDPModule, *loopback) {
+	modules := make(map[ip.IPAddress]*UDPModule)
+	localSender := &loopback{src: local, modules: modules}
+	modules[local] = NewUDPModule(local, localSender)
+	modules[remote] = NewUDPModule(remote, &loopback{src: remote, modules: modules})
+	return modules[local], modules[remote], localSender
+}
+
+func TestDatagramRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		mangle func(data []byte) []byte
+		valid  bool
+	}{
+		{"intact", func(data []byte) []byte { return data }, true},
+		{"padding after the datagram", func(data []byte) []byte { return append(data, 0, 0) }, true},
+		{"no checksum", func(data []byte) []byte { data[6], data[7] = 0, 0; data[8] ^= 1; return data }, true},
+		{"shorter than a header", func(data []byte) []byte { return data[:HeaderSize-1] }, false},
+		{"length past the buffer", func(data []byte) []byte { return data[:len(data)-1] }, false},
+		{"length inside the header", func(data []byte) []byte { data[5] = HeaderSize - 1; return data }, false},
+		{"bad checksum", func(data []byte) []byte { data[len(data)-1] ^= 1; return data }, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			datagram := &Datagram{SrcPort: 1234, DstPort: 53, Data: []byte("query")}
+			data := test.mangle(datagram.Serialize(local, remote))
+			got, err := Deserialize(data, local, remote)
+			if !test.valid {
+				if err == nil {
+					t.Errorf("Deserialize() accepted an invalid datagram")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.SrcPort != 1234 || got.DstPort != 53 || len(got.Data) != len("query") {
+				t.Errorf("Deserialize() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestChecksumCoversAddresses(t *testing.T) {
+	data := (&Datagram{SrcPort: 1, DstPort: 2, Data: []byte("data")}).Serialize(local, remote)
+	if _, err := Deserialize(data, local, ip.IPAddress{10, 0, 1, 2}); err == nil {
+		t.Errorf("Deserialize() accepted a datagram for another address")
+	}
+}
+
+func TestDemux(t *testing.T) {
+	client, server, sender := modulePair()
+	first, err := server.Bind(53)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := server.Bind(54)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket, err := client.Bind(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, send := range []struct {
+		port uint16
+		data string
+	}{{53, "one"}, {54, "two"}, {53, "three"}} {
+		if err := socket.SendTo([]byte(send.data), remote, send.port); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, receive := range []struct {
+		socket *Socket
+		data   string
+	}{{first, "one"}, {first, "three"}, {second, "two"}} {
+		data, src, srcPort, err := receive.socket.RecvFrom()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != receive.data || src != local || srcPort != socket.LocalPort() {
+			t.Errorf("port %d received %q from %v:%d", receive.socket.LocalPort(), data, src, srcPort)
+		}
+	}
+
+	if err := socket.SendTo([]byte("nobody"), remote, 55); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(sender.err, ErrPortUnreachable) {
+		t.Errorf("Receive() error = %v, want %v", sender.err, ErrPortUnreachable)
+	}
+}
+
+func TestBind(t *testing.T) {
+	module, _, _ := modulePair()
+	socket, err := module.Bind(53)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := module.Bind(53); !errors.Is(err, ErrPortInUse) {
+		t.Errorf("Bind() error = %v, want %v", err, ErrPortInUse)
+	}
+	socket.Close()
+	if _, err := module.Bind(53); err != nil {
+		t.Errorf("Bind() after Close() error = %v", err)
+	}
+
+	ephemeral, err := module.Bind(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := module.Bind(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ephemeral.LocalPort() < EphemeralFirst || next.LocalPort() != ephemeral.LocalPort()+1 {
+		t.Errorf("ephemeral ports %d then %d", ephemeral.LocalPort(), next.LocalPort())
+	}
+	// a closed ephemeral port is not handed out again right away
+	ephemeral.Close()
+	if reused, _ := module.Bind(0); reused.LocalPort() == ephemeral.LocalPort() {
+		t.Errorf("ephemeral port %d reused right away", reused.LocalPort())
+	}
+}
+
+func TestBindExhausted(t *testing.T) {
+	module, _, _ := modulePair()
+	for range EphemeralLast - EphemeralFirst + 1 {
+		if _, err := module.Bind(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := module.Bind(0); !errors.Is(err, ErrNoFreePorts) {
+		t.Errorf("Bind() error = %v, want %v", err, ErrNoFreePorts)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	client, server, _ := modulePair()
+	socket, _ := server.Bind(53)
+	sender, _ := client.Bind(0)
+	for i := range socketQueueDepth + 1 {
+		sender.SendTo([]byte{byte(i)}, remote, 53)
+	}
+	for i := range socketQueueDepth {
+		data, _, _, err := socket.RecvFrom()
+		if err != nil || !bytes.Equal(data, []byte{byte(i)}) {
+			t.Fatalf("RecvFrom() = %v, %v, want datagram %d", data, err, i)
+		}
+	}
+	socket.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, _, _, err := socket.RecvFrom(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("RecvFrom() error = %v, want the overflowing datagram dropped", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	module, _, _ := modulePair()
+	socket, _ := module.Bind(53)
+	done := make(chan error)
+	go func() {
+		_, _, _, err := socket.RecvFrom()
+		done <- err
+	}()
+	if err := socket.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, ErrSocketClosed) {
+		t.Errorf("RecvFrom() error = %v, want %v", err, ErrSocketClosed)
+	}
+	if err := socket.Close(); !errors.Is(err, ErrSocketClosed) {
+		t.Errorf("second Close() error = %v, want %v", err, ErrSocketClosed)
+	}
+	if err := socket.SendTo(nil, remote, 53); !errors.Is(err, ErrSocketClosed) {
+		t.Errorf("SendTo() error = %v, want %v", err, ErrSocketClosed)
+	}
+}